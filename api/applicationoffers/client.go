@@ -193,9 +193,10 @@ func (c *Client) FindApplicationOffers(filters ...crossmodel.ApplicationOfferFil
 	var paramsFilter params.OfferFilters
 	for _, f := range filters {
 		filterTerm := params.OfferFilter{
-			OfferName: f.OfferName,
-			ModelName: f.ModelName,
-			OwnerName: f.OwnerName,
+			OfferName:    f.OfferName,
+			ModelName:    f.ModelName,
+			OwnerName:    f.OwnerName,
+			IncludeUsers: f.IncludeUsers,
 		}
 		filterTerm.Endpoints = make([]params.EndpointFilterAttributes, len(f.Endpoints))
 		for i, ep := range f.Endpoints {
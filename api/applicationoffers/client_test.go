@@ -134,13 +134,13 @@ func (s *crossmodelMockSuite) TestList(c *gc.C) {
 
 			if results, ok := result.(*params.ListApplicationOffersResults); ok {
 				offer := params.ApplicationOffer{
-					OfferURL:  url,
-					OfferName: offerName,
-					Endpoints: endpoints,
+					OfferURL:        url,
+					OfferName:       offerName,
+					ApplicationName: "db2-app",
+					Endpoints:       endpoints,
 				}
 				results.Results = []params.ApplicationOfferDetails{{
 					ApplicationOffer: offer,
-					ApplicationName:  "db2-app",
 					CharmName:        "db2",
 					ConnectedCount:   3,
 				}}
@@ -412,10 +412,11 @@ func (s *crossmodelMockSuite) TestFind(c *gc.C) {
 	relations := []jujucrossmodel.EndpointFilterTerm{{Name: "endPointA", Interface: "http"}}
 
 	filter := jujucrossmodel.ApplicationOfferFilter{
-		OwnerName: ownerName,
-		ModelName: modelName,
-		OfferName: offerName,
-		Endpoints: relations,
+		OwnerName:    ownerName,
+		ModelName:    modelName,
+		OfferName:    offerName,
+		Endpoints:    relations,
+		IncludeUsers: true,
 	}
 
 	called := false
@@ -442,6 +443,7 @@ func (s *crossmodelMockSuite) TestFind(c *gc.C) {
 					Name:      "endPointA",
 					Interface: "http",
 				}},
+				IncludeUsers: true,
 			})
 
 			if results, ok := result.(*params.FindApplicationOffersResults); ok {
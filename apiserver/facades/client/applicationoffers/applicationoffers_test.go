@@ -5,6 +5,7 @@ package applicationoffers_test
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/juju/errors"
 	jc "github.com/juju/testing/checkers"
@@ -22,6 +23,7 @@ import (
 	"github.com/juju/juju/permission"
 	"github.com/juju/juju/state"
 	"github.com/juju/juju/testing"
+	jujuversion "github.com/juju/juju/version"
 )
 
 type applicationOffersSuite struct {
@@ -197,6 +199,7 @@ func (s *applicationOffersSuite) TestOfferError(c *gc.C) {
 }
 
 func (s *applicationOffersSuite) assertList(c *gc.C, expectedErr error) {
+	zero := 0
 	s.setupOffers(c, "test")
 	filter := params.OfferFilters{
 		Filters: []params.OfferFilter{
@@ -219,10 +222,11 @@ func (s *applicationOffersSuite) assertList(c *gc.C, expectedErr error) {
 			{
 				ApplicationOffer: params.ApplicationOffer{
 					SourceModelTag:         testing.ModelTag.String(),
+					ControllerVersion:      jujuversion.Current.String(),
 					ApplicationDescription: "description",
 					OfferName:              "hosted-db2",
 					OfferURL:               "fred/prod.hosted-db2",
-					Endpoints:              []params.RemoteEndpoint{{Name: "db"}},
+					Endpoints:              []params.RemoteEndpoint{{Name: "db", ConnectedCount: &zero}},
 					Bindings:               map[string]string{"db2": "myspace"},
 					Spaces: []params.RemoteSpace{
 						{
@@ -260,6 +264,98 @@ func (s *applicationOffersSuite) TestListPermission(c *gc.C) {
 	s.assertList(c, common.ErrPerm)
 }
 
+func (s *applicationOffersSuite) assertListUsers(c *gc.C, includeUsers bool) []params.OfferUserDetails {
+	s.setupOffers(c, "test")
+	s.applicationOffers.listOffers = func(filters ...jujucrossmodel.ApplicationOfferFilter) ([]jujucrossmodel.ApplicationOffer, error) {
+		c.Assert(filters, gc.HasLen, 1)
+		c.Assert(filters[0].IncludeUsers, gc.Equals, includeUsers)
+		return []jujucrossmodel.ApplicationOffer{{
+			OfferName:       "hosted-db2",
+			ApplicationName: "test",
+			Endpoints:       map[string]charm.Relation{"db": {Name: "db2"}},
+		}}, nil
+	}
+	s.authorizer.Tag = names.NewUserTag("admin")
+	user := names.NewUserTag("mary")
+	s.mockState.users.Add(user.Name())
+	err := s.mockState.CreateOfferAccess(names.NewApplicationOfferTag("hosted-db2"), user, permission.ConsumeAccess)
+	c.Assert(err, jc.ErrorIsNil)
+
+	found, err := s.api.ListApplicationOffers(params.OfferFilters{
+		Filters: []params.OfferFilter{{
+			OwnerName:       "fred",
+			ModelName:       "prod",
+			OfferName:       "hosted-db2",
+			ApplicationName: "test",
+			IncludeUsers:    includeUsers,
+		}},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(found.Results, gc.HasLen, 1)
+	c.Assert(found.Results[0].CharmName, gc.Equals, "db2")
+	return found.Results[0].Users
+}
+
+func (s *applicationOffersSuite) TestListIncludeUsers(c *gc.C) {
+	users := s.assertListUsers(c, true)
+	c.Assert(users, jc.DeepEquals, []params.OfferUserDetails{{UserName: "mary", Access: "consume"}})
+}
+
+func (s *applicationOffersSuite) TestListUsersNotRequested(c *gc.C) {
+	// Offer users are not looked up unless requested.
+	s.mockState.offerUsersErr = errors.New("boom")
+	users := s.assertListUsers(c, false)
+	c.Assert(users, gc.HasLen, 0)
+	c.Assert(c.GetTestLog(), gc.Not(jc.Contains), "cannot get offer users")
+}
+
+func (s *applicationOffersSuite) TestListUsersError(c *gc.C) {
+	s.mockState.offerUsersErr = errors.New("boom")
+	users := s.assertListUsers(c, true)
+	c.Assert(users, gc.HasLen, 0)
+	c.Assert(c.GetTestLog(), jc.Contains, "cannot get offer users: boom")
+}
+
+func (s *applicationOffersSuite) TestListEndpointConnectedCount(c *gc.C) {
+	s.setupOffers(c, "test")
+	s.authorizer.Tag = names.NewUserTag("admin")
+	app := s.mockState.applications["test"].(*mockApplication)
+	app.name = "test"
+	relation := func(localEndpoint, remoteApp string) applicationoffers.Relation {
+		return &mockRelation{endpoints: []state.Endpoint{
+			{ApplicationName: "test", Relation: charm.Relation{Name: localEndpoint}},
+			{ApplicationName: remoteApp, Relation: charm.Relation{Name: "server"}},
+		}}
+	}
+	app.relations = []applicationoffers.Relation{
+		relation("db2", "remote-1"),
+		relation("db2", "remote-2"),
+		relation("db2", "remote-other"),
+		relation("db2", "local"),
+		relation("admin", "remote-1"),
+	}
+	s.mockState.remoteApplications = map[string]applicationoffers.RemoteApplication{
+		"remote-1":     &mockRemoteApplication{name: "remote-1", offerName: "hosted-db2"},
+		"remote-2":     &mockRemoteApplication{name: "remote-2", offerName: "hosted-db2"},
+		"remote-other": &mockRemoteApplication{name: "remote-other", offerName: "hosted-other"},
+	}
+
+	found, err := s.api.ListApplicationOffers(params.OfferFilters{
+		Filters: []params.OfferFilter{{
+			OwnerName:       "fred",
+			ModelName:       "prod",
+			OfferName:       "hosted-db2",
+			ApplicationName: "test",
+		}},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(found.Results, gc.HasLen, 1)
+	two := 2
+	c.Assert(found.Results[0].Endpoints, jc.DeepEquals, []params.RemoteEndpoint{
+		{Name: "db", ConnectedCount: &two},
+	})
+}
+
 func (s *applicationOffersSuite) TestListError(c *gc.C) {
 	s.setupOffers(c, "test")
 	s.authorizer.Tag = names.NewUserTag("admin")
@@ -329,13 +425,15 @@ func (s *applicationOffersSuite) assertShow(c *gc.C, url string, expected []para
 }
 
 func (s *applicationOffersSuite) TestShow(c *gc.C) {
+	zero := 0
 	expected := []params.ApplicationOfferResult{{
 		Result: &params.ApplicationOffer{
 			SourceModelTag:         testing.ModelTag.String(),
+			ControllerVersion:      jujuversion.Current.String(),
 			ApplicationDescription: "description",
 			OfferURL:               "fred/prod.hosted-db2",
 			OfferName:              "hosted-db2",
-			Endpoints:              []params.RemoteEndpoint{{Name: "db"}},
+			Endpoints:              []params.RemoteEndpoint{{Name: "db", ConnectedCount: &zero}},
 			Bindings:               map[string]string{"db2": "myspace"},
 			Spaces: []params.RemoteSpace{
 				{
@@ -375,6 +473,7 @@ func (s *applicationOffersSuite) TestShowPermission(c *gc.C) {
 	expected := []params.ApplicationOfferResult{{
 		Result: &params.ApplicationOffer{
 			SourceModelTag:         testing.ModelTag.String(),
+			ControllerVersion:      jujuversion.Current.String(),
 			ApplicationDescription: "description",
 			OfferURL:               "fred/prod.hosted-db2",
 			OfferName:              "hosted-db2",
@@ -554,6 +653,7 @@ func (s *applicationOffersSuite) TestShowFoundMultiple(c *gc.C) {
 	c.Assert(results, jc.DeepEquals, []params.ApplicationOffer{
 		{
 			SourceModelTag:         testing.ModelTag.String(),
+			ControllerVersion:      jujuversion.Current.String(),
 			ApplicationDescription: "description",
 			OfferName:              "hosted-" + name,
 			OfferURL:               url,
@@ -569,6 +669,7 @@ func (s *applicationOffersSuite) TestShowFoundMultiple(c *gc.C) {
 			},
 		}, {
 			SourceModelTag:         "model-uuid2",
+			ControllerVersion:      jujuversion.Current.String(),
 			ApplicationDescription: "description2",
 			OfferName:              "hosted-" + name2,
 			OfferURL:               url2,
@@ -608,15 +709,17 @@ func (s *applicationOffersSuite) assertFind(c *gc.C, expected []params.Applicati
 }
 
 func (s *applicationOffersSuite) TestFind(c *gc.C) {
+	zero := 0
 	s.setupOffers(c, "")
 	s.authorizer.Tag = names.NewUserTag("admin")
 	expected := []params.ApplicationOffer{
 		{
 			SourceModelTag:         testing.ModelTag.String(),
+			ControllerVersion:      jujuversion.Current.String(),
 			ApplicationDescription: "description",
 			OfferName:              "hosted-db2",
 			OfferURL:               "fred/prod.hosted-db2",
-			Endpoints:              []params.RemoteEndpoint{{Name: "db"}},
+			Endpoints:              []params.RemoteEndpoint{{Name: "db", ConnectedCount: &zero}},
 			Bindings:               map[string]string{"db2": "myspace"},
 			Spaces: []params.RemoteSpace{
 				{
@@ -648,6 +751,7 @@ func (s *applicationOffersSuite) TestFindPermission(c *gc.C) {
 	expected := []params.ApplicationOffer{
 		{
 			SourceModelTag:         testing.ModelTag.String(),
+			ControllerVersion:      jujuversion.Current.String(),
 			ApplicationDescription: "description",
 			OfferName:              "hosted-db2",
 			OfferURL:               "fred/prod.hosted-db2",
@@ -666,6 +770,17 @@ func (s *applicationOffersSuite) TestFindPermission(c *gc.C) {
 	s.assertFind(c, expected)
 }
 
+func (s *applicationOffersSuite) TestFindControllerVersion(c *gc.C) {
+	s.setupOffers(c, "")
+	s.authorizer.Tag = names.NewUserTag("admin")
+	found, err := s.api.FindApplicationOffers(params.OfferFilters{
+		Filters: []params.OfferFilter{{OfferName: "hosted-db2"}},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(found.Results, gc.HasLen, 1)
+	c.Assert(found.Results[0].ControllerVersion, gc.Equals, jujuversion.Current.String())
+}
+
 func (s *applicationOffersSuite) TestFindFiltersRequireModel(c *gc.C) {
 	s.setupOffers(c, "")
 	filter := params.OfferFilters{
@@ -690,6 +805,7 @@ func (s *applicationOffersSuite) TestFindRequiresFilter(c *gc.C) {
 }
 
 func (s *applicationOffersSuite) TestFindMulti(c *gc.C) {
+	zero := 0
 	db2Offer := jujucrossmodel.ApplicationOffer{
 		OfferName:              "hosted-db2",
 		ApplicationName:        "db2",
@@ -781,7 +897,9 @@ func (s *applicationOffersSuite) TestFindMulti(c *gc.C) {
 			&mockSubnet{cidr: "4.3.2.0/24", providerId: "juju-subnet-1", zones: []string{"az1"}},
 		},
 	}
-	anotherState.model = &mockModel{uuid: "uuid2", name: "another", owner: "mary"}
+	anotherState.model = &mockModel{
+		uuid: "uuid2", name: "another", owner: "mary", cloud: "aws", cloudRegion: "us-east-1",
+	}
 	anotherState.connStatus = &mockConnectionStatus{count: 15}
 	anotherState.users.Add(user.Name())
 	anotherState.CreateOfferAccess(names.NewApplicationOfferTag("hosted-mysql"), user, permission.ReadAccess)
@@ -805,9 +923,10 @@ func (s *applicationOffersSuite) TestFindMulti(c *gc.C) {
 				ModelName: "another",
 			},
 			{
-				OfferName: "hosted-postgresql",
-				OwnerName: "mary",
-				ModelName: "another",
+				OfferName:    "hosted-postgresql",
+				OwnerName:    "mary",
+				ModelName:    "another",
+				IncludeUsers: true,
 			},
 			{
 				OfferName: "badoffer",
@@ -822,6 +941,7 @@ func (s *applicationOffersSuite) TestFindMulti(c *gc.C) {
 		[]params.ApplicationOffer{
 			{
 				SourceModelTag:         testing.ModelTag.String(),
+				ControllerVersion:      jujuversion.Current.String(),
 				ApplicationDescription: "db2 description",
 				OfferName:              "hosted-db2",
 				OfferURL:               "fred/prod.hosted-db2",
@@ -838,25 +958,91 @@ func (s *applicationOffersSuite) TestFindMulti(c *gc.C) {
 			},
 			{
 				SourceModelTag:         "model-uuid2",
+				ControllerVersion:      jujuversion.Current.String(),
 				ApplicationDescription: "mysql description",
 				OfferName:              "hosted-mysql",
 				OfferURL:               "mary/another.hosted-mysql",
 				Access:                 "read",
 				Endpoints:              []params.RemoteEndpoint{{Name: "db"}},
+				CloudName:              "aws",
+				CloudRegion:            "us-east-1",
 			},
 			{
 				SourceModelTag:         "model-uuid2",
+				ControllerVersion:      jujuversion.Current.String(),
 				ApplicationDescription: "postgresql description",
 				OfferName:              "hosted-postgresql",
 				OfferURL:               "mary/another.hosted-postgresql",
 				Access:                 "admin",
-				Endpoints:              []params.RemoteEndpoint{{Name: "db"}},
+				Endpoints:              []params.RemoteEndpoint{{Name: "db", ConnectedCount: &zero}},
+				Users:                  []params.OfferUserDetails{{UserName: "someone", Access: "admin"}},
+				CloudName:              "aws",
+				CloudRegion:            "us-east-1",
 			},
 		},
 	})
 	s.applicationOffers.CheckCallNames(c, listOffersBackendCall, listOffersBackendCall)
 }
 
+func (s *applicationOffersSuite) TestFindSameModelNameDifferentOwners(c *gc.C) {
+	s.applicationOffers.listOffers = func(filters ...jujucrossmodel.ApplicationOfferFilter) ([]jujucrossmodel.ApplicationOffer, error) {
+		c.Assert(filters, gc.HasLen, 1)
+		return []jujucrossmodel.ApplicationOffer{{
+			OfferName:       "hosted-" + filters[0].OfferName,
+			ApplicationName: filters[0].OfferName,
+		}}, nil
+	}
+	ch := &mockCharm{meta: &charm.Meta{Description: "A pretty popular blog engine"}}
+	s.mockState.applications = map[string]applicationoffers.Application{
+		"db2": &mockApplication{charm: ch, curl: charm.MustParseURL("db2-2")},
+	}
+	s.mockState.model = &mockModel{uuid: testing.ModelTag.Id(), name: "prod", owner: "fred"}
+	s.mockState.connStatus = &mockConnectionStatus{count: 5}
+
+	user := names.NewUserTag("someone")
+	s.authorizer.Tag = user
+	s.mockState.users.Add(user.Name())
+	s.mockState.CreateOfferAccess(names.NewApplicationOfferTag("hosted-db2"), user, permission.ReadAccess)
+
+	anotherState := &mockState{
+		modelUUID:   "uuid2",
+		users:       set.NewStrings(),
+		accessPerms: make(map[offerAccess]permission.Access),
+		spaces:      make(map[string]applicationoffers.Space),
+	}
+	s.mockStatePool.st["uuid2"] = anotherState
+	anotherState.applications = map[string]applicationoffers.Application{
+		"mysql": &mockApplication{charm: ch, curl: charm.MustParseURL("mysql-2")},
+	}
+	anotherState.model = &mockModel{uuid: "uuid2", name: "prod", owner: "mary"}
+	anotherState.connStatus = &mockConnectionStatus{count: 5}
+	anotherState.users.Add(user.Name())
+	anotherState.CreateOfferAccess(names.NewApplicationOfferTag("hosted-mysql"), user, permission.ReadAccess)
+
+	s.mockState.allmodels = []applicationoffers.Model{
+		s.mockState.model,
+		anotherState.model,
+	}
+
+	found, err := s.api.FindApplicationOffers(params.OfferFilters{
+		Filters: []params.OfferFilter{
+			{OfferName: "db2", OwnerName: "fred", ModelName: "prod"},
+			{OfferName: "mysql", OwnerName: "mary", ModelName: "prod"},
+		},
+	})
+	c.Assert(err, jc.ErrorIsNil)
+	var urls, modelTags []string
+	for _, offer := range found.Results {
+		urls = append(urls, offer.OfferURL)
+		modelTags = append(modelTags, offer.SourceModelTag)
+	}
+	sort.Strings(urls)
+	sort.Strings(modelTags)
+	c.Assert(urls, jc.DeepEquals, []string{"fred/prod.hosted-db2", "mary/prod.hosted-mysql"})
+	c.Assert(modelTags, jc.DeepEquals, []string{testing.ModelTag.String(), "model-uuid2"})
+	s.applicationOffers.CheckCallNames(c, listOffersBackendCall, listOffersBackendCall)
+}
+
 func (s *applicationOffersSuite) TestFindError(c *gc.C) {
 	filter := params.OfferFilters{
 		Filters: []params.OfferFilter{
@@ -976,6 +1162,7 @@ func (s *consumeSuite) TestConsumeDetailsWithPermission(c *gc.C) {
 	c.Assert(results.Results[0].Error, gc.IsNil)
 	c.Assert(results.Results[0].Offer, jc.DeepEquals, &params.ApplicationOffer{
 		SourceModelTag:         "model-deadbeef-0bad-400d-8000-4b1d0d06f00d",
+		ControllerVersion:      jujuversion.Current.String(),
 		OfferURL:               "fred/prod.hosted-mysql",
 		OfferName:              "hosted-mysql",
 		ApplicationDescription: "a database",
@@ -1022,6 +1209,7 @@ func (s *consumeSuite) TestConsumeDetailsDefaultEndpoint(c *gc.C) {
 	c.Assert(results.Results[0].Error, gc.IsNil)
 	c.Assert(results.Results[0].Offer, jc.DeepEquals, &params.ApplicationOffer{
 		SourceModelTag:         "model-deadbeef-0bad-400d-8000-4b1d0d06f00d",
+		ControllerVersion:      jujuversion.Current.String(),
 		OfferURL:               "fred/prod.hosted-mysql",
 		OfferName:              "hosted-mysql",
 		ApplicationDescription: "a database",
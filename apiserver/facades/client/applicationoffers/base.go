@@ -17,6 +17,8 @@ import (
 	jujucrossmodel "github.com/juju/juju/core/crossmodel"
 	"github.com/juju/juju/environs"
 	"github.com/juju/juju/permission"
+	"github.com/juju/juju/state"
+	jujuversion "github.com/juju/juju/version"
 )
 
 // BaseAPI provides various boilerplate methods used by the facade business logic.
@@ -107,6 +109,10 @@ func (api *BaseAPI) applicationOffersFromModel(
 	if err != nil {
 		return nil, errors.Trace(err)
 	}
+	includeUsers := false
+	for _, filter := range filters {
+		includeUsers = includeUsers || filter.IncludeUsers
+	}
 
 	var results []params.ApplicationOfferDetails
 	for _, appOffer := range offers {
@@ -143,12 +149,83 @@ func (api *BaseAPI) applicationOffersFromModel(
 			offer.ApplicationName = app.Name()
 			offer.CharmName = curl.Name
 			offer.ConnectedCount = status.ConnectionCount()
+			if err := setEndpointConnectedCounts(backend, app, &appOffer, offer.Endpoints); err != nil {
+				logger.Warningf("cannot get offer endpoint connection counts: %v", err)
+			}
+			if includeUsers {
+				users, err := backend.GetOfferUsers(offer.OfferName)
+				if err != nil {
+					logger.Warningf("cannot get offer users: %v", err)
+				} else {
+					offer.Users = makeOfferUsers(users)
+				}
+			}
 		}
 		results = append(results, offer)
 	}
 	return results, nil
 }
 
+// setEndpointConnectedCounts sets the number of relations between
+// each of the offer's endpoints and the applications consuming it.
+func setEndpointConnectedCounts(
+	backend Backend, app Application, offer *jujucrossmodel.ApplicationOffer, endpoints []params.RemoteEndpoint,
+) error {
+	relations, err := app.Relations()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	// Applications consuming the offer are represented
+	// in the offering model by remote applications.
+	counts := make(map[string]int)
+	for _, rel := range relations {
+		var local, remote *state.Endpoint
+		relEndpoints := rel.Endpoints()
+		for i, ep := range relEndpoints {
+			if ep.ApplicationName == app.Name() {
+				local = &relEndpoints[i]
+			} else {
+				remote = &relEndpoints[i]
+			}
+		}
+		if local == nil || remote == nil {
+			continue
+		}
+		remoteApp, err := backend.RemoteApplication(remote.ApplicationName)
+		if errors.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if remoteApp.OfferName() == offer.OfferName {
+			counts[local.Name]++
+		}
+	}
+	for i, ep := range endpoints {
+		count := counts[offer.Endpoints[ep.Name].Name]
+		endpoints[i].ConnectedCount = &count
+	}
+	return nil
+}
+
+// makeOfferUsers returns the offer users and their access, sorted by user name.
+func makeOfferUsers(users map[string]permission.Access) []params.OfferUserDetails {
+	if len(users) == 0 {
+		return nil
+	}
+	userNames := make([]string, 0, len(users))
+	for name := range users {
+		userNames = append(userNames, name)
+	}
+	sort.Strings(userNames)
+	result := make([]params.OfferUserDetails, len(userNames))
+	for i, name := range userNames {
+		result[i] = params.OfferUserDetails{UserName: name, Access: string(users[name])}
+	}
+	return result
+}
+
 // checkOfferAccess returns the level of access the authenticated user has to the offer,
 // so long as it is greater than the requested perm.
 func (api *BaseAPI) checkOfferAccess(backend Backend, offerName string, perm permission.Access) (permission.Access, error) {
@@ -213,7 +290,8 @@ func (api *BaseAPI) getModelFilters(filters params.OfferFilters) (
 	filtersPerModel = make(map[string][]jujucrossmodel.ApplicationOfferFilter)
 
 	// Group the filters per model and then query each model with the relevant filters
-	// for that model.
+	// for that model. Models are keyed by owner and name, as models of
+	// different owners may have the same name.
 	modelUUIDs := make(map[string]string)
 	for _, f := range filters.Filters {
 		if f.ModelName == "" {
@@ -223,7 +301,8 @@ func (api *BaseAPI) getModelFilters(filters params.OfferFilters) (
 			modelUUID string
 			ok        bool
 		)
-		if modelUUID, ok = modelUUIDs[f.ModelName]; !ok {
+		modelKey := f.OwnerName + "/" + f.ModelName
+		if modelUUID, ok = modelUUIDs[modelKey]; !ok {
 			var err error
 			model, ok, err := api.modelForName(f.ModelName, f.OwnerName)
 			if err != nil {
@@ -235,7 +314,7 @@ func (api *BaseAPI) getModelFilters(filters params.OfferFilters) (
 			}
 			// Record the UUID and model for next time.
 			modelUUID = model.UUID()
-			modelUUIDs[f.ModelName] = modelUUID
+			modelUUIDs[modelKey] = modelUUID
 			models[modelUUID] = model
 		}
 
@@ -285,6 +364,9 @@ func (api *BaseAPI) getApplicationOffersDetails(
 
 		for _, offerDetails := range offers {
 			offerDetails.OfferURL = jujucrossmodel.MakeURL(model.Owner().Name(), model.Name(), offerDetails.OfferName, "")
+			offerDetails.CloudName = model.Cloud()
+			offerDetails.CloudRegion = model.CloudRegion()
+			offerDetails.ControllerVersion = jujuversion.Current.String()
 			result = append(result, offerDetails)
 		}
 	}
@@ -296,6 +378,7 @@ func makeOfferFilterFromParams(filter params.OfferFilter) jujucrossmodel.Applica
 		OfferName:              filter.OfferName,
 		ApplicationName:        filter.ApplicationName,
 		ApplicationDescription: filter.ApplicationDescription,
+		IncludeUsers:           filter.IncludeUsers,
 	}
 	// TODO(wallyworld) - add support for Endpoint filter attribute
 	return offerFilter
@@ -90,9 +90,11 @@ type mockNoNetworkEnviron struct {
 }
 
 type mockModel struct {
-	uuid  string
-	name  string
-	owner string
+	uuid        string
+	name        string
+	owner       string
+	cloud       string
+	cloudRegion string
 }
 
 func (m *mockModel) UUID() string {
@@ -111,6 +113,14 @@ func (m *mockModel) Owner() names.UserTag {
 	return names.NewUserTag(m.owner)
 }
 
+func (m *mockModel) Cloud() string {
+	return m.cloud
+}
+
+func (m *mockModel) CloudRegion() string {
+	return m.cloudRegion
+}
+
 type mockCharm struct {
 	meta *charm.Meta
 }
@@ -129,6 +139,7 @@ type mockApplication struct {
 	curl      *charm.URL
 	endpoints []state.Endpoint
 	bindings  map[string]string
+	relations []applicationoffers.Relation
 }
 
 func (m *mockApplication) Name() string {
@@ -151,6 +162,18 @@ func (m *mockApplication) EndpointBindings() (map[string]string, error) {
 	return m.bindings, nil
 }
 
+func (m *mockApplication) Relations() ([]applicationoffers.Relation, error) {
+	return m.relations, nil
+}
+
+type mockRelation struct {
+	endpoints []state.Endpoint
+}
+
+func (m *mockRelation) Endpoints() []state.Endpoint {
+	return m.endpoints
+}
+
 type mockRemoteApplication struct {
 	name           string
 	sourceModelTag names.ModelTag
@@ -181,6 +204,10 @@ func (m *mockRemoteApplication) Spaces() []state.RemoteSpace {
 	return m.spaces
 }
 
+func (m *mockRemoteApplication) OfferName() string {
+	return m.offerName
+}
+
 func (m *mockRemoteApplication) AddEndpoints(eps []charm.Relation) error {
 	for _, ep := range eps {
 		m.endpoints = append(m.endpoints, state.Endpoint{
@@ -271,15 +298,17 @@ type offerAccess struct {
 
 type mockState struct {
 	common.AddressAndCertGetter
-	modelUUID         string
-	model             applicationoffers.Model
-	allmodels         []applicationoffers.Model
-	users             set.Strings
-	applications      map[string]applicationoffers.Application
-	applicationOffers map[string]jujucrossmodel.ApplicationOffer
-	spaces            map[string]applicationoffers.Space
-	connStatus        applicationoffers.RemoteConnectionStatus
-	accessPerms       map[offerAccess]permission.Access
+	modelUUID          string
+	model              applicationoffers.Model
+	allmodels          []applicationoffers.Model
+	users              set.Strings
+	applications       map[string]applicationoffers.Application
+	remoteApplications map[string]applicationoffers.RemoteApplication
+	applicationOffers  map[string]jujucrossmodel.ApplicationOffer
+	spaces             map[string]applicationoffers.Space
+	connStatus         applicationoffers.RemoteConnectionStatus
+	accessPerms        map[offerAccess]permission.Access
+	offerUsersErr      error
 }
 
 func (m *mockState) ControllerTag() names.ControllerTag {
@@ -298,6 +327,14 @@ func (m *mockState) Application(name string) (applicationoffers.Application, err
 	return app, nil
 }
 
+func (m *mockState) RemoteApplication(name string) (applicationoffers.RemoteApplication, error) {
+	app, ok := m.remoteApplications[name]
+	if !ok {
+		return nil, errors.NotFoundf("remote application %q", name)
+	}
+	return app, nil
+}
+
 func (m *mockState) ApplicationOffer(name string) (*jujucrossmodel.ApplicationOffer, error) {
 	offer, ok := m.applicationOffers[name]
 	if !ok {
@@ -345,6 +382,20 @@ func (m *mockState) GetOfferAccess(offer names.ApplicationOfferTag, user names.U
 	return access, nil
 }
 
+func (m *mockState) GetOfferUsers(offerName string) (map[string]permission.Access, error) {
+	if m.offerUsersErr != nil {
+		return nil, m.offerUsersErr
+	}
+	result := make(map[string]permission.Access)
+	for offerAccess, access := range m.accessPerms {
+		if offerAccess.offer.Id() != offerName {
+			continue
+		}
+		result[offerAccess.user.Id()] = access
+	}
+	return result, nil
+}
+
 func (m *mockState) CreateOfferAccess(offer names.ApplicationOfferTag, user names.UserTag, access permission.Access) error {
 	if !m.users.Contains(user.Name()) {
 		return errors.NotFoundf("user %q", user.Name())
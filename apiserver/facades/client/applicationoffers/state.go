@@ -53,9 +53,11 @@ type Backend interface {
 	AllModels() ([]Model, error)
 	ModelTag() names.ModelTag
 	RemoteConnectionStatus(offerName string) (RemoteConnectionStatus, error)
+	RemoteApplication(name string) (RemoteApplication, error)
 	Space(string) (Space, error)
 
 	GetOfferAccess(offer names.ApplicationOfferTag, user names.UserTag) (permission.Access, error)
+	GetOfferUsers(offerName string) (map[string]permission.Access, error)
 	CreateOfferAccess(offer names.ApplicationOfferTag, user names.UserTag, access permission.Access) error
 	UpdateOfferAccess(offer names.ApplicationOfferTag, user names.UserTag, access permission.Access) error
 	RemoveOfferAccess(offer names.ApplicationOfferTag, user names.UserTag) error
@@ -133,6 +135,7 @@ type Application interface {
 	Name() string
 	Endpoints() ([]state.Endpoint, error)
 	EndpointBindings() (map[string]string, error)
+	Relations() ([]Relation, error)
 }
 
 type applicationShim struct {
@@ -143,6 +146,34 @@ func (a *applicationShim) Charm() (ch Charm, force bool, err error) {
 	return a.Application.Charm()
 }
 
+func (a *applicationShim) Relations() ([]Relation, error) {
+	relations, err := a.Application.Relations()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	result := make([]Relation, len(relations))
+	for i, rel := range relations {
+		result[i] = rel
+	}
+	return result, nil
+}
+
+type Relation interface {
+	Endpoints() []state.Endpoint
+}
+
+type RemoteApplication interface {
+	OfferName() string
+}
+
+func (s *stateShim) RemoteApplication(name string) (RemoteApplication, error) {
+	app, err := s.State.RemoteApplication(name)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	return app, nil
+}
+
 type Charm interface {
 	Meta() *charm.Meta
 	StoragePath() string
@@ -191,6 +222,8 @@ type Model interface {
 	ModelTag() names.ModelTag
 	Name() string
 	Owner() names.UserTag
+	Cloud() string
+	CloudRegion() string
 }
 
 type modelShim struct {
@@ -36,27 +36,42 @@ type OfferFilter struct {
 	ApplicationUser        string                     `json:"application-user"`
 	Endpoints              []EndpointFilterAttributes `json:"endpoints"`
 	AllowedUserTags        []string                   `json:"allowed-users"`
+
+	// IncludeUsers requests the users with access to each matching
+	// offer. They are only returned to offer admins.
+	IncludeUsers bool `json:"include-users,omitempty"`
 }
 
 // ApplicationOffer represents an application offering from an external model.
 type ApplicationOffer struct {
-	SourceModelTag         string            `json:"source-model-tag"`
-	OfferURL               string            `json:"offer-url"`
-	OfferName              string            `json:"offer-name"`
-	ApplicationDescription string            `json:"application-description"`
-	Endpoints              []RemoteEndpoint  `json:"endpoints"`
-	Spaces                 []RemoteSpace     `json:"spaces"`
-	Bindings               map[string]string `json:"bindings"`
-	Access                 string            `json:"access"`
+	SourceModelTag         string             `json:"source-model-tag"`
+	OfferURL               string             `json:"offer-url"`
+	OfferName              string             `json:"offer-name"`
+	ApplicationName        string             `json:"application-name,omitempty"`
+	ApplicationDescription string             `json:"application-description"`
+	Endpoints              []RemoteEndpoint   `json:"endpoints"`
+	Spaces                 []RemoteSpace      `json:"spaces"`
+	Bindings               map[string]string  `json:"bindings"`
+	Access                 string             `json:"access"`
+	Users                  []OfferUserDetails `json:"users,omitempty"`
+	CloudName              string             `json:"cloud-name,omitempty"`
+	CloudRegion            string             `json:"cloud-region,omitempty"`
+	APIAddresses           []string           `json:"api-addresses,omitempty"`
+	ControllerVersion      string             `json:"controller-version,omitempty"`
+}
+
+// OfferUserDetails represents a user and their access on an offer.
+type OfferUserDetails struct {
+	UserName string `json:"user"`
+	Access   string `json:"access"`
 }
 
 // ApplicationOfferDetails represents an application offering,
 // including details about how it has been deployed.
 type ApplicationOfferDetails struct {
 	ApplicationOffer
-	ApplicationName string `json:"application-name"`
-	CharmName       string `json:"charm-name"`
-	ConnectedCount  int    `json:"connected-count"`
+	CharmName      string `json:"charm-name"`
+	ConnectedCount int    `json:"connected-count"`
 }
 
 // ListApplicationOffersResults is a result of listing application offers.
@@ -86,6 +101,10 @@ type RemoteEndpoint struct {
 	Interface string              `json:"interface"`
 	Limit     int                 `json:"limit"`
 	Scope     charm.RelationScope `json:"scope"`
+
+	// ConnectedCount is the number of relations to the endpoint
+	// from consuming models. It is only set for offer admins.
+	ConnectedCount *int `json:"connected-count,omitempty"`
 }
 
 // RemoteSpace represents a space in some remote model.
@@ -5,8 +5,10 @@ package crossmodel
 
 import (
 	"github.com/juju/cmd"
+	"github.com/juju/utils/clock"
 
 	"github.com/juju/juju/cmd/modelcmd"
+	"github.com/juju/juju/core/crossmodel"
 	"github.com/juju/juju/jujuclient"
 )
 
@@ -59,3 +61,82 @@ func NewFindEndpointsCommandForTest(store jujuclient.ClientStore, api FindAPI) c
 	aCmd.SetClientStore(store)
 	return modelcmd.WrapController(aCmd)
 }
+
+func NewFindEndpointsCommandForTestWithCloudAPI(store jujuclient.ClientStore, api FindAPI, cloudAPI CloudAPI) cmd.Command {
+	aCmd := &findCommand{
+		newAPIFunc: func(controllerName string) (FindAPI, error) {
+			return api, nil
+		},
+		newCloudAPIFunc: func(controllerName string) (CloudAPI, error) {
+			return cloudAPI, nil
+		},
+	}
+	aCmd.SetClientStore(store)
+	return modelcmd.WrapController(aCmd)
+}
+
+func NewFindEndpointsCommandForTestWithStatusAPI(store jujuclient.ClientStore, api FindAPI, statusAPI StatusAPI) cmd.Command {
+	aCmd := &findCommand{
+		newAPIFunc: func(controllerName string) (FindAPI, error) {
+			return api, nil
+		},
+		newStatusAPIFunc: func(controllerName string) (StatusAPI, error) {
+			return statusAPI, nil
+		},
+	}
+	aCmd.SetClientStore(store)
+	return modelcmd.WrapController(aCmd)
+}
+
+func NewFindEndpointsCommandForTestWithAPIFunc(store jujuclient.ClientStore, newAPIFunc func(string) (FindAPI, error)) cmd.Command {
+	aCmd := &findCommand{newAPIFunc: newAPIFunc}
+	aCmd.SetClientStore(store)
+	return modelcmd.WrapController(aCmd)
+}
+
+func NewFindEndpointsCommandForTestWithClock(store jujuclient.ClientStore, api FindAPI, clock clock.Clock) cmd.Command {
+	aCmd := &findCommand{
+		newAPIFunc: func(controllerName string) (FindAPI, error) {
+			return api, nil
+		},
+		clock: clock,
+	}
+	aCmd.SetClientStore(store)
+	return modelcmd.WrapController(aCmd)
+}
+
+func NewFindEndpointsCommandForTestWithAPIFuncAndClock(store jujuclient.ClientStore, newAPIFunc func(string) (FindAPI, error), clock clock.Clock) cmd.Command {
+	aCmd := &findCommand{newAPIFunc: newAPIFunc, clock: clock}
+	aCmd.SetClientStore(store)
+	return modelcmd.WrapController(aCmd)
+}
+
+// ResetOfferIndexes discards any offers cached by earlier queries.
+func ResetOfferIndexes() {
+	cachedOfferIndexes.mu.Lock()
+	defer cachedOfferIndexes.mu.Unlock()
+	cachedOfferIndexes.indexes = make(map[string]*offerIndex)
+}
+
+// WhereFilter parses the expression and applies it to the filter.
+func WhereFilter(expr string, filter *crossmodel.ApplicationOfferFilter) error {
+	where, err := parseWhere(expr)
+	if err != nil {
+		return err
+	}
+	applyWhereFilter(where, filter)
+	return nil
+}
+
+// WhereMatches parses the expression and evaluates it against the offer.
+func WhereMatches(expr, url string, offer ApplicationOfferResult) (bool, error) {
+	where, err := parseWhere(expr)
+	if err != nil {
+		return false, err
+	}
+	fields, err := newOfferFields(url, offer)
+	if err != nil {
+		return false, err
+	}
+	return where.matches(fields), nil
+}
@@ -4,32 +4,225 @@
 package crossmodel
 
 import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
 	"github.com/juju/cmd"
 	"github.com/juju/errors"
 	"github.com/juju/gnuflag"
+	"github.com/juju/loggo"
+	"github.com/juju/utils/clock"
+	"gopkg.in/juju/charm.v6-unstable"
+	"gopkg.in/juju/names.v2"
 
 	"github.com/juju/juju/apiserver/params"
+	jujucloud "github.com/juju/juju/cloud"
 	"github.com/juju/juju/cmd/modelcmd"
 	"github.com/juju/juju/core/crossmodel"
+	"github.com/juju/juju/jujuclient"
+	"github.com/juju/juju/permission"
 )
 
+var logger = loggo.GetLogger("juju.cmd.juju.crossmodel")
+
 const findCommandDoc = `
 Find which offered application endpoints are available to the current user.
 
 This command is aimed for a user who wants to discover what endpoints are available to them.
 
+In yaml and json output, endpoints of an interface the offer both provides
+and requires are marked pass-through, as the offer may be related on either
+side of that interface.
+
 options:
 -o, --output (= "")
    specify an output file
 --format (= tabular)
-   specify output format (tabular|json|yaml)
+   specify output format (dot|env|json|matrix|tabular|yaml)
 
 Examples:
    $ juju find-endpoints
    $ juju find-endpoints mycontroller:
    $ juju find-endpoints fred/prod
+   $ juju find-endpoints db2
+   $ juju find-endpoints mycontroller:fred/prod --no-resolve
+   $ juju find-endpoints fred/prod.db2 --strict-url
+   $ juju find-endpoints --group-by application
    $ juju find-endpoints --interface mysql --url fred/prod
+   $ juju find-endpoints --model fred/prod --model fred/staging
    $ juju find-endpoints --url fred/prod.db2
+   $ juju find-endpoints fred/prod.DB2 --ignore-case
+   $ juju find-endpoints --interface mysql --endpoint db --explain-matches
+   $ juju find-endpoints --interface logging --match-both-roles
+   $ juju find-endpoints --endpoint-pattern "^db.*"
+   $ juju find-endpoints --url-regex "^prod-.*:fred/.*\.db$"
+   $ juju find-endpoints fred/prod --format dot | dot -Tpng -o offers.png
+   $ juju find-endpoints fred/prod --format matrix
+   $ eval "$(juju find-endpoints fred/prod --format env)"
+   $ juju find-endpoints --source-group prod --interface mysql
+   $ juju find-endpoints fred/prod.db2 --show-users --format yaml
+   $ juju find-endpoints --where "interface=mysql and access>=consume and owner=alice"
+   $ juju find-endpoints --cloud aws --region us-east-1
+   $ juju find-endpoints --compatible-with mysql:requirer
+   $ juju find-endpoints --provides mysql --requires logging
+   $ juju find-endpoints --interface-all-distinct mysql,http
+   $ juju find-endpoints --consumable-by ./charms/wordpress
+   $ juju find-endpoints fred/prod --cached --interface mysql
+   $ juju find-endpoints --interface http --min-endpoints 3
+   $ juju find-endpoints --interfaces-file ./needed-interfaces
+   $ juju find-endpoints fred/prod.db2 --expect-min 1
+   $ juju find-endpoints fred/prod --list-endpoints provider
+   $ juju find-endpoints --format json --compact
+   $ juju find-endpoints fred/prod --format json --structured-errors
+   $ juju find-endpoints --interface mysql --show-capacity
+   $ juju find-endpoints fred/prod --show-relations
+   $ juju find-endpoints fred/prod --watch --format json
+   $ juju find-endpoints east:fred/prod --show-endpoints-addr --format yaml
+   $ juju find-endpoints fred/prod.db2 --show-usage
+   $ juju find-endpoints fred/prod --show-version
+   $ juju find-endpoints --source-group prod --timings
+   $ juju find-endpoints --interface mysql --count-by model
+   $ juju find-endpoints --source-group prod --list-sources
+   $ juju find-endpoints fred/prod --histogram interface
+   $ juju find-endpoints --interface mysql --plan mysql:wordpress:db
+   $ generate-filter | juju find-endpoints --filter-file -
+   $ juju find-endpoints --interface mysql --not-consumed
+   $ juju find-endpoints fred/prod -o offers.yaml --format yaml --summary-to-stdout
+
+The --url-regex pattern is matched against the full URL of each offer,
+including the controller, eg "mycontroller:fred/prod.db2".
+
+An offer with more than one endpoint of the same name is malformed; only
+the last of them is shown, with a warning, unless --strict-endpoints is
+specified, in which case it is an error.
+
+A URL consisting only of an offer name, eg "db2", finds that offer in the
+current model. A URL without a user, eg "prod.db2", finds offers in the
+current user's models, unless --strict-url is specified, in which case
+it is an error.
+
+By default --interface matches the interfaces an offer provides. Use
+--match-both-roles to also match interfaces the offer requires, which a
+consumer would provide.
+
+With --interfaces-file, offers matching any of the interfaces listed in
+the file, one per line, are returned. Blank lines and lines starting with
+"#" are ignored.
+
+Use --provides or --requires to find offers with a provider or requirer
+endpoint of exactly the specified interface. When both are given, offers
+must match both.
+
+Use --interface-all-distinct to find offers exposing each of a comma
+separated list of interfaces on a separate endpoint, as a gateway
+application would. An interface listed twice must be exposed by two
+endpoints. As only the last of several endpoints of the same name is
+shown, such endpoints count once.
+
+The --where expression combines comparisons on the fields owner, model,
+offer, interface, endpoint and access using "and", "or" and parentheses.
+Comparisons use = or !=; access may also be compared using >=, <=, > or <,
+where read < consume < admin.
+
+Tabular results are sorted by URL. A summary of the number of offers with each level
+of access follows the table.
+
+With --show-usage, each offer is shown with the commands to consume it
+and to relate an application to it once consumed. The relate command
+uses the first of the offer's endpoints by name; replace <application>
+with the name of the consuming application.
+
+Where the controller hosting an offer reports its Juju version, it is
+included in yaml and json output as controller-version. Use --show-version
+to add a Version column to tabular output; it is blank for offers whose
+controller version is not known.
+
+With --format matrix, each interface is shown against each offer, marked
+P if the offer provides it, R if the offer requires it or has it as a
+peer, or PR if both.
+
+With --format env, shell export statements are written for the number of
+offers, JUJU_OFFER_COUNT, and for the URL, access and endpoint interfaces
+of the Nth offer in order of URL, eg JUJU_OFFER_1_URL, JUJU_OFFER_1_ACCESS
+and JUJU_OFFER_1_ENDPOINT_DB. Endpoint names are upper cased, with any
+character not valid in a variable name replaced by "_". Nothing is written
+if there are no matching offers.
+
+With --count-by model, the number of matching offers in each model is
+shown instead of the offers themselves.
+
+With --group-by application, offers are grouped under the name of the
+application backing them, so that all the offers of one application are
+shown together. The application is only reported to offer admins; other
+offers are grouped under "(unknown)".
+
+With --consumed or --not-consumed, the offers are compared with those
+consumed by the current model, and only those which are, or are not,
+consumed are returned. Each result is marked with whether it is consumed.
+
+With --list-sources, the controllers hosting matching offers are shown,
+with the number of offers each hosts, instead of the offers themselves.
+
+With --histogram interface, the number of matching offers exposing each
+interface is shown instead of the offers themselves, as a bar chart with
+the most offered interfaces first in tabular output.
+
+With --plan <interface>:<application>[:<endpoint>], the commands to consume
+each offer exposing the interface and relate it to the local application
+endpoint are shown instead of the offers themselves. Each offer is
+consumed under its offer name, unless that is already used by another
+offer in the plan or by the local application, and related using its first
+endpoint of the interface by name.
+
+With --timings, the time each controller took to return its offers is
+shown after the results in tabular output, or as a "timings" map alongside
+the "results" in yaml and json output. Controllers answered from the
+--cached index are not timed.
+
+With --structured-errors, an error finding the offers is written to
+stderr in the output format, as an "error" object with a "message" and,
+where the controller gave one, a "code".
+
+With --filter-file, the URL, interface and endpoint to match are read
+from a YAML file, or from stdin if the file is "-", eg:
+
+   url: fred/prod
+   interface: mysql
+   endpoint: db
+
+Terms given in the file may not also be given on the command line.
+
+With --output, the results are written to the specified file instead
+of stdout. Add --summary-to-stdout to also print a line to stdout with
+the number of results written, eg "wrote 12 offers to offers.yaml".
+
+With --expect-min, only the number of matching offers is printed, and
+the command fails if there are fewer than specified. This allows scripts
+to check that offers exist.
+
+With --cached, all offers matching the URL are fetched once and indexed by
+endpoint name and interface; later --cached queries for the same URL made
+by the same process are answered from the index without contacting the
+controller.
+
+With --watch, the matching offers are written as a json "added" event,
+and each later change as an "added", "removed" or "modified" event, one
+per line, until interrupted. Controllers which cannot notify of offer
+changes are queried every --poll-interval instead.
+
+A source group names a set of controllers to query in turn. Groups are
+read from ~/.local/share/juju/source-groups.yaml, or the file specified
+with --source-group-file, eg:
+
+   source-groups:
+     prod:
+     - controller-east
+     - controller-west
    
 See also:
    show-endpoints   
@@ -45,18 +238,103 @@ type findCommand struct {
 	offerName      string
 	interfaceName  string
 	endpoint       string
+	compatibleWith string
+	provides       string
+	requires       string
+	consumableBy   string
+
+	allDistinct           string
+	allDistinctInterfaces []string
+
+	// endpointTerms holds the endpoint filter terms applied on
+	// the client, as the controller does not filter by endpoint.
+	endpointTerms []crossmodel.EndpointFilterTerm
+
+	matchBothRoles bool
+	endpointRegexp *regexp.Regexp
+	urlRegexp      *regexp.Regexp
+	explainMatches bool
+	showUsers      bool
+	cached         bool
+	bareOfferName  bool
+	noResolve      bool
+	strictURL      bool
+	strictEndpoint bool
+	ignoreCase     bool
+	groupBy        string
+	countBy        string
+	listSources    bool
+	histogram      string
+	planValue      string
+	plan           planTarget
+	consumed       bool
+	notConsumed    bool
+	compact        bool
+	showCapacity   bool
+	showRelations  bool
+	showAPIAddrs   bool
+	showUsage      bool
+	showVersion    bool
+	showTimings    bool
+	watch          bool
+	pollInterval   time.Duration
+	where          string
+	whereExpr      whereExpr
+
+	structuredErrors bool
+	summaryToStdout  bool
+
+	// matchedOffers is the number of offers found, once
+	// filtered, reported by the --summary-to-stdout line.
+	matchedOffers int
+
+	endpointPattern   string
+	urlPattern        string
+	minEndpoints      int
+	expectMin         int
+	listEndpointsRole string
+
+	cloudName   string
+	cloudRegion string
+
+	compatibleInterface string
+	compatibleRole      string
+
+	modelValues []string
+	models      []modelRef
+
+	sourceGroup     string
+	sourceGroupFile string
+	filterFile      cmd.FileVar
+	interfacesFile  string
+	sources         []string
+
+	out             cmd.Output
+	outputFlag      *gnuflag.Flag
+	newAPIFunc      func(string) (FindAPI, error)
+	newCloudAPIFunc func(string) (CloudAPI, error)
+
+	newStatusAPIFunc func(string) (StatusAPI, error)
+	clock            clock.Clock
 
-	out        cmd.Output
-	newAPIFunc func(string) (FindAPI, error)
+	// timings holds how long each source took to return
+	// its offers, when --timings is specified.
+	timings map[string]time.Duration
 }
 
 // NewFindEndpointsCommand constructs command that
 // allows to find offered application endpoints.
 func NewFindEndpointsCommand() cmd.Command {
-	findCmd := &findCommand{}
+	findCmd := &findCommand{clock: clock.WallClock}
 	findCmd.newAPIFunc = func(controllerName string) (FindAPI, error) {
 		return findCmd.NewRemoteEndpointsAPI(controllerName)
 	}
+	findCmd.newCloudAPIFunc = func(controllerName string) (CloudAPI, error) {
+		return findCmd.NewCloudAPI(controllerName)
+	}
+	findCmd.newStatusAPIFunc = func(controllerName string) (StatusAPI, error) {
+		return findCmd.NewModelStatusAPI(controllerName)
+	}
 	return modelcmd.WrapController(findCmd)
 }
 
@@ -71,6 +349,164 @@ func (c *findCommand) Init(args []string) (err error) {
 			return errors.New("URL term cannot be specified twice")
 		}
 		c.url = url
+		c.bareOfferName = !strings.ContainsAny(url, "/.:")
+	}
+	if c.ignoreCase {
+		c.url = foldOfferURL(c.url)
+	}
+	if c.compatibleWith != "" {
+		if err := c.parseCompatibleWith(); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if c.allDistinct != "" {
+		if c.allDistinctInterfaces, err = parseInterfaceList(c.allDistinct); err != nil {
+			return errors.Annotate(err, "invalid --interface-all-distinct")
+		}
+	}
+	if c.consumed && c.notConsumed {
+		return errors.New("cannot specify both --consumed and --not-consumed")
+	}
+	if len(c.modelValues) > 0 {
+		if c.models, err = parseModels(c.modelValues); err != nil {
+			return errors.Trace(err)
+		}
+		if c.watch || c.ignoreCase {
+			return errors.New("--model cannot be used with --watch or --ignore-case")
+		}
+	}
+	if c.interfacesFile != "" && (c.interfaceName != "" || c.matchBothRoles) {
+		return errors.New("--interfaces-file cannot be used with --interface or --match-both-roles")
+	}
+	if c.matchBothRoles && c.interfaceName == "" && c.filterFile.Path == "" {
+		// The interface may instead be read from the filter file.
+		return errors.New("--match-both-roles requires --interface")
+	}
+	if c.cloudRegion != "" && c.cloudName == "" {
+		return errors.New("--region requires --cloud")
+	}
+	switch charm.RelationRole(c.listEndpointsRole) {
+	case "", charm.RoleProvider, charm.RoleRequirer, charm.RolePeer:
+	default:
+		return errors.Errorf("invalid --list-endpoints role %q, expected %q, %q or %q",
+			c.listEndpointsRole, charm.RoleProvider, charm.RoleRequirer, charm.RolePeer)
+	}
+	if c.compact && c.out.Name() != "yaml" && c.out.Name() != "json" {
+		return errors.New("--compact requires --format yaml or json")
+	}
+	if c.showAPIAddrs && c.out.Name() != "yaml" && c.out.Name() != "json" {
+		return errors.New("--show-endpoints-addr requires --format yaml or json")
+	}
+	if c.structuredErrors && c.out.Name() != "yaml" && c.out.Name() != "json" {
+		return errors.New("--structured-errors requires --format yaml or json")
+	}
+	// The dot, matrix and env formats can only show offers.
+	offersOnly := c.out.Name() == "dot" || c.out.Name() == "matrix" || c.out.Name() == "env"
+	if c.listEndpointsRole != "" && offersOnly {
+		return errors.Errorf("--list-endpoints cannot be used with --format %s", c.out.Name())
+	}
+	if c.groupBy != "" {
+		if c.groupBy != groupByApplication {
+			return errors.Errorf("invalid --group-by value %q, expected %q", c.groupBy, groupByApplication)
+		}
+		if offersOnly {
+			return errors.Errorf("--group-by cannot be used with --format %s", c.out.Name())
+		}
+		if c.listEndpointsRole != "" || c.countBy != "" || c.listSources || c.histogram != "" || c.watch {
+			return errors.New("--group-by cannot be used with --list-endpoints, --count-by, --list-sources, --histogram or --watch")
+		}
+	}
+	if c.countBy != "" {
+		if c.countBy != countByModel {
+			return errors.Errorf("invalid --count-by value %q, expected %q", c.countBy, countByModel)
+		}
+		if offersOnly {
+			return errors.Errorf("--count-by cannot be used with --format %s", c.out.Name())
+		}
+		if c.listEndpointsRole != "" {
+			return errors.New("--count-by cannot be used with --list-endpoints")
+		}
+	}
+	if c.listSources {
+		if offersOnly {
+			return errors.Errorf("--list-sources cannot be used with --format %s", c.out.Name())
+		}
+		if c.listEndpointsRole != "" || c.countBy != "" {
+			return errors.New("--list-sources cannot be used with --list-endpoints or --count-by")
+		}
+	}
+	if c.histogram != "" {
+		if c.histogram != histogramByInterface {
+			return errors.Errorf("invalid --histogram value %q, expected %q", c.histogram, histogramByInterface)
+		}
+		if offersOnly {
+			return errors.Errorf("--histogram cannot be used with --format %s", c.out.Name())
+		}
+		if c.listEndpointsRole != "" || c.countBy != "" || c.listSources {
+			return errors.New("--histogram cannot be used with --list-endpoints, --count-by or --list-sources")
+		}
+	}
+	if c.planValue != "" {
+		if c.plan, err = parsePlanTarget(c.planValue); err != nil {
+			return errors.Trace(err)
+		}
+		if offersOnly {
+			return errors.Errorf("--plan cannot be used with --format %s", c.out.Name())
+		}
+		if c.groupBy != "" || c.listEndpointsRole != "" || c.countBy != "" || c.listSources || c.histogram != "" || c.watch {
+			return errors.New("--plan cannot be used with --group-by, --list-endpoints, --count-by, --list-sources, --histogram or --watch")
+		}
+	}
+	if c.watch {
+		if c.out.Name() != "json" {
+			return errors.New("--watch requires --format json")
+		}
+		if c.cached || c.listEndpointsRole != "" || c.countBy != "" || c.listSources || c.histogram != "" {
+			return errors.New("--watch cannot be used with --cached, --list-endpoints, --count-by, --list-sources or --histogram")
+		}
+		if c.pollInterval <= 0 {
+			return errors.Errorf("invalid --poll-interval %v, expected a positive duration", c.pollInterval)
+		}
+	}
+	if c.minEndpoints < 0 {
+		return errors.Errorf("invalid --min-endpoints %d, expected a positive number", c.minEndpoints)
+	}
+	if c.expectMin < 0 {
+		return errors.Errorf("invalid --expect-min %d, expected a positive number", c.expectMin)
+	}
+	if c.expectMin > 0 && c.watch {
+		return errors.New("--expect-min cannot be used with --watch")
+	}
+	if c.summaryToStdout {
+		if c.outputPath() == "" {
+			return errors.New("--summary-to-stdout requires --output")
+		}
+		if c.watch || c.expectMin > 0 {
+			return errors.New("--summary-to-stdout cannot be used with --watch or --expect-min")
+		}
+	}
+	if c.showTimings {
+		if offersOnly {
+			return errors.Errorf("--timings cannot be used with --format %s", c.out.Name())
+		}
+		if c.watch || c.expectMin > 0 {
+			return errors.New("--timings cannot be used with --watch or --expect-min")
+		}
+	}
+	if c.endpointPattern != "" {
+		if c.endpointRegexp, err = regexp.Compile(c.endpointPattern); err != nil {
+			return errors.Annotate(err, "invalid --endpoint-pattern")
+		}
+	}
+	if c.urlPattern != "" {
+		if c.urlRegexp, err = regexp.Compile(c.urlPattern); err != nil {
+			return errors.Annotate(err, "invalid --url-regex")
+		}
+	}
+	if c.where != "" {
+		if c.whereExpr, err = parseWhere(c.where); err != nil {
+			return errors.Annotate(err, "invalid --where expression")
+		}
 	}
 	return nil
 }
@@ -90,60 +526,850 @@ func (c *findCommand) SetFlags(f *gnuflag.FlagSet) {
 	f.StringVar(&c.url, "url", "", "application URL")
 	f.StringVar(&c.interfaceName, "interface", "", "return results matching the interface name")
 	f.StringVar(&c.endpoint, "endpoint", "", "return results matching the endpoint name")
+	f.StringVar(&c.consumableBy, "consumable-by", "", "return results providing an interface required by the charm at the specified path")
+	f.StringVar(&c.compatibleWith, "compatible-with", "", "return results with an endpoint able to relate to the specified <interface>:<role>")
+	f.StringVar(&c.provides, "provides", "", "return results with a provider endpoint of the specified interface")
+	f.StringVar(&c.requires, "requires", "", "return results with a requirer endpoint of the specified interface")
+	f.StringVar(&c.allDistinct, "interface-all-distinct", "", "return results exposing each of the comma separated interfaces on a separate endpoint")
+	f.BoolVar(&c.matchBothRoles, "match-both-roles", false, "match the interface name against requirer as well as provider endpoints")
+	f.StringVar(&c.endpointPattern, "endpoint-pattern", "", "return results with an endpoint name matching the regular expression")
+	f.StringVar(&c.urlPattern, "url-regex", "", "return results with a URL matching the regular expression")
+	f.StringVar(&c.listEndpointsRole, "list-endpoints", "", "list the endpoints of the specified role (provider|requirer|peer) rather than offers")
+	f.IntVar(&c.minEndpoints, "min-endpoints", 0, "return results with at least the specified number of endpoints")
+	f.IntVar(&c.expectMin, "expect-min", 0, "print only the number of results, failing if there are fewer than specified")
+	f.StringVar(&c.cloudName, "cloud", "", "return results for offers in models on the specified cloud")
+	f.StringVar(&c.cloudRegion, "region", "", "return results for offers in models on the specified cloud region")
+	f.Var(cmd.NewAppendStringsValue(&c.modelValues), "model", "return results in the specified <owner>/<model>; may be repeated")
+	f.StringVar(&c.sourceGroup, "source-group", "", "query each controller in the named source group")
+	f.StringVar(&c.sourceGroupFile, "source-group-file", "", "read source groups from the specified file")
+	f.Var(&c.filterFile, "filter-file", "read the URL, interface and endpoint to match from a YAML file, or stdin if \"-\"")
+	f.StringVar(&c.interfacesFile, "interfaces-file", "", "return results matching any of the interface names listed in the specified file")
+	f.StringVar(&c.where, "where", "", "return results matching the filter expression")
+	f.BoolVar(&c.showUsers, "show-users", false, "show the access each user has on the offer (admin only)")
+	f.BoolVar(&c.showCapacity, "show-capacity", false, "show how many more relations each endpoint can accept")
+	f.BoolVar(&c.showRelations, "show-relations", false, "show how many relations currently use each endpoint")
+	f.BoolVar(&c.showAPIAddrs, "show-endpoints-addr", false, "show the API addresses of the controller hosting each offer, where known")
+	f.BoolVar(&c.showUsage, "show-usage", false, "show the commands to consume and relate to each offer")
+	f.BoolVar(&c.showVersion, "show-version", false, "show the Juju version of the controller hosting each offer in tabular output")
+	f.BoolVar(&c.showTimings, "timings", false, "show how long each controller took to return its offers")
+	f.StringVar(&c.groupBy, "group-by", "", "group results by the application backing each offer (application)")
+	f.StringVar(&c.countBy, "count-by", "", "show the number of results in each model (model)")
+	f.BoolVar(&c.listSources, "list-sources", false, "list the controllers hosting results rather than offers")
+	f.StringVar(&c.histogram, "histogram", "", "show a chart of the number of results exposing each interface (interface)")
+	f.StringVar(&c.planValue, "plan", "", "show the commands to consume and relate each result exposing an interface to a local endpoint (<interface>:<application>[:<endpoint>])")
+	f.BoolVar(&c.consumed, "consumed", false, "return results consumed by the current model")
+	f.BoolVar(&c.notConsumed, "not-consumed", false, "return results not consumed by the current model")
+	f.BoolVar(&c.ignoreCase, "ignore-case", false, "match the owner, model and offer names in the URL regardless of case")
+	f.BoolVar(&c.noResolve, "no-resolve", false, "use the URL as entered, without filling in the current controller or user")
+	f.BoolVar(&c.strictURL, "strict-url", false, "require the URL to specify the user rather than using the current user")
+	f.BoolVar(&c.strictEndpoint, "strict-endpoints", false, "fail rather than warn if an offer has more than one endpoint of the same name")
+	f.BoolVar(&c.compact, "compact", false, "omit empty fields from yaml and json output")
+	f.BoolVar(&c.structuredErrors, "structured-errors", false, "write errors to stderr in the output format (yaml|json) rather than as text")
+	f.BoolVar(&c.watch, "watch", false, "stream changes to the matching offers as json events until interrupted")
+	f.DurationVar(&c.pollInterval, "poll-interval", defaultPollInterval, "how often to query for changes when watching is not supported")
+	f.BoolVar(&c.cached, "cached", false, "answer the query from offers fetched earlier in this process, where possible")
+	f.BoolVar(&c.explainMatches, "explain-matches", false, "annotate each result with the filter terms it matched")
 	c.out.AddFlags(f, "tabular", map[string]cmd.Formatter{
 		"yaml":    cmd.FormatYaml,
 		"json":    cmd.FormatJson,
-		"tabular": formatFindTabular,
+		"tabular": c.formatTabular,
+		"dot":     formatFindDot,
+		"matrix":  formatFindMatrix,
+		"env":     formatFindEnv,
 	})
+	c.outputFlag = f.Lookup("output")
+	f.BoolVar(&c.summaryToStdout, "summary-to-stdout", false, "with --output, print the number of results written to the file")
+}
+
+// formatTabular writes the results in tabular form, in the requested order.
+func (c *findCommand) formatTabular(writer io.Writer, value interface{}) error {
+	switch value := value.(type) {
+	case map[string]map[string]ApplicationOfferResult:
+		return formatGroupedTabular(writer, c.groupBy, value, c.showRelations, c.showVersion)
+	case map[string]int:
+		return formatCountsTabular(writer, value)
+	case []FoundSource:
+		return formatSourcesTabular(writer, value)
+	case offerHistogram:
+		return formatHistogramTabular(writer, value)
+	case []PlanStep:
+		return formatPlanTabular(writer, value)
+	case timedResults:
+		return c.formatTimedTabular(writer, value)
+	}
+	return formatFindTabular(writer, value, c.showRelations, c.showVersion)
 }
 
 // Run implements Command.Run.
-func (c *findCommand) Run(ctx *cmd.Context) (err error) {
-	if err := c.validateOrSetURL(); err != nil {
-		return errors.Trace(err)
+func (c *findCommand) Run(ctx *cmd.Context) error {
+	err := c.run(ctx)
+	if err == nil || !c.structuredErrors {
+		return err
 	}
-	api, err := c.newAPIFunc(c.source)
-	if err != nil {
+	if writeErr := c.writeStructuredError(ctx, err); writeErr != nil {
+		logger.Errorf("cannot write structured error: %v", writeErr)
 		return err
 	}
-	defer api.Close()
+	// The error has been reported, so there is no need to print it.
+	return cmd.ErrSilent
+}
 
+// run finds the offers and writes the results.
+func (c *findCommand) run(ctx *cmd.Context) (err error) {
+	if c.filterFile.Path != "" {
+		terms, err := c.readFilterFile(ctx)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if err := c.applyFilterTerms(terms); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if err := c.validateOrSetURL(); err != nil {
+		return errors.Trace(err)
+	}
+	if len(c.models) > 0 && (c.modelOwnerName != "" || c.modelName != "" || c.offerName != "") {
+		return errors.New("--model cannot be used with a URL naming a model or offer")
+	}
 	filter := crossmodel.ApplicationOfferFilter{
-		OwnerName: c.modelOwnerName,
-		ModelName: c.modelName,
-		OfferName: c.offerName,
+		OwnerName:    c.modelOwnerName,
+		ModelName:    c.modelName,
+		OfferName:    c.offerName,
+		IncludeUsers: c.showUsers,
 		// TODO(wallyworld): interface
 		// TODO(wallyworld): endpoint
 	}
-	if c.interfaceName != "" || c.endpoint != "" {
+	if c.matchBothRoles {
+		filter.Endpoints = []crossmodel.EndpointFilterTerm{{
+			Interface: c.interfaceName,
+			Name:      c.endpoint,
+			Role:      charm.RoleProvider,
+		}, {
+			Interface: c.interfaceName,
+			Name:      c.endpoint,
+			Role:      charm.RoleRequirer,
+		}}
+	} else if c.interfacesFile != "" {
+		interfaces, err := readInterfacesFile(c.interfacesFile)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		for _, name := range interfaces {
+			filter.Endpoints = append(filter.Endpoints, crossmodel.EndpointFilterTerm{
+				Interface: name,
+				Name:      c.endpoint,
+			})
+		}
+	} else if c.interfaceName != "" || c.endpoint != "" {
 		filter.Endpoints = []crossmodel.EndpointFilterTerm{{
 			Interface: c.interfaceName,
 			Name:      c.endpoint,
 		}}
 	}
-	found, err := api.FindApplicationOffers(filter)
-	if err != nil {
-		return err
+	if c.whereExpr != nil {
+		applyWhereFilter(c.whereExpr, &filter)
 	}
-
-	output, err := convertFoundOffers(c.source, found...)
+	for _, term := range filter.Endpoints {
+		if err := term.Validate(); err != nil {
+			return errors.Annotate(err, "invalid endpoint filter")
+		}
+	}
+	if c.matchBothRoles || c.interfacesFile != "" || c.explainMatches {
+		c.endpointTerms = filter.Endpoints
+	}
+	if c.ignoreCase {
+		// Names are matched exactly by the controller,
+		// so are instead compared once the offers are found.
+		filter.OwnerName, filter.ModelName, filter.OfferName = "", "", ""
+	}
+	if c.watch {
+		return c.watchOffers(ctx, filter)
+	}
+	output, err := c.findModelOffers(filter)
 	if err != nil {
 		return err
 	}
+	if err := c.filterOffers(ctx, output); err != nil {
+		return errors.Trace(err)
+	}
+	if c.consumed || c.notConsumed {
+		if err := c.filterConsumed(output); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if c.expectMin > 0 {
+		fmt.Fprintln(ctx.Stdout, len(output))
+		if len(output) < c.expectMin {
+			return errors.Errorf("found %d matching offers, expected at least %d", len(output), c.expectMin)
+		}
+		return nil
+	}
 	if len(output) == 0 {
+		if c.out.Name() == "env" {
+			// There are no variables to export.
+			return nil
+		}
 		return errors.New("no matching application offers found")
 	}
-	return c.out.Write(ctx, output)
+	if err := c.filterUsers(output); err != nil {
+		return errors.Trace(err)
+	}
+	c.filterAPIAddresses(output)
+	c.matchedOffers = len(output)
+	if c.listEndpointsRole != "" {
+		endpoints := flattenEndpoints(output, c.listEndpointsRole)
+		if len(endpoints) == 0 {
+			return errors.Errorf("no matching %s endpoints found", c.listEndpointsRole)
+		}
+		return c.write(ctx, endpoints)
+	}
+	if c.listSources {
+		sources, err := offerSources(output)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		return c.write(ctx, sources)
+	}
+	if c.countBy == countByModel {
+		counts, err := countOffersByModel(output)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		return c.write(ctx, counts)
+	}
+	if c.histogram == histogramByInterface {
+		return c.write(ctx, interfaceHistogram(output))
+	}
+	if c.planValue != "" {
+		steps, err := consumePlan(output, c.plan)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		return c.write(ctx, steps)
+	}
+	if c.explainMatches {
+		explainMatches(output, filter.Endpoints)
+	}
+	if c.showCapacity {
+		setCapacities(output)
+	}
+	if c.showRelations {
+		setRelationCounts(output)
+	}
+	if c.showUsage {
+		setUsage(output)
+	}
+	if c.groupBy == groupByApplication {
+		return c.writeGroups(ctx, groupOffersByApplication(output))
+	}
+	if c.compact {
+		return c.write(ctx, compactOfferResults(output))
+	}
+	return c.write(ctx, output)
+}
+
+// findAllOffers queries each source for offers matching
+// any of the filters and merges the results.
+func (c *findCommand) findAllOffers(filters ...crossmodel.ApplicationOfferFilter) (map[string]ApplicationOfferResult, error) {
+	var allFound []map[string]ApplicationOfferResult
+	for _, source := range c.sources {
+		if c.cloudName != "" {
+			if err := c.validateCloud(source); err != nil {
+				return nil, errors.Trace(err)
+			}
+		}
+		var (
+			found map[string]ApplicationOfferResult
+			err   error
+		)
+		if c.cached {
+			found, err = c.findCachedOffers(source, filters...)
+		} else {
+			found, err = c.findOffers(source, filters...)
+		}
+		if err != nil {
+			return nil, err
+		}
+		allFound = append(allFound, found)
+	}
+	return MergeOfferResults(allFound...), nil
+}
+
+// filterOffers removes the offers not matching
+// the filters which are applied on the client.
+func (c *findCommand) filterOffers(ctx *cmd.Context, output map[string]ApplicationOfferResult) error {
+	if c.ignoreCase {
+		filterNamesIgnoringCase(c.modelOwnerName, c.modelName, c.offerName, output)
+	}
+	if c.urlRegexp != nil {
+		filterURLPattern(c.urlRegexp, output)
+	}
+	if len(c.endpointTerms) > 0 {
+		filterEndpointTerms(c.endpointTerms, output)
+	}
+	if c.endpointRegexp != nil {
+		filterEndpointPattern(c.endpointRegexp, output)
+	}
+	if c.compatibleInterface != "" {
+		filterCompatible(c.compatibleInterface, c.compatibleRole, output)
+	}
+	if c.provides != "" {
+		filterEndpointRole(c.provides, charm.RoleProvider, output)
+	}
+	if c.requires != "" {
+		filterEndpointRole(c.requires, charm.RoleRequirer, output)
+	}
+	if len(c.allDistinctInterfaces) > 0 {
+		filterAllDistinct(c.allDistinctInterfaces, output)
+	}
+	if c.consumableBy != "" {
+		if interfaces, err := requiredInterfaces(c.consumableBy); err != nil {
+			ctx.Infof("WARNING: not filtering by --consumable-by: %v", err)
+		} else {
+			filterConsumable(interfaces, output)
+		}
+	}
+	if c.minEndpoints > 0 {
+		filterMinEndpoints(c.minEndpoints, output)
+	}
+	if c.whereExpr != nil {
+		if err := filterWhere(c.whereExpr, output); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	return nil
+}
+
+// filterConsumed marks each offer with whether it is consumed by the
+// current model, and removes those not matching --consumed or
+// --not-consumed.
+func (c *findCommand) filterConsumed(results map[string]ApplicationOfferResult) error {
+	consumed, err := c.consumedOfferURLs()
+	if err != nil {
+		return errors.Annotate(err, "finding offers consumed by the current model")
+	}
+	for url, result := range results {
+		result.Consumed = consumed[url]
+		if result.Consumed != c.consumed {
+			delete(results, url)
+			continue
+		}
+		results[url] = result
+	}
+	return nil
+}
+
+// consumedOfferURLs returns the URLs of the offers consumed by the
+// current model, including the controller hosting each offer.
+func (c *findCommand) consumedOfferURLs() (map[string]bool, error) {
+	controllerName, err := c.ControllerName()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	api, err := c.newStatusAPIFunc(controllerName)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer api.Close()
+	status, err := api.Status(nil)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	consumed := make(map[string]bool)
+	for _, app := range status.RemoteApplications {
+		url, err := crossmodel.ParseApplicationURL(app.ApplicationURL)
+		if err != nil {
+			logger.Debugf("ignoring remote application %q: %v", app.ApplicationName, err)
+			continue
+		}
+		// Offers hosted by the current controller may
+		// be recorded without the controller name.
+		if url.Source == "" {
+			url.Source = controllerName
+		}
+		consumed[url.String()] = true
+	}
+	return consumed, nil
+}
+
+// writeGroups writes the offers grouped by application.
+func (c *findCommand) writeGroups(ctx *cmd.Context, groups map[string]map[string]ApplicationOfferResult) error {
+	if !c.compact {
+		return c.write(ctx, groups)
+	}
+	compact := make(map[string]map[string]compactOfferResult, len(groups))
+	for name, group := range groups {
+		compact[name] = compactOfferResults(group)
+	}
+	return c.write(ctx, compact)
+}
+
+// filterUsers ensures offer users are only included in the results
+// when requested, and that the user is an admin of each such offer.
+func (c *findCommand) filterUsers(results map[string]ApplicationOfferResult) error {
+	for url, result := range results {
+		if !c.showUsers {
+			result.Users = nil
+			results[url] = result
+			continue
+		}
+		if result.Access != string(permission.AdminAccess) {
+			return errors.Errorf("--show-users requires admin access to offer %q", url)
+		}
+	}
+	return nil
+}
+
+// filterAPIAddresses ensures the API addresses of the controller hosting
+// each offer are only included in the results when requested. Where the
+// controller did not report them, the addresses recorded in the client
+// store for the offer's source are used, if any.
+func (c *findCommand) filterAPIAddresses(results map[string]ApplicationOfferResult) {
+	for url, result := range results {
+		switch {
+		case !c.showAPIAddrs:
+			result.APIAddresses = nil
+		case len(result.APIAddresses) == 0:
+			result.APIAddresses = c.storeAPIAddresses(url)
+		}
+		results[url] = result
+	}
+}
+
+// storeAPIAddresses returns the API addresses recorded in the client
+// store for the controller hosting the offer with the specified URL.
+func (c *findCommand) storeAPIAddresses(offerURL string) []string {
+	url, err := crossmodel.ParseApplicationURL(offerURL)
+	if err != nil || url.Source == "" {
+		return nil
+	}
+	details, err := c.ClientStore().ControllerByName(url.Source)
+	if err != nil {
+		logger.Debugf("no API addresses for controller %q: %v", url.Source, err)
+		return nil
+	}
+	return details.APIEndpoints
+}
+
+// parseCompatibleWith parses the --compatible-with value,
+// which is of the form <interface>:<role>.
+func (c *findCommand) parseCompatibleWith() error {
+	parts := strings.Split(c.compatibleWith, ":")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return errors.Errorf("invalid --compatible-with %q, expected <interface>:<role>", c.compatibleWith)
+	}
+	switch charm.RelationRole(parts[1]) {
+	case charm.RoleProvider, charm.RoleRequirer, charm.RolePeer:
+	default:
+		return errors.Errorf("invalid --compatible-with role %q, expected provider, requirer or peer", parts[1])
+	}
+	c.compatibleInterface, c.compatibleRole = parts[0], parts[1]
+	return nil
+}
+
+// filterCompatible removes any results without an endpoint able to
+// relate to an endpoint of the specified interface and role.
+func filterCompatible(interfaceName, role string, results map[string]ApplicationOfferResult) {
+	for url, result := range results {
+		compatible := false
+		for _, ep := range result.Endpoints {
+			if CheckInterfaceCompatible(ep, interfaceName, role) == nil {
+				compatible = true
+				break
+			}
+		}
+		if !compatible {
+			delete(results, url)
+		}
+	}
+}
+
+// filterEndpointTerms removes any results with no
+// endpoint satisfying one of the terms.
+func filterEndpointTerms(terms []crossmodel.EndpointFilterTerm, results map[string]ApplicationOfferResult) {
+	for url, result := range results {
+		found := false
+		for _, term := range terms {
+			if offerMatchesTerm(result, term) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			delete(results, url)
+		}
+	}
+}
+
+// filterEndpointRole removes any results without an
+// endpoint of the specified interface and role.
+func filterEndpointRole(interfaceName string, role charm.RelationRole, results map[string]ApplicationOfferResult) {
+	for url, result := range results {
+		found := false
+		for _, ep := range result.Endpoints {
+			if ep.Interface == interfaceName && ep.Role == string(role) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			delete(results, url)
+		}
+	}
+}
+
+// parseInterfaceList returns the interface names
+// in the comma separated list.
+func parseInterfaceList(list string) ([]string, error) {
+	var interfaces []string
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, errors.Errorf("empty interface name in %q", list)
+		}
+		interfaces = append(interfaces, name)
+	}
+	return interfaces, nil
+}
+
+// filterAllDistinct removes the results which do not expose each of
+// the interfaces on a separate endpoint. An interface listed more than
+// once must be exposed by as many endpoints.
+func filterAllDistinct(interfaces []string, results map[string]ApplicationOfferResult) {
+	needed := make(map[string]int)
+	for _, name := range interfaces {
+		needed[name]++
+	}
+	for url, result := range results {
+		exposed := make(map[string]int)
+		for _, ep := range result.Endpoints {
+			exposed[ep.Interface]++
+		}
+		for name, count := range needed {
+			if exposed[name] < count {
+				delete(results, url)
+				break
+			}
+		}
+	}
+}
+
+// FoundEndpoint is an endpoint of an offer, as listed by --list-endpoints.
+type FoundEndpoint struct {
+	// URL is the URL of the offer.
+	URL string `yaml:"url" json:"url"`
+
+	// Endpoint is the name of the endpoint.
+	Endpoint string `yaml:"endpoint" json:"endpoint"`
+
+	// Interface is the relation interface of the endpoint.
+	Interface string `yaml:"interface" json:"interface"`
+}
+
+// flattenEndpoints returns the endpoints of the specified role
+// across all the results, ordered by offer URL and endpoint name.
+func flattenEndpoints(results map[string]ApplicationOfferResult, role string) []FoundEndpoint {
+	endpoints := []FoundEndpoint{}
+	for _, url := range OfferURLs(results) {
+		names := []string{}
+		for name, ep := range results[url].Endpoints {
+			if ep.Role == role {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			endpoints = append(endpoints, FoundEndpoint{
+				URL:       url,
+				Endpoint:  name,
+				Interface: results[url].Endpoints[name].Interface,
+			})
+		}
+	}
+	return endpoints
+}
+
+// setCapacities records the remaining capacity
+// of each endpoint of the results.
+func setCapacities(results map[string]ApplicationOfferResult) {
+	for _, result := range results {
+		for name, ep := range result.Endpoints {
+			ep.Capacity = ep.capacity()
+			result.Endpoints[name] = ep
+		}
+	}
+}
+
+// setRelationCounts records the number of relations using each
+// endpoint of the results, where the controller reported it.
+func setRelationCounts(results map[string]ApplicationOfferResult) {
+	for _, result := range results {
+		for name, ep := range result.Endpoints {
+			ep.RelationCount = ep.connectedCount
+			result.Endpoints[name] = ep
+		}
+	}
+}
+
+// setUsage sets the commands to consume and relate to each offer.
+func setUsage(results map[string]ApplicationOfferResult) {
+	for url, result := range results {
+		result.Usage = offerUsage(url, result)
+		results[url] = result
+	}
+}
+
+// offerUsage returns the commands to consume the offer with the
+// specified canonical URL, and to relate an application to it. Once
+// consumed, the offer is known in the consuming model by its name.
+func offerUsage(offerURL string, result ApplicationOfferResult) *OfferUsage {
+	relateTo := offerURL
+	if url, err := crossmodel.ParseApplicationURL(offerURL); err == nil {
+		relateTo = url.ApplicationName
+	}
+	if len(result.Endpoints) > 0 {
+		names := make([]string, 0, len(result.Endpoints))
+		for name := range result.Endpoints {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		relateTo += ":" + names[0]
+	}
+	return &OfferUsage{
+		Consume: fmt.Sprintf("juju consume %s", offerURL),
+		Relate:  fmt.Sprintf("juju relate <application> %s", relateTo),
+	}
+}
+
+// foldOfferURL returns the URL with all but any controller name in
+// lower case, so that names entered in any case may be parsed.
+func foldOfferURL(url string) string {
+	folded := strings.ToLower(url)
+	parts, err := crossmodel.ParseApplicationURLParts(folded)
+	if err != nil || parts.Source == "" {
+		return folded
+	}
+	return url[:len(parts.Source)] + folded[len(parts.Source):]
+}
+
+// filterNamesIgnoringCase removes any results whose owner, model or
+// offer name differs from those specified, other than in case. Empty
+// names match any result.
+func filterNamesIgnoringCase(owner, model, offer string, results map[string]ApplicationOfferResult) {
+	matches := func(want, got string) bool {
+		return want == "" || strings.EqualFold(want, got)
+	}
+	for url := range results {
+		offerURL, err := crossmodel.ParseApplicationURL(url)
+		if err != nil {
+			continue
+		}
+		if !matches(owner, offerURL.User) || !matches(model, offerURL.ModelName) || !matches(offer, offerURL.ApplicationName) {
+			delete(results, url)
+		}
+	}
+}
+
+// filterMinEndpoints removes any results with fewer than
+// the specified number of endpoints.
+func filterMinEndpoints(min int, results map[string]ApplicationOfferResult) {
+	for url, result := range results {
+		if len(result.Endpoints) < min {
+			delete(results, url)
+		}
+	}
+}
+
+// requiredInterfaces returns the interfaces required
+// by the charm at the specified path.
+func requiredInterfaces(charmPath string) ([]string, error) {
+	ch, err := charm.ReadCharm(charmPath)
+	if err != nil {
+		return nil, errors.Annotatef(err, "cannot read charm %q", charmPath)
+	}
+	var interfaces []string
+	for _, relation := range ch.Meta().Requires {
+		interfaces = append(interfaces, relation.Interface)
+	}
+	return interfaces, nil
+}
+
+// filterConsumable removes any results without an endpoint able
+// to relate to a requirer of one of the specified interfaces.
+func filterConsumable(interfaces []string, results map[string]ApplicationOfferResult) {
+	for url, result := range results {
+		consumable := false
+		for _, ep := range result.Endpoints {
+			for _, interfaceName := range interfaces {
+				if CheckInterfaceCompatible(ep, interfaceName, string(charm.RoleRequirer)) == nil {
+					consumable = true
+				}
+			}
+		}
+		if !consumable {
+			delete(results, url)
+		}
+	}
+}
+
+// filterURLPattern removes any results whose full
+// URL, including the store, does not match the pattern.
+func filterURLPattern(pattern *regexp.Regexp, results map[string]ApplicationOfferResult) {
+	for url := range results {
+		if !pattern.MatchString(url) {
+			delete(results, url)
+		}
+	}
+}
+
+// filterEndpointPattern removes any results without an endpoint
+// whose name matches the pattern.
+func filterEndpointPattern(pattern *regexp.Regexp, results map[string]ApplicationOfferResult) {
+	for url, result := range results {
+		matched := false
+		for name := range result.Endpoints {
+			if pattern.MatchString(name) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			delete(results, url)
+		}
+	}
+}
+
+// findOffers queries the specified source for
+// offers matching any of the filters.
+func (c *findCommand) findOffers(source string, filters ...crossmodel.ApplicationOfferFilter) (map[string]ApplicationOfferResult, error) {
+	api, err := c.newAPIFunc(source)
+	if err != nil {
+		return nil, err
+	}
+	defer api.Close()
+
+	started := c.startTiming()
+	found, err := api.FindApplicationOffers(filters...)
+	if err != nil {
+		return nil, err
+	}
+	c.recordTiming(source, started)
+	if err := c.checkEndpointNames(found); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return convertFoundOffers(source, c.filterCloud(found)...)
+}
+
+// checkEndpointNames logs a warning for each offer with more than one
+// endpoint of the same name, as only the last of them is shown. With
+// --strict-endpoints, such an offer is instead an error.
+func (c *findCommand) checkEndpointNames(offers []params.ApplicationOffer) error {
+	for _, offer := range offers {
+		names := duplicateEndpointNames(offer.Endpoints...)
+		if len(names) == 0 {
+			continue
+		}
+		if c.strictEndpoint {
+			return errors.Errorf("offer %q has duplicate endpoints %s", offer.OfferURL, strings.Join(names, ", "))
+		}
+		logger.Warningf("offer %q has duplicate endpoints %s, showing only the last of each", offer.OfferURL, strings.Join(names, ", "))
+	}
+	return nil
+}
+
+// filterCloud returns the offers whose models are on
+// the requested cloud and region, if any.
+func (c *findCommand) filterCloud(offers []params.ApplicationOffer) []params.ApplicationOffer {
+	if c.cloudName == "" {
+		return offers
+	}
+	var result []params.ApplicationOffer
+	for _, offer := range offers {
+		if offer.CloudName != c.cloudName {
+			continue
+		}
+		if c.cloudRegion != "" && offer.CloudRegion != c.cloudRegion {
+			continue
+		}
+		result = append(result, offer)
+	}
+	return result
+}
+
+// validateCloud ensures the requested cloud, and region if
+// specified, are known to the controller.
+func (c *findCommand) validateCloud(controllerName string) error {
+	api, err := c.newCloudAPIFunc(controllerName)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	defer api.Close()
+
+	clouds, err := api.Clouds()
+	if err != nil {
+		return errors.Trace(err)
+	}
+	cloud, ok := clouds[names.NewCloudTag(c.cloudName)]
+	if !ok {
+		return errors.NotFoundf("cloud %q on controller %q", c.cloudName, controllerName)
+	}
+	if c.cloudRegion == "" {
+		return nil
+	}
+	for _, region := range cloud.Regions {
+		if region.Name == c.cloudRegion {
+			return nil
+		}
+	}
+	return errors.NotFoundf("region %q in cloud %q", c.cloudRegion, c.cloudName)
+}
+
+// resolveSourceGroup returns the controller names belonging to the
+// configured source group.
+func (c *findCommand) resolveSourceGroup() ([]string, error) {
+	file := c.sourceGroupFile
+	if file == "" {
+		file = jujuclient.JujuSourceGroupsPath()
+	}
+	groups, err := jujuclient.ReadSourceGroupsFile(file)
+	if err != nil {
+		return nil, errors.Annotatef(err, "reading source groups from %q", file)
+	}
+	sources, ok := groups[c.sourceGroup]
+	if !ok {
+		return nil, errors.NotFoundf("source group %q in %q", c.sourceGroup, file)
+	}
+	if len(sources) == 0 {
+		return nil, errors.Errorf("source group %q has no controllers", c.sourceGroup)
+	}
+	return sources, nil
 }
 
 func (c *findCommand) validateOrSetURL() error {
+	if c.noResolve {
+		return c.setVerbatimURL()
+	}
 	controllerName, err := c.ControllerName()
 	if err != nil {
 		return errors.Trace(err)
 	}
+	if c.sourceGroup != "" {
+		if c.sources, err = c.resolveSourceGroup(); err != nil {
+			return errors.Trace(err)
+		}
+	}
+	if c.bareOfferName {
+		if c.strictURL {
+			return errors.Errorf("URL %q does not specify a user, required with --strict-url", c.url)
+		}
+		if c.url, err = ResolveOfferURL(c.ClientStore(), c.url); err != nil {
+			return errors.Trace(err)
+		}
+	}
 	if c.url == "" {
 		c.url = controllerName + ":"
 		c.source = controllerName
+		c.setDefaultSources()
 		return nil
 	}
 	urlParts, err := crossmodel.ParseApplicationURLParts(c.url)
@@ -151,11 +1377,23 @@ func (c *findCommand) validateOrSetURL() error {
 		return errors.Trace(err)
 	}
 	if urlParts.Source != "" {
+		if c.sourceGroup != "" {
+			return errors.New("cannot specify both a source group and a URL source")
+		}
 		c.source = urlParts.Source
 	} else {
 		c.source = controllerName
 	}
+	if urlParts.User == "" && urlParts.ModelName == "" && urlParts.ApplicationName == "" {
+		// A URL naming only a controller, eg "mycontroller:",
+		// finds the offers in all models on that controller.
+		c.setDefaultSources()
+		return nil
+	}
 	user := urlParts.User
+	if user == "" && c.strictURL {
+		return errors.Errorf("URL %q does not specify a user, required with --strict-url", c.url)
+	}
 	if user == "" {
 		accountDetails, err := c.CurrentAccountDetails()
 		if err != nil {
@@ -166,27 +1404,146 @@ func (c *findCommand) validateOrSetURL() error {
 	c.modelOwnerName = user
 	c.modelName = urlParts.ModelName
 	c.offerName = urlParts.ApplicationName
+	c.setDefaultSources()
 	return nil
 }
 
+// setVerbatimURL sets the source and filter terms from the URL
+// without reference to the current controller or user, returning
+// an error if the URL does not fully specify them.
+func (c *findCommand) setVerbatimURL() error {
+	if c.url == "" {
+		return errors.New("--no-resolve requires a URL")
+	}
+	if c.sourceGroup != "" {
+		return errors.New("cannot specify both --no-resolve and a source group")
+	}
+	urlParts, err := crossmodel.ParseApplicationURLParts(c.url)
+	if err != nil {
+		return errors.Trace(err)
+	}
+	if urlParts.Source == "" {
+		return errors.Errorf("URL %q does not specify a controller, required with --no-resolve", c.url)
+	}
+	controllerOnly := urlParts.User == "" && urlParts.ModelName == "" && urlParts.ApplicationName == ""
+	if !controllerOnly && (urlParts.User == "" || urlParts.ModelName == "") {
+		return errors.Errorf("URL %q does not specify a model owner and model, required with --no-resolve", c.url)
+	}
+	c.source = urlParts.Source
+	c.modelOwnerName = urlParts.User
+	c.modelName = urlParts.ModelName
+	c.offerName = urlParts.ApplicationName
+	c.setDefaultSources()
+	return nil
+}
+
+// ResolveOfferURL returns the URL of the offer with the specified
+// name in the current model of the current controller.
+func ResolveOfferURL(store jujuclient.ClientStore, name string) (string, error) {
+	if !names.IsValidApplication(name) {
+		return "", errors.NotValidf("offer name %q", name)
+	}
+	controllerName, err := store.CurrentController()
+	if err != nil {
+		return "", errors.Annotatef(err, "resolving offer %q", name)
+	}
+	modelName, err := store.CurrentModel(controllerName)
+	if err != nil {
+		return "", errors.Annotatef(err, "resolving offer %q", name)
+	}
+	if !jujuclient.IsQualifiedModelName(modelName) {
+		accountDetails, err := store.AccountDetails(controllerName)
+		if err != nil {
+			return "", errors.Annotatef(err, "resolving offer %q", name)
+		}
+		modelName = jujuclient.JoinOwnerModelName(names.NewUserTag(accountDetails.User), modelName)
+	}
+	return fmt.Sprintf("%s:%s.%s", controllerName, modelName, name), nil
+}
+
+// setDefaultSources queries only the source from the URL,
+// unless a source group has been specified.
+func (c *findCommand) setDefaultSources() {
+	if len(c.sources) == 0 {
+		c.sources = []string{c.source}
+	}
+}
+
 // FindAPI defines the API methods that cross model find command uses.
 type FindAPI interface {
 	Close() error
 	FindApplicationOffers(filters ...crossmodel.ApplicationOfferFilter) ([]params.ApplicationOffer, error)
 }
 
+// CloudAPI defines the cloud API methods that cross model find command uses.
+type CloudAPI interface {
+	Close() error
+	Clouds() (map[names.CloudTag]jujucloud.Cloud, error)
+}
+
+// StatusAPI defines the API methods that cross model find command
+// uses to find the offers consumed by the current model.
+type StatusAPI interface {
+	Close() error
+	Status(patterns []string) (*params.FullStatus, error)
+}
+
 // ApplicationOfferResult defines the serialization behaviour of an application offer.
 // This is used in map-style yaml output where remote application URL is the key.
 type ApplicationOfferResult struct {
 	// Access is the level of access the user has on the offer.
 	Access string `yaml:"access" json:"access"`
 
+	// ApplicationName is the name of the application being offered.
+	// It is only known to offer admins.
+	ApplicationName string `yaml:"application,omitempty" json:"application,omitempty"`
+
 	// Endpoints is the list of offered application endpoints.
 	Endpoints map[string]RemoteEndpoint `yaml:"endpoints" json:"endpoints"`
+
+	// Users is the access level of each user on the offer.
+	// It is only populated for admins when requested.
+	Users map[string]string `yaml:"users,omitempty" json:"users,omitempty"`
+
+	// APIAddresses holds the API addresses of the controller hosting
+	// the offer. It is only populated on request, where known.
+	APIAddresses []string `yaml:"api-addresses,omitempty" json:"api-addresses,omitempty"`
+
+	// Remote is true if the offer is hosted by a controller other
+	// than the one which was queried.
+	Remote bool `yaml:"remote,omitempty" json:"remote,omitempty"`
+
+	// Consumed is true if the offer is consumed by the current
+	// model. It is only populated on request.
+	Consumed bool `yaml:"consumed,omitempty" json:"consumed,omitempty"`
+
+	// MatchedBy holds the filter terms satisfied by the offer.
+	// It is only populated when explaining matches.
+	MatchedBy []string `yaml:"matched-by,omitempty" json:"matched-by,omitempty"`
+
+	// Usage holds sample commands for using the offer.
+	// It is only populated on request.
+	Usage *OfferUsage `yaml:"usage,omitempty" json:"usage,omitempty"`
+
+	// ControllerVersion is the Juju version of the controller
+	// hosting the offer, where it is known.
+	ControllerVersion string `yaml:"controller-version,omitempty" json:"controller-version,omitempty"`
+}
+
+// OfferUsage holds sample commands for using an offer.
+type OfferUsage struct {
+	// Consume is the command to consume the offer.
+	Consume string `yaml:"consume" json:"consume"`
+
+	// Relate is the command to relate an application
+	// to the offer once it has been consumed.
+	Relate string `yaml:"relate" json:"relate"`
 }
 
 // convertFoundOffers takes any number of api-formatted remote applications and
-// creates a collection of ui-formatted applications.
+// creates a collection of ui-formatted applications. Offers without a source
+// are hosted by the queried store; those whose source is another controller
+// keep that source and are marked as remote.
 func convertFoundOffers(store string, offers ...params.ApplicationOffer) (map[string]ApplicationOfferResult, error) {
 	if len(offers) == 0 {
 		return nil, nil
@@ -194,17 +1551,160 @@ func convertFoundOffers(store string, offers ...params.ApplicationOffer) (map[st
 	output := make(map[string]ApplicationOfferResult, len(offers))
 	for _, one := range offers {
 		app := ApplicationOfferResult{
-			Access:    one.Access,
-			Endpoints: convertRemoteEndpoints(one.Endpoints...),
+			Access:          one.Access,
+			ApplicationName: one.ApplicationName,
+			Endpoints:       convertRemoteEndpoints(one.Endpoints...),
+			Users:           convertOfferUsers(one.Users...),
+			APIAddresses:    one.APIAddresses,
+
+			ControllerVersion: one.ControllerVersion,
+		}
+		markPassThrough(app.Endpoints)
+		// Offers are keyed by canonical URL, so that differently
+		// formatted URLs for the same offer are not shown twice.
+		canonical, err := crossmodel.CanonicalOfferURL(one.OfferURL)
+		if err != nil {
+			return nil, err
 		}
-		url, err := crossmodel.ParseApplicationURL(one.OfferURL)
+		url, err := crossmodel.ParseApplicationURL(canonical)
 		if err != nil {
 			return nil, err
 		}
 		if url.Source == "" {
 			url.Source = store
 		}
+		app.Remote = url.Source != store
+		if _, ok := output[url.String()]; ok {
+			logger.Debugf("offer %q found more than once, showing only the last", url)
+		}
 		output[url.String()] = app
 	}
 	return output, nil
 }
+
+// MergeOfferResults merges the result maps by URL. Where the same URL
+// appears in more than one map, the endpoints are combined and the
+// highest access level is used. The maps passed in are not modified.
+func MergeOfferResults(maps ...map[string]ApplicationOfferResult) map[string]ApplicationOfferResult {
+	result := make(map[string]ApplicationOfferResult)
+	for _, m := range maps {
+		for url, offer := range m {
+			existing, ok := result[url]
+			if !ok {
+				offer.Endpoints = mergeEndpoints(nil, offer.Endpoints)
+				result[url] = offer
+				continue
+			}
+			logger.Debugf("merging duplicate results for offer %q", url)
+			existing.Endpoints = mergeEndpoints(existing.Endpoints, offer.Endpoints)
+			access := permission.Access(offer.Access)
+			if access.GreaterOfferAccessThan(permission.Access(existing.Access)) {
+				existing.Access = offer.Access
+			}
+			result[url] = existing
+		}
+	}
+	return result
+}
+
+// OfferURLs returns the URLs of the results, sorted. The results are
+// keyed by canonical offer URL, as returned by find-endpoints.
+func OfferURLs(results map[string]ApplicationOfferResult) []string {
+	urls := make([]string, 0, len(results))
+	for url := range results {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+	return urls
+}
+
+// mergeEndpoints returns a new map holding the endpoints in both maps,
+// flagging any interface they provide and require as a pass-through.
+func mergeEndpoints(a, b map[string]RemoteEndpoint) map[string]RemoteEndpoint {
+	if len(a) == 0 && len(b) == 0 {
+		return nil
+	}
+	result := make(map[string]RemoteEndpoint, len(a)+len(b))
+	for name, ep := range a {
+		result[name] = ep
+	}
+	for name, ep := range b {
+		result[name] = ep
+	}
+	markPassThrough(result)
+	return result
+}
+
+// convertOfferUsers takes any number of api-formatted offer users and
+// creates a map of user name to access level.
+func convertOfferUsers(users ...params.OfferUserDetails) map[string]string {
+	if len(users) == 0 {
+		return nil
+	}
+	output := make(map[string]string, len(users))
+	for _, one := range users {
+		output[one.UserName] = one.Access
+	}
+	return output
+}
+
+// explainMatches annotates each result with the endpoint filter
+// terms it satisfied, eg "interface=mysql" or "endpoint=db". The
+// results not satisfying any term have already been removed.
+func explainMatches(results map[string]ApplicationOfferResult, terms []crossmodel.EndpointFilterTerm) {
+	for url, result := range results {
+		var matchedBy []string
+		for _, term := range terms {
+			matchedBy = append(matchedBy, endpointTermMatches(term, result.Endpoints)...)
+		}
+		result.MatchedBy = matchedBy
+		results[url] = result
+	}
+}
+
+// endpointTermMatches returns a description of each part of the
+// filter term satisfied by any of the specified endpoints. If the
+// term has a role, only endpoints with that role are considered.
+func endpointTermMatches(term crossmodel.EndpointFilterTerm, endpoints map[string]RemoteEndpoint) []string {
+	var matched []string
+	if ep, ok := endpoints[term.Name]; ok && term.Name != "" && roleMatches(term, ep) {
+		matched = append(matched, fmt.Sprintf("endpoint=%s", term.Name))
+	}
+	if term.Interface != "" {
+		for _, ep := range endpoints {
+			if ep.Interface == term.Interface && roleMatches(term, ep) {
+				matched = append(matched, fmt.Sprintf("interface=%s", term.Interface))
+				break
+			}
+		}
+	}
+	if len(matched) > 0 && term.Role != "" {
+		matched = append(matched, fmt.Sprintf("role=%s", term.Role))
+	}
+	return matched
+}
+
+func roleMatches(term crossmodel.EndpointFilterTerm, ep RemoteEndpoint) bool {
+	return term.Role == "" || string(term.Role) == ep.Role
+}
+
+// readInterfacesFile returns the interface names listed one per line
+// in the file, ignoring blank lines and comments starting with "#".
+func readInterfacesFile(path string) ([]string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Annotate(err, "reading interfaces file")
+	}
+	var interfaces []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		interfaces = append(interfaces, line)
+	}
+	if len(interfaces) == 0 {
+		return nil, errors.Errorf("no interfaces listed in %q", path)
+	}
+	return interfaces, nil
+}
@@ -5,17 +5,25 @@ package crossmodel_test
 
 import (
 	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/juju/cmd"
 	"github.com/juju/cmd/cmdtesting"
 	"github.com/juju/errors"
+	"github.com/juju/testing"
 	jc "github.com/juju/testing/checkers"
 	gc "gopkg.in/check.v1"
 	"gopkg.in/juju/charm.v6-unstable"
+	"gopkg.in/juju/names.v2"
 
 	"github.com/juju/juju/apiserver/params"
+	jujucloud "github.com/juju/juju/cloud"
 	"github.com/juju/juju/cmd/juju/crossmodel"
 	jujucrossmodel "github.com/juju/juju/core/crossmodel"
+	"github.com/juju/juju/jujuclient"
 )
 
 type findSuite struct {
@@ -27,6 +35,7 @@ var _ = gc.Suite(&findSuite{})
 
 func (s *findSuite) SetUpTest(c *gc.C) {
 	s.BaseCrossModelSuite.SetUpTest(c)
+	crossmodel.ResetOfferIndexes()
 
 	s.mockAPI = &mockFindAPI{
 		offerName:         "hosted-db2",
@@ -48,69 +57,2569 @@ func (s *findSuite) TestFindNoArgs(c *gc.C) {
 Store   URL                   Access   Interfaces
 master  fred/test.hosted-db2  consume  http:db2, http:log
 
+1 offer: 1 consume
+
+`[1:],
+	)
+}
+
+func (s *findSuite) TestFindDuplicateUrl(c *gc.C) {
+	s.assertFindError(c, []string{"url", "--url", "urlparam"}, ".*URL term cannot be specified twice.*")
+}
+
+func (s *findSuite) TestNoResults(c *gc.C) {
+	s.mockAPI.c = c
+	s.mockAPI.expectedModelName = "none"
+	s.mockAPI.expectedFilter = &jujucrossmodel.ApplicationOfferFilter{
+		OwnerName: "bob",
+		ModelName: "none",
+	}
+	s.mockAPI.results = []params.ApplicationOffer{}
+	s.assertFindError(
+		c,
+		[]string{"--url", "none"},
+		`no matching application offers found`,
+	)
+}
+
+func (s *findSuite) TestSimpleFilter(c *gc.C) {
+	s.mockAPI.c = c
+	s.mockAPI.expectedModelName = "model"
+	s.mockAPI.expectedFilter = &jujucrossmodel.ApplicationOfferFilter{
+		OfferName: "hosted-db2",
+		OwnerName: "fred",
+		ModelName: "model",
+	}
+	s.mockAPI.expectedModelName = "model"
+	s.assertFind(
+		c,
+		[]string{"--format", "tabular", "--url", "fred/model.hosted-db2"},
+		`
+Store   URL                    Access   Interfaces
+master  fred/model.hosted-db2  consume  http:db2, http:log
+
+1 offer: 1 consume
+
+`[1:],
+	)
+}
+
+func (s *findSuite) TestEndpointFilter(c *gc.C) {
+	s.mockAPI.c = c
+	s.mockAPI.expectedFilter = &jujucrossmodel.ApplicationOfferFilter{
+		OwnerName: "fred",
+		ModelName: "model",
+		Endpoints: []jujucrossmodel.EndpointFilterTerm{{
+			Interface: "mysql",
+			Name:      "db",
+		}},
+	}
+	s.mockAPI.expectedModelName = "model"
+	s.assertFind(
+		c,
+		[]string{"--format", "tabular", "--url", "fred/model", "--endpoint", "db", "--interface", "mysql"},
+		`
+Store   URL                    Access   Interfaces
+master  fred/model.hosted-db2  consume  http:db2, http:log
+
+1 offer: 1 consume
+
+`[1:],
+	)
+}
+
+func (s *findSuite) TestExplainMatchesYaml(c *gc.C) {
+	s.mockAPI.c = c
+	s.mockAPI.expectedFilter = &jujucrossmodel.ApplicationOfferFilter{
+		OwnerName: "fred",
+		ModelName: "model",
+		Endpoints: []jujucrossmodel.EndpointFilterTerm{{
+			Interface: "http",
+			Name:      "db2",
+		}},
+	}
+	s.mockAPI.expectedModelName = "model"
+	s.assertFind(
+		c,
+		[]string{"--format", "yaml", "--url", "fred/model", "--endpoint", "db2", "--interface", "http", "--explain-matches"},
+		`
+master:fred/model.hosted-db2:
+  access: consume
+  endpoints:
+    db2:
+      interface: http
+      role: requirer
+      pass-through: true
+    log:
+      interface: http
+      role: provider
+      pass-through: true
+  matched-by:
+  - endpoint=db2
+  - interface=http
+`[1:],
+	)
+}
+
+func (s *findSuite) TestExplainMatchesTabular(c *gc.C) {
+	s.mockAPI.expectedModelName = "model"
+	s.assertFind(
+		c,
+		[]string{"--format", "tabular", "--url", "fred/model", "--endpoint", "log", "--interface", "http", "--explain-matches"},
+		`
+Store   URL                    Access   Interfaces          Matched by
+master  fred/model.hosted-db2  consume  http:db2, http:log  endpoint=log, interface=http
+
+1 offer: 1 consume
+
+`[1:],
+	)
+}
+
+func (s *findSuite) TestExplainMatchesDropsNonMatching(c *gc.C) {
+	s.mockAPI.results = []params.ApplicationOffer{{
+		OfferURL:  "master:fred/model.hosted-db2",
+		OfferName: "hosted-db2",
+		Endpoints: []params.RemoteEndpoint{
+			{Name: "log", Interface: "http", Role: charm.RoleProvider},
+		},
+		Access: "consume",
+	}, {
+		OfferURL:  "master:fred/model.hosted-mysql",
+		OfferName: "hosted-mysql",
+		Endpoints: []params.RemoteEndpoint{
+			{Name: "db", Interface: "mysql", Role: charm.RoleProvider},
+		},
+		Access: "consume",
+	}}
+	expected := `
+master:fred/model.hosted-mysql:
+  access: consume
+  endpoints:
+    db:
+      interface: mysql
+      role: provider
+  matched-by:
+  - interface=mysql
+`[1:]
+	args := []string{"fred/model", "--interface", "mysql", "--explain-matches", "--format", "yaml"}
+	s.assertFind(c, args, expected)
+	// The cached index gives the same answer.
+	s.assertFind(c, append(args, "--cached"), expected)
+}
+
+func (s *findSuite) writeSourceGroups(c *gc.C) string {
+	path := filepath.Join(c.MkDir(), "source-groups.yaml")
+	err := ioutil.WriteFile(path, []byte(`
+source-groups:
+  prod:
+  - east
+  - west
+`[1:]), 0600)
+	c.Assert(err, jc.ErrorIsNil)
+	return path
+}
+
+func (s *findSuite) TestFindSourceGroup(c *gc.C) {
+	s.mockAPI.expectedModelName = "model"
+	var queried []string
+	newAPIFunc := func(controllerName string) (crossmodel.FindAPI, error) {
+		queried = append(queried, controllerName)
+		api := *s.mockAPI
+		api.controllerName = controllerName
+		return api, nil
+	}
+	path := s.writeSourceGroups(c)
+	context, err := cmdtesting.RunCommand(c, crossmodel.NewFindEndpointsCommandForTestWithAPIFunc(s.store, newAPIFunc),
+		"fred/model", "--source-group", "prod", "--source-group-file", path)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(queried, jc.DeepEquals, []string{"east", "west"})
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+Store  URL                    Access   Interfaces
+east   fred/model.hosted-db2  consume  http:db2, http:log
+west   fred/model.hosted-db2  consume  http:db2, http:log
+
+2 offers: 2 consume
+
+`[1:])
+}
+
+func (s *findSuite) TestFindCachedUsesIndex(c *gc.C) {
+	s.mockAPI.c = c
+	s.mockAPI.results = []params.ApplicationOffer{{
+		OfferURL:  "master:fred/model.hosted-db2",
+		OfferName: "hosted-db2",
+		Endpoints: []params.RemoteEndpoint{
+			{Name: "log", Interface: "http", Role: charm.RoleProvider},
+			{Name: "db2", Interface: "http", Role: charm.RoleRequirer},
+		},
+		Access: "consume",
+	}, {
+		OfferURL:  "master:fred/model.hosted-mysql",
+		OfferName: "hosted-mysql",
+		Endpoints: []params.RemoteEndpoint{
+			{Name: "db", Interface: "mysql", Role: charm.RoleProvider},
+		},
+		Access: "consume",
+	}}
+	s.mockAPI.expectedFilter = &jujucrossmodel.ApplicationOfferFilter{
+		OwnerName: "fred",
+		ModelName: "model",
+	}
+	calls := 0
+	newAPIFunc := func(string) (crossmodel.FindAPI, error) {
+		calls++
+		return s.mockAPI, nil
+	}
+	run := func(args ...string) (*cmd.Context, error) {
+		args = append([]string{"fred/model", "--cached", "--format", "yaml"}, args...)
+		return cmdtesting.RunCommand(c, crossmodel.NewFindEndpointsCommandForTestWithAPIFunc(s.store, newAPIFunc), args...)
+	}
+
+	context, err := run("--interface", "mysql")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Matches, `(?s)master:fred/model.hosted-mysql:.*`)
+
+	context, err = run("--interface", "http")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Matches, `(?s)master:fred/model.hosted-db2:.*`)
+	c.Assert(cmdtesting.Stdout(context), gc.Not(gc.Matches), `(?s).*hosted-mysql.*`)
+
+	context, err = run("--endpoint", "db")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Matches, `(?s)master:fred/model.hosted-mysql:.*`)
+
+	_, err = run("--interface", "pgsql")
+	c.Assert(err, gc.ErrorMatches, "no matching application offers found")
+
+	c.Assert(calls, gc.Equals, 1)
+}
+
+func (s *findSuite) TestFindCachedShowUsers(c *gc.C) {
+	s.mockAPI.results = []params.ApplicationOffer{{
+		OfferURL:  "master:fred/model.hosted-db2",
+		OfferName: "hosted-db2",
+		Endpoints: []params.RemoteEndpoint{
+			{Name: "db2", Interface: "http", Role: charm.RoleRequirer},
+		},
+		Access: "admin",
+		Users:  []params.OfferUserDetails{{UserName: "fred", Access: "admin"}},
+	}}
+	var received [][]jujucrossmodel.ApplicationOfferFilter
+	s.mockAPI.received = &received
+
+	_, err := s.runFind(c, "fred/model", "--cached")
+	c.Assert(err, jc.ErrorIsNil)
+	for i := 0; i < 2; i++ {
+		context, err := s.runFind(c, "fred/model", "--cached", "--show-users", "--format", "yaml")
+		c.Assert(err, jc.ErrorIsNil)
+		c.Assert(cmdtesting.Stdout(context), jc.Contains, "users:\n    fred: admin\n")
+	}
+	// The offers fetched without users are not used for --show-users.
+	c.Assert(received, gc.HasLen, 2)
+	c.Assert(received[0][0].IncludeUsers, jc.IsFalse)
+	c.Assert(received[1][0].IncludeUsers, jc.IsTrue)
+}
+
+func (s *findSuite) TestFindNotCachedCallsAPI(c *gc.C) {
+	calls := 0
+	newAPIFunc := func(string) (crossmodel.FindAPI, error) {
+		calls++
+		return s.mockAPI, nil
+	}
+	for i := 0; i < 2; i++ {
+		_, err := cmdtesting.RunCommand(c, crossmodel.NewFindEndpointsCommandForTestWithAPIFunc(s.store, newAPIFunc),
+			"fred/test", "--interface", "http")
+		c.Assert(err, jc.ErrorIsNil)
+	}
+	c.Assert(calls, gc.Equals, 2)
+}
+
+func (s *findSuite) offersWithSources() []params.ApplicationOffer {
+	endpoints := []params.RemoteEndpoint{
+		{Name: "db", Interface: "mysql", Role: charm.RoleProvider},
+	}
+	return []params.ApplicationOffer{{
+		OfferURL:  "fred/model.no-source",
+		OfferName: "no-source",
+		Endpoints: endpoints,
+		Access:    "consume",
+	}, {
+		OfferURL:  "master:fred/model.same-source",
+		OfferName: "same-source",
+		Endpoints: endpoints,
+		Access:    "consume",
+	}, {
+		OfferURL:  "east:fred/model.other-source",
+		OfferName: "other-source",
+		Endpoints: endpoints,
+		Access:    "read",
+	}}
+}
+
+func (s *findSuite) TestFindOfferSourceAttributionTabular(c *gc.C) {
+	s.mockAPI.results = s.offersWithSources()
+	context, err := s.runFind(c, "fred/model")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+Store          URL                      Access   Interfaces
+east (remote)  fred/model.other-source  read     mysql:db
+master         fred/model.no-source     consume  mysql:db
+master         fred/model.same-source   consume  mysql:db
+
+3 offers: 2 consume, 1 read
+
+`[1:])
+}
+
+func (s *findSuite) TestFindOfferSourceAttributionYAML(c *gc.C) {
+	s.mockAPI.results = s.offersWithSources()
+	context, err := s.runFind(c, "fred/model", "--format", "yaml")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+east:fred/model.other-source:
+  access: read
+  endpoints:
+    db:
+      interface: mysql
+      role: provider
+  remote: true
+master:fred/model.no-source:
+  access: consume
+  endpoints:
+    db:
+      interface: mysql
+      role: provider
+master:fred/model.same-source:
+  access: consume
+  endpoints:
+    db:
+      interface: mysql
+      role: provider
+`[1:])
+}
+
+func (s *findSuite) TestFindCanonicalOfferURLs(c *gc.C) {
+	endpoints := []params.RemoteEndpoint{
+		{Name: "db", Interface: "mysql", Role: charm.RoleProvider},
+	}
+	s.mockAPI.results = []params.ApplicationOffer{{
+		OfferURL:  "master:/Fred/Model.DB/",
+		OfferName: "db",
+		Endpoints: endpoints,
+		Access:    "read",
+	}, {
+		OfferURL:  "master:fred/model.db",
+		OfferName: "db",
+		Endpoints: endpoints,
+		Access:    "consume",
+	}}
+	context, err := s.runFind(c, "fred/model")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+Store   URL            Access   Interfaces
+master  fred/model.db  consume  mysql:db
+
+1 offer: 1 consume
+
+`[1:])
+}
+
+func (s *findSuite) TestFindControllerOnlyURL(c *gc.C) {
+	s.mockAPI.c = c
+	s.mockAPI.expectedFilter = &jujucrossmodel.ApplicationOfferFilter{}
+	s.assertFind(
+		c,
+		[]string{"master:"},
+		`
+Store   URL                   Access   Interfaces
+master  fred/test.hosted-db2  consume  http:db2, http:log
+
+1 offer: 1 consume
+
+`[1:],
+	)
+}
+
+func (s *findSuite) TestFindControllerOnlyURLOtherController(c *gc.C) {
+	var queried []string
+	newAPIFunc := func(controllerName string) (crossmodel.FindAPI, error) {
+		queried = append(queried, controllerName)
+		api := *s.mockAPI
+		api.c = c
+		api.controllerName = controllerName
+		api.expectedFilter = &jujucrossmodel.ApplicationOfferFilter{}
+		return api, nil
+	}
+	context, err := cmdtesting.RunCommand(c, crossmodel.NewFindEndpointsCommandForTestWithAPIFunc(s.store, newAPIFunc),
+		"east:")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(queried, jc.DeepEquals, []string{"east"})
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+Store  URL                   Access   Interfaces
+east   fred/test.hosted-db2  consume  http:db2, http:log
+
+1 offer: 1 consume
+
+`[1:])
+}
+
+func (s *findSuite) TestFindSourceGroupMissing(c *gc.C) {
+	path := s.writeSourceGroups(c)
+	s.assertFindError(c, []string{"--source-group", "dev", "--source-group-file", path}, `source group "dev" in ".*" not found`)
+}
+
+func (s *findSuite) TestFindSourceGroupWithURLSource(c *gc.C) {
+	path := s.writeSourceGroups(c)
+	s.assertFindError(c, []string{"east:fred/model", "--source-group", "prod", "--source-group-file", path},
+		"cannot specify both a source group and a URL source")
+}
+
+func (s *findSuite) TestFindShowUsers(c *gc.C) {
+	s.mockAPI.c = c
+	s.mockAPI.expectedFilter = &jujucrossmodel.ApplicationOfferFilter{
+		OwnerName:    "fred",
+		ModelName:    "model",
+		OfferName:    "hosted-db2",
+		IncludeUsers: true,
+	}
+	s.mockAPI.results = []params.ApplicationOffer{{
+		OfferURL:  "master:fred/model.hosted-db2",
+		OfferName: "hosted-db2",
+		Endpoints: []params.RemoteEndpoint{
+			{Name: "db2", Interface: "http", Role: charm.RoleRequirer},
+		},
+		Access: "admin",
+		Users: []params.OfferUserDetails{
+			{UserName: "fred", Access: "admin"},
+			{UserName: "mary", Access: "consume"},
+		},
+	}}
+	s.assertFind(
+		c,
+		[]string{"fred/model.hosted-db2", "--show-users", "--format", "yaml"},
+		`
+master:fred/model.hosted-db2:
+  access: admin
+  endpoints:
+    db2:
+      interface: http
+      role: requirer
+  users:
+    fred: admin
+    mary: consume
+`[1:],
+	)
+}
+
+func (s *findSuite) TestFindUsersOmittedByDefault(c *gc.C) {
+	s.mockAPI.results = []params.ApplicationOffer{{
+		OfferURL:  "master:fred/model.hosted-db2",
+		OfferName: "hosted-db2",
+		Endpoints: []params.RemoteEndpoint{
+			{Name: "db2", Interface: "http", Role: charm.RoleRequirer},
+		},
+		Access: "admin",
+		Users:  []params.OfferUserDetails{{UserName: "fred", Access: "admin"}},
+	}}
+	s.assertFind(
+		c,
+		[]string{"fred/model.hosted-db2", "--format", "yaml"},
+		`
+master:fred/model.hosted-db2:
+  access: admin
+  endpoints:
+    db2:
+      interface: http
+      role: requirer
+`[1:],
+	)
+}
+
+func (s *findSuite) TestFindShowUsersNotAdmin(c *gc.C) {
+	s.mockAPI.expectedModelName = "model"
+	s.assertFindError(c, []string{"fred/model.hosted-db2", "--show-users"},
+		`--show-users requires admin access to offer "master:fred/model.hosted-db2"`)
+}
+
+func (s *findSuite) TestFindWhere(c *gc.C) {
+	s.mockAPI.c = c
+	s.mockAPI.expectedFilter = &jujucrossmodel.ApplicationOfferFilter{
+		OwnerName: "fred",
+		ModelName: "model",
+		Endpoints: []jujucrossmodel.EndpointFilterTerm{{
+			Interface: "http",
+		}},
+	}
+	s.mockAPI.expectedModelName = "model"
+	s.assertFind(
+		c,
+		[]string{"--url", "fred/model", "--where", "interface=http and access>=consume"},
+		`
+Store   URL                    Access   Interfaces
+master  fred/model.hosted-db2  consume  http:db2, http:log
+
+1 offer: 1 consume
+
+`[1:],
+	)
+}
+
+func (s *findSuite) TestFindWhereNoMatch(c *gc.C) {
+	s.mockAPI.expectedModelName = "model"
+	s.assertFindError(c, []string{"--url", "fred/model", "--where", "access=admin or endpoint=db"},
+		"no matching application offers found")
+}
+
+func (s *findSuite) TestFindWhereInvalid(c *gc.C) {
+	s.assertFindError(c, []string{"--where", "colour=red"},
+		`invalid --where expression: unknown field "colour"`)
+}
+
+func (s *findSuite) TestFindEndpointPattern(c *gc.C) {
+	s.mockAPI.expectedModelName = "model"
+	s.assertFind(
+		c,
+		[]string{"fred/model", "--endpoint-pattern", "^db.*", "--format", "tabular"},
+		`
+Store   URL                    Access   Interfaces
+master  fred/model.hosted-db2  consume  http:db2, http:log
+
+1 offer: 1 consume
+
+`[1:],
+	)
+}
+
+func (s *findSuite) TestFindEndpointPatternNoMatch(c *gc.C) {
+	s.mockAPI.expectedModelName = "model"
+	s.assertFindError(c, []string{"fred/model", "--endpoint-pattern", "^mysql"},
+		"no matching application offers found")
+}
+
+func (s *findSuite) TestFindEndpointPatternInvalid(c *gc.C) {
+	s.assertFindError(c, []string{"--endpoint-pattern", "db("},
+		"invalid --endpoint-pattern: error parsing regexp: .*")
+}
+
+func (s *findSuite) TestFindURLRegex(c *gc.C) {
+	s.setupMixedModelOffers()
+	context, err := s.runFind(c, "master:", "--url-regex", `^master:fred/[a-z]+\.db$`)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+Store   URL            Access   Interfaces
+master  fred/model.db  consume  mysql:db
+master  fred/other.db  consume  mysql:db
+
+2 offers: 2 consume
+
+`[1:])
+}
+
+func (s *findSuite) TestFindURLRegexNoMatch(c *gc.C) {
+	s.setupMixedModelOffers()
+	s.assertFindError(c, []string{"master:", "--url-regex", `^east:`},
+		"no matching application offers found")
+}
+
+func (s *findSuite) TestFindURLRegexInvalid(c *gc.C) {
+	s.assertFindError(c, []string{"--url-regex", "db("},
+		"invalid --url-regex: error parsing regexp: .*")
+}
+
+func (s *findSuite) setupEndpointCountOffers() {
+	s.mockAPI.results = []params.ApplicationOffer{{
+		OfferURL:  "master:fred/model.one",
+		OfferName: "one",
+		Endpoints: []params.RemoteEndpoint{
+			{Name: "web", Interface: "http", Role: charm.RoleProvider},
+		},
+		Access: "consume",
+	}, {
+		OfferURL:  "master:fred/model.two",
+		OfferName: "two",
+		Endpoints: []params.RemoteEndpoint{
+			{Name: "web", Interface: "http", Role: charm.RoleProvider},
+			{Name: "db", Interface: "mysql", Role: charm.RoleRequirer},
+		},
+		Access: "consume",
+	}, {
+		OfferURL:  "master:fred/model.three",
+		OfferName: "three",
+		Endpoints: []params.RemoteEndpoint{
+			{Name: "web", Interface: "http", Role: charm.RoleProvider},
+			{Name: "db", Interface: "mysql", Role: charm.RoleRequirer},
+			{Name: "cache", Interface: "redis", Role: charm.RoleRequirer},
+		},
+		Access: "consume",
+	}}
+}
+
+func (s *findSuite) TestFindMinEndpoints(c *gc.C) {
+	s.setupEndpointCountOffers()
+	context, err := s.runFind(c, "fred/model", "--min-endpoints", "2")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+Store   URL               Access   Interfaces
+master  fred/model.three  consume  http:web, mysql:db, redis:cache
+master  fred/model.two    consume  http:web, mysql:db
+
+2 offers: 2 consume
+
+`[1:])
+}
+
+func (s *findSuite) TestFindMinEndpointsWithPattern(c *gc.C) {
+	s.setupEndpointCountOffers()
+	context, err := s.runFind(c, "fred/model", "--min-endpoints", "3", "--endpoint-pattern", "^db$")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+Store   URL               Access   Interfaces
+master  fred/model.three  consume  http:web, mysql:db, redis:cache
+
+1 offer: 1 consume
+
+`[1:])
+}
+
+func (s *findSuite) TestFindMinEndpointsNoMatch(c *gc.C) {
+	s.setupEndpointCountOffers()
+	s.assertFindError(c, []string{"fred/model", "--min-endpoints", "4"},
+		"no matching application offers found")
+}
+
+func (s *findSuite) TestFindMinEndpointsInvalid(c *gc.C) {
+	s.assertFindError(c, []string{"--min-endpoints", "-1"},
+		"invalid --min-endpoints -1, expected a positive number")
+}
+
+func (s *findSuite) TestFindListEndpoints(c *gc.C) {
+	s.setupEndpointCountOffers()
+	s.mockAPI.results = append(s.mockAPI.results, params.ApplicationOffer{
+		OfferURL:  "master:fred/model.cluster",
+		OfferName: "cluster",
+		Endpoints: []params.RemoteEndpoint{
+			{Name: "peers", Interface: "cluster", Role: charm.RolePeer},
+		},
+		Access: "consume",
+	})
+	context, err := s.runFind(c, "fred/model", "--list-endpoints", "provider")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+Store   URL               Endpoint  Interface
+master  fred/model.one    web       http
+master  fred/model.three  web       http
+master  fred/model.two    web       http
+
+`[1:])
+}
+
+func (s *findSuite) TestFindListEndpointsYAML(c *gc.C) {
+	s.setupEndpointCountOffers()
+	context, err := s.runFind(c, "fred/model", "--list-endpoints", "requirer", "--format", "yaml")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+- url: master:fred/model.three
+  endpoint: cache
+  interface: redis
+- url: master:fred/model.three
+  endpoint: db
+  interface: mysql
+- url: master:fred/model.two
+  endpoint: db
+  interface: mysql
+`[1:])
+}
+
+func (s *findSuite) TestFindListEndpointsNoMatch(c *gc.C) {
+	s.setupEndpointCountOffers()
+	s.assertFindError(c, []string{"fred/model", "--list-endpoints", "peer"},
+		"no matching peer endpoints found")
+}
+
+func (s *findSuite) TestFindListEndpointsInvalidRole(c *gc.C) {
+	s.assertFindError(c, []string{"--list-endpoints", "consumer"},
+		`invalid --list-endpoints role "consumer", expected "provider", "requirer" or "peer"`)
+}
+
+func (s *findSuite) TestFindListEndpointsDot(c *gc.C) {
+	s.assertFindError(c, []string{"--list-endpoints", "provider", "--format", "dot"},
+		"--list-endpoints cannot be used with --format dot")
+}
+
+func (s *findSuite) setupSparseOffers() {
+	s.mockAPI.results = []params.ApplicationOffer{{
+		OfferURL:  "master:fred/model.bare",
+		OfferName: "bare",
+	}, {
+		OfferURL:  "master:fred/model.db",
+		OfferName: "db",
+		Endpoints: []params.RemoteEndpoint{
+			{Name: "db", Interface: "mysql"},
+		},
+		Access: "read",
+	}}
+}
+
+func (s *findSuite) TestFindCompactJSON(c *gc.C) {
+	s.setupSparseOffers()
+	context, err := s.runFind(c, "fred/model", "--format", "json", "--compact")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals,
+		`{"master:fred/model.bare":{},"master:fred/model.db":{"access":"read","endpoints":{"db":{"interface":"mysql"}}}}`+"\n")
+}
+
+func (s *findSuite) TestFindNotCompactJSON(c *gc.C) {
+	s.setupSparseOffers()
+	context, err := s.runFind(c, "fred/model", "--format", "json")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals,
+		`{"master:fred/model.bare":{"access":"","endpoints":null},"master:fred/model.db":{"access":"read","endpoints":{"db":{"interface":"mysql","role":""}}}}`+"\n")
+}
+
+func (s *findSuite) TestFindCompactYAML(c *gc.C) {
+	s.setupSparseOffers()
+	context, err := s.runFind(c, "fred/model", "--format", "yaml", "--compact")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+master:fred/model.bare: {}
+master:fred/model.db:
+  access: read
+  endpoints:
+    db:
+      interface: mysql
+`[1:])
+}
+
+func (s *findSuite) setupAddressedOffers() {
+	endpoints := []params.RemoteEndpoint{{Name: "db", Interface: "mysql", Role: charm.RoleProvider}}
+	s.mockAPI.results = []params.ApplicationOffer{{
+		OfferURL:     "master:fred/model.db",
+		OfferName:    "db",
+		Endpoints:    endpoints,
+		Access:       "consume",
+		APIAddresses: []string{"10.0.0.1:17070"},
+	}, {
+		OfferURL:  "east:fred/model.web",
+		OfferName: "web",
+		Endpoints: endpoints,
+		Access:    "read",
+	}}
+}
+
+func (s *findSuite) TestFindShowEndpointsAddr(c *gc.C) {
+	s.setupAddressedOffers()
+	context, err := s.runFind(c, "fred/model", "--show-endpoints-addr", "--format", "yaml")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+east:fred/model.web:
+  access: read
+  endpoints:
+    db:
+      interface: mysql
+      role: provider
+  remote: true
+master:fred/model.db:
+  access: consume
+  endpoints:
+    db:
+      interface: mysql
+      role: provider
+  api-addresses:
+  - 10.0.0.1:17070
+`[1:])
+}
+
+func (s *findSuite) TestFindShowEndpointsAddrFromStore(c *gc.C) {
+	s.setupAddressedOffers()
+	s.store.Controllers["east"] = jujuclient.ControllerDetails{
+		APIEndpoints: []string{"10.0.1.1:17070", "10.0.1.2:17070"},
+	}
+	context, err := s.runFind(c, "fred/model", "--show-endpoints-addr", "--format", "json")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `{`+
+		`"east:fred/model.web":{"access":"read","endpoints":{"db":{"interface":"mysql","role":"provider"}},"api-addresses":["10.0.1.1:17070","10.0.1.2:17070"],"remote":true},`+
+		`"master:fred/model.db":{"access":"consume","endpoints":{"db":{"interface":"mysql","role":"provider"}},"api-addresses":["10.0.0.1:17070"]}`+
+		`}`+"\n")
+}
+
+func (s *findSuite) TestFindListSources(c *gc.C) {
+	s.setupAddressedOffers()
+	context, err := s.runFind(c, "fred/model", "--list-sources")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+Source         Offers
+east (remote)  1
+master         1
+
+`[1:])
+}
+
+func (s *findSuite) TestFindListSourcesYAML(c *gc.C) {
+	s.setupAddressedOffers()
+	context, err := s.runFind(c, "fred/model", "--list-sources", "--format", "yaml")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+- name: east
+  remote: true
+  offers: 1
+- name: master
+  offers: 1
+`[1:])
+}
+
+func (s *findSuite) TestFindListSourcesIncompatible(c *gc.C) {
+	s.assertFindError(c, []string{"--list-sources", "--format", "dot"},
+		"--list-sources cannot be used with --format dot")
+	s.assertFindError(c, []string{"--list-sources", "--count-by", "model"},
+		"--list-sources cannot be used with --list-endpoints or --count-by")
+}
+
+func (s *findSuite) TestFindEndpointsAddrNotRequested(c *gc.C) {
+	s.setupAddressedOffers()
+	context, err := s.runFind(c, "fred/model", "--format", "json")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `{`+
+		`"east:fred/model.web":{"access":"read","endpoints":{"db":{"interface":"mysql","role":"provider"}},"remote":true},`+
+		`"master:fred/model.db":{"access":"consume","endpoints":{"db":{"interface":"mysql","role":"provider"}}}`+
+		`}`+"\n")
+}
+
+func (s *findSuite) TestFindShowEndpointsAddrTabular(c *gc.C) {
+	s.assertFindError(c, []string{"--show-endpoints-addr"}, "--show-endpoints-addr requires --format yaml or json")
+}
+
+func (s *findSuite) setupMixedModelOffers() {
+	endpoints := []params.RemoteEndpoint{{Name: "db", Interface: "mysql", Role: charm.RoleProvider}}
+	s.mockAPI.results = []params.ApplicationOffer{{
+		OfferURL:  "master:fred/model.db",
+		OfferName: "db",
+		Endpoints: endpoints,
+		Access:    "consume",
+	}, {
+		OfferURL:  "master:fred/model.web",
+		OfferName: "web",
+		Endpoints: endpoints,
+		Access:    "consume",
+	}, {
+		OfferURL:  "master:fred/other.db",
+		OfferName: "db",
+		Endpoints: endpoints,
+		Access:    "consume",
+	}}
+}
+
+func (s *findSuite) TestFindIgnoreCase(c *gc.C) {
+	s.setupMixedModelOffers()
+	s.mockAPI.c = c
+	s.mockAPI.expectedFilter = &jujucrossmodel.ApplicationOfferFilter{}
+	for _, url := range []string{"fred/model.DB", "Fred/Model.db", "master:FRED/MODEL.DB"} {
+		context, err := s.runFind(c, url, "--ignore-case")
+		c.Assert(err, jc.ErrorIsNil)
+		c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+Store   URL            Access   Interfaces
+master  fred/model.db  consume  mysql:db
+
+1 offer: 1 consume
+
+`[1:])
+	}
+}
+
+func (s *findSuite) TestFindCaseSensitiveByDefault(c *gc.C) {
+	s.setupMixedModelOffers()
+	s.assertFindError(c, []string{"fred/model.DB"}, `application name "DB" not valid`)
+}
+
+func (s *findSuite) TestFindAccessSummary(c *gc.C) {
+	endpoints := []params.RemoteEndpoint{{Name: "db", Interface: "mysql", Role: charm.RoleProvider}}
+	for _, offer := range []struct{ name, access string }{
+		{"a", "admin"}, {"b", "consume"}, {"c", "read"}, {"d", "consume"},
+	} {
+		s.mockAPI.results = append(s.mockAPI.results, params.ApplicationOffer{
+			OfferURL:  "master:fred/model." + offer.name,
+			OfferName: offer.name,
+			Endpoints: endpoints,
+			Access:    offer.access,
+		})
+	}
+	context, err := s.runFind(c, "fred/model")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+Store   URL           Access   Interfaces
+master  fred/model.a  admin    mysql:db
+master  fred/model.b  consume  mysql:db
+master  fred/model.c  read     mysql:db
+master  fred/model.d  consume  mysql:db
+
+4 offers: 1 admin, 2 consume, 1 read
+
+`[1:])
+
+	// The summary reflects any filters applied.
+	context, err = s.runFind(c, "fred/model", "--where", "access>=consume")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Matches, `(?s).*\n3 offers: 1 admin, 2 consume\n\n`)
+}
+
+func (s *findSuite) TestFindCompactTabular(c *gc.C) {
+	s.assertFindError(c, []string{"--compact"}, "--compact requires --format yaml or json")
+}
+
+func (s *findSuite) setupCapacityOffers() {
+	two, one := 2, 1
+	s.mockAPI.results = []params.ApplicationOffer{{
+		OfferURL:  "master:fred/model.db",
+		OfferName: "db",
+		Endpoints: []params.RemoteEndpoint{
+			{Name: "db", Interface: "mysql", Role: charm.RoleProvider, Limit: 5, ConnectedCount: &two},
+			{Name: "backup", Interface: "storage", Role: charm.RoleProvider, Limit: 1, ConnectedCount: &one},
+			{Name: "logs", Interface: "syslog", Role: charm.RoleRequirer},
+		},
+		Access: "consume",
+	}}
+}
+
+func (s *findSuite) TestFindShowCapacity(c *gc.C) {
+	s.setupCapacityOffers()
+	context, err := s.runFind(c, "fred/model", "--show-capacity")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+Store   URL            Access   Interfaces                             Capacity
+master  fred/model.db  consume  mysql:db, storage:backup, syslog:logs  backup:0, db:3, logs:-
+
+1 offer: 1 consume
+
+`[1:])
+}
+
+func (s *findSuite) TestFindShowCapacityUnknown(c *gc.C) {
+	s.mockAPI.results = []params.ApplicationOffer{{
+		OfferURL:  "master:fred/model.db",
+		OfferName: "db",
+		Endpoints: []params.RemoteEndpoint{
+			{Name: "db", Interface: "mysql", Role: charm.RoleProvider, Limit: 5},
+			{Name: "logs", Interface: "syslog", Role: charm.RoleRequirer},
+		},
+		Access: "read",
+	}}
+	context, err := s.runFind(c, "fred/model", "--show-capacity")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+Store   URL            Access  Interfaces             Capacity
+master  fred/model.db  read    mysql:db, syslog:logs  db:unknown, logs:-
+
+1 offer: 1 read
+
+`[1:])
+}
+
+func (s *findSuite) TestFindShowCapacityYAML(c *gc.C) {
+	s.setupCapacityOffers()
+	context, err := s.runFind(c, "fred/model", "--show-capacity", "--format", "yaml")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+master:fred/model.db:
+  access: consume
+  endpoints:
+    backup:
+      interface: storage
+      role: provider
+      capacity: "0"
+    db:
+      interface: mysql
+      role: provider
+      capacity: "3"
+    logs:
+      interface: syslog
+      role: requirer
+      capacity: unlimited
+`[1:])
+}
+
+func (s *findSuite) TestFindShowRelations(c *gc.C) {
+	s.setupCapacityOffers()
+	context, err := s.runFind(c, "fred/model", "--show-relations")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+Store   URL            Access   Interfaces                             Relations
+master  fred/model.db  consume  mysql:db, storage:backup, syslog:logs  backup:1, db:2, logs:unknown
+
+1 offer: 1 consume
+
+`[1:])
+}
+
+func (s *findSuite) TestFindShowRelationsYAML(c *gc.C) {
+	s.setupCapacityOffers()
+	context, err := s.runFind(c, "fred/model", "--show-relations", "--show-capacity", "--format", "yaml")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+master:fred/model.db:
+  access: consume
+  endpoints:
+    backup:
+      interface: storage
+      role: provider
+      capacity: "0"
+      relation-count: 1
+    db:
+      interface: mysql
+      role: provider
+      capacity: "3"
+      relation-count: 2
+    logs:
+      interface: syslog
+      role: requirer
+      capacity: unlimited
+`[1:])
+}
+
+func (s *findSuite) TestFindShowRelationsCompactJSON(c *gc.C) {
+	s.setupCapacityOffers()
+	context, err := s.runFind(c, "fred/model", "--show-relations", "--format", "json", "--compact")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals,
+		`{"master:fred/model.db":{"access":"consume","endpoints":{`+
+			`"backup":{"interface":"storage","role":"provider","relation-count":1},`+
+			`"db":{"interface":"mysql","role":"provider","relation-count":2},`+
+			`"logs":{"interface":"syslog","role":"requirer"}}}}`+"\n")
+}
+
+func (s *findSuite) TestFindNoCapacity(c *gc.C) {
+	s.setupCapacityOffers()
+	context, err := s.runFind(c, "fred/model")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+Store   URL            Access   Interfaces
+master  fred/model.db  consume  mysql:db, storage:backup, syslog:logs
+
+1 offer: 1 consume
+
+`[1:])
+}
+
+func (s *findSuite) TestFindShowUsage(c *gc.C) {
+	s.setupCapacityOffers()
+	context, err := s.runFind(c, "fred/model", "--show-usage")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+Store   URL            Access   Interfaces
+master  fred/model.db  consume  mysql:db, storage:backup, syslog:logs
+
+master:fred/model.db:
+  juju consume master:fred/model.db
+  juju relate <application> db:backup
+
+1 offer: 1 consume
+
+`[1:])
+}
+
+func (s *findSuite) setupDuplicateEndpointOffers() {
+	s.mockAPI.results = []params.ApplicationOffer{{
+		OfferURL:  "master:fred/model.db",
+		OfferName: "db",
+		Endpoints: []params.RemoteEndpoint{
+			{Name: "db", Interface: "mysql", Role: charm.RoleProvider},
+			{Name: "db", Interface: "pgsql", Role: charm.RoleProvider},
+		},
+		Access: "consume",
+	}}
+}
+
+func (s *findSuite) TestFindDuplicateEndpointsWarning(c *gc.C) {
+	s.setupDuplicateEndpointOffers()
+	context, err := s.runFind(c, "fred/model")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+Store   URL            Access   Interfaces
+master  fred/model.db  consume  pgsql:db
+
+1 offer: 1 consume
+
+`[1:])
+	c.Check(c.GetTestLog(), jc.Contains,
+		`offer "master:fred/model.db" has duplicate endpoints db, showing only the last of each`)
+}
+
+func (s *findSuite) TestFindDuplicateEndpointsStrict(c *gc.C) {
+	s.setupDuplicateEndpointOffers()
+	s.assertFindError(c, []string{"fred/model", "--strict-endpoints"},
+		`offer "master:fred/model.db" has duplicate endpoints db`)
+}
+
+func (s *findSuite) TestFindNoDuplicateEndpoints(c *gc.C) {
+	s.setupTwoOffers()
+	_, err := s.runFind(c, "fred/model", "--strict-endpoints")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(c.GetTestLog(), gc.Not(jc.Contains), "duplicate endpoints")
+}
+
+func (s *findSuite) TestFindSummaryToStdout(c *gc.C) {
+	s.setupMixedModelOffers()
+	path := filepath.Join(c.MkDir(), "offers.yaml")
+	context, err := s.runFind(c, "master:", "--format", "yaml", "--count-by", "model")
+	c.Assert(err, jc.ErrorIsNil)
+	expected := cmdtesting.Stdout(context)
+
+	context, err = s.runFind(c, "master:", "--format", "yaml", "--count-by", "model", "-o", path, "--summary-to-stdout")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, "wrote 3 offers to "+path+"\n")
+	data, err := ioutil.ReadFile(path)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(data), gc.Equals, expected)
+}
+
+func (s *findSuite) TestFindSummaryToStdoutOffers(c *gc.C) {
+	s.setupMixedModelOffers()
+	path := filepath.Join(c.MkDir(), "offers.txt")
+	context, err := s.runFind(c, "master:", "--output", path, "--summary-to-stdout")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, "wrote 3 offers to "+path+"\n")
+	data, err := ioutil.ReadFile(path)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(data), gc.Equals, `
+Store   URL             Access   Interfaces
+master  fred/model.db   consume  mysql:db
+master  fred/model.web  consume  mysql:db
+master  fred/other.db   consume  mysql:db
+
+3 offers: 3 consume
+
+`[1:])
+}
+
+func (s *findSuite) TestFindSummaryToStdoutEndpoints(c *gc.C) {
+	s.setupRoleOffers()
+	path := filepath.Join(c.MkDir(), "endpoints.json")
+	context, err := s.runFind(c, "master:", "--list-endpoints", "provider", "--format", "json", "-o", path, "--summary-to-stdout")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, "wrote 3 endpoints to "+path+"\n")
+}
+
+func (s *findSuite) TestFindSummaryToStdoutHistogram(c *gc.C) {
+	s.setupHistogramOffers()
+	path := filepath.Join(c.MkDir(), "histogram.yaml")
+	context, err := s.runFind(c, "master:", "--histogram", "interface", "--format", "yaml", "-o", path, "--summary-to-stdout")
+	c.Assert(err, jc.ErrorIsNil)
+	// Offers with several interfaces are counted once.
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, "wrote 3 offers to "+path+"\n")
+}
+
+func (s *findSuite) TestFindSummaryToStdoutSources(c *gc.C) {
+	s.setupMixedModelOffers()
+	path := filepath.Join(c.MkDir(), "sources.yaml")
+	context, err := s.runFind(c, "master:", "--list-sources", "--format", "yaml", "-o", path, "--summary-to-stdout")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, "wrote 3 offers to "+path+"\n")
+}
+
+func (s *findSuite) TestFindSummaryToStdoutPlan(c *gc.C) {
+	s.setupPlanOffers()
+	path := filepath.Join(c.MkDir(), "plan.txt")
+	context, err := s.runFind(c, "master:", "--plan", "mysql:wordpress:db", "-o", path, "--summary-to-stdout")
+	c.Assert(err, jc.ErrorIsNil)
+	// The logs offer has no mysql endpoint, so is not in the plan.
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, "wrote 3 offers to "+path+"\n")
+}
+
+func (s *findSuite) TestFindSummaryToStdoutInvalid(c *gc.C) {
+	s.assertFindError(c, []string{"--summary-to-stdout"}, "--summary-to-stdout requires --output")
+	s.assertFindError(c, []string{"-o", "offers.json", "--format", "json", "--summary-to-stdout", "--watch"},
+		"--summary-to-stdout cannot be used with --watch or --expect-min")
+}
+
+func (s *findSuite) setupTwoOffers() {
+	endpoints := []params.RemoteEndpoint{{Name: "db", Interface: "mysql", Role: charm.RoleProvider}}
+	s.mockAPI.results = []params.ApplicationOffer{{
+		OfferURL:  "master:fred/model.db",
+		OfferName: "db",
+		Endpoints: endpoints,
+		Access:    "consume",
+	}, {
+		OfferURL:  "master:fred/model.web",
+		OfferName: "web",
+		Endpoints: endpoints,
+		Access:    "consume",
+	}}
+}
+
+func (s *findSuite) setupVersionOffers() {
+	s.setupTwoOffers()
+	s.mockAPI.results[0].ControllerVersion = "2.3.1"
+}
+
+func (s *findSuite) TestFindShowVersion(c *gc.C) {
+	s.setupVersionOffers()
+	context, err := s.runFind(c, "fred/model", "--show-version")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+Store   URL             Access   Version  Interfaces
+master  fred/model.db   consume  2.3.1    mysql:db
+master  fred/model.web  consume           mysql:db
+
+2 offers: 2 consume
+
+`[1:])
+}
+
+func (s *findSuite) TestFindVersionHiddenByDefault(c *gc.C) {
+	s.setupVersionOffers()
+	context, err := s.runFind(c, "fred/model")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+Store   URL             Access   Interfaces
+master  fred/model.db   consume  mysql:db
+master  fred/model.web  consume  mysql:db
+
+2 offers: 2 consume
+
+`[1:])
+}
+
+func (s *findSuite) TestFindVersionJSON(c *gc.C) {
+	s.setupVersionOffers()
+	context, err := s.runFind(c, "fred/model", "--format", "json")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `{`+
+		`"master:fred/model.db":{"access":"consume","endpoints":{"db":{"interface":"mysql","role":"provider"}},`+
+		`"controller-version":"2.3.1"},`+
+		`"master:fred/model.web":{"access":"consume","endpoints":{"db":{"interface":"mysql","role":"provider"}}}}`+"\n")
+}
+
+func (s *findSuite) TestFindVersionCompactYAML(c *gc.C) {
+	s.setupVersionOffers()
+	context, err := s.runFind(c, "fred/model", "--format", "yaml", "--compact")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+master:fred/model.db:
+  access: consume
+  endpoints:
+    db:
+      interface: mysql
+      role: provider
+  controller-version: 2.3.1
+master:fred/model.web:
+  access: consume
+  endpoints:
+    db:
+      interface: mysql
+      role: provider
+`[1:])
+}
+
+func (s *findSuite) TestFindShowUsageYAML(c *gc.C) {
+	s.setupCapacityOffers()
+	context, err := s.runFind(c, "fred/model", "--show-usage", "--format", "yaml", "--compact")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+master:fred/model.db:
+  access: consume
+  endpoints:
+    backup:
+      interface: storage
+      role: provider
+    db:
+      interface: mysql
+      role: provider
+    logs:
+      interface: syslog
+      role: requirer
+  usage:
+    consume: juju consume master:fred/model.db
+    relate: juju relate <application> db:backup
+`[1:])
+}
+
+func (s *findSuite) TestFindShowUsageJSON(c *gc.C) {
+	s.setupCapacityOffers()
+	context, err := s.runFind(c, "fred/model", "--show-usage", "--format", "json")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), jc.Contains,
+		`"usage":{"consume":"juju consume master:fred/model.db","relate":"juju relate \u003capplication\u003e db:backup"}`)
+}
+
+func (s *findSuite) TestFindBareOfferName(c *gc.C) {
+	s.mockAPI.c = c
+	s.mockAPI.expectedFilter = &jujucrossmodel.ApplicationOfferFilter{
+		OwnerName: "fred",
+		ModelName: "test",
+		OfferName: "hosted-db2",
+	}
+	s.assertFind(
+		c,
+		[]string{"hosted-db2"},
+		`
+Store   URL                   Access   Interfaces
+master  fred/test.hosted-db2  consume  http:db2, http:log
+
+1 offer: 1 consume
+
+`[1:],
+	)
+}
+
+func (s *findSuite) TestFindNoResolve(c *gc.C) {
+	var queried []string
+	newAPIFunc := func(controllerName string) (crossmodel.FindAPI, error) {
+		queried = append(queried, controllerName)
+		api := *s.mockAPI
+		api.c = c
+		api.controllerName = controllerName
+		api.expectedModelName = "model"
+		api.expectedFilter = &jujucrossmodel.ApplicationOfferFilter{
+			OwnerName: "fred",
+			ModelName: "model",
+		}
+		return api, nil
+	}
+	context, err := cmdtesting.RunCommand(c, crossmodel.NewFindEndpointsCommandForTestWithAPIFunc(s.store, newAPIFunc),
+		"east:fred/model", "--no-resolve")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(queried, jc.DeepEquals, []string{"east"})
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+Store  URL                    Access   Interfaces
+east   fred/model.hosted-db2  consume  http:db2, http:log
+
+1 offer: 1 consume
+
+`[1:])
+}
+
+func (s *findSuite) TestFindNoResolveNoURL(c *gc.C) {
+	s.assertFindError(c, []string{"--no-resolve"}, "--no-resolve requires a URL")
+}
+
+func (s *findSuite) TestFindNoResolveNoController(c *gc.C) {
+	s.assertFindError(c, []string{"fred/model", "--no-resolve"},
+		`URL "fred/model" does not specify a controller, required with --no-resolve`)
+}
+
+func (s *findSuite) TestFindNoResolveNoUser(c *gc.C) {
+	s.assertFindError(c, []string{"east:model", "--no-resolve"},
+		`URL "east:model" does not specify a model owner and model, required with --no-resolve`)
+}
+
+func (s *findSuite) TestFindNoResolveBareOfferName(c *gc.C) {
+	s.assertFindError(c, []string{"hosted-db2", "--no-resolve"},
+		`URL "hosted-db2" does not specify a controller, required with --no-resolve`)
+}
+
+func (s *findSuite) TestFindStrictURLNoUser(c *gc.C) {
+	s.assertFindError(c, []string{"model.hosted-db2", "--strict-url"},
+		`URL "model.hosted-db2" does not specify a user, required with --strict-url`)
+	s.assertFindError(c, []string{"--url", "none", "--strict-url"},
+		`URL "none" does not specify a user, required with --strict-url`)
+}
+
+func (s *findSuite) TestFindStrictURLBareOfferName(c *gc.C) {
+	s.assertFindError(c, []string{"hosted-db2", "--strict-url"},
+		`URL "hosted-db2" does not specify a user, required with --strict-url`)
+}
+
+func (s *findSuite) TestFindStrictURL(c *gc.C) {
+	s.mockAPI.c = c
+	s.mockAPI.expectedModelName = "model"
+	s.mockAPI.expectedFilter = &jujucrossmodel.ApplicationOfferFilter{
+		OfferName: "hosted-db2",
+		OwnerName: "fred",
+		ModelName: "model",
+	}
+	context, err := s.runFind(c, "fred/model.hosted-db2", "--strict-url")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+Store   URL                    Access   Interfaces
+master  fred/model.hosted-db2  consume  http:db2, http:log
+
+1 offer: 1 consume
+
+`[1:])
+}
+
+func (s *findSuite) TestResolveOfferURL(c *gc.C) {
+	url, err := crossmodel.ResolveOfferURL(s.store, "hosted-db2")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(url, gc.Equals, "test-master:fred/test.hosted-db2")
+}
+
+func (s *findSuite) TestResolveOfferURLUnqualifiedModel(c *gc.C) {
+	s.store.Models["test-master"].CurrentModel = "prod"
+	url, err := crossmodel.ResolveOfferURL(s.store, "hosted-db2")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(url, gc.Equals, "test-master:bob/prod.hosted-db2")
+}
+
+func (s *findSuite) TestResolveOfferURLNoCurrentModel(c *gc.C) {
+	s.store.Models["test-master"].CurrentModel = ""
+	_, err := crossmodel.ResolveOfferURL(s.store, "hosted-db2")
+	c.Assert(err, gc.ErrorMatches, `resolving offer "hosted-db2": .*`)
+}
+
+func (s *findSuite) TestResolveOfferURLInvalidName(c *gc.C) {
+	_, err := crossmodel.ResolveOfferURL(s.store, "hosted_db2")
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+}
+
+func (s *findSuite) writeConsumerCharm(c *gc.C) string {
+	dir := c.MkDir()
+	err := ioutil.WriteFile(filepath.Join(dir, "metadata.yaml"), []byte(`
+name: wordpress
+summary: a blog
+description: a blog
+requires:
+  db:
+    interface: mysql
+`[1:]), 0600)
+	c.Assert(err, jc.ErrorIsNil)
+	return dir
+}
+
+func (s *findSuite) setupConsumableOffers() {
+	s.mockAPI.results = []params.ApplicationOffer{{
+		OfferURL:  "master:fred/model.mysql",
+		OfferName: "mysql",
+		Endpoints: []params.RemoteEndpoint{
+			{Name: "db", Interface: "mysql", Role: charm.RoleProvider},
+		},
+		Access: "consume",
+	}, {
+		OfferURL:  "master:fred/model.pgsql",
+		OfferName: "pgsql",
+		Endpoints: []params.RemoteEndpoint{
+			{Name: "db", Interface: "pgsql", Role: charm.RoleProvider},
+		},
+		Access: "consume",
+	}, {
+		OfferURL:  "master:fred/model.app",
+		OfferName: "app",
+		Endpoints: []params.RemoteEndpoint{
+			{Name: "db", Interface: "mysql", Role: charm.RoleRequirer},
+		},
+		Access: "consume",
+	}}
+}
+
+func (s *findSuite) TestFindConsumableBy(c *gc.C) {
+	s.setupConsumableOffers()
+	context, err := s.runFind(c, "fred/model", "--consumable-by", s.writeConsumerCharm(c))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+Store   URL               Access   Interfaces
+master  fred/model.mysql  consume  mysql:db
+
+1 offer: 1 consume
+
+`[1:])
+}
+
+func (s *findSuite) TestFindConsumableByUnreadableCharm(c *gc.C) {
+	s.setupConsumableOffers()
+	path := filepath.Join(c.MkDir(), "missing")
+	context, err := s.runFind(c, "fred/model", "--consumable-by", path)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stderr(context), gc.Matches, `WARNING: not filtering by --consumable-by: cannot read charm ".*missing": .*\n`)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+Store   URL               Access   Interfaces
+master  fred/model.app    consume  mysql:db
+master  fred/model.mysql  consume  mysql:db
+master  fred/model.pgsql  consume  pgsql:db
+
+3 offers: 3 consume
+
+`[1:])
+}
+
+func (s *findSuite) setupApplicationOffers() {
+	endpoints := []params.RemoteEndpoint{
+		{Name: "db", Interface: "mysql", Role: charm.RoleProvider},
+	}
+	s.mockAPI.results = []params.ApplicationOffer{{
+		OfferURL:        "master:fred/model.db-admin",
+		OfferName:       "db-admin",
+		ApplicationName: "mysql",
+		Endpoints:       endpoints,
+		Access:          "admin",
+	}, {
+		OfferURL:        "master:fred/model.db-read",
+		OfferName:       "db-read",
+		ApplicationName: "mysql",
+		Endpoints:       endpoints,
+		Access:          "read",
+	}, {
+		OfferURL:        "master:fred/model.pg",
+		OfferName:       "pg",
+		ApplicationName: "postgresql",
+		Endpoints:       endpoints,
+		Access:          "consume",
+	}, {
+		OfferURL:  "master:fred/model.other",
+		OfferName: "other",
+		Endpoints: endpoints,
+		Access:    "consume",
+	}}
+}
+
+func (s *findSuite) TestFindGroupByApplication(c *gc.C) {
+	s.setupApplicationOffers()
+	context, err := s.runFind(c, "fred/model", "--group-by", "application")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+application: mysql
+Store   URL                  Access  Application  Interfaces
+master  fred/model.db-admin  admin   mysql        mysql:db
+master  fred/model.db-read   read    mysql        mysql:db
+
+application: postgresql
+Store   URL            Access   Application  Interfaces
+master  fred/model.pg  consume  postgresql   mysql:db
+
+application: (unknown)
+Store   URL               Access   Interfaces
+master  fred/model.other  consume  mysql:db
+
+4 offers: 1 admin, 2 consume, 1 read
+
+`[1:])
+}
+
+func (s *findSuite) TestFindGroupByApplicationYAML(c *gc.C) {
+	s.setupApplicationOffers()
+	s.mockAPI.results = s.mockAPI.results[:3]
+	context, err := s.runFind(c, "fred/model", "--group-by", "application", "--format", "yaml")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+mysql:
+  master:fred/model.db-admin:
+    access: admin
+    application: mysql
+    endpoints:
+      db:
+        interface: mysql
+        role: provider
+  master:fred/model.db-read:
+    access: read
+    application: mysql
+    endpoints:
+      db:
+        interface: mysql
+        role: provider
+postgresql:
+  master:fred/model.pg:
+    access: consume
+    application: postgresql
+    endpoints:
+      db:
+        interface: mysql
+        role: provider
+`[1:])
+}
+
+func (s *findSuite) TestFindGroupByInvalid(c *gc.C) {
+	s.assertFindError(c, []string{"--group-by", "model"},
+		`invalid --group-by value "model", expected "application"`)
+}
+
+func (s *findSuite) TestFindGroupByDot(c *gc.C) {
+	s.assertFindError(c, []string{"--group-by", "application", "--format", "dot"},
+		"--group-by cannot be used with --format dot")
+}
+
+func (s *findSuite) TestFindCountByModel(c *gc.C) {
+	s.setupMixedModelOffers()
+	context, err := s.runFind(c, "master:", "--count-by", "model")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+Model              Offers
+master:fred/model  2
+master:fred/other  1
+
+`[1:])
+}
+
+func (s *findSuite) TestFindCountByModelYAML(c *gc.C) {
+	s.setupMixedModelOffers()
+	context, err := s.runFind(c, "master:", "--count-by", "model", "--format", "yaml")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+master:fred/model: 2
+master:fred/other: 1
+`[1:])
+}
+
+func (s *findSuite) TestFindCountByModelJSON(c *gc.C) {
+	s.setupMixedModelOffers()
+	context, err := s.runFind(c, "master:", "--count-by", "model", "--format", "json")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `{"master:fred/model":2,"master:fred/other":1}`+"\n")
+}
+
+func (s *findSuite) TestFindCountByModelFiltered(c *gc.C) {
+	s.setupMixedModelOffers()
+	context, err := s.runFind(c, "master:", "--count-by", "model", "--url-regex", `\.db$`, "--format", "yaml")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+master:fred/model: 1
+master:fred/other: 1
+`[1:])
+}
+
+func (s *findSuite) TestFindCountByInvalid(c *gc.C) {
+	s.assertFindError(c, []string{"--count-by", "owner"}, `invalid --count-by value "owner", expected "model"`)
+	s.assertFindError(c, []string{"--count-by", "model", "--format", "dot"}, "--count-by cannot be used with --format dot")
+	s.assertFindError(c, []string{"--count-by", "model", "--list-endpoints", "provider"},
+		"--count-by cannot be used with --list-endpoints")
+}
+
+func (s *findSuite) setupHistogramOffers() {
+	s.mockAPI.results = []params.ApplicationOffer{{
+		OfferURL:  "master:fred/model.db",
+		OfferName: "db",
+		Endpoints: []params.RemoteEndpoint{
+			{Name: "db", Interface: "mysql", Role: charm.RoleProvider},
+			{Name: "db-admin", Interface: "mysql", Role: charm.RoleProvider},
+			{Name: "website", Interface: "http", Role: charm.RoleProvider},
+		},
+		Access: "consume",
+	}, {
+		OfferURL:  "master:fred/model.web",
+		OfferName: "web",
+		Endpoints: []params.RemoteEndpoint{
+			{Name: "db", Interface: "mysql", Role: charm.RoleRequirer},
+			{Name: "website", Interface: "http", Role: charm.RoleProvider},
+			{Name: "logs", Interface: "logging", Role: charm.RoleProvider},
+		},
+		Access: "consume",
+	}, {
+		OfferURL:  "master:fred/other.db",
+		OfferName: "db",
+		Endpoints: []params.RemoteEndpoint{
+			{Name: "db", Interface: "mysql", Role: charm.RoleProvider},
+		},
+		Access: "consume",
+	}}
+}
+
+func (s *findSuite) TestFindHistogram(c *gc.C) {
+	s.setupHistogramOffers()
+	context, err := s.runFind(c, "master:", "--histogram", "interface")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+Interface  Offers  Chart
+mysql      3       ###
+http       2       ##
+logging    1       #
+
+`[1:])
+}
+
+func (s *findSuite) TestFindHistogramYAML(c *gc.C) {
+	s.setupHistogramOffers()
+	context, err := s.runFind(c, "master:", "--histogram", "interface", "--format", "yaml")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+http: 2
+logging: 1
+mysql: 3
+`[1:])
+}
+
+func (s *findSuite) TestFindHistogramJSON(c *gc.C) {
+	s.setupHistogramOffers()
+	context, err := s.runFind(c, "master:", "--histogram", "interface", "--format", "json")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `{"http":2,"logging":1,"mysql":3}`+"\n")
+}
+
+func (s *findSuite) TestFindHistogramFiltered(c *gc.C) {
+	s.setupHistogramOffers()
+	context, err := s.runFind(c, "master:", "--histogram", "interface", "--url-regex", `\.db$`)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+Interface  Offers  Chart
+mysql      2       ##
+http       1       #
+
+`[1:])
+}
+
+func (s *findSuite) setupPlanOffers() {
+	s.mockAPI.results = []params.ApplicationOffer{{
+		OfferURL:  "master:fred/model.db",
+		OfferName: "db",
+		Endpoints: []params.RemoteEndpoint{
+			{Name: "db", Interface: "mysql", Role: charm.RoleProvider},
+			{Name: "admin", Interface: "mysql", Role: charm.RoleProvider},
+		},
+		Access: "consume",
+	}, {
+		OfferURL:  "master:fred/model.logs",
+		OfferName: "logs",
+		Endpoints: []params.RemoteEndpoint{
+			{Name: "logs", Interface: "logging", Role: charm.RoleProvider},
+		},
+		Access: "consume",
+	}, {
+		OfferURL:  "master:fred/model.wordpress",
+		OfferName: "wordpress",
+		Endpoints: []params.RemoteEndpoint{
+			{Name: "db", Interface: "mysql", Role: charm.RoleProvider},
+		},
+		Access: "consume",
+	}, {
+		OfferURL:  "master:fred/other.db",
+		OfferName: "db",
+		Endpoints: []params.RemoteEndpoint{
+			{Name: "db", Interface: "mysql", Role: charm.RoleProvider},
+		},
+		Access: "consume",
+	}}
+}
+
+func (s *findSuite) TestFindPlan(c *gc.C) {
+	s.setupPlanOffers()
+	context, err := s.runFind(c, "master:", "--plan", "mysql:wordpress:db")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+juju consume master:fred/model.db db
+juju relate wordpress:db db:admin
+
+juju consume master:fred/model.wordpress wordpress-model
+juju relate wordpress:db wordpress-model:db
+
+juju consume master:fred/other.db db-other
+juju relate wordpress:db db-other:db
+
+`[1:])
+}
+
+func (s *findSuite) TestFindPlanYAML(c *gc.C) {
+	s.setupPlanOffers()
+	context, err := s.runFind(c, "master:", "--plan", "logging:rsyslog", "--format", "yaml")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+- offer: master:fred/model.logs
+  alias: logs
+  consume: juju consume master:fred/model.logs logs
+  relate: juju relate rsyslog logs:logs
+`[1:])
+}
+
+func (s *findSuite) TestFindPlanInvalid(c *gc.C) {
+	for _, value := range []string{"mysql", ":wordpress", "mysql:Wordpress", "mysql:wordpress:", "mysql:wordpress:db:extra"} {
+		s.assertFindError(c, []string{"--plan", value},
+			fmt.Sprintf(`invalid --plan %q, expected <interface>:<application>\[:<endpoint>\]`, value))
+	}
+	s.assertFindError(c, []string{"--plan", "mysql:wordpress", "--format", "env"}, "--plan cannot be used with --format env")
+	s.assertFindError(c, []string{"--plan", "mysql:wordpress", "--histogram", "interface"},
+		"--plan cannot be used with --group-by, --list-endpoints, --count-by, --list-sources, --histogram or --watch")
+}
+
+func (s *findSuite) TestFindHistogramInvalid(c *gc.C) {
+	s.assertFindError(c, []string{"--histogram", "endpoint"}, `invalid --histogram value "endpoint", expected "interface"`)
+	s.assertFindError(c, []string{"--histogram", "interface", "--format", "matrix"}, "--histogram cannot be used with --format matrix")
+	s.assertFindError(c, []string{"--histogram", "interface", "--count-by", "model"},
+		"--histogram cannot be used with --list-endpoints, --count-by or --list-sources")
+}
+
+func (s *findSuite) runFindWithStdin(c *gc.C, stdin string, args ...string) (*cmd.Context, error) {
+	ctx := cmdtesting.Context(c)
+	ctx.Stdin = strings.NewReader(stdin)
+	command := crossmodel.NewFindEndpointsCommandForTest(s.store, s.mockAPI)
+	if err := cmdtesting.InitCommand(command, args); err != nil {
+		return ctx, err
+	}
+	return ctx, command.Run(ctx)
+}
+
+func (s *findSuite) setupFilterFileExpectations(c *gc.C) {
+	s.mockAPI.c = c
+	s.mockAPI.expectedModelName = "model"
+	s.mockAPI.expectedFilter = &jujucrossmodel.ApplicationOfferFilter{
+		OfferName: "hosted-db2",
+		OwnerName: "fred",
+		ModelName: "model",
+		Endpoints: []jujucrossmodel.EndpointFilterTerm{{
+			Interface: "http",
+		}},
+	}
+}
+
+func (s *findSuite) TestFindFilterFileStdin(c *gc.C) {
+	s.setupFilterFileExpectations(c)
+	context, err := s.runFindWithStdin(c, "url: fred/model.hosted-db2\ninterface: http\n", "--filter-file", "-")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+Store   URL                    Access   Interfaces
+master  fred/model.hosted-db2  consume  http:db2, http:log
+
+1 offer: 1 consume
+
+`[1:])
+}
+
+func (s *findSuite) TestFindFilterFilePath(c *gc.C) {
+	s.setupFilterFileExpectations(c)
+	path := filepath.Join(c.MkDir(), "filter.yaml")
+	err := ioutil.WriteFile(path, []byte("url: fred/model.hosted-db2\n"), 0600)
+	c.Assert(err, jc.ErrorIsNil)
+	_, err = s.runFind(c, "--filter-file", path, "--interface", "http")
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *findSuite) TestFindFilterFileMatchBothRoles(c *gc.C) {
+	s.mockAPI.c = c
+	s.mockAPI.expectedFilter = &jujucrossmodel.ApplicationOfferFilter{
+		Endpoints: []jujucrossmodel.EndpointFilterTerm{{
+			Interface: "http",
+			Role:      charm.RoleProvider,
+		}, {
+			Interface: "http",
+			Role:      charm.RoleRequirer,
+		}},
+	}
+	_, err := s.runFindWithStdin(c, "interface: http\n", "--filter-file", "-", "--match-both-roles")
+	c.Assert(err, jc.ErrorIsNil)
+
+	_, err = s.runFindWithStdin(c, "endpoint: db\n", "--filter-file", "-", "--match-both-roles")
+	c.Assert(err, gc.ErrorMatches, "--match-both-roles requires --interface")
+}
+
+func (s *findSuite) TestFindFilterFileErrors(c *gc.C) {
+	for i, test := range []struct {
+		stdin string
+		args  []string
+		err   string
+	}{{
+		stdin: "",
+		err:   "no filter read from stdin",
+	}, {
+		stdin: "\n  \n",
+		err:   "no filter read from stdin",
+	}, {
+		stdin: "url: [fred",
+		err:   "cannot parse filter from stdin: yaml: .*",
+	}, {
+		stdin: "owner: fred\n",
+		err:   "(?s)cannot parse filter from stdin: yaml: unmarshal errors:.*",
+	}, {
+		stdin: "url: fred/model.db\n",
+		args:  []string{"fred/model"},
+		err:   "URL term cannot be specified both on the command line and in the filter file",
+	}, {
+		stdin: "interface: mysql\n",
+		args:  []string{"--interface", "http"},
+		err:   "--interface cannot be specified both on the command line and in the filter file",
+	}} {
+		c.Logf("test %d: %q", i, test.stdin)
+		args := append([]string{"--filter-file", "-"}, test.args...)
+		_, err := s.runFindWithStdin(c, test.stdin, args...)
+		c.Check(err, gc.ErrorMatches, test.err)
+	}
+}
+
+func (s *findSuite) TestFindFilterFileMissing(c *gc.C) {
+	path := filepath.Join(c.MkDir(), "missing.yaml")
+	s.assertFindError(c, []string{"--filter-file", path}, "reading filter from .*missing.yaml: .*")
+}
+
+func (s *findSuite) runFindConsumed(c *gc.C, args ...string) (*cmd.Context, error) {
+	s.setupMixedModelOffers()
+	statusAPI := &mockStatusAPI{status: &params.FullStatus{
+		RemoteApplications: map[string]params.RemoteApplicationStatus{
+			"db":    {ApplicationName: "db", ApplicationURL: "master:fred/model.db"},
+			"other": {ApplicationName: "other", ApplicationURL: "master:fred/unrelated.db"},
+		},
+	}}
+	command := crossmodel.NewFindEndpointsCommandForTestWithStatusAPI(s.store, s.mockAPI, statusAPI)
+	return cmdtesting.RunCommand(c, command, args...)
+}
+
+func (s *findSuite) TestFindConsumed(c *gc.C) {
+	context, err := s.runFindConsumed(c, "master:", "--consumed", "--format", "yaml")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+master:fred/model.db:
+  access: consume
+  endpoints:
+    db:
+      interface: mysql
+      role: provider
+  consumed: true
+`[1:])
+}
+
+func (s *findSuite) TestFindNotConsumed(c *gc.C) {
+	context, err := s.runFindConsumed(c, "master:", "--not-consumed")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+Store   URL             Access   Interfaces
+master  fred/model.web  consume  mysql:db
+master  fred/other.db   consume  mysql:db
+
+2 offers: 2 consume
+
+`[1:])
+}
+
+func (s *findSuite) TestFindConsumedStatusError(c *gc.C) {
+	s.setupMixedModelOffers()
+	statusAPI := &mockStatusAPI{err: errors.New("boom")}
+	command := crossmodel.NewFindEndpointsCommandForTestWithStatusAPI(s.store, s.mockAPI, statusAPI)
+	_, err := cmdtesting.RunCommand(c, command, "master:", "--consumed")
+	c.Assert(err, gc.ErrorMatches, "finding offers consumed by the current model: boom")
+}
+
+func (s *findSuite) TestFindConsumedAndNotConsumed(c *gc.C) {
+	s.assertFindError(c, []string{"--consumed", "--not-consumed"},
+		"cannot specify both --consumed and --not-consumed")
+}
+
+func (s *findSuite) TestFindDot(c *gc.C) {
+	s.mockAPI.results = []params.ApplicationOffer{{
+		OfferURL:  "master:fred/model.hosted-db2",
+		OfferName: "hosted-db2",
+		Endpoints: []params.RemoteEndpoint{
+			{Name: "db", Interface: "db2", Role: charm.RoleProvider},
+			{Name: "logging", Interface: `say"what`, Role: charm.RoleRequirer},
+		},
+		Access: "consume",
+	}}
+	context, err := s.runFind(c, "fred/model", "--format", "dot")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+digraph offers {
+  "master:fred/model.hosted-db2" [shape=box];
+  "interface:db2" [label="db2", shape=ellipse];
+  "interface:say\"what" [label="say\"what", shape=ellipse];
+  "master:fred/model.hosted-db2" -> "interface:db2" [label="db"];
+  "interface:say\"what" -> "master:fred/model.hosted-db2" [label="logging"];
+}
+
+`[1:])
+}
+
+func (s *findSuite) TestFindEnv(c *gc.C) {
+	s.mockAPI.results = []params.ApplicationOffer{{
+		OfferURL:  "master:fred/model.web",
+		OfferName: "web",
+		Endpoints: []params.RemoteEndpoint{
+			{Name: "website", Interface: "http", Role: charm.RoleProvider},
+		},
+		Access: "read",
+	}, {
+		OfferURL:  "master:fred/model.db",
+		OfferName: "db",
+		Endpoints: []params.RemoteEndpoint{
+			{Name: "db", Interface: "mysql", Role: charm.RoleProvider},
+			{Name: "db-admin", Interface: "mysql-root", Role: charm.RoleProvider},
+		},
+		Access: "consume",
+	}}
+	context, err := s.runFind(c, "fred/model", "--format", "env")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+export JUJU_OFFER_COUNT='2'
+export JUJU_OFFER_1_URL='master:fred/model.db'
+export JUJU_OFFER_1_ACCESS='consume'
+export JUJU_OFFER_1_ENDPOINT_DB='mysql'
+export JUJU_OFFER_1_ENDPOINT_DB_ADMIN='mysql-root'
+export JUJU_OFFER_2_URL='master:fred/model.web'
+export JUJU_OFFER_2_ACCESS='read'
+export JUJU_OFFER_2_ENDPOINT_WEBSITE='http'
+
+`[1:])
+}
+
+func (s *findSuite) TestFindEnvNoOffers(c *gc.C) {
+	s.setupRoleOffers()
+	context, err := s.runFind(c, "master:", "--provides", "pgsql", "--format", "env")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, "")
+}
+
+func (s *findSuite) TestFindEnvOffersOnly(c *gc.C) {
+	s.assertFindError(c, []string{"--list-endpoints", "provider", "--format", "env"},
+		"--list-endpoints cannot be used with --format env")
+}
+
+func (s *findSuite) TestFindMatrix(c *gc.C) {
+	s.mockAPI.results = []params.ApplicationOffer{{
+		OfferURL:  "master:fred/model.app",
+		OfferName: "app",
+		Endpoints: []params.RemoteEndpoint{
+			{Name: "db", Interface: "mysql", Role: charm.RoleProvider},
+			{Name: "backend", Interface: "mysql", Role: charm.RoleRequirer},
+		},
+		Access: "consume",
+	}, {
+		OfferURL:  "master:fred/model.db",
+		OfferName: "db",
+		Endpoints: []params.RemoteEndpoint{
+			{Name: "db", Interface: "mysql", Role: charm.RoleProvider},
+			{Name: "logs", Interface: "syslog", Role: charm.RoleRequirer},
+		},
+		Access: "consume",
+	}, {
+		OfferURL:  "master:fred/model.web",
+		OfferName: "web",
+		Endpoints: []params.RemoteEndpoint{
+			{Name: "website", Interface: "http", Role: charm.RoleProvider},
+			{Name: "database", Interface: "mysql", Role: charm.RoleRequirer},
+			{Name: "cluster", Interface: "syslog", Role: charm.RolePeer},
+		},
+		Access: "read",
+	}}
+	context, err := s.runFind(c, "fred/model", "--format", "matrix")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+Interface  master:fred/model.app  master:fred/model.db  master:fred/model.web
+http                                                    P
+mysql      PR                     P                     R
+syslog                            R                     R
+
+`[1:])
+}
+
+func (s *findSuite) TestFindMatrixIncompatible(c *gc.C) {
+	s.assertFindError(c, []string{"--format", "matrix", "--group-by", "application"},
+		"--group-by cannot be used with --format matrix")
+	s.assertFindError(c, []string{"--format", "matrix", "--list-endpoints", "provider"},
+		"--list-endpoints cannot be used with --format matrix")
+}
+
+func (s *findSuite) setupCloudOffers() {
+	endpoints := []params.RemoteEndpoint{
+		{Name: "db", Interface: "mysql", Role: charm.RoleProvider},
+	}
+	s.mockAPI.results = []params.ApplicationOffer{{
+		OfferURL:    "master:fred/east.mysql",
+		OfferName:   "mysql",
+		Endpoints:   endpoints,
+		Access:      "read",
+		CloudName:   "aws",
+		CloudRegion: "us-east-1",
+	}, {
+		OfferURL:    "master:fred/west.mysql",
+		OfferName:   "mysql",
+		Endpoints:   endpoints,
+		Access:      "read",
+		CloudName:   "aws",
+		CloudRegion: "us-west-1",
+	}, {
+		OfferURL:    "master:fred/gce.mysql",
+		OfferName:   "mysql",
+		Endpoints:   endpoints,
+		Access:      "read",
+		CloudName:   "google",
+		CloudRegion: "us-east1",
+	}}
+}
+
+func (s *findSuite) runFindWithClouds(c *gc.C, args ...string) (*cmd.Context, error) {
+	cloudAPI := &mockCloudAPI{
+		clouds: map[names.CloudTag]jujucloud.Cloud{
+			names.NewCloudTag("aws"): {
+				Regions: []jujucloud.Region{{Name: "us-east-1"}, {Name: "us-west-1"}},
+			},
+			names.NewCloudTag("google"): {
+				Regions: []jujucloud.Region{{Name: "us-east1"}},
+			},
+		},
+	}
+	return cmdtesting.RunCommand(c, crossmodel.NewFindEndpointsCommandForTestWithCloudAPI(s.store, s.mockAPI, cloudAPI), args...)
+}
+
+func (s *findSuite) TestFindCloud(c *gc.C) {
+	s.setupCloudOffers()
+	context, err := s.runFindWithClouds(c, "--cloud", "aws", "--format", "tabular")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+Store   URL              Access  Interfaces
+master  fred/east.mysql  read    mysql:db
+master  fred/west.mysql  read    mysql:db
+
+2 offers: 2 read
+
+`[1:])
+}
+
+func (s *findSuite) TestFindCloudRegion(c *gc.C) {
+	s.setupCloudOffers()
+	context, err := s.runFindWithClouds(c, "--cloud", "aws", "--region", "us-west-1", "--format", "tabular")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+Store   URL              Access  Interfaces
+master  fred/west.mysql  read    mysql:db
+
+1 offer: 1 read
+
+`[1:])
+}
+
+func (s *findSuite) TestFindUnknownCloud(c *gc.C) {
+	s.setupCloudOffers()
+	_, err := s.runFindWithClouds(c, "--cloud", "azure")
+	c.Assert(err, gc.ErrorMatches, `cloud "azure" on controller "master" not found`)
+}
+
+func (s *findSuite) TestFindUnknownRegion(c *gc.C) {
+	s.setupCloudOffers()
+	_, err := s.runFindWithClouds(c, "--cloud", "aws", "--region", "eu-west-1")
+	c.Assert(err, gc.ErrorMatches, `region "eu-west-1" in cloud "aws" not found`)
+}
+
+func (s *findSuite) TestFindRegionWithoutCloud(c *gc.C) {
+	s.assertFindError(c, []string{"--region", "us-east-1"}, "--region requires --cloud")
+}
+
+func (s *findSuite) TestFindMatchBothRoles(c *gc.C) {
+	s.mockAPI.c = c
+	s.mockAPI.expectedFilter = &jujucrossmodel.ApplicationOfferFilter{
+		OwnerName: "fred",
+		ModelName: "model",
+		Endpoints: []jujucrossmodel.EndpointFilterTerm{{
+			Interface: "logging",
+			Role:      charm.RoleProvider,
+		}, {
+			Interface: "logging",
+			Role:      charm.RoleRequirer,
+		}},
+	}
+	s.mockAPI.results = []params.ApplicationOffer{{
+		OfferURL:  "master:fred/model.hosted-db2",
+		OfferName: "hosted-db2",
+		Endpoints: []params.RemoteEndpoint{
+			{Name: "logs", Interface: "logging", Role: charm.RoleRequirer},
+		},
+		Access: "consume",
+	}}
+	s.assertFind(
+		c,
+		[]string{"--format", "yaml", "--url", "fred/model", "--interface", "logging", "--match-both-roles", "--explain-matches"},
+		`
+master:fred/model.hosted-db2:
+  access: consume
+  endpoints:
+    logs:
+      interface: logging
+      role: requirer
+  matched-by:
+  - interface=logging
+  - role=requirer
+`[1:],
+	)
+}
+
+func (s *findSuite) TestFindMatchBothRolesFiltersOffers(c *gc.C) {
+	s.mockAPI.results = []params.ApplicationOffer{{
+		OfferURL:  "master:fred/model.provider",
+		OfferName: "provider",
+		Endpoints: []params.RemoteEndpoint{
+			{Name: "logs", Interface: "logging", Role: charm.RoleProvider},
+		},
+		Access: "consume",
+	}, {
+		OfferURL:  "master:fred/model.requirer",
+		OfferName: "requirer",
+		Endpoints: []params.RemoteEndpoint{
+			{Name: "logs", Interface: "logging", Role: charm.RoleRequirer},
+		},
+		Access: "consume",
+	}, {
+		OfferURL:  "master:fred/model.peer",
+		OfferName: "peer",
+		Endpoints: []params.RemoteEndpoint{
+			{Name: "logs", Interface: "logging", Role: charm.RolePeer},
+		},
+		Access: "consume",
+	}, {
+		OfferURL:  "master:fred/model.db",
+		OfferName: "db",
+		Endpoints: []params.RemoteEndpoint{
+			{Name: "db", Interface: "mysql", Role: charm.RoleProvider},
+		},
+		Access: "consume",
+	}}
+	s.assertFind(
+		c,
+		[]string{"fred/model", "--interface", "logging", "--match-both-roles"},
+		`
+Store   URL                  Access   Interfaces
+master  fred/model.provider  consume  logging:logs
+master  fred/model.requirer  consume  logging:logs
+
+2 offers: 2 consume
+
+`[1:],
+	)
+}
+
+func (s *findSuite) TestFindMatchBothRolesRequiresInterface(c *gc.C) {
+	s.assertFindError(c, []string{"--match-both-roles"}, "--match-both-roles requires --interface")
+}
+
+func (s *findSuite) TestFindCompatibleWith(c *gc.C) {
+	s.mockAPI.expectedModelName = "model"
+	s.assertFind(
+		c,
+		[]string{"fred/model", "--compatible-with", "http:requirer", "--format", "tabular"},
+		`
+Store   URL                    Access   Interfaces
+master  fred/model.hosted-db2  consume  http:db2, http:log
+
+1 offer: 1 consume
+
 `[1:],
 	)
 }
 
-func (s *findSuite) TestFindDuplicateUrl(c *gc.C) {
-	s.assertFindError(c, []string{"url", "--url", "urlparam"}, ".*URL term cannot be specified twice.*")
+func (s *findSuite) TestFindCompatibleWithNoMatch(c *gc.C) {
+	s.mockAPI.expectedModelName = "model"
+	s.assertFindError(c, []string{"fred/model", "--compatible-with", "mysql:requirer"},
+		"no matching application offers found")
+}
+
+func (s *findSuite) TestFindCompatibleWithInvalid(c *gc.C) {
+	s.assertFindError(c, []string{"--compatible-with", "mysql"},
+		`invalid --compatible-with "mysql", expected <interface>:<role>`)
+	s.assertFindError(c, []string{"--compatible-with", "mysql:consumer"},
+		`invalid --compatible-with role "consumer", expected provider, requirer or peer`)
+}
+
+func (s *findSuite) setupRoleOffers() {
+	s.mockAPI.results = []params.ApplicationOffer{{
+		OfferURL:  "master:fred/model.db",
+		OfferName: "db",
+		Endpoints: []params.RemoteEndpoint{
+			{Name: "db", Interface: "mysql", Role: charm.RoleProvider},
+			{Name: "logs", Interface: "syslog", Role: charm.RoleRequirer},
+		},
+		Access: "consume",
+	}, {
+		OfferURL:  "master:fred/model.web",
+		OfferName: "web",
+		Endpoints: []params.RemoteEndpoint{
+			{Name: "website", Interface: "http", Role: charm.RoleProvider},
+			{Name: "db", Interface: "mysql", Role: charm.RoleRequirer},
+		},
+		Access: "consume",
+	}, {
+		OfferURL:  "master:fred/other.db",
+		OfferName: "db",
+		Endpoints: []params.RemoteEndpoint{
+			{Name: "db", Interface: "mysql", Role: charm.RoleProvider},
+		},
+		Access: "consume",
+	}}
+}
+
+func (s *findSuite) TestFindProvides(c *gc.C) {
+	s.setupRoleOffers()
+	context, err := s.runFind(c, "master:", "--provides", "mysql")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+Store   URL            Access   Interfaces
+master  fred/model.db  consume  mysql:db, syslog:logs
+master  fred/other.db  consume  mysql:db
+
+2 offers: 2 consume
+
+`[1:])
+}
+
+func (s *findSuite) TestFindRequires(c *gc.C) {
+	s.setupRoleOffers()
+	context, err := s.runFind(c, "master:", "--requires", "mysql")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+Store   URL             Access   Interfaces
+master  fred/model.web  consume  http:website, mysql:db
+
+1 offer: 1 consume
+
+`[1:])
+}
+
+func (s *findSuite) TestFindProvidesAndRequires(c *gc.C) {
+	s.setupRoleOffers()
+	context, err := s.runFind(c, "master:", "--provides", "mysql", "--requires", "syslog")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+Store   URL            Access   Interfaces
+master  fred/model.db  consume  mysql:db, syslog:logs
+
+1 offer: 1 consume
+
+`[1:])
+
+	s.assertFindError(c, []string{"master:", "--provides", "http", "--requires", "syslog"},
+		"no matching application offers found")
+}
+
+func (s *findSuite) setupGatewayOffers() {
+	s.mockAPI.results = []params.ApplicationOffer{{
+		OfferURL:  "master:fred/model.gateway",
+		OfferName: "gateway",
+		Endpoints: []params.RemoteEndpoint{
+			{Name: "db", Interface: "mysql", Role: charm.RoleProvider},
+			{Name: "web", Interface: "http", Role: charm.RoleProvider},
+		},
+		Access: "consume",
+	}, {
+		// A single endpoint cannot expose two interfaces;
+		// only the last is kept.
+		OfferURL:  "master:fred/model.single",
+		OfferName: "single",
+		Endpoints: []params.RemoteEndpoint{
+			{Name: "api", Interface: "mysql", Role: charm.RoleProvider},
+			{Name: "api", Interface: "http", Role: charm.RoleProvider},
+		},
+		Access: "consume",
+	}, {
+		OfferURL:  "master:fred/model.pair",
+		OfferName: "pair",
+		Endpoints: []params.RemoteEndpoint{
+			{Name: "db", Interface: "mysql", Role: charm.RoleProvider},
+			{Name: "replica", Interface: "mysql", Role: charm.RoleProvider},
+		},
+		Access: "consume",
+	}}
 }
 
-func (s *findSuite) TestNoResults(c *gc.C) {
-	s.mockAPI.c = c
-	s.mockAPI.expectedModelName = "none"
-	s.mockAPI.expectedFilter = &jujucrossmodel.ApplicationOfferFilter{
-		OwnerName: "bob",
-		ModelName: "none",
-	}
-	s.mockAPI.results = []params.ApplicationOffer{}
-	s.assertFindError(
-		c,
-		[]string{"--url", "none"},
-		`no matching application offers found`,
-	)
+func (s *findSuite) TestFindInterfaceAllDistinct(c *gc.C) {
+	s.setupGatewayOffers()
+	context, err := s.runFind(c, "master:", "--interface-all-distinct", "mysql, http")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+Store   URL                 Access   Interfaces
+master  fred/model.gateway  consume  http:web, mysql:db
+
+1 offer: 1 consume
+
+`[1:])
 }
 
-func (s *findSuite) TestSimpleFilter(c *gc.C) {
+func (s *findSuite) TestFindInterfaceAllDistinctRepeated(c *gc.C) {
+	s.setupGatewayOffers()
+	context, err := s.runFind(c, "master:", "--interface-all-distinct", "mysql,mysql")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+Store   URL              Access   Interfaces
+master  fred/model.pair  consume  mysql:db, mysql:replica
+
+1 offer: 1 consume
+
+`[1:])
+}
+
+func (s *findSuite) TestFindInterfaceAllDistinctNoMatch(c *gc.C) {
+	s.setupGatewayOffers()
+	s.assertFindError(c, []string{"master:", "--interface-all-distinct", "mysql,http,http"},
+		"no matching application offers found")
+}
+
+func (s *findSuite) TestFindInterfaceAllDistinctInvalid(c *gc.C) {
+	s.assertFindError(c, []string{"--interface-all-distinct", "mysql,,http"},
+		`invalid --interface-all-distinct: empty interface name in "mysql,,http"`)
+}
+
+func (s *findSuite) runFindMain(c *gc.C, args ...string) (*cmd.Context, int) {
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(crossmodel.NewFindEndpointsCommandForTest(s.store, s.mockAPI), ctx, args)
+	return ctx, code
+}
+
+func (s *findSuite) TestFindExpectMinPass(c *gc.C) {
+	s.setupMixedModelOffers()
+	ctx, code := s.runFindMain(c, "master:", "--expect-min", "3")
+	c.Assert(code, gc.Equals, 0)
+	c.Assert(cmdtesting.Stdout(ctx), gc.Equals, "3\n")
+	c.Assert(cmdtesting.Stderr(ctx), gc.Equals, "")
+}
+
+func (s *findSuite) TestFindExpectMinFail(c *gc.C) {
+	s.setupMixedModelOffers()
+	ctx, code := s.runFindMain(c, "master:", "--expect-min", "4")
+	c.Assert(code, gc.Equals, 1)
+	c.Assert(cmdtesting.Stdout(ctx), gc.Equals, "3\n")
+	c.Assert(cmdtesting.Stderr(ctx), gc.Equals, "ERROR found 3 matching offers, expected at least 4\n")
+}
+
+func (s *findSuite) TestFindExpectMinFiltered(c *gc.C) {
+	s.setupMixedModelOffers()
+	ctx, code := s.runFindMain(c, "master:", "--url-regex", `\.web$`, "--expect-min", "1")
+	c.Assert(code, gc.Equals, 0)
+	c.Assert(cmdtesting.Stdout(ctx), gc.Equals, "1\n")
+
+	ctx, code = s.runFindMain(c, "master:", "--url-regex", `\.none$`, "--expect-min", "1")
+	c.Assert(code, gc.Equals, 1)
+	c.Assert(cmdtesting.Stdout(ctx), gc.Equals, "0\n")
+	c.Assert(cmdtesting.Stderr(ctx), gc.Equals, "ERROR found 0 matching offers, expected at least 1\n")
+}
+
+func (s *findSuite) TestFindExpectMinInvalid(c *gc.C) {
+	s.assertFindError(c, []string{"--expect-min", "-1"}, "invalid --expect-min -1, expected a positive number")
+	s.assertFindError(c, []string{"--expect-min", "1", "--watch", "--format", "json"}, "--expect-min cannot be used with --watch")
+}
+
+func (s *findSuite) writeInterfacesFile(c *gc.C, content string) string {
+	path := filepath.Join(c.MkDir(), "interfaces")
+	err := ioutil.WriteFile(path, []byte(content), 0600)
+	c.Assert(err, jc.ErrorIsNil)
+	return path
+}
+
+func (s *findSuite) TestFindInterfacesFile(c *gc.C) {
+	path := s.writeInterfacesFile(c, `
+# databases
+mysql
+
+  pgsql
+# logging
+syslog
+`)
+	s.setupRoleOffers()
 	s.mockAPI.c = c
-	s.mockAPI.expectedModelName = "model"
 	s.mockAPI.expectedFilter = &jujucrossmodel.ApplicationOfferFilter{
-		OfferName: "hosted-db2",
 		OwnerName: "fred",
 		ModelName: "model",
+		Endpoints: []jujucrossmodel.EndpointFilterTerm{
+			{Interface: "mysql"},
+			{Interface: "pgsql"},
+			{Interface: "syslog"},
+		},
 	}
-	s.mockAPI.expectedModelName = "model"
-	s.assertFind(
-		c,
-		[]string{"--format", "tabular", "--url", "fred/model.hosted-db2"},
-		`
-Store   URL                    Access   Interfaces
-master  fred/model.hosted-db2  consume  http:db2, http:log
+	context, err := s.runFind(c, "fred/model", "--interfaces-file", path)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+Store   URL             Access   Interfaces
+master  fred/model.db   consume  mysql:db, syslog:logs
+master  fred/model.web  consume  http:website, mysql:db
+master  fred/other.db   consume  mysql:db
 
-`[1:],
-	)
+3 offers: 3 consume
+
+`[1:])
 }
 
-func (s *findSuite) TestEndpointFilter(c *gc.C) {
+func (s *findSuite) TestFindInterfacesFileExcludesOtherInterfaces(c *gc.C) {
+	path := s.writeInterfacesFile(c, "pgsql\nsyslog\n")
+	s.setupRoleOffers()
+	context, err := s.runFind(c, "fred/model", "--interfaces-file", path)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+Store   URL            Access   Interfaces
+master  fred/model.db  consume  mysql:db, syslog:logs
+
+1 offer: 1 consume
+
+`[1:])
+}
+
+func (s *findSuite) TestFindInterfacesFileWithEndpoint(c *gc.C) {
+	path := s.writeInterfacesFile(c, "mysql\npgsql\n")
+	s.setupRoleOffers()
 	s.mockAPI.c = c
 	s.mockAPI.expectedFilter = &jujucrossmodel.ApplicationOfferFilter{
-		OwnerName: "fred",
-		ModelName: "model",
-		Endpoints: []jujucrossmodel.EndpointFilterTerm{{
-			Interface: "mysql",
-			Name:      "db",
-		}},
+		Endpoints: []jujucrossmodel.EndpointFilterTerm{
+			{Interface: "mysql", Name: "db"},
+			{Interface: "pgsql", Name: "db"},
+		},
 	}
+	_, err := s.runFind(c, "--interfaces-file", path, "--endpoint", "db")
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *findSuite) TestFindInterfacesFileErrors(c *gc.C) {
+	path := s.writeInterfacesFile(c, "# nothing here\n\n")
+	s.assertFindError(c, []string{"--interfaces-file", path}, `no interfaces listed in ".*interfaces"`)
+	s.assertFindError(c, []string{"--interfaces-file", path + "-missing"}, "reading interfaces file: .*")
+	s.assertFindError(c, []string{"--interfaces-file", path, "--interface", "mysql"},
+		"--interfaces-file cannot be used with --interface or --match-both-roles")
+}
+
+func (s *findSuite) runFindTimed(c *gc.C, args ...string) (*cmd.Context, error) {
 	s.mockAPI.expectedModelName = "model"
-	s.assertFind(
-		c,
-		[]string{"--format", "tabular", "--url", "fred/model", "--endpoint", "db", "--interface", "mysql"},
-		`
-Store   URL                    Access   Interfaces
-master  fred/model.hosted-db2  consume  http:db2, http:log
+	clock := testing.NewClock(time.Now())
+	latencies := map[string]time.Duration{
+		"east": 250 * time.Millisecond,
+		"west": 1500 * time.Millisecond,
+	}
+	newAPIFunc := func(controllerName string) (crossmodel.FindAPI, error) {
+		api := mockSlowFindAPI{
+			mockFindAPI: *s.mockAPI,
+			clock:       clock,
+			latency:     latencies[controllerName],
+		}
+		api.controllerName = controllerName
+		return api, nil
+	}
+	path := s.writeSourceGroups(c)
+	args = append([]string{"fred/model", "--source-group", "prod", "--source-group-file", path, "--timings"}, args...)
+	return cmdtesting.RunCommand(c, crossmodel.NewFindEndpointsCommandForTestWithAPIFuncAndClock(s.store, newAPIFunc, clock), args...)
+}
 
-`[1:],
-	)
+func (s *findSuite) TestFindTimingsTabular(c *gc.C) {
+	context, err := s.runFindTimed(c)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+Store  URL                    Access   Interfaces
+east   fred/model.hosted-db2  consume  http:db2, http:log
+west   fred/model.hosted-db2  consume  http:db2, http:log
+
+2 offers: 2 consume
+
+Source  Time
+east    250ms
+west    1.5s
+
+`[1:])
+}
+
+func (s *findSuite) TestFindTimingsYAML(c *gc.C) {
+	context, err := s.runFindTimed(c, "--format", "yaml")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+results:
+  east:fred/model.hosted-db2:
+    access: consume
+    endpoints:
+      db2:
+        interface: http
+        role: requirer
+        pass-through: true
+      log:
+        interface: http
+        role: provider
+        pass-through: true
+  west:fred/model.hosted-db2:
+    access: consume
+    endpoints:
+      db2:
+        interface: http
+        role: requirer
+        pass-through: true
+      log:
+        interface: http
+        role: provider
+        pass-through: true
+timings:
+  east: 250ms
+  west: 1.5s
+`[1:])
+}
+
+func (s *findSuite) TestFindTimingsJSON(c *gc.C) {
+	context, err := s.runFindTimed(c, "--list-sources", "--format", "json")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals,
+		`{"results":[{"name":"east","offers":1},{"name":"west","offers":1}],"timings":{"east":"250ms","west":"1.5s"}}`+"\n")
+}
+
+func (s *findSuite) TestFindTimingsErrors(c *gc.C) {
+	s.assertFindError(c, []string{"--timings", "--format", "dot"}, "--timings cannot be used with --format dot")
+	s.assertFindError(c, []string{"--timings", "--expect-min", "1"}, "--timings cannot be used with --watch or --expect-min")
 }
 
 func (s *findSuite) TestFindApiError(c *gc.C) {
@@ -118,6 +2627,29 @@ func (s *findSuite) TestFindApiError(c *gc.C) {
 	s.assertFindError(c, []string{"fred/model.db2"}, ".*fail.*")
 }
 
+func (s *findSuite) TestFindStructuredErrorJSON(c *gc.C) {
+	s.mockAPI.err = &params.Error{Code: params.CodeUnauthorized, Message: "permission denied"}
+	context, err := s.runFind(c, "fred/model.db2", "--format", "json", "--structured-errors")
+	c.Assert(err, gc.Equals, cmd.ErrSilent)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, "")
+	c.Assert(cmdtesting.Stderr(context), gc.Equals,
+		`{"error":{"message":"permission denied","code":"unauthorized access"}}`+"\n")
+}
+
+func (s *findSuite) TestFindStructuredErrorYAML(c *gc.C) {
+	s.mockAPI.msg = "fail"
+	context, err := s.runFind(c, "fred/model.db2", "--format", "yaml", "--structured-errors")
+	c.Assert(err, gc.Equals, cmd.ErrSilent)
+	c.Assert(cmdtesting.Stderr(context), gc.Equals, `
+error:
+  message: fail
+`[1:])
+}
+
+func (s *findSuite) TestFindStructuredErrorTabular(c *gc.C) {
+	s.assertFindError(c, []string{"--structured-errors"}, "--structured-errors requires --format yaml or json")
+}
+
 func (s *findSuite) TestFindYaml(c *gc.C) {
 	s.mockAPI.expectedModelName = "model"
 	s.assertFind(
@@ -130,13 +2662,156 @@ master:fred/model.hosted-db2:
     db2:
       interface: http
       role: requirer
+      pass-through: true
     log:
       interface: http
       role: provider
+      pass-through: true
 `[1:],
 	)
 }
 
+func (s *findSuite) setupModelOffers() {
+	offer := func(url string) params.ApplicationOffer {
+		return params.ApplicationOffer{
+			OfferURL:  url,
+			OfferName: "db",
+			Endpoints: []params.RemoteEndpoint{{Name: "db", Interface: "mysql", Role: charm.RoleProvider}},
+			Access:    "consume",
+		}
+	}
+	s.mockAPI.modelResults = map[string][]params.ApplicationOffer{
+		"fred/prod":    {offer("master:fred/prod.db")},
+		"fred/staging": {offer("master:fred/staging.db")},
+		"mary/prod":    {offer("master:mary/prod.db")},
+	}
+}
+
+func (s *findSuite) TestFindModels(c *gc.C) {
+	s.setupModelOffers()
+	context, err := s.runFind(c, "--model", "fred/prod", "--model", "mary/prod")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+Store   URL           Access   Interfaces
+master  fred/prod.db  consume  mysql:db
+master  mary/prod.db  consume  mysql:db
+
+2 offers: 2 consume
+
+`[1:])
+}
+
+func (s *findSuite) TestFindModelsSingleQuery(c *gc.C) {
+	s.setupModelOffers()
+	var received [][]jujucrossmodel.ApplicationOfferFilter
+	s.mockAPI.received = &received
+	_, err := s.runFind(c, "--model", "fred/prod", "--model", "mary/prod", "--interface", "mysql")
+	c.Assert(err, jc.ErrorIsNil)
+	endpoints := []jujucrossmodel.EndpointFilterTerm{{Interface: "mysql"}}
+	c.Assert(received, jc.DeepEquals, [][]jujucrossmodel.ApplicationOfferFilter{{
+		{OwnerName: "fred", ModelName: "prod", Endpoints: endpoints},
+		{OwnerName: "mary", ModelName: "prod", Endpoints: endpoints},
+	}})
+}
+
+func (s *findSuite) TestFindModelsControllerURL(c *gc.C) {
+	s.setupModelOffers()
+	context, err := s.runFind(c, "master:", "--model", "fred/prod,fred/staging", "--format", "yaml", "--count-by", "model")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+master:fred/prod: 1
+master:fred/staging: 1
+`[1:])
+}
+
+func (s *findSuite) TestFindModelsDuplicate(c *gc.C) {
+	s.setupModelOffers()
+	context, err := s.runFind(c, "--model", "fred/prod", "--model", "fred/prod", "--format", "yaml", "--count-by", "model")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, "master:fred/prod: 1\n")
+}
+
+func (s *findSuite) TestFindModelsInvalid(c *gc.C) {
+	s.assertFindError(c, []string{"--model", "prod"}, `invalid --model "prod", expected <owner>/<model>`)
+	s.assertFindError(c, []string{"--model", "fred/prod/db"}, `invalid --model "fred/prod/db", expected <owner>/<model>`)
+	s.assertFindError(c, []string{"--model", "fred/Prod"}, `invalid --model "fred/Prod", expected <owner>/<model>`)
+	s.assertFindError(c, []string{"--model", "fred/prod", "--watch"},
+		"--model cannot be used with --watch or --ignore-case")
+	s.assertFindError(c, []string{"--model", "fred/prod", "fred/staging"},
+		"--model cannot be used with a URL naming a model or offer")
+}
+
+func (s *findSuite) setupPassThroughOffers() {
+	s.mockAPI.results = []params.ApplicationOffer{{
+		OfferURL:  "master:fred/model.proxy",
+		OfferName: "proxy",
+		Endpoints: []params.RemoteEndpoint{
+			{Name: "website", Interface: "http", Role: charm.RoleProvider},
+			{Name: "upstream", Interface: "http", Role: charm.RoleRequirer},
+			{Name: "db", Interface: "mysql", Role: charm.RoleRequirer},
+		},
+		Access: "consume",
+	}}
+}
+
+func (s *findSuite) TestFindPassThroughYAML(c *gc.C) {
+	s.setupPassThroughOffers()
+	context, err := s.runFind(c, "fred/model", "--format", "yaml")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+master:fred/model.proxy:
+  access: consume
+  endpoints:
+    db:
+      interface: mysql
+      role: requirer
+    upstream:
+      interface: http
+      role: requirer
+      pass-through: true
+    website:
+      interface: http
+      role: provider
+      pass-through: true
+`[1:])
+}
+
+func (s *findSuite) TestFindPassThroughCompactJSON(c *gc.C) {
+	s.setupPassThroughOffers()
+	context, err := s.runFind(c, "fred/model", "--format", "json", "--compact")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals,
+		`{"master:fred/model.proxy":{"access":"consume","endpoints":{`+
+			`"db":{"interface":"mysql","role":"requirer"},`+
+			`"upstream":{"interface":"http","role":"requirer","pass-through":true},`+
+			`"website":{"interface":"http","role":"provider","pass-through":true}}}}`+"\n")
+}
+
+func (s *findSuite) TestFindPassThroughSameRole(c *gc.C) {
+	s.mockAPI.results = []params.ApplicationOffer{{
+		OfferURL:  "master:fred/model.web",
+		OfferName: "web",
+		Endpoints: []params.RemoteEndpoint{
+			{Name: "website", Interface: "http", Role: charm.RoleProvider},
+			{Name: "admin", Interface: "http", Role: charm.RoleProvider},
+		},
+		Access: "consume",
+	}}
+	context, err := s.runFind(c, "fred/model", "--format", "yaml")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, `
+master:fred/model.web:
+  access: consume
+  endpoints:
+    admin:
+      interface: http
+      role: provider
+    website:
+      interface: http
+      role: provider
+`[1:])
+}
+
 func (s *findSuite) TestFindTabular(c *gc.C) {
 	s.mockAPI.expectedModelName = "model"
 	s.assertFind(
@@ -146,6 +2821,65 @@ func (s *findSuite) TestFindTabular(c *gc.C) {
 Store   URL                    Access   Interfaces
 master  fred/model.hosted-db2  consume  http:db2, http:log
 
+1 offer: 1 consume
+
+`[1:],
+	)
+}
+
+func (s *findSuite) TestFindApplicationName(c *gc.C) {
+	s.mockAPI.results = []params.ApplicationOffer{{
+		OfferURL:        "master:fred/model.hosted-db2",
+		OfferName:       "hosted-db2",
+		ApplicationName: "db2",
+		Endpoints: []params.RemoteEndpoint{
+			{Name: "db2", Interface: "http", Role: charm.RoleRequirer},
+		},
+		Access: "admin",
+	}}
+	s.assertFind(
+		c,
+		[]string{"fred/model.hosted-db2", "--format", "yaml"},
+		`
+master:fred/model.hosted-db2:
+  access: admin
+  application: db2
+  endpoints:
+    db2:
+      interface: http
+      role: requirer
+`[1:],
+	)
+}
+
+func (s *findSuite) TestFindApplicationNameTabular(c *gc.C) {
+	s.mockAPI.results = []params.ApplicationOffer{{
+		OfferURL:        "master:fred/model.hosted-db2",
+		OfferName:       "hosted-db2",
+		ApplicationName: "db2",
+		Endpoints: []params.RemoteEndpoint{
+			{Name: "db2", Interface: "http", Role: charm.RoleRequirer},
+		},
+		Access: "admin",
+	}, {
+		OfferURL:        "master:fred/model.mysql",
+		OfferName:       "mysql",
+		ApplicationName: "mysql",
+		Endpoints: []params.RemoteEndpoint{
+			{Name: "db", Interface: "mysql", Role: charm.RoleProvider},
+		},
+		Access: "admin",
+	}}
+	s.assertFind(
+		c,
+		[]string{"fred/model", "--format", "tabular"},
+		`
+Store   URL                    Access  Application  Interfaces
+master  fred/model.hosted-db2  admin   db2          http:db2
+master  fred/model.mysql       admin   mysql        mysql:db
+
+2 offers: 2 admin
+
 `[1:],
 	)
 }
@@ -160,6 +2894,8 @@ func (s *findSuite) TestFindDifferentController(c *gc.C) {
 Store      URL                    Access   Interfaces
 different  fred/model.hosted-db2  consume  http:db2, http:log
 
+1 offer: 1 consume
+
 `[1:],
 	)
 }
@@ -177,13 +2913,163 @@ func (s *findSuite) assertFindError(c *gc.C, args []string, expected string) {
 	c.Assert(err, gc.ErrorMatches, expected)
 }
 
+type compatibleSuite struct{}
+
+var _ = gc.Suite(&compatibleSuite{})
+
+func (s *compatibleSuite) TestCheckInterfaceCompatible(c *gc.C) {
+	for i, t := range []struct {
+		endpoint crossmodel.RemoteEndpoint
+		iface    string
+		role     string
+		err      string
+	}{{
+		endpoint: crossmodel.RemoteEndpoint{Interface: "mysql", Role: "provider"},
+		iface:    "mysql",
+		role:     "requirer",
+	}, {
+		endpoint: crossmodel.RemoteEndpoint{Interface: "logging", Role: "requirer"},
+		iface:    "logging",
+		role:     "provider",
+	}, {
+		endpoint: crossmodel.RemoteEndpoint{Interface: "cluster", Role: "peer"},
+		iface:    "cluster",
+		role:     "peer",
+	}, {
+		endpoint: crossmodel.RemoteEndpoint{Interface: "mysql", Role: "provider"},
+		iface:    "pgsql",
+		role:     "requirer",
+		err:      `interface "mysql" does not match "pgsql"`,
+	}, {
+		endpoint: crossmodel.RemoteEndpoint{Interface: "mysql", Role: "provider"},
+		iface:    "mysql",
+		role:     "provider",
+		err:      `role "provider" cannot relate to "provider"`,
+	}, {
+		endpoint: crossmodel.RemoteEndpoint{Interface: "mysql", Role: "provider"},
+		iface:    "mysql",
+		role:     "consumer",
+		err:      `relation role "consumer" not valid`,
+	}} {
+		c.Logf("test %d", i)
+		err := crossmodel.CheckInterfaceCompatible(t.endpoint, t.iface, t.role)
+		if t.err == "" {
+			c.Check(err, jc.ErrorIsNil)
+		} else {
+			c.Check(err, gc.ErrorMatches, t.err)
+		}
+	}
+}
+
+type mergeSuite struct{}
+
+var _ = gc.Suite(&mergeSuite{})
+
+func (s *mergeSuite) TestMergeDisjoint(c *gc.C) {
+	a := map[string]crossmodel.ApplicationOfferResult{
+		"east:fred/model.db2": {
+			Access:    "read",
+			Endpoints: map[string]crossmodel.RemoteEndpoint{"db": {Interface: "db2", Role: "provider"}},
+		},
+	}
+	b := map[string]crossmodel.ApplicationOfferResult{
+		"west:fred/model.mysql": {
+			Access:    "consume",
+			Endpoints: map[string]crossmodel.RemoteEndpoint{"db": {Interface: "mysql", Role: "provider"}},
+		},
+	}
+	merged := crossmodel.MergeOfferResults(a, b)
+	c.Assert(merged, jc.DeepEquals, map[string]crossmodel.ApplicationOfferResult{
+		"east:fred/model.db2":   a["east:fred/model.db2"],
+		"west:fred/model.mysql": b["west:fred/model.mysql"],
+	})
+}
+
+func (s *mergeSuite) TestMergeCollision(c *gc.C) {
+	a := map[string]crossmodel.ApplicationOfferResult{
+		"east:fred/model.db2": {
+			Access:    "admin",
+			Endpoints: map[string]crossmodel.RemoteEndpoint{"db": {Interface: "db2", Role: "provider"}},
+		},
+	}
+	b := map[string]crossmodel.ApplicationOfferResult{
+		"east:fred/model.db2": {
+			Access:    "read",
+			Endpoints: map[string]crossmodel.RemoteEndpoint{"log": {Interface: "http", Role: "requirer"}},
+		},
+	}
+	merged := crossmodel.MergeOfferResults(a, b)
+	c.Assert(merged, jc.DeepEquals, map[string]crossmodel.ApplicationOfferResult{
+		"east:fred/model.db2": {
+			Access: "admin",
+			Endpoints: map[string]crossmodel.RemoteEndpoint{
+				"db":  {Interface: "db2", Role: "provider"},
+				"log": {Interface: "http", Role: "requirer"},
+			},
+		},
+	})
+	// The inputs are left untouched.
+	c.Assert(a["east:fred/model.db2"].Endpoints, gc.HasLen, 1)
+
+	// The highest access wins regardless of order.
+	merged = crossmodel.MergeOfferResults(b, a)
+	c.Assert(merged["east:fred/model.db2"].Access, gc.Equals, "admin")
+}
+
+func (s *mergeSuite) TestMergePassThrough(c *gc.C) {
+	a := map[string]crossmodel.ApplicationOfferResult{
+		"east:fred/model.proxy": {
+			Endpoints: map[string]crossmodel.RemoteEndpoint{"website": {Interface: "http", Role: "provider"}},
+		},
+	}
+	b := map[string]crossmodel.ApplicationOfferResult{
+		"east:fred/model.proxy": {
+			Endpoints: map[string]crossmodel.RemoteEndpoint{"upstream": {Interface: "http", Role: "requirer"}},
+		},
+	}
+	merged := crossmodel.MergeOfferResults(a, b)
+	c.Assert(merged["east:fred/model.proxy"].Endpoints, jc.DeepEquals, map[string]crossmodel.RemoteEndpoint{
+		"website":  {Interface: "http", Role: "provider", PassThrough: true},
+		"upstream": {Interface: "http", Role: "requirer", PassThrough: true},
+	})
+	// The inputs are left untouched.
+	c.Assert(a["east:fred/model.proxy"].Endpoints["website"].PassThrough, jc.IsFalse)
+}
+
+func (s *mergeSuite) TestOfferURLs(c *gc.C) {
+	results := map[string]crossmodel.ApplicationOfferResult{
+		"west:fred/model.mysql": {Access: "consume"},
+		"east:fred/model.db2":   {Access: "read"},
+		"east:alice/prod.web":   {Access: "admin"},
+		"east:fred/model.cache": {Access: "read"},
+	}
+	c.Assert(crossmodel.OfferURLs(results), jc.DeepEquals, []string{
+		"east:alice/prod.web",
+		"east:fred/model.cache",
+		"east:fred/model.db2",
+		"west:fred/model.mysql",
+	})
+}
+
+func (s *mergeSuite) TestOfferURLsEmpty(c *gc.C) {
+	c.Assert(crossmodel.OfferURLs(nil), gc.HasLen, 0)
+}
+
 type mockFindAPI struct {
 	c                 *gc.C
 	controllerName    string
 	msg, offerName    string
+	err               error
 	expectedModelName string
 	expectedFilter    *jujucrossmodel.ApplicationOfferFilter
 	results           []params.ApplicationOffer
+
+	// modelResults, if set, holds the offers
+	// returned for each "<owner>/<model>" filter.
+	modelResults map[string][]params.ApplicationOffer
+
+	// received, if set, records the filters of each call.
+	received *[][]jujucrossmodel.ApplicationOfferFilter
 }
 
 func (s mockFindAPI) Close() error {
@@ -191,13 +3077,26 @@ func (s mockFindAPI) Close() error {
 }
 
 func (s mockFindAPI) FindApplicationOffers(filters ...jujucrossmodel.ApplicationOfferFilter) ([]params.ApplicationOffer, error) {
+	if s.received != nil {
+		*s.received = append(*s.received, filters)
+	}
 	if s.msg != "" {
 		return nil, errors.New(s.msg)
 	}
+	if s.err != nil {
+		return nil, s.err
+	}
 	if s.expectedFilter != nil {
 		s.c.Assert(filters, gc.HasLen, 1)
 		s.c.Assert(filters[0], jc.DeepEquals, *s.expectedFilter)
 	}
+	if s.modelResults != nil {
+		var offers []params.ApplicationOffer
+		for _, filter := range filters {
+			offers = append(offers, s.modelResults[filter.OwnerName+"/"+filter.ModelName]...)
+		}
+		return offers, nil
+	}
 
 	if s.results != nil {
 		return s.results, nil
@@ -217,3 +3116,44 @@ func (s mockFindAPI) FindApplicationOffers(filters ...jujucrossmodel.Application
 		Access: "consume",
 	}}, nil
 }
+
+// mockSlowFindAPI is a find API which
+// takes latency to return its offers.
+type mockSlowFindAPI struct {
+	mockFindAPI
+	clock   *testing.Clock
+	latency time.Duration
+}
+
+func (s mockSlowFindAPI) FindApplicationOffers(filters ...jujucrossmodel.ApplicationOfferFilter) ([]params.ApplicationOffer, error) {
+	s.clock.Advance(s.latency)
+	return s.mockFindAPI.FindApplicationOffers(filters...)
+}
+
+type mockStatusAPI struct {
+	status *params.FullStatus
+	err    error
+}
+
+func (m *mockStatusAPI) Close() error {
+	return nil
+}
+
+func (m *mockStatusAPI) Status(patterns []string) (*params.FullStatus, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	return m.status, nil
+}
+
+type mockCloudAPI struct {
+	clouds map[names.CloudTag]jujucloud.Cloud
+}
+
+func (m *mockCloudAPI) Close() error {
+	return nil
+}
+
+func (m *mockCloudAPI) Clouds() (map[names.CloudTag]jujucloud.Cloud, error) {
+	return m.clouds, nil
+}
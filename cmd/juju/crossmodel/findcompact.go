@@ -0,0 +1,64 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package crossmodel
+
+// compactOfferResult is the view of an ApplicationOfferResult
+// written by --compact, in which empty fields are omitted.
+type compactOfferResult struct {
+	Access          string                     `yaml:"access,omitempty" json:"access,omitempty"`
+	ApplicationName string                     `yaml:"application,omitempty" json:"application,omitempty"`
+	Endpoints       map[string]compactEndpoint `yaml:"endpoints,omitempty" json:"endpoints,omitempty"`
+	Users           map[string]string          `yaml:"users,omitempty" json:"users,omitempty"`
+	Remote          bool                       `yaml:"remote,omitempty" json:"remote,omitempty"`
+	Consumed        bool                       `yaml:"consumed,omitempty" json:"consumed,omitempty"`
+	APIAddresses    []string                   `yaml:"api-addresses,omitempty" json:"api-addresses,omitempty"`
+	MatchedBy       []string                   `yaml:"matched-by,omitempty" json:"matched-by,omitempty"`
+	Usage           *OfferUsage                `yaml:"usage,omitempty" json:"usage,omitempty"`
+
+	ControllerVersion string `yaml:"controller-version,omitempty" json:"controller-version,omitempty"`
+}
+
+// compactEndpoint is the view of a RemoteEndpoint
+// written by --compact, in which empty fields are omitted.
+type compactEndpoint struct {
+	Interface     string `yaml:"interface,omitempty" json:"interface,omitempty"`
+	Role          string `yaml:"role,omitempty" json:"role,omitempty"`
+	Capacity      string `yaml:"capacity,omitempty" json:"capacity,omitempty"`
+	RelationCount *int   `yaml:"relation-count,omitempty" json:"relation-count,omitempty"`
+	PassThrough   bool   `yaml:"pass-through,omitempty" json:"pass-through,omitempty"`
+}
+
+// compactOfferResults returns the compact views of the results.
+func compactOfferResults(results map[string]ApplicationOfferResult) map[string]compactOfferResult {
+	compact := make(map[string]compactOfferResult, len(results))
+	for url, result := range results {
+		var endpoints map[string]compactEndpoint
+		if len(result.Endpoints) > 0 {
+			endpoints = make(map[string]compactEndpoint, len(result.Endpoints))
+			for name, ep := range result.Endpoints {
+				endpoints[name] = compactEndpoint{
+					Interface:     ep.Interface,
+					Role:          ep.Role,
+					Capacity:      ep.Capacity,
+					RelationCount: ep.RelationCount,
+					PassThrough:   ep.PassThrough,
+				}
+			}
+		}
+		compact[url] = compactOfferResult{
+			Access:          result.Access,
+			ApplicationName: result.ApplicationName,
+			Endpoints:       endpoints,
+			Users:           result.Users,
+			Remote:          result.Remote,
+			Consumed:        result.Consumed,
+			APIAddresses:    result.APIAddresses,
+			MatchedBy:       result.MatchedBy,
+			Usage:           result.Usage,
+
+			ControllerVersion: result.ControllerVersion,
+		}
+	}
+	return compact
+}
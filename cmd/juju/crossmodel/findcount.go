@@ -0,0 +1,57 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package crossmodel
+
+import (
+	"io"
+	"sort"
+
+	"github.com/juju/juju/cmd/output"
+	"github.com/juju/juju/core/crossmodel"
+)
+
+// countByModel is the --count-by value counting offers per model.
+const countByModel = "model"
+
+// countOffersByModel returns the number of offers in each model,
+// keyed by the model's URL, eg "mycontroller:fred/prod".
+func countOffersByModel(results map[string]ApplicationOfferResult) (map[string]int, error) {
+	counts := make(map[string]int)
+	for urlStr := range results {
+		url, err := crossmodel.ParseApplicationURL(urlStr)
+		if err != nil {
+			return nil, err
+		}
+		counts[modelURL(url)]++
+	}
+	return counts, nil
+}
+
+// modelURL returns the URL of the model hosting the offer.
+func modelURL(url *crossmodel.ApplicationURL) string {
+	model := url.User + "/" + url.ModelName
+	if url.Source == "" {
+		return model
+	}
+	return url.Source + ":" + model
+}
+
+// formatCountsTabular writes the number of offers in each model,
+// ordered by model.
+func formatCountsTabular(writer io.Writer, counts map[string]int) error {
+	models := make([]string, 0, len(counts))
+	for model := range counts {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+
+	tw := output.TabWriter(writer)
+	w := output.Wrapper{tw}
+	w.Println("Model", "Offers")
+	for _, model := range models {
+		w.Println(model, counts[model])
+	}
+	tw.Flush()
+	return nil
+}
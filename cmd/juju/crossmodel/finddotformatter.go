@@ -0,0 +1,83 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package crossmodel
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/juju/errors"
+	"gopkg.in/juju/charm.v6-unstable"
+)
+
+// formatFindDot returns a Graphviz graph connecting the offers to the
+// interfaces they provide and require, or errors out if parameter is
+// not of expected type.
+func formatFindDot(writer io.Writer, value interface{}) error {
+	offers, ok := value.(map[string]ApplicationOfferResult)
+	if !ok {
+		return errors.Errorf("expected value of type %T, got %T", offers, value)
+	}
+	return formatFoundEndpointsDot(writer, offers)
+}
+
+// formatFoundEndpointsDot writes a graph in which offers and interfaces
+// are nodes. Each offered endpoint is an edge labelled with the endpoint
+// name, from the offer to the interface for providers and from the
+// interface to the offer for requirers and peers.
+func formatFoundEndpointsDot(writer io.Writer, all map[string]ApplicationOfferResult) error {
+	urls := OfferURLs(all)
+
+	interfaces := make(map[string]bool)
+	var edges []string
+	for _, url := range urls {
+		offer := all[url]
+		names := make([]string, 0, len(offer.Endpoints))
+		for name := range offer.Endpoints {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			ep := offer.Endpoints[name]
+			interfaces[ep.Interface] = true
+			from, to := dotQuote(url), dotInterfaceNode(ep.Interface)
+			if ep.Role != string(charm.RoleProvider) {
+				from, to = to, from
+			}
+			edges = append(edges, fmt.Sprintf("  %s -> %s [label=%s];", from, to, dotQuote(name)))
+		}
+	}
+	interfaceNames := make([]string, 0, len(interfaces))
+	for name := range interfaces {
+		interfaceNames = append(interfaceNames, name)
+	}
+	sort.Strings(interfaceNames)
+
+	lines := []string{"digraph offers {"}
+	for _, url := range urls {
+		lines = append(lines, fmt.Sprintf("  %s [shape=box];", dotQuote(url)))
+	}
+	for _, name := range interfaceNames {
+		lines = append(lines, fmt.Sprintf("  %s [label=%s, shape=ellipse];", dotInterfaceNode(name), dotQuote(name)))
+	}
+	lines = append(lines, edges...)
+	lines = append(lines, "}")
+	_, err := fmt.Fprintln(writer, strings.Join(lines, "\n"))
+	return err
+}
+
+// dotInterfaceNode returns the quoted node ID for an interface,
+// distinct from any offer URL.
+func dotInterfaceNode(name string) string {
+	return dotQuote("interface:" + name)
+}
+
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// dotQuote returns s as a quoted DOT identifier.
+func dotQuote(s string) string {
+	return `"` + dotEscaper.Replace(s) + `"`
+}
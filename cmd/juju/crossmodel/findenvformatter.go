@@ -0,0 +1,75 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package crossmodel
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/juju/errors"
+)
+
+// formatFindEnv returns shell export statements describing the offers,
+// or errors out if parameter is not of expected type.
+func formatFindEnv(writer io.Writer, value interface{}) error {
+	offers, ok := value.(map[string]ApplicationOfferResult)
+	if !ok {
+		return errors.Errorf("expected value of type %T, got %T", offers, value)
+	}
+	return formatFoundEndpointsEnv(writer, offers)
+}
+
+// formatFoundEndpointsEnv writes an export statement for the number of
+// offers, JUJU_OFFER_COUNT, and, for the Nth offer in order of URL, for
+// its URL and access, JUJU_OFFER_<N>_URL and JUJU_OFFER_<N>_ACCESS, and
+// for the interface of each endpoint, JUJU_OFFER_<N>_ENDPOINT_<NAME>.
+// Nothing is written if there are no offers.
+func formatFoundEndpointsEnv(writer io.Writer, all map[string]ApplicationOfferResult) error {
+	if len(all) == 0 {
+		return nil
+	}
+	urls := OfferURLs(all)
+
+	lines := []string{envExport("JUJU_OFFER_COUNT", fmt.Sprint(len(urls)))}
+	for i, url := range urls {
+		offer := all[url]
+		prefix := fmt.Sprintf("JUJU_OFFER_%d_", i+1)
+		lines = append(lines,
+			envExport(prefix+"URL", url),
+			envExport(prefix+"ACCESS", offer.Access),
+		)
+		names := make([]string, 0, len(offer.Endpoints))
+		for name := range offer.Endpoints {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			lines = append(lines, envExport(prefix+"ENDPOINT_"+envName(name), offer.Endpoints[name].Interface))
+		}
+	}
+	_, err := fmt.Fprintln(writer, strings.Join(lines, "\n"))
+	return err
+}
+
+// envExport returns a shell statement exporting the variable
+// with the value, which is quoted so that it is taken literally.
+func envExport(name, value string) string {
+	return fmt.Sprintf("export %s='%s'", name, strings.Replace(value, "'", `'\''`, -1))
+}
+
+// envName returns s in upper case, with each character not valid
+// in an environment variable name replaced by an underscore.
+func envName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '_':
+			return r
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		}
+		return '_'
+	}, s)
+}
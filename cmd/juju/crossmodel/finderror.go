@@ -0,0 +1,45 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package crossmodel
+
+import (
+	"fmt"
+
+	"github.com/juju/cmd"
+
+	"github.com/juju/juju/apiserver/params"
+)
+
+// structuredError is the form in which --structured-errors writes
+// an error, so that it can be read in the requested output format.
+type structuredError struct {
+	Error structuredErrorDetail `yaml:"error" json:"error"`
+}
+
+// structuredErrorDetail describes an error written by --structured-errors.
+type structuredErrorDetail struct {
+	// Message is the error message.
+	Message string `yaml:"message" json:"message"`
+
+	// Code is the API error code, if any, eg "unauthorized access".
+	Code string `yaml:"code,omitempty" json:"code,omitempty"`
+}
+
+// writeStructuredError writes the error to stderr in
+// the output format, which must be yaml or json.
+func (c *findCommand) writeStructuredError(ctx *cmd.Context, err error) error {
+	value := structuredError{structuredErrorDetail{
+		Message: err.Error(),
+		Code:    params.ErrCode(err),
+	}}
+	format := cmd.FormatYaml
+	if c.out.Name() == "json" {
+		format = cmd.FormatJson
+	}
+	if err := format(ctx.Stderr, value); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(ctx.Stderr)
+	return err
+}
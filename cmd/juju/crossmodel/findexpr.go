@@ -0,0 +1,386 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package crossmodel
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/juju/errors"
+
+	"github.com/juju/juju/core/crossmodel"
+	"github.com/juju/juju/permission"
+)
+
+// The --where expression grammar is:
+//
+//   expr       := and-expr { "or" and-expr }
+//   and-expr   := primary { "and" primary }
+//   primary    := "(" expr ")" | comparison
+//   comparison := field op value
+//   field      := "owner" | "model" | "offer" | "interface" | "endpoint" | "access"
+//   op         := "=" | "!=" | ">=" | "<=" | ">" | "<"
+//
+// The ordering operators may only be used with the access field, where
+// offer access levels are ordered read < consume < admin.
+
+// whereFields holds the valid fields in a --where expression.
+var whereFields = map[string]bool{
+	"owner":     true,
+	"model":     true,
+	"offer":     true,
+	"interface": true,
+	"endpoint":  true,
+	"access":    true,
+}
+
+// offerFields holds the attributes of an offer which can be
+// tested by a --where expression.
+type offerFields struct {
+	owner     string
+	model     string
+	offer     string
+	access    string
+	endpoints map[string]RemoteEndpoint
+}
+
+// newOfferFields returns the attributes of the offer at the given URL.
+func newOfferFields(urlStr string, offer ApplicationOfferResult) (offerFields, error) {
+	url, err := crossmodel.ParseApplicationURL(urlStr)
+	if err != nil {
+		return offerFields{}, errors.Trace(err)
+	}
+	return offerFields{
+		owner:     url.User,
+		model:     url.ModelName,
+		offer:     url.ApplicationName,
+		access:    offer.Access,
+		endpoints: offer.Endpoints,
+	}, nil
+}
+
+// whereExpr is a node in a parsed --where expression.
+type whereExpr interface {
+	// matches returns whether the offer satisfies the expression.
+	matches(offer offerFields) bool
+}
+
+type orExpr struct {
+	terms []whereExpr
+}
+
+func (e *orExpr) matches(offer offerFields) bool {
+	for _, term := range e.terms {
+		if term.matches(offer) {
+			return true
+		}
+	}
+	return false
+}
+
+type andExpr struct {
+	terms []whereExpr
+}
+
+func (e *andExpr) matches(offer offerFields) bool {
+	for _, term := range e.terms {
+		if !term.matches(offer) {
+			return false
+		}
+	}
+	return true
+}
+
+type comparison struct {
+	field string
+	op    string
+	value string
+}
+
+func (e *comparison) matches(offer offerFields) bool {
+	switch e.field {
+	case "owner":
+		return e.compareEqual(offer.owner == e.value)
+	case "model":
+		return e.compareEqual(offer.model == e.value)
+	case "offer":
+		return e.compareEqual(offer.offer == e.value)
+	case "endpoint":
+		_, ok := offer.endpoints[e.value]
+		return e.compareEqual(ok)
+	case "interface":
+		found := false
+		for _, ep := range offer.endpoints {
+			if ep.Interface == e.value {
+				found = true
+				break
+			}
+		}
+		return e.compareEqual(found)
+	case "access":
+		return e.compareAccess(permission.Access(offer.access))
+	}
+	return false
+}
+
+func (e *comparison) compareEqual(equal bool) bool {
+	if e.op == "!=" {
+		return !equal
+	}
+	return equal
+}
+
+func (e *comparison) compareAccess(access permission.Access) bool {
+	value := permission.Access(e.value)
+	switch e.op {
+	case "=":
+		return access == value
+	case "!=":
+		return access != value
+	case ">=":
+		return access.EqualOrGreaterOfferAccessThan(value)
+	case ">":
+		return access.GreaterOfferAccessThan(value)
+	case "<=":
+		return value.EqualOrGreaterOfferAccessThan(access)
+	case "<":
+		return value.GreaterOfferAccessThan(access)
+	}
+	return false
+}
+
+// applyWhereFilter updates the filter with any terms of the expression
+// which the server is able to evaluate. This is only possible where the
+// expression is a conjunction, and only for equality comparisons on
+// attributes not already set in the filter.
+func applyWhereFilter(expr whereExpr, filter *crossmodel.ApplicationOfferFilter) {
+	var terms []whereExpr
+	switch e := expr.(type) {
+	case *andExpr:
+		terms = e.terms
+	case *comparison:
+		terms = []whereExpr{e}
+	default:
+		return
+	}
+	var endpointTerm crossmodel.EndpointFilterTerm
+	for _, term := range terms {
+		cmp, ok := term.(*comparison)
+		if !ok || cmp.op != "=" {
+			continue
+		}
+		switch cmp.field {
+		case "owner":
+			if filter.OwnerName == "" {
+				filter.OwnerName = cmp.value
+			}
+		case "model":
+			if filter.ModelName == "" {
+				filter.ModelName = cmp.value
+			}
+		case "offer":
+			if filter.OfferName == "" {
+				filter.OfferName = cmp.value
+			}
+		case "interface":
+			if endpointTerm.Interface == "" {
+				endpointTerm.Interface = cmp.value
+			}
+		case "endpoint":
+			if endpointTerm.Name == "" {
+				endpointTerm.Name = cmp.value
+			}
+		}
+	}
+	if len(filter.Endpoints) == 0 && (endpointTerm.Interface != "" || endpointTerm.Name != "") {
+		filter.Endpoints = []crossmodel.EndpointFilterTerm{endpointTerm}
+	}
+}
+
+// filterWhere removes any results not satisfying the expression.
+func filterWhere(expr whereExpr, results map[string]ApplicationOfferResult) error {
+	for url, offer := range results {
+		fields, err := newOfferFields(url, offer)
+		if err != nil {
+			return errors.Trace(err)
+		}
+		if !expr.matches(fields) {
+			delete(results, url)
+		}
+	}
+	return nil
+}
+
+// parseWhere parses a --where expression.
+func parseWhere(input string) (whereExpr, error) {
+	tokens, err := tokenizeWhere(input)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if len(tokens) == 0 {
+		return nil, errors.New("empty expression")
+	}
+	p := &whereParser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	if p.pos < len(p.tokens) {
+		return nil, errors.Errorf("unexpected %q", p.tokens[p.pos])
+	}
+	return expr, nil
+}
+
+const whereOperatorChars = "=!<>"
+
+// tokenizeWhere splits the input into words, parentheses and operators.
+func tokenizeWhere(input string) ([]string, error) {
+	var tokens []string
+	runes := []rune(input)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(' || r == ')':
+			tokens = append(tokens, string(r))
+			i++
+		case strings.ContainsRune(whereOperatorChars, r):
+			start := i
+			for i < len(runes) && strings.ContainsRune(whereOperatorChars, runes[i]) {
+				i++
+			}
+			op := string(runes[start:i])
+			switch op {
+			case "=", "!=", ">=", "<=", ">", "<":
+			default:
+				return nil, errors.Errorf("invalid operator %q", op)
+			}
+			tokens = append(tokens, op)
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) &&
+				runes[i] != '(' && runes[i] != ')' &&
+				!strings.ContainsRune(whereOperatorChars, runes[i]) {
+				i++
+			}
+			tokens = append(tokens, string(runes[start:i]))
+		}
+	}
+	return tokens, nil
+}
+
+// whereParser is a recursive descent parser for --where expressions.
+type whereParser struct {
+	tokens []string
+	pos    int
+}
+
+func (p *whereParser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *whereParser) next() (string, error) {
+	if p.pos >= len(p.tokens) {
+		return "", errors.New("unexpected end of expression")
+	}
+	token := p.tokens[p.pos]
+	p.pos++
+	return token, nil
+}
+
+func (p *whereParser) parseOr() (whereExpr, error) {
+	var terms []whereExpr
+	for {
+		term, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+		if strings.ToLower(p.peek()) != "or" {
+			break
+		}
+		p.pos++
+	}
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return &orExpr{terms}, nil
+}
+
+func (p *whereParser) parseAnd() (whereExpr, error) {
+	var terms []whereExpr
+	for {
+		term, err := p.parsePrimary()
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, term)
+		if strings.ToLower(p.peek()) != "and" {
+			break
+		}
+		p.pos++
+	}
+	if len(terms) == 1 {
+		return terms[0], nil
+	}
+	return &andExpr{terms}, nil
+}
+
+func (p *whereParser) parsePrimary() (whereExpr, error) {
+	if p.peek() == "(" {
+		p.pos++
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if token, err := p.next(); err != nil {
+			return nil, errors.New(`missing ")"`)
+		} else if token != ")" {
+			return nil, errors.Errorf(`expected ")", got %q`, token)
+		}
+		return expr, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *whereParser) parseComparison() (whereExpr, error) {
+	field, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	field = strings.ToLower(field)
+	if !whereFields[field] {
+		return nil, errors.Errorf("unknown field %q", field)
+	}
+	op, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	switch op {
+	case "=", "!=":
+	case ">=", "<=", ">", "<":
+		if field != "access" {
+			return nil, errors.Errorf("operator %q not valid for field %q", op, field)
+		}
+	default:
+		return nil, errors.Errorf("expected operator after %q, got %q", field, op)
+	}
+	value, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	if value == "(" || value == ")" || strings.ContainsAny(value, whereOperatorChars) {
+		return nil, errors.Errorf("expected value after %q, got %q", field+op, value)
+	}
+	if field == "access" {
+		if err := permission.ValidateOfferAccess(permission.Access(value)); err != nil {
+			return nil, errors.Trace(err)
+		}
+	}
+	return &comparison{field: field, op: op, value: value}, nil
+}
@@ -0,0 +1,129 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package crossmodel_test
+
+import (
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/juju/cmd/juju/crossmodel"
+	jujucrossmodel "github.com/juju/juju/core/crossmodel"
+)
+
+type whereSuite struct{}
+
+var _ = gc.Suite(&whereSuite{})
+
+var whereParseErrorTests = []struct {
+	expr string
+	err  string
+}{{
+	expr: "",
+	err:  "empty expression",
+}, {
+	expr: "colour=red",
+	err:  `unknown field "colour"`,
+}, {
+	expr: "interface",
+	err:  "unexpected end of expression",
+}, {
+	expr: "interface mysql",
+	err:  `expected operator after "interface", got "mysql"`,
+}, {
+	expr: "interface==mysql",
+	err:  `invalid operator "=="`,
+}, {
+	expr: "interface>=mysql",
+	err:  `operator ">=" not valid for field "interface"`,
+}, {
+	expr: "access>=everything",
+	err:  `"everything" offer access not valid`,
+}, {
+	expr: "(interface=mysql",
+	err:  `missing "\)"`,
+}, {
+	expr: "interface=mysql owner=fred",
+	err:  `unexpected "owner"`,
+}, {
+	expr: "interface=mysql and",
+	err:  "unexpected end of expression",
+}}
+
+func (s *whereSuite) TestParseErrors(c *gc.C) {
+	for i, t := range whereParseErrorTests {
+		c.Logf("test %d: %q", i, t.expr)
+		err := crossmodel.WhereFilter(t.expr, &jujucrossmodel.ApplicationOfferFilter{})
+		c.Check(err, gc.ErrorMatches, t.err)
+	}
+}
+
+var whereFilterTests = []struct {
+	expr     string
+	expected jujucrossmodel.ApplicationOfferFilter
+}{{
+	expr: "interface=mysql and access>=consume and owner=alice",
+	expected: jujucrossmodel.ApplicationOfferFilter{
+		OwnerName: "alice",
+		Endpoints: []jujucrossmodel.EndpointFilterTerm{{Interface: "mysql"}},
+	},
+}, {
+	expr: "model=prod AND offer=db2 and endpoint=db",
+	expected: jujucrossmodel.ApplicationOfferFilter{
+		ModelName: "prod",
+		OfferName: "db2",
+		Endpoints: []jujucrossmodel.EndpointFilterTerm{{Name: "db"}},
+	},
+}, {
+	expr:     "owner=alice or owner=bob",
+	expected: jujucrossmodel.ApplicationOfferFilter{},
+}, {
+	expr:     "owner!=alice",
+	expected: jujucrossmodel.ApplicationOfferFilter{},
+}}
+
+func (s *whereSuite) TestFilter(c *gc.C) {
+	for i, t := range whereFilterTests {
+		c.Logf("test %d: %q", i, t.expr)
+		var filter jujucrossmodel.ApplicationOfferFilter
+		err := crossmodel.WhereFilter(t.expr, &filter)
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(filter, jc.DeepEquals, t.expected)
+	}
+}
+
+var whereMatchTests = []struct {
+	expr  string
+	match bool
+}{
+	{"interface=mysql", true},
+	{"interface=http", false},
+	{"interface!=http", true},
+	{"endpoint=db", true},
+	{"endpoint=db and interface=mysql", true},
+	{"endpoint=log or interface=mysql", true},
+	{"endpoint=log or interface=http", false},
+	{"access>=read", true},
+	{"access>=consume", true},
+	{"access>consume", false},
+	{"access<admin", true},
+	{"access<=read", false},
+	{"owner=fred and (model=test or model=prod)", true},
+	{"owner=fred and (model=staging or offer=other)", false},
+	{"offer=hosted-mysql", true},
+}
+
+func (s *whereSuite) TestMatches(c *gc.C) {
+	offer := crossmodel.ApplicationOfferResult{
+		Access: "consume",
+		Endpoints: map[string]crossmodel.RemoteEndpoint{
+			"db": {Interface: "mysql", Role: "provider"},
+		},
+	}
+	for i, t := range whereMatchTests {
+		c.Logf("test %d: %q", i, t.expr)
+		match, err := crossmodel.WhereMatches(t.expr, "master:fred/prod.hosted-mysql", offer)
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(match, gc.Equals, t.match)
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package crossmodel
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+
+	"github.com/juju/cmd"
+	"github.com/juju/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// offerFilterTerms holds the filter terms read with --filter-file.
+type offerFilterTerms struct {
+	// URL is the offer URL, as accepted on the command line.
+	URL string `yaml:"url,omitempty"`
+
+	// Interface is the endpoint interface to match.
+	Interface string `yaml:"interface,omitempty"`
+
+	// Endpoint is the endpoint name to match.
+	Endpoint string `yaml:"endpoint,omitempty"`
+}
+
+// readFilterFile reads the filter terms from the --filter-file,
+// or from stdin if the path is "-".
+func (c *findCommand) readFilterFile(ctx *cmd.Context) (*offerFilterTerms, error) {
+	var (
+		data []byte
+		err  error
+	)
+	name := c.filterFile.Path
+	if name == "-" {
+		name = "stdin"
+		data, err = ioutil.ReadAll(ctx.Stdin)
+	} else {
+		data, err = c.filterFile.Read(ctx)
+	}
+	if err != nil {
+		return nil, errors.Annotatef(err, "reading filter from %s", name)
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return nil, errors.Errorf("no filter read from %s", name)
+	}
+	var terms offerFilterTerms
+	if err := yaml.UnmarshalStrict(data, &terms); err != nil {
+		return nil, errors.Annotatef(err, "cannot parse filter from %s", name)
+	}
+	return &terms, nil
+}
+
+// applyFilterTerms sets the filter terms read from the filter file,
+// which may not also be specified on the command line.
+func (c *findCommand) applyFilterTerms(terms *offerFilterTerms) error {
+	if terms.URL != "" {
+		if c.url != "" {
+			return errors.New("URL term cannot be specified both on the command line and in the filter file")
+		}
+		c.url = terms.URL
+		c.bareOfferName = !strings.ContainsAny(c.url, "/.:")
+		if c.ignoreCase {
+			c.url = foldOfferURL(c.url)
+		}
+	}
+	if terms.Interface != "" {
+		if c.interfaceName != "" {
+			return errors.New("--interface cannot be specified both on the command line and in the filter file")
+		}
+		c.interfaceName = terms.Interface
+	}
+	if terms.Endpoint != "" {
+		if c.endpoint != "" {
+			return errors.New("--endpoint cannot be specified both on the command line and in the filter file")
+		}
+		c.endpoint = terms.Endpoint
+	}
+	if c.matchBothRoles && c.interfaceName == "" {
+		return errors.New("--match-both-roles requires --interface")
+	}
+	return nil
+}
@@ -13,30 +13,136 @@ import (
 
 	"github.com/juju/juju/cmd/output"
 	"github.com/juju/juju/core/crossmodel"
+	"github.com/juju/juju/permission"
 )
 
-// formatFindTabular returns a tabular summary of remote applications or
-// errors out if parameter is not of expected type.
-func formatFindTabular(writer io.Writer, value interface{}) error {
+// formatFindTabular returns a tabular summary of remote applications,
+// ordered by URL, or errors out if parameter is not of expected type.
+// If showRelations is true, the number of relations using each endpoint
+// is shown. If showVersion is true, the version of the controller
+// hosting each offer is shown, where known.
+func formatFindTabular(writer io.Writer, value interface{}, showRelations, showVersion bool) error {
+	if endpoints, ok := value.([]FoundEndpoint); ok {
+		return formatFlatEndpointsTabular(writer, endpoints)
+	}
 	endpoints, ok := value.(map[string]ApplicationOfferResult)
 	if !ok {
 		return errors.Errorf("expected value of type %T, got %T", endpoints, value)
 	}
-	return formatFoundEndpointsTabular(writer, endpoints)
+	if err := formatFoundEndpointsTabular(writer, endpoints, showRelations, showVersion); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(writer, "\n%s\n", offerSummary(endpoints))
+	return err
+}
+
+// offerSummary returns a one line summary of the number of offers
+// with each level of access, eg "3 offers: 1 admin, 2 read".
+func offerSummary(all map[string]ApplicationOfferResult) string {
+	counts := make(map[string]int)
+	for _, one := range all {
+		if one.Access != "" {
+			counts[one.Access]++
+		}
+	}
+	order := []string{
+		string(permission.AdminAccess),
+		string(permission.ConsumeAccess),
+		string(permission.ReadAccess),
+	}
+	var others []string
+	for access := range counts {
+		switch permission.Access(access) {
+		case permission.AdminAccess, permission.ConsumeAccess, permission.ReadAccess:
+		default:
+			others = append(others, access)
+		}
+	}
+	sort.Strings(others)
+	var breakdown []string
+	for _, access := range append(order, others...) {
+		if counts[access] > 0 {
+			breakdown = append(breakdown, fmt.Sprintf("%d %s", counts[access], access))
+		}
+	}
+	summary := fmt.Sprintf("%d offers", len(all))
+	if len(all) == 1 {
+		summary = "1 offer"
+	}
+	if len(breakdown) == 0 {
+		return summary
+	}
+	return summary + ": " + strings.Join(breakdown, ", ")
+}
+
+// formatFlatEndpointsTabular returns a tabular list of endpoints,
+// one per row.
+func formatFlatEndpointsTabular(writer io.Writer, all []FoundEndpoint) error {
+	tw := output.TabWriter(writer)
+	w := output.Wrapper{tw}
+	w.Println("Store", "URL", "Endpoint", "Interface")
+	for _, one := range all {
+		url, err := crossmodel.ParseApplicationURL(one.URL)
+		if err != nil {
+			return err
+		}
+		store := url.Source
+		url.Source = ""
+		w.Println(store, url.String(), one.Endpoint, one.Interface)
+	}
+	tw.Flush()
+	return nil
 }
 
 // formatFoundEndpointsTabular returns a tabular summary of offered applications' endpoints.
-func formatFoundEndpointsTabular(writer io.Writer, all map[string]ApplicationOfferResult) error {
+func formatFoundEndpointsTabular(writer io.Writer, all map[string]ApplicationOfferResult, showRelations, showVersion bool) error {
 	tw := output.TabWriter(writer)
 	w := output.Wrapper{tw}
-	w.Println("Store", "URL", "Access", "Interfaces")
+	explain := false
+	showApplication := false
+	showCapacity := false
+	for _, one := range all {
+		if len(one.MatchedBy) > 0 {
+			explain = true
+		}
+		if one.ApplicationName != "" {
+			showApplication = true
+		}
+		for _, ep := range one.Endpoints {
+			if ep.Capacity != "" {
+				showCapacity = true
+			}
+		}
+	}
+	headers := []interface{}{"Store", "URL", "Access"}
+	if showApplication {
+		headers = append(headers, "Application")
+	}
+	if showVersion {
+		headers = append(headers, "Version")
+	}
+	headers = append(headers, "Interfaces")
+	if showCapacity {
+		headers = append(headers, "Capacity")
+	}
+	if showRelations {
+		headers = append(headers, "Relations")
+	}
+	if explain {
+		headers = append(headers, "Matched by")
+	}
+	w.Println(headers...)
 
-	for urlStr, one := range all {
+	for _, urlStr := range OfferURLs(all) {
+		one := all[urlStr]
 		url, err := crossmodel.ParseApplicationURL(urlStr)
 		if err != nil {
 			return err
 		}
 		store := url.Source
+		if one.Remote {
+			store += " (remote)"
+		}
 		url.Source = ""
 
 		interfaces := []string{}
@@ -44,9 +150,79 @@ func formatFoundEndpointsTabular(writer io.Writer, all map[string]ApplicationOff
 			interfaces = append(interfaces, fmt.Sprintf("%s:%s", ep.Interface, name))
 		}
 		sort.Strings(interfaces)
-		w.Println(store, url.String(), one.Access, strings.Join(interfaces, ", "))
+		row := []interface{}{store, url.String(), one.Access}
+		if showApplication {
+			row = append(row, one.ApplicationName)
+		}
+		if showVersion {
+			row = append(row, one.ControllerVersion)
+		}
+		row = append(row, strings.Join(interfaces, ", "))
+		if showCapacity {
+			row = append(row, formatCapacities(one.Endpoints))
+		}
+		if showRelations {
+			row = append(row, formatRelationCounts(one.Endpoints))
+		}
+		if explain {
+			row = append(row, strings.Join(one.MatchedBy, ", "))
+		}
+		w.Println(row...)
 	}
 	tw.Flush()
 
+	return formatUsage(writer, all)
+}
+
+// formatUsage writes the sample commands for using each offer,
+// if known, in the same order as the offers are tabulated.
+func formatUsage(writer io.Writer, all map[string]ApplicationOfferResult) error {
+	for _, urlStr := range OfferURLs(all) {
+		usage := all[urlStr].Usage
+		if usage == nil {
+			continue
+		}
+		if _, err := fmt.Fprintf(writer, "\n%s:\n  %s\n  %s\n", urlStr, usage.Consume, usage.Relate); err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+// formatRelationCounts returns the number of relations using each
+// endpoint, or "unknown" if it was not reported, ordered by endpoint name.
+func formatRelationCounts(endpoints map[string]RemoteEndpoint) string {
+	names := []string{}
+	for name := range endpoints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	counts := make([]string, len(names))
+	for i, name := range names {
+		count := "unknown"
+		if ep := endpoints[name]; ep.RelationCount != nil {
+			count = fmt.Sprint(*ep.RelationCount)
+		}
+		counts[i] = fmt.Sprintf("%s:%s", name, count)
+	}
+	return strings.Join(counts, ", ")
+}
+
+// formatCapacities returns the remaining capacity of each endpoint,
+// ordered by endpoint name, with "-" for unlimited endpoints.
+func formatCapacities(endpoints map[string]RemoteEndpoint) string {
+	names := []string{}
+	for name := range endpoints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	capacities := make([]string, len(names))
+	for i, name := range names {
+		capacity := endpoints[name].Capacity
+		if capacity == unlimitedCapacity {
+			capacity = "-"
+		}
+		capacities[i] = fmt.Sprintf("%s:%s", name, capacity)
+	}
+	return strings.Join(capacities, ", ")
+}
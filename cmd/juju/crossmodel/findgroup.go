@@ -0,0 +1,74 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package crossmodel
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// groupByApplication is the --group-by value grouping
+// offers by the application backing them.
+const groupByApplication = "application"
+
+// unknownApplicationGroup is the group holding offers
+// whose application is not reported by the controller.
+const unknownApplicationGroup = "(unknown)"
+
+// groupOffersByApplication returns the results grouped by the name of
+// the application backing each offer, with offers whose application is
+// not known in the unknown application group.
+func groupOffersByApplication(results map[string]ApplicationOfferResult) map[string]map[string]ApplicationOfferResult {
+	groups := make(map[string]map[string]ApplicationOfferResult)
+	for url, result := range results {
+		name := result.ApplicationName
+		if name == "" {
+			name = unknownApplicationGroup
+		}
+		group, ok := groups[name]
+		if !ok {
+			group = make(map[string]ApplicationOfferResult)
+			groups[name] = group
+		}
+		group[url] = result
+	}
+	return groups
+}
+
+// sortedGroups returns the names of the groups in order,
+// with the unknown application group last.
+func sortedGroups(groups map[string]map[string]ApplicationOfferResult) []string {
+	names := make([]string, 0, len(groups))
+	var last []string
+	for name := range groups {
+		if name == unknownApplicationGroup {
+			last = append(last, name)
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return append(names, last...)
+}
+
+// formatGroupedTabular writes a tabular summary of each group of
+// offers, preceded by a header naming the application of the group.
+func formatGroupedTabular(writer io.Writer, key string, groups map[string]map[string]ApplicationOfferResult, showRelations, showVersion bool) error {
+	all := make(map[string]ApplicationOfferResult)
+	for i, name := range sortedGroups(groups) {
+		if i > 0 {
+			fmt.Fprintln(writer)
+		}
+		fmt.Fprintf(writer, "%s: %s\n", key, name)
+		if err := formatFoundEndpointsTabular(writer, groups[name], showRelations, showVersion); err != nil {
+			return err
+		}
+		for url, one := range groups[name] {
+			all[url] = one
+		}
+	}
+	_, err := fmt.Fprintf(writer, "\n%s\n", offerSummary(all))
+	return err
+}
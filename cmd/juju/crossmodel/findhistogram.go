@@ -0,0 +1,96 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package crossmodel
+
+import (
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/juju/juju/cmd/output"
+)
+
+// histogramByInterface is the --histogram value counting the
+// offers exposing each interface.
+const histogramByInterface = "interface"
+
+// maxHistogramBar is the longest bar drawn in a tabular histogram;
+// longer bars are scaled down to fit.
+const maxHistogramBar = 40
+
+// offerHistogram holds the number of offers for each value
+// of the --histogram attribute. It is a distinct type from the
+// --count-by counts so that it is formatted as a bar chart.
+type offerHistogram map[string]int
+
+// interfaceHistogram returns the number of offers exposing each
+// interface. An offer with several endpoints of the same interface
+// is counted once for that interface.
+func interfaceHistogram(results map[string]ApplicationOfferResult) offerHistogram {
+	histogram := make(offerHistogram)
+	for _, result := range results {
+		seen := make(map[string]bool)
+		for _, ep := range result.Endpoints {
+			if seen[ep.Interface] {
+				continue
+			}
+			seen[ep.Interface] = true
+			histogram[ep.Interface]++
+		}
+	}
+	return histogram
+}
+
+// formatHistogramTabular writes the histogram as a text bar chart,
+// with the most offered interfaces first.
+func formatHistogramTabular(writer io.Writer, histogram offerHistogram) error {
+	names := make([]string, 0, len(histogram))
+	most := 0
+	for name, count := range histogram {
+		names = append(names, name)
+		if count > most {
+			most = count
+		}
+	}
+	sort.Sort(byOffers{names, histogram})
+
+	tw := output.TabWriter(writer)
+	w := output.Wrapper{tw}
+	w.Println("Interface", "Offers", "Chart")
+	for _, name := range names {
+		count := histogram[name]
+		w.Println(name, count, strings.Repeat("#", histogramBar(count, most)))
+	}
+	tw.Flush()
+	return nil
+}
+
+type byOffers struct {
+	names     []string
+	histogram offerHistogram
+}
+
+func (b byOffers) Len() int      { return len(b.names) }
+func (b byOffers) Swap(i, j int) { b.names[i], b.names[j] = b.names[j], b.names[i] }
+func (b byOffers) Less(i, j int) bool {
+	ci, cj := b.histogram[b.names[i]], b.histogram[b.names[j]]
+	if ci != cj {
+		return ci > cj
+	}
+	return b.names[i] < b.names[j]
+}
+
+// histogramBar returns the length of the bar for count, scaled so that
+// the bar for most is no longer than maxHistogramBar. Any non-zero
+// count has a bar at least one long.
+func histogramBar(count, most int) int {
+	if most <= maxHistogramBar {
+		return count
+	}
+	bar := count * maxHistogramBar / most
+	if bar == 0 && count > 0 {
+		bar = 1
+	}
+	return bar
+}
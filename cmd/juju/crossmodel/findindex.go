@@ -0,0 +1,149 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package crossmodel
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/juju/utils/set"
+
+	"github.com/juju/juju/core/crossmodel"
+)
+
+// offerIndex holds offers found by an earlier query, indexed by the
+// interface and name of their endpoints.
+type offerIndex struct {
+	offers      map[string]ApplicationOfferResult
+	byInterface map[string]set.Strings
+	byEndpoint  map[string]set.Strings
+}
+
+// newOfferIndex returns an index of the specified offers.
+func newOfferIndex(offers map[string]ApplicationOfferResult) *offerIndex {
+	idx := &offerIndex{
+		offers:      offers,
+		byInterface: make(map[string]set.Strings),
+		byEndpoint:  make(map[string]set.Strings),
+	}
+	for url, offer := range offers {
+		for name, ep := range offer.Endpoints {
+			addToIndex(idx.byInterface, ep.Interface, url)
+			addToIndex(idx.byEndpoint, name, url)
+		}
+	}
+	return idx
+}
+
+func addToIndex(index map[string]set.Strings, key, url string) {
+	urls, ok := index[key]
+	if !ok {
+		urls = set.NewStrings()
+		index[key] = urls
+	}
+	urls.Add(url)
+}
+
+// lookup returns the indexed offers matching any of the terms, or all
+// offers if there are no terms.
+func (idx *offerIndex) lookup(terms []crossmodel.EndpointFilterTerm) map[string]ApplicationOfferResult {
+	result := make(map[string]ApplicationOfferResult)
+	if len(terms) == 0 {
+		for url, offer := range idx.offers {
+			result[url] = offer
+		}
+		return result
+	}
+	for _, term := range terms {
+		for url := range idx.candidates(term) {
+			offer := idx.offers[url]
+			if offerMatchesTerm(offer, term) {
+				result[url] = offer
+			}
+		}
+	}
+	return result
+}
+
+// candidates returns the URLs of offers which may match the term.
+func (idx *offerIndex) candidates(term crossmodel.EndpointFilterTerm) map[string]bool {
+	var urls set.Strings
+	switch {
+	case term.Interface != "" && term.Name != "":
+		urls = idx.byInterface[term.Interface].Intersection(idx.byEndpoint[term.Name])
+	case term.Interface != "":
+		urls = idx.byInterface[term.Interface]
+	case term.Name != "":
+		urls = idx.byEndpoint[term.Name]
+	default:
+		urls = set.NewStrings()
+		for url := range idx.offers {
+			urls.Add(url)
+		}
+	}
+	result := make(map[string]bool)
+	for _, url := range urls.Values() {
+		result[url] = true
+	}
+	return result
+}
+
+// offerMatchesTerm returns whether any single endpoint
+// of the offer satisfies all parts of the term.
+func offerMatchesTerm(offer ApplicationOfferResult, term crossmodel.EndpointFilterTerm) bool {
+	for name, ep := range offer.Endpoints {
+		if term.Name != "" && name != term.Name {
+			continue
+		}
+		if term.Interface != "" && ep.Interface != term.Interface {
+			continue
+		}
+		if roleMatches(term, ep) {
+			return true
+		}
+	}
+	return false
+}
+
+// offerIndexes holds the offer indexes built by earlier queries in
+// this process, keyed by source and the query used to fetch the offers.
+type offerIndexes struct {
+	mu      sync.Mutex
+	indexes map[string]*offerIndex
+}
+
+var cachedOfferIndexes = &offerIndexes{
+	indexes: make(map[string]*offerIndex),
+}
+
+// findCachedOffers returns the offers from the source matching the
+// filters, using the offers fetched by an earlier query of the same
+// source with the same filters, other than their endpoints, where
+// there was one. The filters differ only in their owner, model and
+// offer name, so the endpoints of the first are looked up in the index.
+func (c *findCommand) findCachedOffers(source string, filters ...crossmodel.ApplicationOfferFilter) (map[string]ApplicationOfferResult, error) {
+	key := source + ":"
+	allFilters := make([]crossmodel.ApplicationOfferFilter, len(filters))
+	for i, filter := range filters {
+		allFilters[i] = filter
+		allFilters[i].Endpoints = nil
+		// Everything but the endpoints, such as whether users
+		// are included, changes the offers returned.
+		key += fmt.Sprintf("%+v ", allFilters[i])
+	}
+	key += c.cloudName + "/" + c.cloudRegion
+
+	cachedOfferIndexes.mu.Lock()
+	defer cachedOfferIndexes.mu.Unlock()
+	idx, ok := cachedOfferIndexes.indexes[key]
+	if !ok {
+		offers, err := c.findOffers(source, allFilters...)
+		if err != nil {
+			return nil, err
+		}
+		idx = newOfferIndex(offers)
+		cachedOfferIndexes.indexes[key] = idx
+	}
+	return idx.lookup(filters[0].Endpoints), nil
+}
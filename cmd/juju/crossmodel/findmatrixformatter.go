@@ -0,0 +1,97 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package crossmodel
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/juju/errors"
+	"gopkg.in/juju/charm.v6-unstable"
+
+	"github.com/juju/juju/cmd/output"
+)
+
+// formatFindMatrix returns a table of the interfaces against the offers
+// providing or requiring them, or errors out if parameter is not of
+// expected type.
+func formatFindMatrix(writer io.Writer, value interface{}) error {
+	offers, ok := value.(map[string]ApplicationOfferResult)
+	if !ok {
+		return errors.Errorf("expected value of type %T, got %T", offers, value)
+	}
+	return formatFoundEndpointsMatrix(writer, offers)
+}
+
+// formatFoundEndpointsMatrix writes a table with a row for each
+// interface and a column for each offer. Each cell holds P if the offer
+// provides the interface, R if it requires it or has it as a peer, PR if
+// both, and is blank otherwise.
+func formatFoundEndpointsMatrix(writer io.Writer, all map[string]ApplicationOfferResult) error {
+	urls := OfferURLs(all)
+
+	// cells holds the roles of each offer, by interface then URL.
+	cells := make(map[string]map[string]string)
+	for _, url := range urls {
+		for _, ep := range all[url].Endpoints {
+			roles, ok := cells[ep.Interface]
+			if !ok {
+				roles = make(map[string]string)
+				cells[ep.Interface] = roles
+			}
+			roles[url] = matrixCell(roles[url], ep.Role)
+		}
+	}
+	interfaces := make([]string, 0, len(cells))
+	for name := range cells {
+		interfaces = append(interfaces, name)
+	}
+	sort.Strings(interfaces)
+
+	// Blank cells would leave trailing spaces, so the
+	// table is written to a buffer and the lines trimmed.
+	var buf bytes.Buffer
+	tw := output.TabWriter(&buf)
+	w := output.Wrapper{tw}
+	headers := []interface{}{"Interface"}
+	for _, url := range urls {
+		headers = append(headers, url)
+	}
+	w.Println(headers...)
+	for _, name := range interfaces {
+		row := []interface{}{name}
+		for _, url := range urls {
+			row = append(row, cells[name][url])
+		}
+		w.Println(row...)
+	}
+	tw.Flush()
+	for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		if _, err := fmt.Fprintln(writer, strings.TrimRight(line, " ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matrixCell returns the cell marking with the role added.
+func matrixCell(cell, role string) string {
+	provides := cell == "P" || cell == "PR"
+	requires := cell == "R" || cell == "PR"
+	if role == string(charm.RoleProvider) {
+		provides = true
+	} else {
+		requires = true
+	}
+	switch {
+	case provides && requires:
+		return "PR"
+	case provides:
+		return "P"
+	}
+	return "R"
+}
@@ -0,0 +1,55 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package crossmodel
+
+import (
+	"strings"
+
+	"github.com/juju/errors"
+	"gopkg.in/juju/names.v2"
+
+	"github.com/juju/juju/core/crossmodel"
+)
+
+// modelRef identifies a model specified with --model.
+type modelRef struct {
+	owner string
+	name  string
+}
+
+// parseModels parses the --model values, each of the form
+// <owner>/<model>, ignoring any model specified more than once.
+func parseModels(values []string) ([]modelRef, error) {
+	var models []modelRef
+	seen := make(map[modelRef]bool)
+	for _, value := range values {
+		parts := strings.Split(value, "/")
+		if len(parts) != 2 || !names.IsValidUser(parts[0]) || !names.IsValidModelName(parts[1]) {
+			return nil, errors.Errorf("invalid --model %q, expected <owner>/<model>", value)
+		}
+		model := modelRef{owner: parts[0], name: parts[1]}
+		if seen[model] {
+			continue
+		}
+		seen[model] = true
+		models = append(models, model)
+	}
+	return models, nil
+}
+
+// findModelOffers returns the offers matching filter in any of the
+// --model models, or wherever the filter allows if none were specified.
+// The models are queried together, with a filter for each.
+func (c *findCommand) findModelOffers(filter crossmodel.ApplicationOfferFilter) (map[string]ApplicationOfferResult, error) {
+	if len(c.models) == 0 {
+		return c.findAllOffers(filter)
+	}
+	filters := make([]crossmodel.ApplicationOfferFilter, len(c.models))
+	for i, model := range c.models {
+		filters[i] = filter
+		filters[i].OwnerName = model.owner
+		filters[i].ModelName = model.name
+	}
+	return c.findAllOffers(filters...)
+}
@@ -0,0 +1,145 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package crossmodel
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/juju/errors"
+	"gopkg.in/juju/names.v2"
+
+	"github.com/juju/juju/core/crossmodel"
+)
+
+// planTarget is the interface and local endpoint specified with --plan.
+type planTarget struct {
+	interfaceName string
+	application   string
+	endpoint      string
+}
+
+// parsePlanTarget parses a --plan value of the form
+// <interface>:<application>[:<endpoint>].
+func parsePlanTarget(value string) (planTarget, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || !names.IsValidApplication(parts[1]) {
+		return planTarget{}, errors.Errorf("invalid --plan %q, expected <interface>:<application>[:<endpoint>]", value)
+	}
+	target := planTarget{interfaceName: parts[0], application: parts[1]}
+	if len(parts) == 3 {
+		if parts[2] == "" {
+			return planTarget{}, errors.Errorf("invalid --plan %q, expected <interface>:<application>[:<endpoint>]", value)
+		}
+		target.endpoint = parts[2]
+	}
+	return target, nil
+}
+
+// localEndpoint returns the local endpoint to relate offers to.
+func (t planTarget) localEndpoint() string {
+	if t.endpoint == "" {
+		return t.application
+	}
+	return t.application + ":" + t.endpoint
+}
+
+// PlanStep holds the commands to consume an offer and
+// relate it to the local endpoint.
+type PlanStep struct {
+	// OfferURL is the URL of the offer to consume.
+	OfferURL string `yaml:"offer" json:"offer"`
+
+	// Alias is the name the offer is consumed as.
+	Alias string `yaml:"alias" json:"alias"`
+
+	// Consume is the command to consume the offer.
+	Consume string `yaml:"consume" json:"consume"`
+
+	// Relate is the command to relate the consumed offer
+	// to the local endpoint.
+	Relate string `yaml:"relate" json:"relate"`
+}
+
+// consumePlan returns the steps to consume each offer exposing the
+// target's interface and relate it to the target's local endpoint, in
+// order of offer URL. Each offer is consumed as its offer name, unless
+// that is already used by an earlier offer or the local application.
+func consumePlan(results map[string]ApplicationOfferResult, target planTarget) ([]PlanStep, error) {
+	steps := []PlanStep{}
+	used := map[string]bool{target.application: true}
+	for _, offerURL := range OfferURLs(results) {
+		endpoint, ok := planEndpoint(results[offerURL], target.interfaceName)
+		if !ok {
+			continue
+		}
+		url, err := crossmodel.ParseApplicationURL(offerURL)
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		alias := uniqueAlias(url, used)
+		used[alias] = true
+		steps = append(steps, PlanStep{
+			OfferURL: offerURL,
+			Alias:    alias,
+			Consume:  fmt.Sprintf("juju consume %s %s", offerURL, alias),
+			Relate:   fmt.Sprintf("juju relate %s %s:%s", target.localEndpoint(), alias, endpoint),
+		})
+	}
+	return steps, nil
+}
+
+// planEndpoint returns the first endpoint of the offer, by name,
+// with the specified interface.
+func planEndpoint(result ApplicationOfferResult, interfaceName string) (string, bool) {
+	var endpoints []string
+	for name, ep := range result.Endpoints {
+		if ep.Interface == interfaceName {
+			endpoints = append(endpoints, name)
+		}
+	}
+	if len(endpoints) == 0 {
+		return "", false
+	}
+	sort.Strings(endpoints)
+	return endpoints[0], true
+}
+
+// uniqueAlias returns a valid application name for the offer which is
+// not already used, trying the offer name, then the offer name followed
+// by the model name, then that followed by a number.
+func uniqueAlias(url *crossmodel.ApplicationURL, used map[string]bool) string {
+	alias := url.ApplicationName
+	if !used[alias] {
+		return alias
+	}
+	if withModel := alias + "-" + url.ModelName; names.IsValidApplication(withModel) {
+		alias = withModel
+		if !used[alias] {
+			return alias
+		}
+	}
+	for i := 2; ; i++ {
+		numbered := fmt.Sprintf("%s-n%d", alias, i)
+		if !used[numbered] {
+			return numbered
+		}
+	}
+}
+
+// formatPlanTabular writes the commands of each step of the plan,
+// with a blank line between the steps.
+func formatPlanTabular(writer io.Writer, steps []PlanStep) error {
+	for i, step := range steps {
+		if i > 0 {
+			fmt.Fprintln(writer)
+		}
+		if _, err := fmt.Fprintf(writer, "%s\n%s\n", step.Consume, step.Relate); err != nil {
+			return err
+		}
+	}
+	return nil
+}
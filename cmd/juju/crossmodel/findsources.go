@@ -0,0 +1,71 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package crossmodel
+
+import (
+	"io"
+	"sort"
+
+	"github.com/juju/juju/cmd/output"
+	"github.com/juju/juju/core/crossmodel"
+)
+
+// FoundSource is a controller hosting offers, as listed by --list-sources.
+type FoundSource struct {
+	// Name is the name of the controller.
+	Name string `yaml:"name" json:"name"`
+
+	// Remote is true if the controller is not
+	// the one which was queried.
+	Remote bool `yaml:"remote,omitempty" json:"remote,omitempty"`
+
+	// Offers is the number of matching offers the controller hosts.
+	Offers int `yaml:"offers" json:"offers"`
+}
+
+// offerSources returns the controllers hosting the offers,
+// ordered by name.
+func offerSources(results map[string]ApplicationOfferResult) ([]FoundSource, error) {
+	sources := make(map[string]*FoundSource)
+	for urlStr, result := range results {
+		url, err := crossmodel.ParseApplicationURL(urlStr)
+		if err != nil {
+			return nil, err
+		}
+		source, ok := sources[url.Source]
+		if !ok {
+			source = &FoundSource{Name: url.Source}
+			sources[url.Source] = source
+		}
+		source.Remote = source.Remote || result.Remote
+		source.Offers++
+	}
+	names := make([]string, 0, len(sources))
+	for name := range sources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	found := make([]FoundSource, len(names))
+	for i, name := range names {
+		found[i] = *sources[name]
+	}
+	return found, nil
+}
+
+// formatSourcesTabular writes the controllers hosting offers,
+// one per row.
+func formatSourcesTabular(writer io.Writer, sources []FoundSource) error {
+	tw := output.TabWriter(writer)
+	w := output.Wrapper{tw}
+	w.Println("Source", "Offers")
+	for _, source := range sources {
+		name := source.Name
+		if source.Remote {
+			name += " (remote)"
+		}
+		w.Println(name, source.Offers)
+	}
+	tw.Flush()
+	return nil
+}
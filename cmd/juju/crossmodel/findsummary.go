@@ -0,0 +1,68 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package crossmodel
+
+import (
+	"fmt"
+
+	"github.com/juju/cmd"
+)
+
+// outputPath returns the file the results are written
+// to with --output, or "" if they are written to stdout.
+func (c *findCommand) outputPath() string {
+	// cmd.Output does not expose the path,
+	// so it is read from the flag instead.
+	if c.outputFlag == nil {
+		return ""
+	}
+	return c.outputFlag.Value.String()
+}
+
+// writeSummary writes a line to stdout describing the results
+// written to the --output file, eg "wrote 12 offers to offers.yaml".
+func (c *findCommand) writeSummary(ctx *cmd.Context, value interface{}) {
+	fmt.Fprintf(ctx.Stdout, "wrote %s to %s\n", c.describeResults(value), c.outputPath())
+}
+
+// describeResults returns the number of offers or
+// endpoints in the results, eg "12 offers".
+func (c *findCommand) describeResults(value interface{}) string {
+	switch value := value.(type) {
+	case map[string]ApplicationOfferResult:
+		return countOf(len(value), "offer")
+	case map[string]compactOfferResult:
+		return countOf(len(value), "offer")
+	case map[string]map[string]ApplicationOfferResult:
+		n := 0
+		for _, group := range value {
+			n += len(group)
+		}
+		return countOf(n, "offer")
+	case map[string]map[string]compactOfferResult:
+		n := 0
+		for _, group := range value {
+			n += len(group)
+		}
+		return countOf(n, "offer")
+	case []FoundEndpoint:
+		return countOf(len(value), "endpoint")
+	case []PlanStep:
+		// Only the offers with the planned interface have a step.
+		return countOf(len(value), "offer")
+	case map[string]int, offerHistogram, []FoundSource:
+		// The counts, histogram and sources summarise
+		// all the offers found.
+		return countOf(c.matchedOffers, "offer")
+	}
+	return "results"
+}
+
+// countOf returns n followed by noun, pluralised unless n is 1.
+func countOf(n int, noun string) string {
+	if n == 1 {
+		return "1 " + noun
+	}
+	return fmt.Sprintf("%d %ss", n, noun)
+}
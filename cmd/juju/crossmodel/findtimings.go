@@ -0,0 +1,90 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package crossmodel
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/juju/cmd"
+
+	"github.com/juju/juju/cmd/output"
+)
+
+// timedResults holds the results written with --timings,
+// along with how long each source took to return its offers.
+type timedResults struct {
+	Results interface{}       `yaml:"results" json:"results"`
+	Timings map[string]string `yaml:"timings" json:"timings"`
+}
+
+// startTiming returns the time a query is started,
+// if --timings was specified.
+func (c *findCommand) startTiming() time.Time {
+	if !c.showTimings {
+		return time.Time{}
+	}
+	return c.clock.Now()
+}
+
+// recordTiming records how long source took to return its
+// offers, if --timings was specified.
+func (c *findCommand) recordTiming(source string, started time.Time) {
+	if !c.showTimings {
+		return
+	}
+	if c.timings == nil {
+		c.timings = make(map[string]time.Duration)
+	}
+	c.timings[source] = c.clock.Now().Sub(started)
+}
+
+// write writes value in the output format, with the timing of
+// each source if --timings was specified. With --summary-to-stdout,
+// a summary of the results written to the output file follows.
+func (c *findCommand) write(ctx *cmd.Context, value interface{}) error {
+	written := value
+	if c.showTimings {
+		timings := make(map[string]string, len(c.timings))
+		for source, d := range c.timings {
+			timings[source] = d.String()
+		}
+		written = timedResults{
+			Results: value,
+			Timings: timings,
+		}
+	}
+	if err := c.out.Write(ctx, written); err != nil {
+		return err
+	}
+	if c.summaryToStdout {
+		c.writeSummary(ctx, value)
+	}
+	return nil
+}
+
+// formatTimedTabular writes the results in tabular form,
+// followed by the timing of each source, ordered by name.
+func (c *findCommand) formatTimedTabular(writer io.Writer, value timedResults) error {
+	if err := c.formatTabular(writer, value.Results); err != nil {
+		return err
+	}
+	sources := make([]string, 0, len(value.Timings))
+	for source := range value.Timings {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+
+	fmt.Fprintln(writer)
+	tw := output.TabWriter(writer)
+	w := output.Wrapper{tw}
+	w.Println("Source", "Time")
+	for _, source := range sources {
+		w.Println(source, value.Timings[source])
+	}
+	tw.Flush()
+	return nil
+}
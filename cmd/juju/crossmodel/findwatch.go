@@ -0,0 +1,181 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package crossmodel
+
+import (
+	"encoding/json"
+	"os"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/juju/cmd"
+	"github.com/juju/errors"
+
+	"github.com/juju/juju/apiserver/params"
+	"github.com/juju/juju/core/crossmodel"
+)
+
+// defaultPollInterval is how often offers are queried
+// when watching a controller unable to notify of changes.
+const defaultPollInterval = 10 * time.Second
+
+const (
+	offerAdded    = "added"
+	offerRemoved  = "removed"
+	offerModified = "modified"
+)
+
+// OfferWatchAPI is implemented by find APIs able
+// to notify of changes to application offers.
+type OfferWatchAPI interface {
+	WatchApplicationOffers(filters ...crossmodel.ApplicationOfferFilter) (OfferWatcher, error)
+}
+
+// OfferWatcher sends the offers matching the watched
+// filters when first started and each time they change.
+type OfferWatcher interface {
+	Changes() <-chan []params.ApplicationOffer
+	Stop() error
+}
+
+// OfferChange is a single event written when watching offers.
+type OfferChange struct {
+	// Change is one of "added", "removed" or "modified".
+	Change string `json:"change"`
+
+	// URL is the URL of the offer which changed.
+	URL string `json:"url"`
+
+	// Offer is the offer after the change. It is
+	// not set for removed offers.
+	Offer *ApplicationOfferResult `json:"offer,omitempty"`
+}
+
+// watchOffers writes the changes to the offers matching filter
+// until interrupted. A single source whose API supports watching
+// is watched; otherwise all sources are polled.
+func (c *findCommand) watchOffers(ctx *cmd.Context, filter crossmodel.ApplicationOfferFilter) error {
+	interrupted := make(chan os.Signal, 1)
+	ctx.InterruptNotify(interrupted)
+	defer ctx.StopInterruptNotify(interrupted)
+
+	var (
+		changes <-chan []params.ApplicationOffer
+		watcher OfferWatcher
+		poll    <-chan time.Time
+	)
+	if len(c.sources) == 1 {
+		api, err := c.newAPIFunc(c.sources[0])
+		if err != nil {
+			return errors.Trace(err)
+		}
+		defer api.Close()
+		if watchAPI, ok := api.(OfferWatchAPI); ok {
+			if watcher, err = watchAPI.WatchApplicationOffers(filter); err != nil {
+				return errors.Annotate(err, "watching offers")
+			}
+			defer watcher.Stop()
+			changes = watcher.Changes()
+		}
+	}
+
+	encoder := json.NewEncoder(ctx.Stdout)
+	var previous map[string]ApplicationOfferResult
+	update := func(current map[string]ApplicationOfferResult) error {
+		if current == nil {
+			current = make(map[string]ApplicationOfferResult)
+		}
+		if err := c.filterOffers(ctx, current); err != nil {
+			return errors.Trace(err)
+		}
+		if err := c.filterUsers(current); err != nil {
+			return errors.Trace(err)
+		}
+		c.filterAPIAddresses(current)
+		for _, change := range diffOffers(previous, current) {
+			if err := encoder.Encode(change); err != nil {
+				return errors.Trace(err)
+			}
+		}
+		previous = current
+		return nil
+	}
+
+	if changes == nil {
+		logger.Debugf("offer watching not supported, polling every %v", c.pollInterval)
+		found, err := c.findAllOffers(filter)
+		if err != nil {
+			return err
+		}
+		if err := update(found); err != nil {
+			return err
+		}
+		poll = c.clock.After(c.pollInterval)
+	}
+	for {
+		select {
+		case <-interrupted:
+			return nil
+		case offers, ok := <-changes:
+			if !ok {
+				if err := watcher.Stop(); err != nil {
+					return errors.Annotate(err, "offer watcher stopped")
+				}
+				return errors.New("offer watcher stopped unexpectedly")
+			}
+			if err := c.checkEndpointNames(offers); err != nil {
+				return errors.Trace(err)
+			}
+			found, err := convertFoundOffers(c.sources[0], c.filterCloud(offers)...)
+			if err != nil {
+				return errors.Trace(err)
+			}
+			if err := update(found); err != nil {
+				return err
+			}
+		case <-poll:
+			found, err := c.findAllOffers(filter)
+			if err != nil {
+				return err
+			}
+			if err := update(found); err != nil {
+				return err
+			}
+			poll = c.clock.After(c.pollInterval)
+		}
+	}
+}
+
+// diffOffers returns the changes from the previous to the
+// current offers, ordered by URL.
+func diffOffers(previous, current map[string]ApplicationOfferResult) []OfferChange {
+	var urls []string
+	for url := range previous {
+		if _, ok := current[url]; !ok {
+			urls = append(urls, url)
+		}
+	}
+	for url := range current {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+
+	var changes []OfferChange
+	for _, url := range urls {
+		offer, ok := current[url]
+		if !ok {
+			changes = append(changes, OfferChange{Change: offerRemoved, URL: url})
+			continue
+		}
+		was, existed := previous[url]
+		switch {
+		case !existed:
+			changes = append(changes, OfferChange{Change: offerAdded, URL: url, Offer: &offer})
+		case !reflect.DeepEqual(was, offer):
+			changes = append(changes, OfferChange{Change: offerModified, URL: url, Offer: &offer})
+		}
+	}
+	return changes
+}
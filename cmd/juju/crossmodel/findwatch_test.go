@@ -0,0 +1,197 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package crossmodel_test
+
+import (
+	"time"
+
+	"github.com/juju/cmd/cmdtesting"
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/juju/charm.v6-unstable"
+
+	"github.com/juju/juju/apiserver/params"
+	"github.com/juju/juju/cmd/juju/crossmodel"
+	jujucrossmodel "github.com/juju/juju/core/crossmodel"
+	coretesting "github.com/juju/juju/testing"
+)
+
+type findWatchSuite struct {
+	BaseCrossModelSuite
+	mockAPI *mockFindAPI
+	clock   *testing.Clock
+}
+
+var _ = gc.Suite(&findWatchSuite{})
+
+func (s *findWatchSuite) SetUpTest(c *gc.C) {
+	s.BaseCrossModelSuite.SetUpTest(c)
+	s.mockAPI = &mockFindAPI{}
+	s.clock = testing.NewClock(time.Now())
+}
+
+var (
+	watchDBOffer = params.ApplicationOffer{
+		OfferURL:  "master:fred/model.db",
+		OfferName: "db",
+		Endpoints: []params.RemoteEndpoint{
+			{Name: "db", Interface: "mysql", Role: charm.RoleProvider},
+		},
+		Access: "read",
+	}
+	watchWebOffer = params.ApplicationOffer{
+		OfferURL:  "master:fred/model.web",
+		OfferName: "web",
+		Endpoints: []params.RemoteEndpoint{
+			{Name: "website", Interface: "http", Role: charm.RoleProvider},
+		},
+		Access: "consume",
+	}
+)
+
+func consumableDBOffer() params.ApplicationOffer {
+	offer := watchDBOffer
+	offer.Access = "consume"
+	return offer
+}
+
+const expectedWatchEvents = `` +
+	`{"change":"added","url":"master:fred/model.db","offer":{"access":"read","endpoints":{"db":{"interface":"mysql","role":"provider"}}}}` + "\n" +
+	`{"change":"modified","url":"master:fred/model.db","offer":{"access":"consume","endpoints":{"db":{"interface":"mysql","role":"provider"}}}}` + "\n" +
+	`{"change":"added","url":"master:fred/model.web","offer":{"access":"consume","endpoints":{"website":{"interface":"http","role":"provider"}}}}` + "\n" +
+	`{"change":"removed","url":"master:fred/model.db"}` + "\n"
+
+func (s *findWatchSuite) TestWatchStreamsChanges(c *gc.C) {
+	watcher := &mockOfferWatcher{changes: make(chan []params.ApplicationOffer, 3)}
+	watcher.changes <- []params.ApplicationOffer{watchDBOffer}
+	watcher.changes <- []params.ApplicationOffer{consumableDBOffer(), watchWebOffer}
+	watcher.changes <- []params.ApplicationOffer{watchWebOffer}
+	close(watcher.changes)
+	api := &mockWatchFindAPI{watcher: watcher}
+
+	command := crossmodel.NewFindEndpointsCommandForTestWithClock(s.store, api, s.clock)
+	context, err := cmdtesting.RunCommand(c, command, "fred/model", "--watch", "--format", "json")
+	c.Assert(err, gc.ErrorMatches, "offer watcher stopped unexpectedly")
+	c.Assert(cmdtesting.Stdout(context), gc.Equals, expectedWatchEvents)
+	c.Assert(api.filters, jc.DeepEquals, []jujucrossmodel.ApplicationOfferFilter{{
+		OwnerName: "fred",
+		ModelName: "model",
+	}})
+	c.Assert(watcher.stopped, jc.IsTrue)
+}
+
+func (s *findWatchSuite) TestWatchIgnoresUnchangedOffers(c *gc.C) {
+	watcher := &mockOfferWatcher{changes: make(chan []params.ApplicationOffer, 2)}
+	watcher.changes <- []params.ApplicationOffer{watchDBOffer}
+	watcher.changes <- []params.ApplicationOffer{watchDBOffer}
+	close(watcher.changes)
+
+	command := crossmodel.NewFindEndpointsCommandForTestWithClock(s.store, &mockWatchFindAPI{watcher: watcher}, s.clock)
+	context, err := cmdtesting.RunCommand(c, command, "fred/model", "--watch", "--format", "json")
+	c.Assert(err, gc.ErrorMatches, "offer watcher stopped unexpectedly")
+	c.Assert(cmdtesting.Stdout(context), gc.Equals,
+		`{"change":"added","url":"master:fred/model.db","offer":{"access":"read","endpoints":{"db":{"interface":"mysql","role":"provider"}}}}`+"\n")
+}
+
+func (s *findWatchSuite) TestWatchStopError(c *gc.C) {
+	watcher := &mockOfferWatcher{
+		changes: make(chan []params.ApplicationOffer),
+		stopErr: errors.New("connection lost"),
+	}
+	close(watcher.changes)
+
+	command := crossmodel.NewFindEndpointsCommandForTestWithClock(s.store, &mockWatchFindAPI{watcher: watcher}, s.clock)
+	_, err := cmdtesting.RunCommand(c, command, "fred/model", "--watch", "--format", "json")
+	c.Assert(err, gc.ErrorMatches, "offer watcher stopped: connection lost")
+}
+
+func (s *findWatchSuite) TestWatchPollsWithoutWatcherSupport(c *gc.C) {
+	s.mockAPI.results = []params.ApplicationOffer{watchDBOffer}
+	command := crossmodel.NewFindEndpointsCommandForTestWithClock(s.store, s.mockAPI, s.clock)
+	err := cmdtesting.InitCommand(command, []string{"fred/model", "--watch", "--format", "json", "--poll-interval", "1m"})
+	c.Assert(err, jc.ErrorIsNil)
+
+	ctx := cmdtesting.Context(c)
+	result := make(chan error)
+	go func() {
+		result <- command.Run(ctx)
+	}()
+
+	s.syncClockAlarm(c)
+	s.mockAPI.results = []params.ApplicationOffer{consumableDBOffer(), watchWebOffer}
+	s.clock.Advance(time.Minute)
+
+	s.syncClockAlarm(c)
+	s.mockAPI.results = []params.ApplicationOffer{watchWebOffer}
+	s.clock.Advance(time.Minute)
+
+	// A failed query ends the watch.
+	s.syncClockAlarm(c)
+	s.mockAPI.msg = "fail"
+	s.clock.Advance(time.Minute)
+
+	select {
+	case err := <-result:
+		c.Assert(err, gc.ErrorMatches, "fail")
+	case <-time.After(coretesting.LongWait):
+		c.Fatal("timed out waiting for result")
+	}
+	c.Assert(cmdtesting.Stdout(ctx), gc.Equals, expectedWatchEvents)
+}
+
+func (s *findWatchSuite) syncClockAlarm(c *gc.C) {
+	select {
+	case <-s.clock.Alarms():
+	case <-time.After(coretesting.LongWait):
+		c.Fatal("timed out waiting for test clock After call")
+	}
+}
+
+func (s *findWatchSuite) TestWatchRequiresJSON(c *gc.C) {
+	s.assertInitError(c, []string{"--watch"}, "--watch requires --format json")
+}
+
+func (s *findWatchSuite) TestWatchCached(c *gc.C) {
+	s.assertInitError(c, []string{"--watch", "--format", "json", "--cached"},
+		"--watch cannot be used with --cached, --list-endpoints, --count-by, --list-sources or --histogram")
+}
+
+func (s *findWatchSuite) TestWatchInvalidPollInterval(c *gc.C) {
+	s.assertInitError(c, []string{"--watch", "--format", "json", "--poll-interval", "0s"},
+		`invalid --poll-interval 0s, expected a positive duration`)
+}
+
+func (s *findWatchSuite) assertInitError(c *gc.C, args []string, expected string) {
+	command := crossmodel.NewFindEndpointsCommandForTestWithClock(s.store, s.mockAPI, s.clock)
+	err := cmdtesting.InitCommand(command, args)
+	c.Assert(err, gc.ErrorMatches, expected)
+}
+
+type mockOfferWatcher struct {
+	changes chan []params.ApplicationOffer
+	stopped bool
+	stopErr error
+}
+
+func (w *mockOfferWatcher) Changes() <-chan []params.ApplicationOffer {
+	return w.changes
+}
+
+func (w *mockOfferWatcher) Stop() error {
+	w.stopped = true
+	return w.stopErr
+}
+
+type mockWatchFindAPI struct {
+	mockFindAPI
+	watcher *mockOfferWatcher
+	filters []jujucrossmodel.ApplicationOfferFilter
+}
+
+func (m *mockWatchFindAPI) WatchApplicationOffers(filters ...jujucrossmodel.ApplicationOfferFilter) (crossmodel.OfferWatcher, error) {
+	m.filters = filters
+	return m.watcher, nil
+}
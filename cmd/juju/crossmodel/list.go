@@ -222,7 +222,7 @@ func convertCharmEndpoints(relations ...charm.Relation) map[string]RemoteEndpoin
 	}
 	output := make(map[string]RemoteEndpoint, len(relations))
 	for _, one := range relations {
-		output[one.Name] = RemoteEndpoint{one.Interface, string(one.Role)}
+		output[one.Name] = RemoteEndpoint{Interface: one.Interface, Role: string(one.Role)}
 	}
 	return output
 }
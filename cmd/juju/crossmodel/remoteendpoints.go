@@ -4,7 +4,15 @@
 package crossmodel
 
 import (
+	"fmt"
+	"sort"
+
+	"github.com/juju/errors"
+	"gopkg.in/juju/charm.v6-unstable"
+
+	"github.com/juju/juju/api"
 	"github.com/juju/juju/api/applicationoffers"
+	cloudapi "github.com/juju/juju/api/cloud"
 	"github.com/juju/juju/apiserver/params"
 	"github.com/juju/juju/cmd/modelcmd"
 )
@@ -24,6 +32,29 @@ func (c *RemoteEndpointsCommandBase) NewRemoteEndpointsAPI(controllerName string
 	return applicationoffers.NewClient(root), nil
 }
 
+// NewCloudAPI returns a cloud api for the specified controller.
+func (c *RemoteEndpointsCommandBase) NewCloudAPI(controllerName string) (*cloudapi.Client, error) {
+	root, err := c.CommandBase.NewAPIRoot(c.ClientStore(), controllerName, "")
+	if err != nil {
+		return nil, err
+	}
+	return cloudapi.NewClient(root), nil
+}
+
+// NewModelStatusAPI returns a client api for the current
+// model of the specified controller.
+func (c *RemoteEndpointsCommandBase) NewModelStatusAPI(controllerName string) (*api.Client, error) {
+	modelName, err := c.ClientStore().CurrentModel(controllerName)
+	if err != nil {
+		return nil, errors.Annotate(err, "getting current model")
+	}
+	root, err := c.CommandBase.NewAPIRoot(c.ClientStore(), controllerName, modelName)
+	if err != nil {
+		return nil, err
+	}
+	return root.Client(), nil
+}
+
 // RemoteEndpoint defines the serialization behaviour of remote endpoints.
 // This is used in map-style yaml output where remote endpoint name is the key.
 type RemoteEndpoint struct {
@@ -32,6 +63,114 @@ type RemoteEndpoint struct {
 
 	// Role is relation role.
 	Role string `yaml:"role" json:"role"`
+
+	// Capacity is the number of further relations the endpoint
+	// can accept, "unlimited", or "unknown" if the controller did
+	// not report the number of relations. It is only populated on
+	// request.
+	Capacity string `yaml:"capacity,omitempty" json:"capacity,omitempty"`
+
+	// RelationCount is the number of relations currently using
+	// the endpoint. It is only populated on request.
+	RelationCount *int `yaml:"relation-count,omitempty" json:"relation-count,omitempty"`
+
+	// PassThrough is set when the offer has both a provider and a
+	// requirer endpoint of the endpoint's interface, so that it may
+	// relate on either side. It is only populated by find.
+	PassThrough bool `yaml:"pass-through,omitempty" json:"pass-through,omitempty"`
+
+	// limit is the maximum number of relations to the
+	// endpoint, or zero if there is no limit.
+	limit int
+
+	// connectedCount is the number of relations to the endpoint,
+	// or nil if the controller did not report it.
+	connectedCount *int
+}
+
+const (
+	unlimitedCapacity = "unlimited"
+	unknownCapacity   = "unknown"
+)
+
+// capacity returns the number of further relations the endpoint
+// can accept, "unlimited", or "unknown" if the number of relations
+// to a limited endpoint was not reported.
+func (ep RemoteEndpoint) capacity() string {
+	if ep.limit <= 0 {
+		return unlimitedCapacity
+	}
+	if ep.connectedCount == nil {
+		return unknownCapacity
+	}
+	remaining := ep.limit - *ep.connectedCount
+	if remaining < 0 {
+		remaining = 0
+	}
+	return fmt.Sprint(remaining)
+}
+
+// CheckInterfaceCompatible returns an error if an application with an
+// endpoint of the specified interface and role could not relate to the
+// offered endpoint. The interfaces must be equal and the roles
+// complementary: provider with requirer, or peer with peer.
+func CheckInterfaceCompatible(offerEndpoint RemoteEndpoint, requirerInterface string, requirerRole string) error {
+	role := charm.RelationRole(requirerRole)
+	var counterpart charm.RelationRole
+	switch role {
+	case charm.RoleProvider:
+		counterpart = charm.RoleRequirer
+	case charm.RoleRequirer:
+		counterpart = charm.RoleProvider
+	case charm.RolePeer:
+		counterpart = charm.RolePeer
+	default:
+		return errors.NotValidf("relation role %q", requirerRole)
+	}
+	if offerEndpoint.Interface != requirerInterface {
+		return errors.Errorf("interface %q does not match %q", offerEndpoint.Interface, requirerInterface)
+	}
+	if offerEndpoint.Role != string(counterpart) {
+		return errors.Errorf("role %q cannot relate to %q", offerEndpoint.Role, requirerRole)
+	}
+	return nil
+}
+
+// markPassThrough sets PassThrough on the endpoints whose interface
+// is both provided and required by the endpoints.
+func markPassThrough(endpoints map[string]RemoteEndpoint) {
+	roles := make(map[string]map[string]bool)
+	for _, ep := range endpoints {
+		if roles[ep.Interface] == nil {
+			roles[ep.Interface] = make(map[string]bool)
+		}
+		roles[ep.Interface][ep.Role] = true
+	}
+	for name, ep := range endpoints {
+		interfaceRoles := roles[ep.Interface]
+		if interfaceRoles[string(charm.RoleProvider)] && interfaceRoles[string(charm.RoleRequirer)] {
+			ep.PassThrough = true
+			endpoints[name] = ep
+		}
+	}
+}
+
+// duplicateEndpointNames returns the sorted names of any endpoints
+// named more than once. Such endpoints collapse to the last of each name
+// when converted by convertRemoteEndpoints.
+func duplicateEndpointNames(apiEndpoints ...params.RemoteEndpoint) []string {
+	count := make(map[string]int)
+	for _, one := range apiEndpoints {
+		count[one.Name]++
+	}
+	var names []string
+	for name, n := range count {
+		if n > 1 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
 }
 
 // convertRemoteEndpoints takes any number of api-formatted remote applications' endpoints and
@@ -42,7 +181,13 @@ func convertRemoteEndpoints(apiEndpoints ...params.RemoteEndpoint) map[string]Re
 	}
 	output := make(map[string]RemoteEndpoint, len(apiEndpoints))
 	for _, one := range apiEndpoints {
-		output[one.Name] = RemoteEndpoint{one.Interface, string(one.Role)}
+		output[one.Name] = RemoteEndpoint{
+			Interface: one.Interface,
+			Role:      string(one.Role),
+
+			limit:          one.Limit,
+			connectedCount: one.ConnectedCount,
+		}
 	}
 	return output
 }
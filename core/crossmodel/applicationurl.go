@@ -157,6 +157,40 @@ func parseApplicationURLParts(urlStr string, allowIncomplete bool) (*Application
 	return &result, nil
 }
 
+// CanonicalOfferURL returns the canonical form of the specified offer
+// URL, so that equivalent URLs may be compared as strings. Surrounding
+// space and any leading or trailing slash are removed, and the user,
+// model and application names are lower cased. The source is left as
+// given, as controller names are case sensitive.
+func CanonicalOfferURL(urlStr string) (string, error) {
+	urlStr = strings.TrimRight(strings.TrimSpace(urlStr), "/")
+	source, rest := maybeParseSource(urlStr)
+	if source != "" {
+		urlStr = source + ":" + strings.ToLower(rest)
+	} else {
+		urlStr = strings.ToLower(urlStr)
+	}
+	url, err := ParseApplicationURL(urlStr)
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	return url.String(), nil
+}
+
+// SameOfferURL returns whether the specified offer URLs
+// refer to the same offer once both are made canonical.
+func SameOfferURL(a, b string) (bool, error) {
+	canonicalA, err := CanonicalOfferURL(a)
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	canonicalB, err := CanonicalOfferURL(b)
+	if err != nil {
+		return false, errors.Trace(err)
+	}
+	return canonicalA == canonicalB, nil
+}
+
 // MakeURL constructs an application URL from the specified components.
 func MakeURL(user, model, application, controller string) string {
 	base := fmt.Sprintf("%s/%s.%s", user, model, application)
@@ -179,3 +179,56 @@ func (s *ApplicationURLSuite) TestAsLocal(c *gc.C) {
 	c.Assert(url.AsLocal(), gc.DeepEquals, expected)
 	c.Assert(*url, gc.DeepEquals, original)
 }
+
+var canonicalOfferURLTests = []struct {
+	s, canonical string
+}{{
+	s:         "controller:user/model.app",
+	canonical: "controller:user/model.app",
+}, {
+	s:         "controller:User/Model.App",
+	canonical: "controller:user/model.app",
+}, {
+	s:         "Controller:user/model.app",
+	canonical: "Controller:user/model.app",
+}, {
+	s:         "controller:/user/model.app/",
+	canonical: "controller:user/model.app",
+}, {
+	s:         " user/model.app// ",
+	canonical: "user/model.app",
+}, {
+	s:         "Model.App:Rel",
+	canonical: "model.app:rel",
+}}
+
+func (s *ApplicationURLSuite) TestCanonicalOfferURL(c *gc.C) {
+	for i, t := range canonicalOfferURLTests {
+		c.Logf("test %d: %q", i, t.s)
+		canonical, err := crossmodel.CanonicalOfferURL(t.s)
+		c.Check(err, jc.ErrorIsNil)
+		c.Check(canonical, gc.Equals, t.canonical)
+	}
+}
+
+func (s *ApplicationURLSuite) TestCanonicalOfferURLInvalid(c *gc.C) {
+	_, err := crossmodel.CanonicalOfferURL("controller:user/model")
+	c.Assert(err, gc.ErrorMatches, "application offer URL is missing application")
+}
+
+func (s *ApplicationURLSuite) TestSameOfferURL(c *gc.C) {
+	same, err := crossmodel.SameOfferURL("controller:/Fred/Prod.DB2/", "controller:fred/prod.db2")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(same, jc.IsTrue)
+
+	same, err = crossmodel.SameOfferURL("controller:fred/prod.db2", "other:fred/prod.db2")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(same, jc.IsFalse)
+
+	same, err = crossmodel.SameOfferURL("fred/prod.db2", "fred/prod.db2:db")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(same, jc.IsFalse)
+
+	_, err = crossmodel.SameOfferURL("fred/prod.db2", "fred/prod")
+	c.Assert(err, gc.ErrorMatches, "application offer URL is missing application")
+}
@@ -4,6 +4,7 @@
 package crossmodel
 
 import (
+	"github.com/juju/errors"
 	"gopkg.in/juju/charm.v6-unstable"
 	"gopkg.in/macaroon.v1"
 
@@ -100,6 +101,10 @@ type ApplicationOfferFilter struct {
 
 	// AllowedUsers are the users allowed to consume the application.
 	AllowedUsers []string
+
+	// IncludeUsers requests the users with access to each matching
+	// offer, which are only returned to offer admins.
+	IncludeUsers bool
 }
 
 // EndpointFilterTerm represents a remote endpoint filter.
@@ -114,6 +119,19 @@ type EndpointFilterTerm struct {
 	Role charm.RelationRole
 }
 
+// Validate returns an error if the term would match every endpoint,
+// having no name, interface or role, or if its role is not valid.
+func (t EndpointFilterTerm) Validate() error {
+	if t.Name == "" && t.Interface == "" && t.Role == "" {
+		return errors.NotValidf("empty endpoint filter term")
+	}
+	switch t.Role {
+	case "", charm.RoleProvider, charm.RoleRequirer, charm.RolePeer:
+		return nil
+	}
+	return errors.NotValidf("endpoint filter role %q", t.Role)
+}
+
 // An ApplicationOffers instance holds application offers from a model.
 type ApplicationOffers interface {
 
@@ -0,0 +1,46 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package crossmodel_test
+
+import (
+	"github.com/juju/errors"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"gopkg.in/juju/charm.v6-unstable"
+
+	"github.com/juju/juju/core/crossmodel"
+)
+
+type endpointFilterTermSuite struct{}
+
+var _ = gc.Suite(&endpointFilterTermSuite{})
+
+func (s *endpointFilterTermSuite) TestValidateEmpty(c *gc.C) {
+	err := crossmodel.EndpointFilterTerm{}.Validate()
+	c.Assert(err, gc.ErrorMatches, "empty endpoint filter term not valid")
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+}
+
+func (s *endpointFilterTermSuite) TestValidateRoleOnly(c *gc.C) {
+	err := crossmodel.EndpointFilterTerm{Role: charm.RoleRequirer}.Validate()
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *endpointFilterTermSuite) TestValidateInvalidRole(c *gc.C) {
+	err := crossmodel.EndpointFilterTerm{Interface: "mysql", Role: "consumer"}.Validate()
+	c.Assert(err, gc.ErrorMatches, `endpoint filter role "consumer" not valid`)
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+}
+
+func (s *endpointFilterTermSuite) TestValidate(c *gc.C) {
+	for i, term := range []crossmodel.EndpointFilterTerm{
+		{Name: "db"},
+		{Interface: "mysql"},
+		{Interface: "mysql", Role: charm.RoleProvider},
+		{Name: "db", Interface: "mysql", Role: charm.RolePeer},
+	} {
+		c.Logf("test %d: %+v", i, term)
+		c.Check(term.Validate(), jc.ErrorIsNil)
+	}
+}
@@ -91,7 +91,15 @@ func ImageMetadataSources(env Environ) ([]simplestreams.DataSource, error) {
 			verify = utils.NoVerifySSLHostnames
 		}
 		publicKey, _ := simplestreams.UserPublicSigningKey()
-		sources = append(sources, simplestreams.NewURLSignedDataSource("image-metadata-url", userURL, publicKey, verify, simplestreams.SPECIFIC_CLOUD_DATA, false))
+		if simplestreams.IsGitURL(userURL) {
+			source, err := simplestreams.NewGitDataSource("image-metadata-url", userURL, publicKey, simplestreams.SPECIFIC_CLOUD_DATA, false)
+			if err != nil {
+				return nil, errors.Annotate(err, "invalid image-metadata-url")
+			}
+			sources = append(sources, source)
+		} else {
+			sources = append(sources, simplestreams.NewURLSignedDataSource("image-metadata-url", userURL, publicKey, verify, simplestreams.SPECIFIC_CLOUD_DATA, false))
+		}
 	}
 
 	envDataSources, err := environmentDataSources(env)
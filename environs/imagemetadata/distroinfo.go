@@ -0,0 +1,133 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package imagemetadata
+
+import (
+	"encoding/csv"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/utils/series"
+)
+
+// SeriesInfo holds the distro-info data for a series.
+type SeriesInfo struct {
+	// Version is the version of the series, eg "16.04".
+	Version string
+
+	// EOL is the date the series reaches its end of life,
+	// or zero if it is not known.
+	EOL time.Time
+}
+
+// DistroInfo holds the distro-info data for each series, keyed by
+// series name, eg "xenial".
+type DistroInfo map[string]SeriesInfo
+
+var (
+	distroInfoMu sync.Mutex
+	distroInfo   DistroInfo
+)
+
+// SetDistroInfo sets the distro-info data used to resolve series
+// versions and end of life dates, in place of the data installed on
+// the system. Series not in info are still resolved using the system
+// data. Passing nil reverts to using only the system data.
+func SetDistroInfo(info DistroInfo) {
+	distroInfoMu.Lock()
+	defer distroInfoMu.Unlock()
+	distroInfo = info
+}
+
+// injectedDistroInfo returns the distro-info data set
+// with SetDistroInfo, or nil if there is none.
+func injectedDistroInfo() DistroInfo {
+	distroInfoMu.Lock()
+	defer distroInfoMu.Unlock()
+	return distroInfo
+}
+
+// seriesVersion returns the version of the series, using any injected
+// distro-info data in preference to that installed on the system.
+func seriesVersion(ser string) (string, error) {
+	if info, ok := injectedDistroInfo()[ser]; ok && info.Version != "" {
+		return info.Version, nil
+	}
+	return series.SeriesVersion(ser)
+}
+
+// LoadDistroInfo reads the distro-info CSV file at path,
+// such as /usr/share/distro-info/ubuntu.csv.
+func LoadDistroInfo(path string) (DistroInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	defer f.Close()
+	info, err := ReadDistroInfo(f)
+	if err != nil {
+		return nil, errors.Annotatef(err, "reading %q", path)
+	}
+	return info, nil
+}
+
+// ReadDistroInfo reads distro-info data in CSV form from r. The data
+// must have a series column, and may have version, eol and eol-server
+// columns. The server end of life date is used where one is given.
+func ReadDistroInfo(r io.Reader) (DistroInfo, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[name] = i
+	}
+	seriesCol, ok := columns["series"]
+	if !ok {
+		return nil, errors.New("no series column")
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+
+	result := make(DistroInfo)
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		if len(record) <= seriesCol {
+			continue
+		}
+		var info SeriesInfo
+		// Versions of LTS releases are followed by "LTS".
+		if fields := strings.Fields(field(record, "version")); len(fields) > 0 {
+			info.Version = fields[0]
+		}
+		eolStr := field(record, "eol-server")
+		if eolStr == "" {
+			eolStr = field(record, "eol")
+		}
+		if eolStr != "" {
+			if info.EOL, err = time.Parse("2006-01-02", eolStr); err != nil {
+				return nil, errors.Annotatef(err, "invalid end of life date for series %q", record[seriesCol])
+			}
+		}
+		result[record[seriesCol]] = info
+	}
+	return result, nil
+}
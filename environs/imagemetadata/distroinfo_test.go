@@ -0,0 +1,91 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package imagemetadata_test
+
+import (
+	"path/filepath"
+	"strings"
+	"time"
+
+	jc "github.com/juju/testing/checkers"
+	"github.com/juju/utils/series"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/juju/environs/imagemetadata"
+	"github.com/juju/juju/environs/simplestreams"
+)
+
+type distroInfoSuite struct {
+	origPath string
+}
+
+var _ = gc.Suite(&distroInfoSuite{})
+
+func (s *distroInfoSuite) SetUpTest(c *gc.C) {
+	// Ensure the system distro-info data is not used.
+	s.origPath = imagemetadata.SetDistroInfoPath(filepath.Join(c.MkDir(), "missing.csv"))
+}
+
+func (s *distroInfoSuite) TearDownTest(c *gc.C) {
+	imagemetadata.SetDistroInfo(nil)
+	imagemetadata.SetDistroInfoPath(s.origPath)
+}
+
+func (s *distroInfoSuite) TestReadDistroInfo(c *gc.C) {
+	info, err := imagemetadata.ReadDistroInfo(strings.NewReader(distroInfo))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(info, jc.DeepEquals, imagemetadata.DistroInfo{
+		"precise": {Version: "12.04", EOL: time.Date(2014, 1, 1, 0, 0, 0, 0, time.UTC)},
+		"xenial":  {Version: "16.04", EOL: time.Date(2099, 4, 21, 0, 0, 0, 0, time.UTC)},
+	})
+}
+
+func (s *distroInfoSuite) TestReadDistroInfoNoSeries(c *gc.C) {
+	_, err := imagemetadata.ReadDistroInfo(strings.NewReader("version,codename\n"))
+	c.Assert(err, gc.ErrorMatches, "no series column")
+}
+
+func (s *distroInfoSuite) TestInjectedSeriesVersion(c *gc.C) {
+	imagemetadata.SetDistroInfo(imagemetadata.DistroInfo{
+		"hermetic": {Version: "42.10"},
+	})
+	imageConstraint := imagemetadata.NewImageConstraint(simplestreams.LookupParams{
+		Series: []string{"hermetic", "xenial"},
+		Arches: []string{"amd64"},
+	})
+	ids, err := imageConstraint.ProductIds()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(ids, gc.DeepEquals, []string{
+		"com.ubuntu.cloud:server:42.10:amd64",
+		"com.ubuntu.cloud:server:16.04:amd64",
+	})
+}
+
+func (s *distroInfoSuite) TestInjectedEOLWarning(c *gc.C) {
+	info, err := imagemetadata.ReadDistroInfo(strings.NewReader(distroInfo))
+	c.Assert(err, jc.ErrorIsNil)
+	imagemetadata.SetDistroInfo(info)
+	imageConstraint := imagemetadata.NewImageConstraint(simplestreams.LookupParams{
+		Series: []string{"precise", "xenial"},
+		Arches: []string{"amd64"},
+	})
+	_, warnings, err := imageConstraint.ProductIdsWithWarnings()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(warnings, gc.DeepEquals, []string{
+		`series "precise" (12.04) reached its end of life on 2014-01-01`,
+	})
+}
+
+func (s *distroInfoSuite) TestRevertToSystem(c *gc.C) {
+	imagemetadata.SetDistroInfo(imagemetadata.DistroInfo{
+		"hermetic": {Version: "42.10"},
+	})
+	imagemetadata.SetDistroInfo(nil)
+	imageConstraint := imagemetadata.NewImageConstraint(simplestreams.LookupParams{
+		Series: []string{"hermetic"},
+		Arches: []string{"amd64"},
+	})
+	_, err := imageConstraint.ProductIds()
+	c.Assert(series.IsUnknownSeriesVersionError(err), jc.IsTrue)
+}
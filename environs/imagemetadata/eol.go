@@ -0,0 +1,54 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package imagemetadata
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// distroInfoPath is the location of the Ubuntu distro-info data
+// used to determine when a series reaches its end of life.
+// Declared as a var so it can be overidden for testing.
+var distroInfoPath = "/usr/share/distro-info/ubuntu.csv"
+
+// ProductIdsWithWarnings behaves like ProductIds, additionally returning
+// a warning for each series which is past its end of life according to
+// distro-info. The data set with SetDistroInfo is used if there is any,
+// otherwise that installed on the system. If there is no distro-info
+// data, no warnings are returned.
+func (ic *ImageConstraint) ProductIdsWithWarnings() ([]string, []string, error) {
+	ids, err := ic.ProductIds()
+	if err != nil {
+		return nil, nil, err
+	}
+	info := injectedDistroInfo()
+	if info == nil {
+		info, err = LoadDistroInfo(distroInfoPath)
+		if os.IsNotExist(errors.Cause(err)) {
+			return ids, nil, nil
+		} else if err != nil {
+			return nil, nil, errors.Annotate(err, "reading series end of life dates")
+		}
+	}
+	var warnings []string
+	now := time.Now()
+	for _, ser := range ic.Series {
+		eolDate := info[ser].EOL
+		if eolDate.IsZero() || now.Before(eolDate) {
+			continue
+		}
+		version, err := seriesVersion(ser)
+		if err != nil {
+			return nil, nil, err
+		}
+		warnings = append(warnings, fmt.Sprintf(
+			"series %q (%s) reached its end of life on %s", ser, version, eolDate.Format("2006-01-02"),
+		))
+	}
+	return ids, warnings, nil
+}
@@ -0,0 +1,85 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package imagemetadata_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	jc "github.com/juju/testing/checkers"
+	"github.com/juju/utils/series"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/juju/environs/imagemetadata"
+	"github.com/juju/juju/environs/simplestreams"
+)
+
+type eolSuite struct {
+	origPath string
+}
+
+var _ = gc.Suite(&eolSuite{})
+
+const distroInfo = `version,codename,series,created,release,eol,eol-server
+12.04 LTS,Precise Pangolin,precise,2011-10-13,2012-04-26,2013-04-26,2014-01-01
+16.04 LTS,Xenial Xerus,xenial,2015-10-22,2016-04-21,2099-04-21,2099-04-21
+`
+
+func (s *eolSuite) SetUpTest(c *gc.C) {
+	path := filepath.Join(c.MkDir(), "ubuntu.csv")
+	err := ioutil.WriteFile(path, []byte(distroInfo), 0644)
+	c.Assert(err, jc.ErrorIsNil)
+	s.origPath = imagemetadata.SetDistroInfoPath(path)
+}
+
+func (s *eolSuite) TearDownTest(c *gc.C) {
+	imagemetadata.SetDistroInfoPath(s.origPath)
+}
+
+func (s *eolSuite) TestEOLSeriesWarning(c *gc.C) {
+	imageConstraint := imagemetadata.NewImageConstraint(simplestreams.LookupParams{
+		Series: []string{"precise", "xenial"},
+		Arches: []string{"amd64"},
+	})
+	ids, warnings, err := imageConstraint.ProductIdsWithWarnings()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(ids, gc.DeepEquals, []string{
+		"com.ubuntu.cloud:server:12.04:amd64",
+		"com.ubuntu.cloud:server:16.04:amd64",
+	})
+	c.Assert(warnings, gc.DeepEquals, []string{
+		`series "precise" (12.04) reached its end of life on 2014-01-01`,
+	})
+}
+
+func (s *eolSuite) TestSupportedSeriesNoWarning(c *gc.C) {
+	imageConstraint := imagemetadata.NewImageConstraint(simplestreams.LookupParams{
+		Series: []string{"xenial"},
+		Arches: []string{"amd64"},
+	})
+	_, warnings, err := imageConstraint.ProductIdsWithWarnings()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(warnings, gc.HasLen, 0)
+}
+
+func (s *eolSuite) TestNoDistroInfo(c *gc.C) {
+	imagemetadata.SetDistroInfoPath(filepath.Join(c.MkDir(), "missing.csv"))
+	imageConstraint := imagemetadata.NewImageConstraint(simplestreams.LookupParams{
+		Series: []string{"precise"},
+		Arches: []string{"amd64"},
+	})
+	ids, warnings, err := imageConstraint.ProductIdsWithWarnings()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(ids, gc.DeepEquals, []string{"com.ubuntu.cloud:server:12.04:amd64"})
+	c.Assert(warnings, gc.HasLen, 0)
+}
+
+func (s *eolSuite) TestUnknownSeries(c *gc.C) {
+	imageConstraint := imagemetadata.NewImageConstraint(simplestreams.LookupParams{
+		Series: []string{"unknown"},
+		Arches: []string{"amd64"},
+	})
+	_, _, err := imageConstraint.ProductIdsWithWarnings()
+	c.Assert(series.IsUnknownSeriesVersionError(err), jc.IsTrue)
+}
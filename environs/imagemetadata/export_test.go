@@ -11,3 +11,10 @@ func SetSigningPublicKey(key string) string {
 	SimplestreamsImagesPublicKey = key
 	return oldKey
 }
+
+// SetDistroInfoPath sets a new distro-info path for testing and returns the original path.
+func SetDistroInfoPath(path string) string {
+	oldPath := distroInfoPath
+	distroInfoPath = path
+	return oldPath
+}
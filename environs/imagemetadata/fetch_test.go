@@ -0,0 +1,1432 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package imagemetadata_test
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	"github.com/juju/utils"
+	"github.com/juju/version"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/juju/environs/imagemetadata"
+	"github.com/juju/juju/environs/simplestreams"
+	sstesting "github.com/juju/juju/environs/simplestreams/testing"
+)
+
+type fetchOptionsSuite struct{}
+
+var _ = gc.Suite(&fetchOptionsSuite{})
+
+func (s *fetchOptionsSuite) SetUpTest(c *gc.C) {
+	sstesting.SetRoundTripperFiles(map[string]string{
+		"/options/streams/v1/index.json":          optionsIndex,
+		"/options/streams/v1/image_metadata.json": optionsProduct,
+		"/labels/streams/v1/index.json":           labelsIndex,
+		"/labels/streams/v1/image_metadata.json":  labelsProduct,
+
+		// The redirect source's index refers to products found
+		// by following its mirror, which itself redirects to
+		// the options source.
+		"/redirect/streams/v1/index.json":          optionsIndex,
+		"/redirect/streams/v1/mirrors.json":        imageMirrorRefs,
+		"/redirect/streams/v1/images-mirrors.json": imageMirror("test://host/mirror/"),
+		"/mirror/streams/v1/mirrors.json":          imageMirrorRefs,
+		"/mirror/streams/v1/images-mirrors.json":   imageMirror("test://host/options/"),
+
+		// The loop-a and loop-b sources are mirrors of each other.
+		"/loop-a/streams/v1/index.json":          optionsIndex,
+		"/loop-a/streams/v1/mirrors.json":        imageMirrorRefs,
+		"/loop-a/streams/v1/images-mirrors.json": imageMirror("test://host/loop-b/"),
+		"/loop-b/streams/v1/mirrors.json":        imageMirrorRefs,
+		"/loop-b/streams/v1/images-mirrors.json": imageMirror("test://host/loop-a/"),
+	}, nil)
+}
+
+func (s *fetchOptionsSuite) TearDownTest(c *gc.C) {
+	sstesting.SetRoundTripperFiles(nil, nil)
+}
+
+func (s *fetchOptionsSuite) fetch(c *gc.C, opts imagemetadata.FetchOptions) []*imagemetadata.ImageMetadata {
+	source := simplestreams.NewURLDataSource("test", "test://host/options", utils.VerifySSLHostnames, simplestreams.DEFAULT_CLOUD_DATA, false)
+	imageConstraint := imagemetadata.NewImageConstraint(simplestreams.LookupParams{
+		CloudSpec: simplestreams.CloudSpec{"us-east-1", "https://ec2.us-east-1.amazonaws.com"},
+		Series:    []string{"precise"},
+		Arches:    []string{"amd64"},
+	})
+	images, _, err := imagemetadata.FetchWithOptions([]simplestreams.DataSource{source}, imageConstraint, opts)
+	c.Assert(err, jc.ErrorIsNil)
+	return images
+}
+
+func imageIds(images []*imagemetadata.ImageMetadata) []string {
+	ids := make([]string, len(images))
+	for i, im := range images {
+		ids[i] = im.Id
+	}
+	return ids
+}
+
+func (s *fetchOptionsSuite) TestFetchCloudSpecs(c *gc.C) {
+	images := s.fetch(c, imagemetadata.FetchOptions{
+		CloudSpecs: []simplestreams.CloudSpec{
+			{"us-east-1", "https://ec2.us-east-1.amazonaws.com"},
+			{"us-west-1", "https://ec2.us-west-1.amazonaws.com/"},
+		},
+	})
+	c.Assert(images, gc.HasLen, 2)
+	c.Check(images[0].Id, gc.Equals, "ami-20140101")
+	c.Check(images[0].RegionName, gc.Equals, "us-east-1")
+	c.Check(images[0].Endpoint, gc.Equals, "https://ec2.us-east-1.amazonaws.com")
+	c.Check(images[1].Id, gc.Equals, "ami-west-20140101")
+	c.Check(images[1].RegionName, gc.Equals, "us-west-1")
+	c.Check(images[1].Endpoint, gc.Equals, "https://ec2.us-west-1.amazonaws.com/")
+}
+
+func (s *fetchOptionsSuite) TestFetchChecksum(c *gc.C) {
+	images := s.fetch(c, imagemetadata.FetchOptions{
+		CloudSpecs: []simplestreams.CloudSpec{
+			{"us-east-1", "https://ec2.us-east-1.amazonaws.com"},
+			{"us-west-1", "https://ec2.us-west-1.amazonaws.com/"},
+		},
+	})
+	checksums := make(map[string]string)
+	for _, im := range images {
+		checksums[im.Id] = im.SHA256
+	}
+	c.Assert(checksums, jc.DeepEquals, map[string]string{
+		"ami-20140101":      "b41b86dcfdc6219bc2fb987591ad9995bcf3a1e40c2bdd3fdbec622371e6e1af",
+		"ami-west-20140101": "",
+	})
+}
+
+func (s *fetchOptionsSuite) TestVerifyChecksum(c *gc.C) {
+	im := &imagemetadata.ImageMetadata{
+		Id:     "ami-20140101",
+		SHA256: "b41b86dcfdc6219bc2fb987591ad9995bcf3a1e40c2bdd3fdbec622371e6e1af",
+	}
+	c.Assert(im.VerifyChecksum(strings.NewReader("image data")), jc.ErrorIsNil)
+	err := im.VerifyChecksum(strings.NewReader("other data"))
+	c.Assert(err, gc.ErrorMatches, `image "ami-20140101" has SHA256 checksum .*, expected b41b86dc.*`)
+}
+
+func (s *fetchOptionsSuite) TestVerifyChecksumMissing(c *gc.C) {
+	im := &imagemetadata.ImageMetadata{Id: "ami-20130101"}
+	c.Assert(im.VerifyChecksum(strings.NewReader("anything")), jc.ErrorIsNil)
+}
+
+func (s *fetchOptionsSuite) fetchLabelled(c *gc.C, label string) []*imagemetadata.ImageMetadata {
+	source := simplestreams.NewURLDataSource("test", "test://host/labels", utils.VerifySSLHostnames, simplestreams.DEFAULT_CLOUD_DATA, false)
+	imageConstraint := imagemetadata.NewImageConstraint(simplestreams.LookupParams{
+		CloudSpec: simplestreams.CloudSpec{"us-east-1", "https://ec2.us-east-1.amazonaws.com"},
+		Series:    []string{"xenial"},
+		Arches:    []string{"amd64"},
+	})
+	images, _, err := imagemetadata.FetchWithOptions(
+		[]simplestreams.DataSource{source}, imageConstraint, imagemetadata.FetchOptions{Label: label},
+	)
+	c.Assert(err, jc.ErrorIsNil)
+	return images
+}
+
+func (s *fetchOptionsSuite) TestFetchLabel(c *gc.C) {
+	images := s.fetchLabelled(c, "ubuntu-minimal")
+	c.Assert(imageIds(images), jc.DeepEquals, []string{"ami-minimal"})
+	c.Assert(images[0].Label, gc.Equals, "ubuntu-minimal")
+}
+
+func (s *fetchOptionsSuite) TestFetchNoLabel(c *gc.C) {
+	images := s.fetchLabelled(c, "")
+	c.Assert(imageIds(images), jc.DeepEquals, []string{"ami-full", "ami-minimal"})
+}
+
+func (s *fetchOptionsSuite) TestFetchUnknownLabel(c *gc.C) {
+	images := s.fetchLabelled(c, "ubuntu-pro")
+	c.Assert(images, gc.HasLen, 0)
+}
+
+func (s *fetchOptionsSuite) TestFetchByProduct(c *gc.C) {
+	source := simplestreams.NewURLDataSource("test", "test://host/options", utils.VerifySSLHostnames, simplestreams.DEFAULT_CLOUD_DATA, false)
+	imageConstraint := imagemetadata.NewImageConstraint(simplestreams.LookupParams{
+		CloudSpec: simplestreams.CloudSpec{"us-east-1", "https://ec2.us-east-1.amazonaws.com"},
+		Series:    []string{"precise"},
+		Arches:    []string{"amd64", "i386"},
+	})
+	products, _, err := imagemetadata.FetchByProduct([]simplestreams.DataSource{source}, imageConstraint)
+	c.Assert(err, jc.ErrorIsNil)
+
+	ids, err := imageConstraint.ProductIds()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(products, gc.HasLen, len(ids))
+	for _, id := range ids {
+		c.Assert(products[id], gc.Not(gc.HasLen), 0)
+	}
+	for _, im := range products["com.ubuntu.cloud:server:12.04:amd64"] {
+		c.Check(im.Arch, gc.Equals, "amd64")
+	}
+	c.Assert(imageIds(products["com.ubuntu.cloud:server:12.04:i386"]), jc.DeepEquals, []string{"ami-i386-20140101"})
+}
+
+type memorySourceSuite struct{}
+
+var _ = gc.Suite(&memorySourceSuite{})
+
+func (s *memorySourceSuite) TestFetchFromMemorySource(c *gc.C) {
+	source := sstesting.NewMemoryDataSource("memory", map[string]string{
+		"streams/v1/index.json":          optionsIndex,
+		"streams/v1/image_metadata.json": optionsProduct,
+	})
+	imageConstraint := imagemetadata.NewImageConstraint(simplestreams.LookupParams{
+		CloudSpec: simplestreams.CloudSpec{"us-east-1", "https://ec2.us-east-1.amazonaws.com"},
+		Series:    []string{"precise"},
+		Arches:    []string{"amd64"},
+	})
+	images, resolveInfo, err := imagemetadata.FetchWithOptions(
+		[]simplestreams.DataSource{source}, imageConstraint, imagemetadata.FetchOptions{},
+	)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(imageIds(images), jc.DeepEquals, []string{"ami-20140101"})
+	c.Assert(resolveInfo.IndexURL, gc.Equals, "memory://memory/streams/v1/index.json")
+}
+
+func (s *memorySourceSuite) fetchDeprecated(c *gc.C, includeDeprecated bool) []*imagemetadata.ImageMetadata {
+	source := sstesting.NewMemoryDataSource("memory", map[string]string{
+		"streams/v1/index.json":          labelsIndex,
+		"streams/v1/image_metadata.json": deprecatedProduct,
+	})
+	imageConstraint := imagemetadata.NewImageConstraint(simplestreams.LookupParams{
+		CloudSpec: simplestreams.CloudSpec{"us-east-1", "https://ec2.us-east-1.amazonaws.com"},
+		Series:    []string{"xenial"},
+		Arches:    []string{"amd64"},
+	})
+	images, _, err := imagemetadata.FetchWithOptions(
+		[]simplestreams.DataSource{source}, imageConstraint, imagemetadata.FetchOptions{IncludeDeprecated: includeDeprecated},
+	)
+	c.Assert(err, jc.ErrorIsNil)
+	return images
+}
+
+func (s *memorySourceSuite) TestFetchExcludesDeprecated(c *gc.C) {
+	images := s.fetchDeprecated(c, false)
+	c.Assert(imageIds(images), jc.DeepEquals, []string{"ami-hvm"})
+	c.Assert(images[0].Deprecated, jc.IsFalse)
+}
+
+func (s *memorySourceSuite) TestFetchIncludeDeprecated(c *gc.C) {
+	images := s.fetchDeprecated(c, true)
+	c.Assert(imageIds(images), jc.DeepEquals, []string{"ami-hvm", "ami-pv"})
+	c.Assert(images[1].Deprecated, jc.IsTrue)
+	c.Assert(images[1].SupersededBy, gc.Equals, "ami-hvm")
+}
+
+// countingDataSource is a memory data source which records
+// how many times each path is fetched.
+type countingDataSource struct {
+	*sstesting.MemoryDataSource
+	fetched map[string]int
+}
+
+func (s *countingDataSource) Fetch(path string) (io.ReadCloser, string, error) {
+	s.fetched[path]++
+	return s.MemoryDataSource.Fetch(path)
+}
+
+func (s *memorySourceSuite) fetchEarlyStop(c *gc.C, opts imagemetadata.FetchOptions) ([]*imagemetadata.ImageMetadata, *countingDataSource) {
+	source := &countingDataSource{
+		MemoryDataSource: sstesting.NewMemoryDataSource("memory", map[string]string{
+			"streams/v1/index.json":          optionsIndex,
+			"streams/v1/image_metadata.json": optionsProduct,
+		}),
+		fetched: make(map[string]int),
+	}
+	imageConstraint := imagemetadata.NewImageConstraint(simplestreams.LookupParams{
+		CloudSpec: simplestreams.CloudSpec{"us-east-1", "https://ec2.us-east-1.amazonaws.com"},
+		Series:    []string{"precise"},
+		Arches:    []string{"amd64", "i386"},
+	})
+	images, _, err := imagemetadata.FetchWithOptions([]simplestreams.DataSource{source}, imageConstraint, opts)
+	c.Assert(err, jc.ErrorIsNil)
+	return images, source
+}
+
+func (s *memorySourceSuite) TestFetchEarlyStop(c *gc.C) {
+	images, _ := s.fetchEarlyStop(c, imagemetadata.FetchOptions{})
+	c.Assert(images, gc.HasLen, 2)
+
+	images, _ = s.fetchEarlyStop(c, imagemetadata.FetchOptions{EarlyStop: 1})
+	c.Assert(images, gc.HasLen, 1)
+	c.Assert(images[0].Id, gc.Matches, "ami-20140101|ami-i386-20140101")
+}
+
+func (s *memorySourceSuite) TestFetchEarlyStopCloudSpecs(c *gc.C) {
+	cloudSpecs := []simplestreams.CloudSpec{
+		{"us-east-1", "https://ec2.us-east-1.amazonaws.com"},
+		{"us-west-1", "https://ec2.us-west-1.amazonaws.com/"},
+	}
+	images, source := s.fetchEarlyStop(c, imagemetadata.FetchOptions{CloudSpecs: cloudSpecs})
+	c.Assert(images, gc.HasLen, 3)
+	c.Assert(source.fetched["streams/v1/image_metadata.json"], gc.Equals, 2)
+
+	images, source = s.fetchEarlyStop(c, imagemetadata.FetchOptions{CloudSpecs: cloudSpecs, EarlyStop: 2})
+	c.Assert(images, gc.HasLen, 2)
+	c.Assert(source.fetched["streams/v1/image_metadata.json"], gc.Equals, 1)
+	for _, im := range images {
+		c.Check(im.RegionName, gc.Equals, "us-east-1")
+	}
+}
+
+// slowDataSource is a memory data source which takes
+// latency, measured by clock, to fetch each path.
+type slowDataSource struct {
+	*sstesting.MemoryDataSource
+	clock   *testing.Clock
+	latency time.Duration
+}
+
+func (s *slowDataSource) Fetch(path string) (io.ReadCloser, string, error) {
+	s.clock.Advance(s.latency)
+	return s.MemoryDataSource.Fetch(path)
+}
+
+func (s *memorySourceSuite) fetchWithDeadline(c *gc.C, deadline time.Duration) ([]*imagemetadata.ImageMetadata, error) {
+	clock := testing.NewClock(time.Now())
+	files := map[string]string{
+		"streams/v1/index.json":          optionsIndex,
+		"streams/v1/image_metadata.json": optionsProduct,
+	}
+	sources := []simplestreams.DataSource{
+		&slowDataSource{sstesting.NewMemoryDataSource("slow-1", nil), clock, 2 * time.Second},
+		&slowDataSource{sstesting.NewMemoryDataSource("slow-2", nil), clock, 2 * time.Second},
+		&slowDataSource{sstesting.NewMemoryDataSource("slow-3", files), clock, 2 * time.Second},
+	}
+	imageConstraint := imagemetadata.NewImageConstraint(simplestreams.LookupParams{
+		CloudSpec: simplestreams.CloudSpec{"us-east-1", "https://ec2.us-east-1.amazonaws.com"},
+		Series:    []string{"precise"},
+		Arches:    []string{"amd64"},
+	})
+	images, _, err := imagemetadata.FetchWithOptions(sources, imageConstraint, imagemetadata.FetchOptions{
+		Deadline: clock.Now().Add(deadline),
+		Clock:    clock,
+	})
+	return images, err
+}
+
+func (s *memorySourceSuite) TestFetchDeadline(c *gc.C) {
+	images, err := s.fetchWithDeadline(c, time.Minute)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(imageIds(images), jc.DeepEquals, []string{"ami-20130101", "ami-20140101"})
+}
+
+func (s *memorySourceSuite) TestFetchDeadlineExceeded(c *gc.C) {
+	// Each fetch takes 2s, so the deadline passes during the
+	// third, and no further fetches are made.
+	_, err := s.fetchWithDeadline(c, 5*time.Second)
+	c.Assert(err, gc.ErrorMatches, `deadline exceeded fetching image metadata, tried `+
+		`slow-1 "streams/v1/index.sjson", slow-1 "streams/v1/index.json", slow-2 "streams/v1/index.sjson"`)
+}
+
+// slowReadDataSource is a memory data source whose fetched
+// data takes latency, measured by clock, to read.
+type slowReadDataSource struct {
+	*sstesting.MemoryDataSource
+	clock   *testing.Clock
+	latency time.Duration
+	closed  []string
+}
+
+func (s *slowReadDataSource) Fetch(path string) (io.ReadCloser, string, error) {
+	rc, url, err := s.MemoryDataSource.Fetch(path)
+	if err != nil {
+		return nil, url, err
+	}
+	return &slowReader{rc, s, path}, url, nil
+}
+
+type slowReader struct {
+	io.ReadCloser
+	source *slowReadDataSource
+	path   string
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	r.source.clock.Advance(r.source.latency)
+	return r.ReadCloser.Read(p)
+}
+
+func (r *slowReader) Close() error {
+	r.source.closed = append(r.source.closed, r.path)
+	return r.ReadCloser.Close()
+}
+
+func (s *memorySourceSuite) TestFetchDeadlineExceededReading(c *gc.C) {
+	clock := testing.NewClock(time.Now())
+	source := &slowReadDataSource{
+		MemoryDataSource: sstesting.NewMemoryDataSource("slow", map[string]string{
+			"streams/v1/index.json":          optionsIndex,
+			"streams/v1/image_metadata.json": optionsProduct,
+		}),
+		clock:   clock,
+		latency: 2 * time.Second,
+	}
+	imageConstraint := imagemetadata.NewImageConstraint(simplestreams.LookupParams{
+		CloudSpec: simplestreams.CloudSpec{"us-east-1", "https://ec2.us-east-1.amazonaws.com"},
+		Series:    []string{"precise"},
+		Arches:    []string{"amd64"},
+	})
+	// Fetching takes no time, but each read takes 2s,
+	// so the deadline passes while reading the index.
+	_, _, err := imagemetadata.FetchWithOptions([]simplestreams.DataSource{source}, imageConstraint, imagemetadata.FetchOptions{
+		Deadline: clock.Now().Add(3 * time.Second),
+		Clock:    clock,
+	})
+	c.Assert(err, gc.ErrorMatches, `deadline exceeded fetching image metadata, tried slow "streams/v1/index.sjson", slow "streams/v1/index.json"`)
+	c.Assert(source.closed, jc.DeepEquals, []string{"streams/v1/index.json"})
+}
+
+// blockingDataSource is a data source whose
+// fetches wait until unblock is closed.
+type blockingDataSource struct {
+	*sstesting.MemoryDataSource
+	unblock chan struct{}
+}
+
+func (s *blockingDataSource) Fetch(path string) (io.ReadCloser, string, error) {
+	<-s.unblock
+	return s.MemoryDataSource.Fetch(path)
+}
+
+func (s *memorySourceSuite) TestFetchDeadlineAbandonsFetch(c *gc.C) {
+	source := &blockingDataSource{
+		MemoryDataSource: sstesting.NewMemoryDataSource("blocked", nil),
+		unblock:          make(chan struct{}),
+	}
+	defer close(source.unblock)
+	imageConstraint := imagemetadata.NewImageConstraint(simplestreams.LookupParams{
+		CloudSpec: simplestreams.CloudSpec{"us-east-1", "https://ec2.us-east-1.amazonaws.com"},
+		Series:    []string{"precise"},
+		Arches:    []string{"amd64"},
+	})
+	done := make(chan error, 1)
+	go func() {
+		_, _, err := imagemetadata.FetchWithOptions([]simplestreams.DataSource{source}, imageConstraint, imagemetadata.FetchOptions{
+			Deadline: time.Now().Add(coretesting.ShortWait),
+		})
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		c.Assert(err, gc.ErrorMatches, `deadline exceeded fetching image metadata, tried blocked "streams/v1/index.sjson"`)
+	case <-time.After(coretesting.LongWait):
+		c.Fatalf("fetch not abandoned at deadline")
+	}
+}
+
+var versionedProduct = strings.NewReplacer(
+	`"id": "ami-20130101"`, `"id": "ami-20130101", "kernel": "3.2.0-23", "agent_version": "1.25.6"`,
+	`"id": "ami-20140101",`, `"id": "ami-20140101", "kernel": "3.13.0-24", "agent_version": "2.0.0",`,
+).Replace(optionsProduct)
+
+func (s *memorySourceSuite) fetchVersioned(c *gc.C, opts imagemetadata.FetchOptions) []string {
+	source := sstesting.NewMemoryDataSource("memory", map[string]string{
+		"streams/v1/index.json":          optionsIndex,
+		"streams/v1/image_metadata.json": versionedProduct,
+	})
+	imageConstraint := imagemetadata.NewImageConstraint(simplestreams.LookupParams{
+		CloudSpec: simplestreams.CloudSpec{"us-east-1", "https://ec2.us-east-1.amazonaws.com"},
+		Series:    []string{"precise"},
+		Arches:    []string{"amd64", "i386"},
+	})
+	images, _, err := imagemetadata.FetchWithOptions([]simplestreams.DataSource{source}, imageConstraint, opts)
+	c.Assert(err, jc.ErrorIsNil)
+	var ids []string
+	for _, im := range images {
+		ids = append(ids, im.Id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (s *memorySourceSuite) TestFetchArchAlias(c *gc.C) {
+	source := sstesting.NewMemoryDataSource("memory", map[string]string{
+		"streams/v1/index.json":          optionsIndex,
+		"streams/v1/image_metadata.json": optionsProduct,
+	})
+	imageConstraint := imagemetadata.NewImageConstraint(simplestreams.LookupParams{
+		CloudSpec: simplestreams.CloudSpec{"us-east-1", "https://ec2.us-east-1.amazonaws.com"},
+		Series:    []string{"precise"},
+		Arches:    []string{"x86"},
+	})
+	images, _, err := imagemetadata.Fetch([]simplestreams.DataSource{source}, imageConstraint)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(images, gc.HasLen, 1)
+	c.Check(images[0].Id, gc.Equals, "ami-i386-20140101")
+	c.Check(images[0].Arch, gc.Equals, "i386")
+}
+
+func (s *memorySourceSuite) fetchEndpoint(c *gc.C, endpoint string, opts imagemetadata.FetchOptions) []string {
+	source := sstesting.NewMemoryDataSource("memory", map[string]string{
+		"streams/v1/index.json":          endpointsIndex,
+		"streams/v1/image_metadata.json": endpointsProduct,
+	})
+	imageConstraint := imagemetadata.NewImageConstraint(simplestreams.LookupParams{
+		CloudSpec: simplestreams.CloudSpec{"us-east-1", endpoint},
+		Series:    []string{"precise"},
+		Arches:    []string{"amd64"},
+	})
+	images, _, err := imagemetadata.FetchWithOptions([]simplestreams.DataSource{source}, imageConstraint, opts)
+	c.Assert(err, jc.ErrorIsNil)
+	return imageIds(images)
+}
+
+func (s *memorySourceSuite) TestFetchMatchEndpoint(c *gc.C) {
+	opts := imagemetadata.FetchOptions{MatchEndpoint: true}
+	ids := s.fetchEndpoint(c, "https://ec2-fips.us-east-1.amazonaws.com", opts)
+	c.Assert(ids, jc.DeepEquals, []string{"ami-fips-20140101"})
+
+	ids = s.fetchEndpoint(c, "https://ec2.us-east-1.amazonaws.com", opts)
+	c.Assert(ids, jc.DeepEquals, []string{"ami-20140101"})
+}
+
+func (s *memorySourceSuite) TestFetchMatchEndpointDefault(c *gc.C) {
+	// By default, images in the region are matched whatever their
+	// endpoint, and only one of each kind is returned, so either
+	// image may be.
+	ids := s.fetchEndpoint(c, "https://ec2-fips.us-east-1.amazonaws.com", imagemetadata.FetchOptions{})
+	c.Assert(ids, gc.HasLen, 1)
+	c.Assert(ids[0], gc.Matches, "ami-20140101|ami-fips-20140101")
+}
+
+// instanceStoreProduct is optionsProduct with ami-20140101
+// in the us-east-1 region on instance storage.
+var instanceStoreProduct = strings.Replace(optionsProduct, `"root_store": "ebs",
+       "virt": "hvm",
+       "id": "ami-20140101",`, `"root_store": "instance",
+       "virt": "hvm",
+       "id": "ami-20140101",`, 1)
+
+func (s *memorySourceSuite) fetchWeighted(c *gc.C, lowPriority, highPriority int) []*imagemetadata.ImageMetadata {
+	ebs := sstesting.NewMemoryDataSource("ebs", map[string]string{
+		"streams/v1/index.json":          optionsIndex,
+		"streams/v1/image_metadata.json": optionsProduct,
+	})
+	instance := sstesting.NewMemoryDataSource("instance", map[string]string{
+		"streams/v1/index.json":          optionsIndex,
+		"streams/v1/image_metadata.json": instanceStoreProduct,
+	})
+	empty := sstesting.NewMemoryDataSource("empty", nil)
+	imageConstraint := imagemetadata.NewImageConstraint(simplestreams.LookupParams{
+		CloudSpec: simplestreams.CloudSpec{"us-east-1", "https://ec2.us-east-1.amazonaws.com"},
+		Series:    []string{"precise"},
+		Arches:    []string{"amd64"},
+	})
+	images, _, err := imagemetadata.FetchWeighted([]imagemetadata.WeightedSource{
+		{Source: empty, Priority: 100},
+		{Source: ebs, Priority: lowPriority},
+		{Source: instance, Priority: highPriority},
+	}, imageConstraint, imagemetadata.FetchOptions{})
+	c.Assert(err, jc.ErrorIsNil)
+	return images
+}
+
+func (s *memorySourceSuite) TestFetchWeightedPriorityWins(c *gc.C) {
+	images := s.fetchWeighted(c, 10, 20)
+	c.Assert(imageIds(images), jc.DeepEquals, []string{"ami-20130101", "ami-20140101"})
+	// The later listed source has the higher priority.
+	c.Assert(images[1].Storage, gc.Equals, "instance")
+}
+
+func (s *memorySourceSuite) TestFetchWeightedTieListOrder(c *gc.C) {
+	images := s.fetchWeighted(c, 10, 10)
+	c.Assert(imageIds(images), jc.DeepEquals, []string{"ami-20130101", "ami-20140101"})
+	c.Assert(images[1].Storage, gc.Equals, "ebs")
+}
+
+func (s *memorySourceSuite) TestFetchWeightedNotFound(c *gc.C) {
+	imageConstraint := imagemetadata.NewImageConstraint(simplestreams.LookupParams{
+		CloudSpec: simplestreams.CloudSpec{"us-east-1", "https://ec2.us-east-1.amazonaws.com"},
+		Series:    []string{"precise"},
+		Arches:    []string{"amd64"},
+	})
+	_, _, err := imagemetadata.FetchWeighted([]imagemetadata.WeightedSource{
+		{Source: sstesting.NewMemoryDataSource("empty", nil), Priority: 1},
+	}, imageConstraint, imagemetadata.FetchOptions{})
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+}
+
+func (s *memorySourceSuite) TestFetchVersionedAttrs(c *gc.C) {
+	source := sstesting.NewMemoryDataSource("memory", map[string]string{
+		"streams/v1/index.json":          optionsIndex,
+		"streams/v1/image_metadata.json": versionedProduct,
+	})
+	imageConstraint := imagemetadata.NewImageConstraint(simplestreams.LookupParams{
+		CloudSpec: simplestreams.CloudSpec{"us-east-1", "https://ec2.us-east-1.amazonaws.com"},
+		Series:    []string{"precise"},
+		Arches:    []string{"amd64"},
+	})
+	images, _, err := imagemetadata.Fetch([]simplestreams.DataSource{source}, imageConstraint)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(images, gc.HasLen, 1)
+	c.Check(images[0].Kernel, gc.Equals, "3.13.0-24")
+	c.Check(images[0].AgentVersion, gc.Equals, "2.0.0")
+}
+
+func (s *memorySourceSuite) TestFetchMinVersions(c *gc.C) {
+	for i, test := range []struct {
+		about string
+		opts  imagemetadata.FetchOptions
+		ids   []string
+	}{{
+		about: "no minimums",
+		ids:   []string{"ami-20140101", "ami-i386-20140101"},
+	}, {
+		about: "kernel excludes images without a kernel",
+		opts:  imagemetadata.FetchOptions{MinKernel: "3.2.0"},
+		ids:   []string{"ami-20140101"},
+	}, {
+		about: "kernel compares numerically",
+		opts:  imagemetadata.FetchOptions{MinKernel: "3.13.0-24"},
+		ids:   []string{"ami-20140101"},
+	}, {
+		about: "kernel too new",
+		opts:  imagemetadata.FetchOptions{MinKernel: "4.4"},
+	}, {
+		about: "agent version",
+		opts:  imagemetadata.FetchOptions{MinAgentVersion: version.MustParse("1.25.0")},
+		ids:   []string{"ami-20140101"},
+	}, {
+		about: "agent version too new",
+		opts:  imagemetadata.FetchOptions{MinAgentVersion: version.MustParse("2.1.0")},
+	}} {
+		c.Logf("test %d: %s", i, test.about)
+		c.Check(s.fetchVersioned(c, test.opts), jc.DeepEquals, test.ids)
+	}
+}
+
+func (s *memorySourceSuite) TestFetchIndexPaths(c *gc.C) {
+	// The daily index shares one image with the default index.
+	dailyIndex := strings.Replace(optionsIndex, "streams/v1/image_metadata.json", "streams/v1/daily.json", 1)
+	dailyProduct := strings.Replace(optionsProduct, "ami-i386-20140101", "ami-i386-daily", 1)
+	source := sstesting.NewMemoryDataSource("memory", map[string]string{
+		"streams/v1/index.json":          optionsIndex,
+		"streams/v1/image_metadata.json": optionsProduct,
+		"streams/v1/daily-index.json":    dailyIndex,
+		"streams/v1/daily.json":          dailyProduct,
+	})
+	imageConstraint := imagemetadata.NewImageConstraint(simplestreams.LookupParams{
+		CloudSpec: simplestreams.CloudSpec{"us-east-1", "https://ec2.us-east-1.amazonaws.com"},
+		Series:    []string{"precise"},
+		Arches:    []string{"amd64", "i386"},
+	})
+	images, resolveInfo, err := imagemetadata.FetchWithOptions(
+		[]simplestreams.DataSource{source}, imageConstraint, imagemetadata.FetchOptions{
+			IndexPaths: []string{"streams/v1/index", "streams/v1/daily-index"},
+		},
+	)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(imageIds(images), jc.DeepEquals, []string{"ami-20140101", "ami-i386-20140101", "ami-i386-daily"})
+	c.Assert(resolveInfo.IndexURL, gc.Equals, "memory://memory/streams/v1/index.json")
+}
+
+func (s *memorySourceSuite) TestFetchIndexPathsMissing(c *gc.C) {
+	source := sstesting.NewMemoryDataSource("memory", map[string]string{
+		"streams/v1/index.json":          optionsIndex,
+		"streams/v1/image_metadata.json": optionsProduct,
+	})
+	imageConstraint := imagemetadata.NewImageConstraint(simplestreams.LookupParams{
+		CloudSpec: simplestreams.CloudSpec{"us-east-1", "https://ec2.us-east-1.amazonaws.com"},
+		Series:    []string{"precise"},
+		Arches:    []string{"amd64"},
+	})
+	_, _, err := imagemetadata.FetchWithOptions(
+		[]simplestreams.DataSource{source}, imageConstraint, imagemetadata.FetchOptions{
+			IndexPaths: []string{"streams/v1/index", "streams/v1/daily-index"},
+		},
+	)
+	c.Assert(err, gc.ErrorMatches, `fetching images using index "streams/v1/daily-index": .*`)
+}
+
+// fetchManyProducts fetches the images from a source with an index
+// for each of ten product files, each holding its own images.
+func (s *memorySourceSuite) fetchManyProducts(
+	c *gc.C, opts imagemetadata.FetchOptions,
+) ([]*imagemetadata.ImageMetadata, []string) {
+	files := make(map[string]string)
+	for i := 0; i < 10; i++ {
+		productPath := fmt.Sprintf("streams/v1/products-%02d.json", i)
+		indexPath := fmt.Sprintf("streams/v1/index-%02d", i)
+		files[indexPath+".json"] = strings.Replace(optionsIndex, "streams/v1/image_metadata.json", productPath, 1)
+		files[productPath] = strings.NewReplacer(
+			"ami-20130101", fmt.Sprintf("ami-%02d-20130101", i),
+			"ami-20140101", fmt.Sprintf("ami-%02d-20140101", i),
+		).Replace(optionsProduct)
+		opts.IndexPaths = append(opts.IndexPaths, indexPath)
+	}
+	source := sstesting.NewMemoryDataSource("memory", files)
+	imageConstraint := imagemetadata.NewImageConstraint(simplestreams.LookupParams{
+		CloudSpec: simplestreams.CloudSpec{"us-east-1", "https://ec2.us-east-1.amazonaws.com"},
+		Series:    []string{"precise"},
+		Arches:    []string{"amd64"},
+	})
+	images, _, warnings, err := imagemetadata.FetchWithWarnings(
+		[]simplestreams.DataSource{source}, imageConstraint, opts,
+	)
+	c.Assert(err, jc.ErrorIsNil)
+	return images, warnings
+}
+
+func (s *memorySourceSuite) TestFetchMaxProducts(c *gc.C) {
+	images, warnings := s.fetchManyProducts(c, imagemetadata.FetchOptions{MaxProducts: 3})
+	ids := imageIds(images)
+	sort.Strings(ids)
+	c.Assert(ids, jc.DeepEquals, []string{
+		"ami-00-20130101", "ami-00-20140101",
+		"ami-01-20130101", "ami-01-20140101",
+		"ami-02-20130101", "ami-02-20140101",
+	})
+	c.Assert(warnings, jc.DeepEquals, []string{
+		`only 3 product files were fetched from "memory", so some images may be missing`,
+	})
+}
+
+func (s *memorySourceSuite) TestFetchMaxProductsUnlimited(c *gc.C) {
+	images, warnings := s.fetchManyProducts(c, imagemetadata.FetchOptions{})
+	c.Assert(images, gc.HasLen, 20)
+	c.Assert(warnings, gc.HasLen, 0)
+}
+
+func (s *memorySourceSuite) TestFetchMaxProductsNotReached(c *gc.C) {
+	images, warnings := s.fetchManyProducts(c, imagemetadata.FetchOptions{MaxProducts: 10})
+	c.Assert(images, gc.HasLen, 20)
+	c.Assert(warnings, gc.HasLen, 0)
+}
+
+func (s *memorySourceSuite) fetchDaily(c *gc.C, opts imagemetadata.FetchOptions) []*imagemetadata.ImageMetadata {
+	// The index holds only released images.
+	source := sstesting.NewMemoryDataSource("memory", map[string]string{
+		"streams/v1/index.json":          optionsIndex,
+		"streams/v1/image_metadata.json": optionsProduct,
+	})
+	imageConstraint := imagemetadata.NewImageConstraint(simplestreams.LookupParams{
+		CloudSpec: simplestreams.CloudSpec{"us-east-1", "https://ec2.us-east-1.amazonaws.com"},
+		Series:    []string{"precise"},
+		Arches:    []string{"amd64", "i386"},
+		Stream:    "daily",
+	})
+	images, _, err := imagemetadata.FetchWithOptions([]simplestreams.DataSource{source}, imageConstraint, opts)
+	c.Assert(err, jc.ErrorIsNil)
+	return images
+}
+
+func (s *memorySourceSuite) TestFetchNoStreamFallback(c *gc.C) {
+	images := s.fetchDaily(c, imagemetadata.FetchOptions{})
+	c.Assert(images, gc.HasLen, 0)
+}
+
+func (s *memorySourceSuite) TestFetchStreamFallback(c *gc.C) {
+	images := s.fetchDaily(c, imagemetadata.FetchOptions{StreamFallback: []string{"proposed", "released"}})
+	c.Assert(imageIds(images), jc.DeepEquals, []string{"ami-20140101", "ami-i386-20140101"})
+	for _, im := range images {
+		c.Check(im.Stream, gc.Equals, "released")
+	}
+}
+
+func (s *memorySourceSuite) fetchProducts(c *gc.C, productIds ...string) ([]*imagemetadata.ImageMetadata, error) {
+	source := sstesting.NewMemoryDataSource("memory", map[string]string{
+		"streams/v1/index.json":          optionsIndex,
+		"streams/v1/image_metadata.json": optionsProduct,
+	})
+	images, _, err := imagemetadata.FetchProducts(
+		[]simplestreams.DataSource{source}, "streams/v1/index", productIds,
+		simplestreams.CloudSpec{"us-east-1", "https://ec2.us-east-1.amazonaws.com"}, false,
+	)
+	return images, err
+}
+
+func (s *memorySourceSuite) TestFetchProducts(c *gc.C) {
+	images, err := s.fetchProducts(c, "com.ubuntu.cloud:server:12.04:i386")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(imageIds(images), jc.DeepEquals, []string{"ami-i386-20140101"})
+	c.Assert(images[0].Arch, gc.Equals, "i386")
+	c.Assert(images[0].RegionName, gc.Equals, "us-east-1")
+}
+
+func (s *memorySourceSuite) TestFetchProductsMultiple(c *gc.C) {
+	images, err := s.fetchProducts(c, "com.ubuntu.cloud:server:12.04:amd64", "com.ubuntu.cloud:server:12.04:i386")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(imageIds(images), jc.DeepEquals, []string{"ami-20140101", "ami-i386-20140101"})
+}
+
+func (s *memorySourceSuite) TestFetchProductsUnknown(c *gc.C) {
+	images, err := s.fetchProducts(c, "com.ubuntu.cloud:server:16.04:amd64")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(images, gc.HasLen, 0)
+}
+
+func (s *memorySourceSuite) TestFetchProductsNone(c *gc.C) {
+	_, err := s.fetchProducts(c)
+	c.Assert(err, gc.ErrorMatches, "no product ids specified")
+}
+
+func (s *memorySourceSuite) fetchHash(c *gc.C, product string) (string, []*imagemetadata.ImageMetadata) {
+	source := sstesting.NewMemoryDataSource("memory", map[string]string{
+		"streams/v1/index.json":          optionsIndex,
+		"streams/v1/image_metadata.json": product,
+	})
+	imageConstraint := imagemetadata.NewImageConstraint(simplestreams.LookupParams{
+		CloudSpec: simplestreams.CloudSpec{"us-east-1", "https://ec2.us-east-1.amazonaws.com"},
+		Series:    []string{"precise"},
+		Arches:    []string{"amd64", "i386"},
+	})
+	hash, images, err := imagemetadata.FetchHash(
+		[]simplestreams.DataSource{source}, "streams/v1/index", imageConstraint, false,
+	)
+	c.Assert(err, jc.ErrorIsNil)
+	return hash, images
+}
+
+func (s *memorySourceSuite) TestFetchHashStable(c *gc.C) {
+	hash, images := s.fetchHash(c, optionsProduct)
+	c.Assert(hash, gc.Matches, "[0-9a-f]{64}")
+	c.Assert(imageIds(images), jc.DeepEquals, []string{"ami-20140101", "ami-i386-20140101"})
+
+	again, _ := s.fetchHash(c, optionsProduct)
+	c.Assert(again, gc.Equals, hash)
+}
+
+func (s *memorySourceSuite) TestFetchHashChangesWhenImageAdded(c *gc.C) {
+	hash, _ := s.fetchHash(c, optionsProduct)
+	added := strings.Replace(optionsProduct, `
+      "usee1pe": {
+       "root_store": "ebs",
+       "virt": "pv",
+       "id": "ami-i386-20140101"
+      }`, `
+      "usee1pe": {
+       "root_store": "ebs",
+       "virt": "pv",
+       "id": "ami-i386-20140101"
+      },
+      "usee1he": {
+       "root_store": "ebs",
+       "virt": "hvm",
+       "id": "ami-i386-hvm-20140101"
+      }`, 1)
+	c.Assert(added, gc.Not(gc.Equals), optionsProduct)
+
+	changed, images := s.fetchHash(c, added)
+	c.Assert(imageIds(images), jc.DeepEquals, []string{"ami-20140101", "ami-i386-20140101", "ami-i386-hvm-20140101"})
+	c.Assert(changed, gc.Not(gc.Equals), hash)
+}
+
+func (s *memorySourceSuite) TestFetchHashRequireSigned(c *gc.C) {
+	source := sstesting.NewMemoryDataSource("memory", map[string]string{
+		"streams/v1/index.json":          optionsIndex,
+		"streams/v1/image_metadata.json": optionsProduct,
+	})
+	imageConstraint := imagemetadata.NewImageConstraint(simplestreams.LookupParams{
+		CloudSpec: simplestreams.CloudSpec{"us-east-1", "https://ec2.us-east-1.amazonaws.com"},
+		Series:    []string{"precise"},
+		Arches:    []string{"amd64"},
+	})
+	_, _, err := imagemetadata.FetchHash(
+		[]simplestreams.DataSource{source}, "streams/v1/index", imageConstraint, true,
+	)
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+}
+
+func (s *memorySourceSuite) TestFetchExtraAttrs(c *gc.C) {
+	product := strings.Replace(optionsProduct, `
+       "id": "ami-i386-20140101"`, `
+       "id": "ami-i386-20140101",
+       "vendor_tier": "gold",
+       "boot": {"uefi": true}`, 1)
+	source := sstesting.NewMemoryDataSource("memory", map[string]string{
+		"streams/v1/index.json":          optionsIndex,
+		"streams/v1/image_metadata.json": product,
+	})
+	imageConstraint := imagemetadata.NewImageConstraint(simplestreams.LookupParams{
+		CloudSpec: simplestreams.CloudSpec{"us-east-1", "https://ec2.us-east-1.amazonaws.com"},
+		Series:    []string{"precise"},
+		Arches:    []string{"amd64", "i386"},
+	})
+	images, _, err := imagemetadata.Fetch([]simplestreams.DataSource{source}, imageConstraint)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(imageIds(images), jc.DeepEquals, []string{"ami-20140101", "ami-i386-20140101"})
+	c.Assert(images[0].Attrs, gc.IsNil)
+	c.Assert(images[1].Attrs, jc.DeepEquals, map[string]interface{}{
+		"vendor_tier": "gold",
+		"boot":        map[string]interface{}{"uefi": true},
+	})
+	c.Assert(images[1].VirtType, gc.Equals, "pv")
+}
+
+func (s *memorySourceSuite) fetchRegions(c *gc.C, index string) map[string]string {
+	source := sstesting.NewMemoryDataSource("memory", map[string]string{
+		"streams/v1/index.json":          index,
+		"streams/v1/image_metadata.json": optionsProduct,
+	})
+	regions, err := imagemetadata.FetchRegions([]simplestreams.DataSource{source}, "streams/v1/index.json", false)
+	c.Assert(err, jc.ErrorIsNil)
+	return regions
+}
+
+func (s *memorySourceSuite) TestFetchRegions(c *gc.C) {
+	c.Assert(s.fetchRegions(c, optionsIndex), jc.DeepEquals, map[string]string{
+		"us-east-1": "https://ec2.us-east-1.amazonaws.com",
+		"us-west-1": "https://ec2.us-west-1.amazonaws.com",
+	})
+}
+
+func (s *memorySourceSuite) TestFetchRegionsFromProducts(c *gc.C) {
+	// Regions not listed in the index are found in the products.
+	index := strings.Replace(optionsIndex, `,
+	{
+	 "region": "us-west-1",
+	 "endpoint": "https://ec2.us-west-1.amazonaws.com"
+	}`, "", 1)
+	c.Assert(index, gc.Not(gc.Equals), optionsIndex)
+	c.Assert(s.fetchRegions(c, index), jc.DeepEquals, map[string]string{
+		"us-east-1": "https://ec2.us-east-1.amazonaws.com",
+		"us-west-1": "https://ec2.us-west-1.amazonaws.com",
+	})
+}
+
+func (s *memorySourceSuite) TestFetchRegionsNotFound(c *gc.C) {
+	source := sstesting.NewMemoryDataSource("memory", nil)
+	_, err := imagemetadata.FetchRegions([]simplestreams.DataSource{source}, "streams/v1/index.json", false)
+	c.Assert(err, gc.ErrorMatches, `index "streams/v1/index.json" not found`)
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+}
+
+func (s *memorySourceSuite) fetchVirtType(c *gc.C, virtType string) []*imagemetadata.ImageMetadata {
+	source := sstesting.NewMemoryDataSource("memory", map[string]string{
+		"streams/v1/index.json":          optionsIndex,
+		"streams/v1/image_metadata.json": optionsProduct,
+	})
+	imageConstraint := imagemetadata.NewImageConstraint(simplestreams.LookupParams{
+		CloudSpec: simplestreams.CloudSpec{"us-east-1", "https://ec2.us-east-1.amazonaws.com"},
+		Series:    []string{"precise"},
+		Arches:    []string{"amd64", "i386"},
+	})
+	imageConstraint.VirtType = virtType
+	images, _, err := imagemetadata.Fetch([]simplestreams.DataSource{source}, imageConstraint)
+	c.Assert(err, jc.ErrorIsNil)
+	return images
+}
+
+func (s *memorySourceSuite) TestFetchAnyVirtType(c *gc.C) {
+	images := s.fetchVirtType(c, "")
+	c.Assert(imageIds(images), jc.DeepEquals, []string{"ami-20140101", "ami-i386-20140101"})
+}
+
+func (s *memorySourceSuite) TestFetchVirtType(c *gc.C) {
+	images := s.fetchVirtType(c, "pv")
+	c.Assert(imageIds(images), jc.DeepEquals, []string{"ami-i386-20140101"})
+}
+
+func (s *memorySourceSuite) TestFetchNegatedVirtType(c *gc.C) {
+	images := s.fetchVirtType(c, "!pv")
+	c.Assert(imageIds(images), jc.DeepEquals, []string{"ami-20140101"})
+	for _, im := range images {
+		c.Check(im.VirtType, gc.Not(gc.Equals), "pv")
+	}
+}
+
+var capabilitiesProduct = strings.NewReplacer(
+	`"id": "ami-20140101",`, `"id": "ami-20140101", "capabilities": ["gpu", "p3"],`,
+	`"id": "ami-i386-20140101"`, `"id": "ami-i386-20140101", "capabilities": ["burstable"]`,
+).Replace(optionsProduct)
+
+func (s *memorySourceSuite) fetchCapability(c *gc.C, capability string) []*imagemetadata.ImageMetadata {
+	c.Assert(capabilitiesProduct, gc.Not(gc.Equals), optionsProduct)
+	source := sstesting.NewMemoryDataSource("memory", map[string]string{
+		"streams/v1/index.json":          optionsIndex,
+		"streams/v1/image_metadata.json": capabilitiesProduct,
+	})
+	imageConstraint := imagemetadata.NewImageConstraint(simplestreams.LookupParams{
+		CloudSpec: simplestreams.CloudSpec{"us-east-1", "https://ec2.us-east-1.amazonaws.com"},
+		Series:    []string{"precise"},
+		Arches:    []string{"amd64", "i386"},
+	})
+	imageConstraint.Capability = capability
+	images, _, err := imagemetadata.FetchWithOptions(
+		[]simplestreams.DataSource{source}, imageConstraint, imagemetadata.FetchOptions{})
+	c.Assert(err, jc.ErrorIsNil)
+	return images
+}
+
+func (s *memorySourceSuite) TestFetchAnyCapability(c *gc.C) {
+	images := s.fetchCapability(c, "")
+	c.Assert(imageIds(images), jc.DeepEquals, []string{"ami-20140101", "ami-i386-20140101"})
+	c.Assert(images[0].Capabilities, jc.DeepEquals, []string{"gpu", "p3"})
+	c.Assert(images[1].Capabilities, jc.DeepEquals, []string{"burstable"})
+}
+
+func (s *memorySourceSuite) TestFetchCapability(c *gc.C) {
+	images := s.fetchCapability(c, "gpu")
+	c.Assert(imageIds(images), jc.DeepEquals, []string{"ami-20140101"})
+}
+
+func (s *memorySourceSuite) TestFetchNegatedCapability(c *gc.C) {
+	// The newest amd64 image is excluded, so the older one is found.
+	images := s.fetchCapability(c, "!gpu")
+	c.Assert(imageIds(images), jc.DeepEquals, []string{"ami-20130101", "ami-i386-20140101"})
+}
+
+func (s *memorySourceSuite) TestFetchFromMemorySourceMissingProducts(c *gc.C) {
+	source := sstesting.NewMemoryDataSource("memory", map[string]string{
+		"streams/v1/index.json": optionsIndex,
+	})
+	imageConstraint := imagemetadata.NewImageConstraint(simplestreams.LookupParams{
+		CloudSpec: simplestreams.CloudSpec{"us-east-1", "https://ec2.us-east-1.amazonaws.com"},
+		Series:    []string{"precise"},
+		Arches:    []string{"amd64"},
+	})
+	_, _, err := imagemetadata.Fetch([]simplestreams.DataSource{source}, imageConstraint)
+	c.Assert(err, gc.ErrorMatches, `cannot read product data, invalid URL "memory://memory/streams/v1/image_metadata.json" not found`)
+}
+
+func (s *fetchOptionsSuite) fetchFrom(sourcePath string) ([]*imagemetadata.ImageMetadata, error) {
+	source := simplestreams.NewURLDataSource("test", "test://host/"+sourcePath, utils.VerifySSLHostnames, simplestreams.DEFAULT_CLOUD_DATA, false)
+	imageConstraint := imagemetadata.NewImageConstraint(simplestreams.LookupParams{
+		CloudSpec: simplestreams.CloudSpec{"us-east-1", "https://ec2.us-east-1.amazonaws.com"},
+		Series:    []string{"precise"},
+		Arches:    []string{"amd64"},
+	})
+	images, _, err := imagemetadata.FetchWithOptions(
+		[]simplestreams.DataSource{source}, imageConstraint, imagemetadata.FetchOptions{},
+	)
+	return images, err
+}
+
+func (s *fetchOptionsSuite) TestFetchFollowsMirrorRedirects(c *gc.C) {
+	images, err := s.fetchFrom("redirect")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(imageIds(images), jc.DeepEquals, []string{"ami-20140101"})
+}
+
+func (s *fetchOptionsSuite) TestFetchMirrorRedirectLoop(c *gc.C) {
+	_, err := s.fetchFrom("loop-a")
+	c.Assert(err, gc.ErrorMatches, ".*mirror redirects exceed limit of 5")
+}
+
+func (s *fetchOptionsSuite) TestFetchMaxBytes(c *gc.C) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(strings.Repeat("x", 2048)))
+	}))
+	defer server.Close()
+
+	source := simplestreams.NewURLDataSource("test", server.URL, utils.VerifySSLHostnames, simplestreams.DEFAULT_CLOUD_DATA, false)
+	imageConstraint := imagemetadata.NewImageConstraint(simplestreams.LookupParams{
+		CloudSpec: simplestreams.CloudSpec{"us-east-1", "https://ec2.us-east-1.amazonaws.com"},
+		Series:    []string{"precise"},
+		Arches:    []string{"amd64"},
+	})
+	_, _, err := imagemetadata.FetchWithOptions(
+		[]simplestreams.DataSource{source}, imageConstraint, imagemetadata.FetchOptions{MaxBytes: 1024},
+	)
+	c.Assert(err, gc.ErrorMatches, ".*metadata file exceeds limit of 1024 bytes")
+}
+
+func (s *fetchOptionsSuite) assertFetchFresh(c *gc.C, maxAge time.Duration, expected []string) {
+	source := simplestreams.NewURLDataSource("test", "test://host/options", utils.VerifySSLHostnames, simplestreams.DEFAULT_CLOUD_DATA, false)
+	imageConstraint := imagemetadata.NewImageConstraint(simplestreams.LookupParams{
+		CloudSpec: simplestreams.CloudSpec{"us-east-1", "https://ec2.us-east-1.amazonaws.com"},
+		Series:    []string{"precise"},
+		Arches:    []string{"amd64"},
+	})
+	// The index was updated at 2013-05-01 13:31:26.
+	clock := testing.NewClock(time.Date(2013, 5, 2, 13, 31, 26, 0, time.UTC))
+	cache := imagemetadata.NewFetchCache(clock)
+
+	images, _, err := imagemetadata.FetchFresh(cache, []simplestreams.DataSource{source}, imageConstraint, maxAge)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(imageIds(images), jc.DeepEquals, []string{"ami-20140101"})
+
+	// Publish a replacement for the newest image.
+	sstesting.SetRoundTripperFiles(map[string]string{
+		"/options/streams/v1/index.json":          optionsIndex,
+		"/options/streams/v1/image_metadata.json": strings.Replace(optionsProduct, "ami-20140101", "ami-20140102", 1),
+	}, nil)
+	images, _, err = imagemetadata.FetchFresh(cache, []simplestreams.DataSource{source}, imageConstraint, maxAge)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(imageIds(images), jc.DeepEquals, expected)
+}
+
+func (s *fetchOptionsSuite) TestFetchFreshCached(c *gc.C) {
+	s.assertFetchFresh(c, 48*time.Hour, []string{"ami-20140101"})
+}
+
+func (s *fetchOptionsSuite) TestFetchFreshStale(c *gc.C) {
+	s.assertFetchFresh(c, time.Hour, []string{"ami-20140102"})
+}
+
+func (s *fetchOptionsSuite) TestFetchFreshVirtType(c *gc.C) {
+	source := simplestreams.NewURLDataSource("test", "test://host/options", utils.VerifySSLHostnames, simplestreams.DEFAULT_CLOUD_DATA, false)
+	cache := imagemetadata.NewFetchCache(testing.NewClock(time.Date(2013, 5, 2, 13, 31, 26, 0, time.UTC)))
+	fetch := func(virtType string) []string {
+		imageConstraint := imagemetadata.NewImageConstraint(simplestreams.LookupParams{
+			CloudSpec: simplestreams.CloudSpec{"us-east-1", "https://ec2.us-east-1.amazonaws.com"},
+			Series:    []string{"precise"},
+			Arches:    []string{"amd64", "i386"},
+		})
+		imageConstraint.VirtType = virtType
+		images, _, err := imagemetadata.FetchFresh(cache, []simplestreams.DataSource{source}, imageConstraint, 48*time.Hour)
+		c.Assert(err, jc.ErrorIsNil)
+		return imageIds(images)
+	}
+	c.Assert(fetch("hvm"), jc.DeepEquals, []string{"ami-20140101"})
+	c.Assert(fetch("pv"), jc.DeepEquals, []string{"ami-i386-20140101"})
+	c.Assert(fetch("!pv"), jc.DeepEquals, []string{"ami-20140101"})
+}
+
+func (s *fetchOptionsSuite) TestFetchFreshReturnsCopies(c *gc.C) {
+	source := simplestreams.NewURLDataSource("test", "test://host/options", utils.VerifySSLHostnames, simplestreams.DEFAULT_CLOUD_DATA, false)
+	imageConstraint := imagemetadata.NewImageConstraint(simplestreams.LookupParams{
+		CloudSpec: simplestreams.CloudSpec{"us-east-1", "https://ec2.us-east-1.amazonaws.com"},
+		Series:    []string{"precise"},
+		Arches:    []string{"amd64"},
+	})
+	cache := imagemetadata.NewFetchCache(testing.NewClock(time.Date(2013, 5, 2, 13, 31, 26, 0, time.UTC)))
+	images, _, err := imagemetadata.FetchFresh(cache, []simplestreams.DataSource{source}, imageConstraint, 48*time.Hour)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(images, gc.HasLen, 1)
+	images[0].Id = "changed"
+
+	images, _, err = imagemetadata.FetchFresh(cache, []simplestreams.DataSource{source}, imageConstraint, 48*time.Hour)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(imageIds(images), jc.DeepEquals, []string{"ami-20140101"})
+}
+
+func (s *fetchOptionsSuite) TestFetchRaw(c *gc.C) {
+	sources := []simplestreams.DataSource{
+		simplestreams.NewURLDataSource("missing", "test://host/missing", utils.VerifySSLHostnames, simplestreams.DEFAULT_CLOUD_DATA, false),
+		simplestreams.NewURLDataSource("test", "test://host/options", utils.VerifySSLHostnames, simplestreams.DEFAULT_CLOUD_DATA, false),
+	}
+	files, err := imagemetadata.FetchRaw(sources, "streams/v1/index.json", false)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(files, gc.HasLen, 2)
+	c.Assert(string(files["streams/v1/index.json"]), gc.Equals, optionsIndex)
+	c.Assert(string(files["streams/v1/image_metadata.json"]), gc.Equals, optionsProduct)
+}
+
+func (s *fetchOptionsSuite) TestFetchRawNotFound(c *gc.C) {
+	source := simplestreams.NewURLDataSource("test", "test://host/options", utils.VerifySSLHostnames, simplestreams.DEFAULT_CLOUD_DATA, false)
+	_, err := imagemetadata.FetchRaw([]simplestreams.DataSource{source}, "streams/v1/missing.json", false)
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+}
+
+var optionsIndex = `
+{
+ "index": {
+  "com.ubuntu.cloud:released:precise": {
+   "updated": "Wed, 01 May 2013 13:31:26 +0000",
+   "clouds": [
+	{
+	 "region": "us-east-1",
+	 "endpoint": "https://ec2.us-east-1.amazonaws.com"
+	},
+	{
+	 "region": "us-west-1",
+	 "endpoint": "https://ec2.us-west-1.amazonaws.com"
+	}
+   ],
+   "cloudname": "aws",
+   "datatype": "image-ids",
+   "format": "products:1.0",
+   "products": [
+	"com.ubuntu.cloud:server:12.04:amd64",
+	"com.ubuntu.cloud:server:12.04:i386"
+   ],
+   "path": "streams/v1/image_metadata.json"
+  }
+ },
+ "updated": "Wed, 01 May 2013 13:31:26 +0000",
+ "format": "index:1.0"
+}
+`
+
+var optionsProduct = `
+{
+ "updated": "Wed, 01 May 2013 13:31:26 +0000",
+ "content_id": "com.ubuntu.cloud:released:aws",
+ "products": {
+  "com.ubuntu.cloud:server:12.04:amd64": {
+   "release": "precise",
+   "version": "12.04",
+   "arch": "amd64",
+   "region": "us-east-1",
+   "endpoint": "https://ec2.us-east-1.amazonaws.com",
+   "versions": {
+    "20130101": {
+     "items": {
+      "usee1he": {
+       "root_store": "ebs",
+       "virt": "hvm",
+       "id": "ami-20130101"
+      }
+     },
+     "pubname": "ubuntu-precise-12.04-amd64-server-20130101",
+     "label": "release"
+    },
+    "20140101": {
+     "items": {
+      "usee1he": {
+       "root_store": "ebs",
+       "virt": "hvm",
+       "id": "ami-20140101",
+       "sha256": "b41b86dcfdc6219bc2fb987591ad9995bcf3a1e40c2bdd3fdbec622371e6e1af"
+      },
+      "usww1he": {
+       "root_store": "ebs",
+       "virt": "hvm",
+       "region": "us-west-1",
+       "endpoint": "https://ec2.us-west-1.amazonaws.com",
+       "id": "ami-west-20140101"
+      }
+     },
+     "pubname": "ubuntu-precise-12.04-amd64-server-20140101",
+     "label": "release"
+    }
+   }
+  },
+  "com.ubuntu.cloud:server:12.04:i386": {
+   "release": "precise",
+   "version": "12.04",
+   "arch": "i386",
+   "region": "us-east-1",
+   "endpoint": "https://ec2.us-east-1.amazonaws.com",
+   "versions": {
+    "20140101": {
+     "items": {
+      "usee1pe": {
+       "root_store": "ebs",
+       "virt": "pv",
+       "id": "ami-i386-20140101"
+      }
+     },
+     "pubname": "ubuntu-precise-12.04-i386-server-20140101",
+     "label": "release"
+    }
+   }
+  }
+ },
+ "format": "products:1.0"
+}
+`
+
+var endpointsIndex = `
+{
+ "index": {
+  "com.ubuntu.cloud:released:precise": {
+   "updated": "Wed, 01 May 2013 13:31:26 +0000",
+   "clouds": [
+	{
+	 "region": "us-east-1",
+	 "endpoint": "https://ec2.us-east-1.amazonaws.com"
+	},
+	{
+	 "region": "us-east-1",
+	 "endpoint": "https://ec2-fips.us-east-1.amazonaws.com"
+	}
+   ],
+   "cloudname": "aws",
+   "datatype": "image-ids",
+   "format": "products:1.0",
+   "products": [
+	"com.ubuntu.cloud:server:12.04:amd64"
+   ],
+   "path": "streams/v1/image_metadata.json"
+  }
+ },
+ "updated": "Wed, 01 May 2013 13:31:26 +0000",
+ "format": "index:1.0"
+}
+`
+
+var endpointsProduct = `
+{
+ "updated": "Wed, 01 May 2013 13:31:26 +0000",
+ "content_id": "com.ubuntu.cloud:released:aws",
+ "products": {
+  "com.ubuntu.cloud:server:12.04:amd64": {
+   "release": "precise",
+   "version": "12.04",
+   "arch": "amd64",
+   "region": "us-east-1",
+   "endpoint": "https://ec2.us-east-1.amazonaws.com",
+   "versions": {
+    "20140101": {
+     "items": {
+      "usee1he": {
+       "root_store": "ebs",
+       "virt": "hvm",
+       "id": "ami-20140101"
+      },
+      "usee1fipshe": {
+       "root_store": "ebs",
+       "virt": "hvm",
+       "endpoint": "https://ec2-fips.us-east-1.amazonaws.com",
+       "id": "ami-fips-20140101"
+      }
+     },
+     "pubname": "ubuntu-precise-12.04-amd64-server-20140101",
+     "label": "release"
+    }
+   }
+  }
+ },
+ "format": "products:1.0"
+}
+`
+
+var labelsIndex = `
+{
+ "index": {
+  "com.ubuntu.cloud:released:xenial": {
+   "updated": "Wed, 01 May 2013 13:31:26 +0000",
+   "clouds": [
+	{
+	 "region": "us-east-1",
+	 "endpoint": "https://ec2.us-east-1.amazonaws.com"
+	}
+   ],
+   "cloudname": "aws",
+   "datatype": "image-ids",
+   "format": "products:1.0",
+   "products": [
+	"com.ubuntu.cloud:server:16.04:amd64"
+   ],
+   "path": "streams/v1/image_metadata.json"
+  }
+ },
+ "updated": "Wed, 01 May 2013 13:31:26 +0000",
+ "format": "index:1.0"
+}
+`
+
+var labelsProduct = `
+{
+ "updated": "Wed, 01 May 2013 13:31:26 +0000",
+ "content_id": "com.ubuntu.cloud:released:aws",
+ "products": {
+  "com.ubuntu.cloud:server:16.04:amd64": {
+   "release": "xenial",
+   "version": "16.04",
+   "arch": "amd64",
+   "region": "us-east-1",
+   "endpoint": "https://ec2.us-east-1.amazonaws.com",
+   "versions": {
+    "20170101": {
+     "items": {
+      "usee1he": {
+       "root_store": "ebs",
+       "virt": "hvm",
+       "label": "ubuntu",
+       "id": "ami-full"
+      },
+      "usee1hem": {
+       "root_store": "ebs",
+       "virt": "hvm",
+       "label": "ubuntu-minimal",
+       "id": "ami-minimal"
+      }
+     },
+     "pubname": "ubuntu-xenial-16.04-amd64-server-20170101",
+     "label": "release"
+    }
+   }
+  }
+ },
+ "format": "products:1.0"
+}
+`
+
+var deprecatedProduct = `
+{
+ "updated": "Wed, 01 May 2013 13:31:26 +0000",
+ "content_id": "com.ubuntu.cloud:released:aws",
+ "products": {
+  "com.ubuntu.cloud:server:16.04:amd64": {
+   "release": "xenial",
+   "version": "16.04",
+   "arch": "amd64",
+   "region": "us-east-1",
+   "endpoint": "https://ec2.us-east-1.amazonaws.com",
+   "versions": {
+    "20170101": {
+     "items": {
+      "usee1he": {
+       "root_store": "ebs",
+       "virt": "hvm",
+       "id": "ami-hvm"
+      },
+      "usee1pe": {
+       "root_store": "ebs",
+       "virt": "pv",
+       "id": "ami-pv",
+       "deprecated": true,
+       "superseded_by": "ami-hvm"
+      }
+     },
+     "pubname": "ubuntu-xenial-16.04-amd64-server-20170101",
+     "label": "release"
+    }
+   }
+  }
+ },
+ "format": "products:1.0"
+}
+`
+
+var imageMirrorRefs = `
+{
+ "mirrors": {
+  "com.ubuntu.cloud:released:images": [
+   {
+    "datatype": "image-ids",
+    "path": "streams/v1/images-mirrors.json",
+    "updated": "Wed, 01 May 2013 13:31:26 +0000",
+    "format": "mirrors:1.0"
+   }
+  ]
+ },
+ "updated": "Wed, 01 May 2013 13:31:26 +0000",
+ "format": "index:1.0"
+}
+`
+
+// imageMirror returns a mirror file redirecting to the mirror URL.
+func imageMirror(mirrorURL string) string {
+	return `
+{
+ "mirrors": {
+  "com.ubuntu.cloud:released:images": [
+   {
+    "mirror": "` + mirrorURL + `",
+    "path": "streams/v1/image_metadata.json",
+    "format": "products:1.0",
+    "clouds": [
+     {
+      "region": "us-east-1",
+      "endpoint": "https://ec2.us-east-1.amazonaws.com"
+     }
+    ]
+   }
+  ]
+ },
+ "format": "mirrors:1.0",
+ "updated": "Wed, 01 May 2013 13:31:26 +0000"
+}
+`
+}
@@ -0,0 +1,95 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package imagemetadata
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/utils/clock"
+
+	"github.com/juju/juju/environs/simplestreams"
+)
+
+// FetchCache holds image metadata found by FetchFresh, so that it can
+// be reused until the index it was found from becomes too old.
+type FetchCache struct {
+	clock clock.Clock
+
+	mu      sync.Mutex
+	entries map[string]fetchCacheEntry
+}
+
+type fetchCacheEntry struct {
+	images       []*ImageMetadata
+	resolveInfo  *simplestreams.ResolveInfo
+	indexUpdated time.Time
+}
+
+// NewFetchCache returns a new, empty FetchCache which uses the
+// specified clock to determine the age of cached metadata.
+func NewFetchCache(clock clock.Clock) *FetchCache {
+	return &FetchCache{
+		clock:   clock,
+		entries: make(map[string]fetchCacheEntry),
+	}
+}
+
+// FetchFresh behaves like Fetch, returning images from the cache where
+// possible. Cached images are only used if the index they were found
+// from was updated no more than maxAge ago; otherwise the images are
+// fetched again and the cache updated.
+func FetchFresh(
+	cache *FetchCache, sources []simplestreams.DataSource, cons *ImageConstraint, maxAge time.Duration,
+) ([]*ImageMetadata, *simplestreams.ResolveInfo, error) {
+	key := fetchCacheKey(sources, cons)
+
+	cache.mu.Lock()
+	entry, ok := cache.entries[key]
+	cache.mu.Unlock()
+	if ok && cache.clock.Now().Sub(entry.indexUpdated) <= maxAge {
+		simplestreams.CountMetric(simplestreams.MetricCacheHits, 1)
+		return copyImages(entry.images), entry.resolveInfo, nil
+	}
+
+	metadata, resolveInfo, indexUpdated, err := fetchMetadata(sources, cons, FetchOptions{})
+	if err != nil {
+		return nil, resolveInfo, err
+	}
+	Sort(metadata)
+
+	cache.mu.Lock()
+	cache.entries[key] = fetchCacheEntry{
+		images:       metadata,
+		resolveInfo:  resolveInfo,
+		indexUpdated: indexUpdated,
+	}
+	cache.mu.Unlock()
+	return copyImages(metadata), resolveInfo, nil
+}
+
+// copyImages returns copies of the images, so that callers
+// cannot change the images held in the cache.
+func copyImages(images []*ImageMetadata) []*ImageMetadata {
+	result := make([]*ImageMetadata, len(images))
+	for i, im := range images {
+		imCopy := *im
+		imCopy.Capabilities = append([]string(nil), im.Capabilities...)
+		result[i] = &imCopy
+	}
+	return result
+}
+
+// fetchCacheKey returns the key under which images found in the
+// sources for the constraint are cached. Every field of the constraint
+// is included, as each may change which images are found.
+func fetchCacheKey(sources []simplestreams.DataSource, cons *ImageConstraint) string {
+	descriptions := make([]string, len(sources))
+	for i, source := range sources {
+		descriptions[i] = source.Description()
+	}
+	return fmt.Sprintf("%s %+v", strings.Join(descriptions, ","), *cons)
+}
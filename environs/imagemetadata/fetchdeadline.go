@@ -0,0 +1,190 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package imagemetadata
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/utils/clock"
+
+	"github.com/juju/juju/environs/simplestreams"
+)
+
+// errDeadlineExceeded is returned by a data source
+// fetch made or completed after the deadline.
+var errDeadlineExceeded = errors.New("deadline exceeded")
+
+// fetchDeadline limits the total time spent fetching image metadata
+// from data sources, and records the fetches tried.
+type fetchDeadline struct {
+	clock    clock.Clock
+	deadline time.Time
+
+	mu       sync.Mutex
+	tried    []string
+	exceeded bool
+}
+
+func newFetchDeadline(deadline time.Time, clk clock.Clock) *fetchDeadline {
+	if clk == nil {
+		clk = clock.WallClock
+	}
+	return &fetchDeadline{
+		clock:    clk,
+		deadline: deadline,
+	}
+}
+
+// wrap returns the sources, each wrapped so that
+// its fetches are limited by the deadline.
+func (d *fetchDeadline) wrap(sources []simplestreams.DataSource) []simplestreams.DataSource {
+	wrapped := make([]simplestreams.DataSource, len(sources))
+	for i, source := range sources {
+		wrapped[i] = deadlineDataSource{source, d}
+	}
+	return wrapped
+}
+
+// start records a fetch of path from source, returning the time
+// remaining before the deadline. If there is none, the deadline
+// is recorded as exceeded.
+func (d *fetchDeadline) start(source, path string) time.Duration {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	remaining := d.deadline.Sub(d.clock.Now())
+	if remaining <= 0 {
+		d.exceeded = true
+		return 0
+	}
+	d.tried = append(d.tried, fmt.Sprintf("%s %q", source, path))
+	return remaining
+}
+
+// check records the deadline as exceeded if it has passed,
+// and reports whether it has been exceeded.
+func (d *fetchDeadline) check() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.clock.Now().Before(d.deadline) {
+		d.exceeded = true
+	}
+	return d.exceeded
+}
+
+// err returns an error listing the fetches tried if the
+// deadline was exceeded, or nil otherwise.
+func (d *fetchDeadline) err() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.exceeded {
+		return nil
+	}
+	tried := "nothing"
+	if len(d.tried) > 0 {
+		tried = strings.Join(d.tried, ", ")
+	}
+	return errors.Errorf("deadline exceeded fetching image metadata, tried %s", tried)
+}
+
+// deadlineDataSource is a data source which makes no fetch after the
+// deadline, and abandons any fetch or read of fetched data still in
+// progress at the deadline.
+type deadlineDataSource struct {
+	simplestreams.DataSource
+	deadline *fetchDeadline
+}
+
+// Fetch is defined in simplestreams.DataSource.
+func (s deadlineDataSource) Fetch(path string) (io.ReadCloser, string, error) {
+	url, _ := s.URL(path)
+	remaining := s.deadline.start(s.Description(), path)
+	if remaining <= 0 {
+		return nil, url, errDeadlineExceeded
+	}
+	type fetched struct {
+		rc  io.ReadCloser
+		url string
+		err error
+	}
+	done := make(chan fetched, 1)
+	go func() {
+		rc, url, err := s.DataSource.Fetch(path)
+		done <- fetched{rc, url, err}
+	}()
+	select {
+	case f := <-done:
+		if s.deadline.check() {
+			if f.rc != nil {
+				f.rc.Close()
+			}
+			return nil, f.url, errDeadlineExceeded
+		}
+		if f.rc != nil {
+			f.rc = newDeadlineReader(f.rc, s.deadline)
+		}
+		return f.rc, f.url, f.err
+	case <-s.deadline.clock.After(remaining):
+		s.deadline.check()
+		// The fetch is abandoned, but its data
+		// must still be closed once fetched.
+		go func() {
+			if f := <-done; f.rc != nil {
+				f.rc.Close()
+			}
+		}()
+		return nil, url, errDeadlineExceeded
+	}
+}
+
+// deadlineReader reads fetched data until the deadline, closing
+// the data once the deadline passes so that reads in progress fail.
+type deadlineReader struct {
+	rc       io.ReadCloser
+	deadline *fetchDeadline
+	timer    clock.Timer
+
+	closeOnce sync.Once
+	closeErr  error
+}
+
+func newDeadlineReader(rc io.ReadCloser, d *fetchDeadline) *deadlineReader {
+	r := &deadlineReader{rc: rc, deadline: d}
+	r.timer = d.clock.AfterFunc(d.deadline.Sub(d.clock.Now()), func() {
+		d.check()
+		r.close()
+	})
+	return r
+}
+
+// Read is defined in io.Reader.
+func (r *deadlineReader) Read(p []byte) (int, error) {
+	if r.deadline.check() {
+		r.close()
+		return 0, errDeadlineExceeded
+	}
+	n, err := r.rc.Read(p)
+	if r.deadline.check() {
+		r.close()
+		return 0, errDeadlineExceeded
+	}
+	return n, err
+}
+
+// Close is defined in io.Closer.
+func (r *deadlineReader) Close() error {
+	r.timer.Stop()
+	return r.close()
+}
+
+func (r *deadlineReader) close() error {
+	r.closeOnce.Do(func() {
+		r.closeErr = r.rc.Close()
+	})
+	return r.closeErr
+}
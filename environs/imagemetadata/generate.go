@@ -10,7 +10,6 @@ import (
 	"time"
 
 	"github.com/juju/errors"
-	"github.com/juju/utils/series"
 
 	"github.com/juju/juju/environs/simplestreams"
 	"github.com/juju/juju/environs/storage"
@@ -30,24 +29,40 @@ func ProductMetadataStoragePath() string {
 // and merges it with supplied metadata, writing the resulting metadata is written to storage.
 func MergeAndWriteMetadata(ser string, metadata []*ImageMetadata, cloudSpec *simplestreams.CloudSpec,
 	metadataStore storage.Storage) error {
+	return MergeAndWriteMetadataWithTemplate(ser, metadata, cloudSpec, metadataStore, "")
+}
+
+// MergeAndWriteMetadataWithTemplate behaves like MergeAndWriteMetadata,
+// generating product ids from the specified template, as accepted by
+// ImageConstraint.SetProductIdTemplate, so that the metadata can be
+// fetched by a constraint with the same template. If the template is
+// empty, DefaultProductIdTemplate is used.
+func MergeAndWriteMetadataWithTemplate(ser string, metadata []*ImageMetadata, cloudSpec *simplestreams.CloudSpec,
+	metadataStore storage.Storage, productIdTemplate string) error {
 
-	existingMetadata, err := readMetadata(metadataStore)
+	if productIdTemplate != "" {
+		if err := validateProductIdTemplate(productIdTemplate); err != nil {
+			return err
+		}
+	}
+	existingMetadata, err := readMetadata(metadataStore, productIdTemplate)
 	if err != nil {
 		return err
 	}
-	seriesVersion, err := series.SeriesVersion(ser)
+	version, err := seriesVersion(ser)
 	if err != nil {
 		return err
 	}
-	toWrite, allCloudSpec := mergeMetadata(seriesVersion, cloudSpec, metadata, existingMetadata)
-	return writeMetadata(toWrite, allCloudSpec, metadataStore)
+	toWrite, allCloudSpec := mergeMetadata(version, cloudSpec, metadata, existingMetadata, productIdTemplate)
+	return writeMetadata(toWrite, allCloudSpec, metadataStore, productIdTemplate)
 }
 
 // readMetadata reads the image metadata from metadataStore.
-func readMetadata(metadataStore storage.Storage) ([]*ImageMetadata, error) {
+func readMetadata(metadataStore storage.Storage, productIdTemplate string) ([]*ImageMetadata, error) {
 	// Read any existing metadata so we can merge the new tools metadata with what's there.
 	dataSource := storage.NewStorageSimpleStreamsDataSource("existing metadata", metadataStore, storage.BaseImagesPath, simplestreams.EXISTING_CLOUD_DATA, false)
 	imageConstraint := NewImageConstraint(simplestreams.LookupParams{})
+	imageConstraint.productIdTemplate = productIdTemplate
 	existingMetadata, _, err := Fetch([]simplestreams.DataSource{dataSource}, imageConstraint)
 	if err != nil && !errors.IsNotFound(err) {
 		return nil, err
@@ -61,13 +76,13 @@ func readMetadata(metadataStore storage.Storage) ([]*ImageMetadata, error) {
 // metadata is not overwritten by closely related ones.
 // This key is similar to image metadata key built in state which combines
 // parameter values rather than using image id to ensure record uniqueness.
-func mapKey(im *ImageMetadata) string {
-	return fmt.Sprintf("%s-%s-%s-%s", im.productId(), im.RegionName, im.VirtType, im.Storage)
+func mapKey(im *ImageMetadata, productIdTemplate string) string {
+	return fmt.Sprintf("%s-%s-%s-%s", im.productId(productIdTemplate), im.RegionName, im.VirtType, im.Storage)
 }
 
 // mergeMetadata merges the newMetadata into existingMetadata, overwriting existing matching image records.
 func mergeMetadata(seriesVersion string, cloudSpec *simplestreams.CloudSpec, newMetadata,
-	existingMetadata []*ImageMetadata) ([]*ImageMetadata, []simplestreams.CloudSpec) {
+	existingMetadata []*ImageMetadata, productIdTemplate string) ([]*ImageMetadata, []simplestreams.CloudSpec) {
 
 	regions := make(map[string]bool)
 	var allCloudSpecs = []simplestreams.CloudSpec{}
@@ -96,11 +111,11 @@ func mergeMetadata(seriesVersion string, cloudSpec *simplestreams.CloudSpec, new
 		newRecord.RegionName = cloudSpec.Region
 		newRecord.Endpoint = cloudSpec.Endpoint
 		toWrite[i] = &newRecord
-		imageIds[mapKey(&newRecord)] = true
+		imageIds[mapKey(&newRecord, productIdTemplate)] = true
 		addDistinctCloudSpec(&newRecord)
 	}
 	for _, im := range existingMetadata {
-		if _, ok := imageIds[mapKey(im)]; !ok {
+		if _, ok := imageIds[mapKey(im, productIdTemplate)]; !ok {
 			toWrite = append(toWrite, im)
 			addDistinctCloudSpec(im)
 		}
@@ -116,10 +131,10 @@ type MetadataFile struct {
 // writeMetadata generates some basic simplestreams metadata using the specified cloud and image details and writes
 // it to the supplied store.
 func writeMetadata(metadata []*ImageMetadata, cloudSpec []simplestreams.CloudSpec,
-	metadataStore storage.Storage) error {
+	metadataStore storage.Storage, productIdTemplate string) error {
 
 	// TODO(perrito666) 2016-05-02 lp:1558657
-	index, products, err := MarshalImageMetadataJSON(metadata, cloudSpec, time.Now())
+	index, products, err := marshalImageMetadataJSON(metadata, cloudSpec, time.Now(), productIdTemplate)
 	if err != nil {
 		return err
 	}
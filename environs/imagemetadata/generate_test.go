@@ -61,6 +61,65 @@ func (s *generateSuite) TestWriteMetadata(c *gc.C) {
 	assertFetch(c, targetStorage, "raring", "amd64", "region", "endpoint", "1234")
 }
 
+func (s *generateSuite) TestWriteMetadataWithTemplate(c *gc.C) {
+	const template = "com.example.images{stream}:{version}:{arch}"
+	im := []*imagemetadata.ImageMetadata{{
+		Id:      "1234",
+		Arch:    "amd64",
+		Version: "13.04",
+	}}
+	cloudSpec := &simplestreams.CloudSpec{
+		Region:   "region",
+		Endpoint: "endpoint",
+	}
+	targetStorage, err := filestorage.NewFileStorageWriter(c.MkDir())
+	c.Assert(err, jc.ErrorIsNil)
+	err = imagemetadata.MergeAndWriteMetadataWithTemplate("raring", im, cloudSpec, targetStorage, template)
+	c.Assert(err, jc.ErrorIsNil)
+	// Merging with the existing metadata reads it back with the template.
+	im2 := []*imagemetadata.ImageMetadata{{
+		Id:      "abcd",
+		Arch:    "i386",
+		Version: "13.04",
+	}}
+	err = imagemetadata.MergeAndWriteMetadataWithTemplate("raring", im2, cloudSpec, targetStorage, template)
+	c.Assert(err, jc.ErrorIsNil)
+
+	dataSource := storage.NewStorageSimpleStreamsDataSource("test datasource", targetStorage, "images", simplestreams.DEFAULT_CLOUD_DATA, false)
+	fetch := func(arch, template string) ([]*imagemetadata.ImageMetadata, error) {
+		cons := imagemetadata.NewImageConstraint(simplestreams.LookupParams{
+			CloudSpec: *cloudSpec,
+			Series:    []string{"raring"},
+			Arches:    []string{arch},
+		})
+		if template != "" {
+			c.Assert(cons.SetProductIdTemplate(template), jc.ErrorIsNil)
+		}
+		metadata, _, err := imagemetadata.Fetch([]simplestreams.DataSource{dataSource}, cons)
+		return metadata, err
+	}
+	metadata, err := fetch("amd64", template)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(metadata, gc.HasLen, 1)
+	c.Assert(metadata[0].Id, gc.Equals, "1234")
+	metadata, err = fetch("i386", template)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(metadata, gc.HasLen, 1)
+	c.Assert(metadata[0].Id, gc.Equals, "abcd")
+
+	// The default template does not find the images.
+	metadata, err = fetch("amd64", "")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(metadata, gc.HasLen, 0)
+}
+
+func (s *generateSuite) TestWriteMetadataWithTemplateInvalid(c *gc.C) {
+	targetStorage, err := filestorage.NewFileStorageWriter(c.MkDir())
+	c.Assert(err, jc.ErrorIsNil)
+	err = imagemetadata.MergeAndWriteMetadataWithTemplate("raring", nil, &simplestreams.CloudSpec{}, targetStorage, "com.example:{arch}")
+	c.Assert(err, gc.ErrorMatches, `product id template "com.example:\{arch\}" without \{stream\} not valid`)
+}
+
 func (s *generateSuite) TestWriteMetadataMergeOverwriteSameArch(c *gc.C) {
 	existingImageMetadata := []*imagemetadata.ImageMetadata{
 		{
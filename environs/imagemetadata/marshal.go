@@ -22,11 +22,19 @@ const (
 // updated is the time at which the JSON file was updated.
 func MarshalImageMetadataJSON(metadata []*ImageMetadata, cloudSpec []simplestreams.CloudSpec,
 	updated time.Time) (index, products []byte, err error) {
+	return marshalImageMetadataJSON(metadata, cloudSpec, updated, "")
+}
+
+// marshalImageMetadataJSON marshals image metadata to index and products
+// JSON, generating product ids from the specified template, or from
+// DefaultProductIdTemplate if it is empty.
+func marshalImageMetadataJSON(metadata []*ImageMetadata, cloudSpec []simplestreams.CloudSpec,
+	updated time.Time, productIdTemplate string) (index, products []byte, err error) {
 
-	if index, err = MarshalImageMetadataIndexJSON(metadata, cloudSpec, updated); err != nil {
+	if index, err = marshalImageMetadataIndexJSON(metadata, cloudSpec, updated, productIdTemplate); err != nil {
 		return nil, nil, err
 	}
-	if products, err = MarshalImageMetadataProductsJSON(metadata, updated); err != nil {
+	if products, err = marshalImageMetadataProductsJSON(metadata, updated, productIdTemplate); err != nil {
 		return nil, nil, err
 	}
 	return index, products, err
@@ -37,10 +45,17 @@ func MarshalImageMetadataJSON(metadata []*ImageMetadata, cloudSpec []simplestrea
 // updated is the time at which the JSON file was updated.
 func MarshalImageMetadataIndexJSON(metadata []*ImageMetadata, cloudSpec []simplestreams.CloudSpec,
 	updated time.Time) (out []byte, err error) {
+	return marshalImageMetadataIndexJSON(metadata, cloudSpec, updated, "")
+}
+
+// marshalImageMetadataIndexJSON marshals image metadata to index
+// JSON, generating product ids from the specified template.
+func marshalImageMetadataIndexJSON(metadata []*ImageMetadata, cloudSpec []simplestreams.CloudSpec,
+	updated time.Time, productIdTemplate string) (out []byte, err error) {
 
 	productIds := make([]string, len(metadata))
 	for i, t := range metadata {
-		productIds[i] = t.productId()
+		productIds[i] = t.productId(productIdTemplate)
 	}
 	var indices simplestreams.Indices
 	indices.Updated = updated.Format(time.RFC1123Z)
@@ -63,6 +78,14 @@ func MarshalImageMetadataIndexJSON(metadata []*ImageMetadata, cloudSpec []simple
 //
 // updated is the time at which the JSON file was updated.
 func MarshalImageMetadataProductsJSON(metadata []*ImageMetadata, updated time.Time) (out []byte, err error) {
+	return marshalImageMetadataProductsJSON(metadata, updated, "")
+}
+
+// marshalImageMetadataProductsJSON marshals image metadata to products
+// JSON, generating product ids from the specified template.
+func marshalImageMetadataProductsJSON(
+	metadata []*ImageMetadata, updated time.Time, productIdTemplate string,
+) (out []byte, err error) {
 	var cloud simplestreams.CloudMetadata
 	cloud.Updated = updated.Format(time.RFC1123Z)
 	cloud.Format = simplestreams.ProductFormat
@@ -76,7 +99,8 @@ func MarshalImageMetadataProductsJSON(metadata []*ImageMetadata, updated time.Ti
 		toWrite.RegionAlias = ""
 		toWrite.Version = ""
 		toWrite.Arch = ""
-		if catalog, ok := cloud.Products[t.productId()]; ok {
+		productId := t.productId(productIdTemplate)
+		if catalog, ok := cloud.Products[productId]; ok {
 			catalog.Items[itemsversion].Items[t.Id] = toWrite
 		} else {
 			catalog = simplestreams.MetadataCatalog{
@@ -88,7 +112,7 @@ func MarshalImageMetadataProductsJSON(metadata []*ImageMetadata, updated time.Ti
 					},
 				},
 			}
-			cloud.Products[t.productId()] = catalog
+			cloud.Products[productId] = catalog
 		}
 	}
 	return json.MarshalIndent(&cloud, "", "    ")
@@ -7,12 +7,22 @@
 package imagemetadata
 
 import (
+	"crypto/sha256"
+	"encoding/json"
 	"fmt"
+	"io"
+	"reflect"
 	"sort"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/juju/errors"
 	"github.com/juju/utils"
 	"github.com/juju/utils/arch"
+	"github.com/juju/utils/clock"
 	"github.com/juju/utils/series"
+	"github.com/juju/version"
 
 	"github.com/juju/juju/environs/simplestreams"
 	"github.com/juju/juju/juju/keys"
@@ -154,6 +164,55 @@ func OfficialDataSources(stream string) ([]simplestreams.DataSource, error) {
 // ImageConstraint defines criteria used to find an image metadata record.
 type ImageConstraint struct {
 	simplestreams.LookupParams
+
+	// productIdTemplate, if set, is used in place of
+	// DefaultProductIdTemplate to generate product ids.
+	productIdTemplate string
+
+	// allowUnknownArches, if true, permits arches
+	// other than those known to Juju.
+	allowUnknownArches bool
+
+	// VirtType, if set, restricts the images to those of the
+	// virtualisation type, eg "hvm". A type prefixed with "!", eg
+	// "!pv", instead restricts the images to those of any other
+	// type. A single type may be required or excluded, but not both.
+	VirtType string
+
+	// Capability, if set, restricts the images to those advertising
+	// the capability, eg "gpu". A capability prefixed with "!", eg
+	// "!gpu", instead restricts the images to those not advertising
+	// it, including images which advertise no capabilities.
+	Capability string
+}
+
+// matchesVirtType reports whether images of the
+// virtualisation type satisfy the constraint.
+func (ic *ImageConstraint) matchesVirtType(virtType string) bool {
+	if ic.VirtType == "" {
+		return true
+	}
+	if strings.HasPrefix(ic.VirtType, "!") {
+		return virtType != ic.VirtType[1:]
+	}
+	return virtType == ic.VirtType
+}
+
+// matchesCapabilities reports whether images advertising
+// the capabilities satisfy the constraint.
+func (ic *ImageConstraint) matchesCapabilities(capabilities []string) bool {
+	if ic.Capability == "" {
+		return true
+	}
+	want := strings.TrimPrefix(ic.Capability, "!")
+	found := false
+	for _, capability := range capabilities {
+		if capability == want {
+			found = true
+			break
+		}
+	}
+	return found != strings.HasPrefix(ic.Capability, "!")
 }
 
 func NewImageConstraint(params simplestreams.LookupParams) *ImageConstraint {
@@ -166,6 +225,61 @@ func NewImageConstraint(params simplestreams.LookupParams) *ImageConstraint {
 	return &ImageConstraint{LookupParams: params}
 }
 
+// imageConstraintYAML is the YAML serialisation of an ImageConstraint.
+type imageConstraintYAML struct {
+	Region     string   `yaml:"region,omitempty"`
+	Endpoint   string   `yaml:"endpoint,omitempty"`
+	Series     []string `yaml:"series,omitempty"`
+	Arches     []string `yaml:"arches,omitempty"`
+	Stream     string   `yaml:"stream,omitempty"`
+	VirtType   string   `yaml:"virt-type,omitempty"`
+	Capability string   `yaml:"capability,omitempty"`
+
+	ProductIdTemplate  string `yaml:"product-id-template,omitempty"`
+	AllowUnknownArches bool   `yaml:"allow-unknown-arches,omitempty"`
+}
+
+// MarshalYAML implements yaml.Marshaler.
+func (ic ImageConstraint) MarshalYAML() (interface{}, error) {
+	return imageConstraintYAML{
+		Region:     ic.Region,
+		Endpoint:   ic.Endpoint,
+		Series:     ic.Series,
+		Arches:     ic.Arches,
+		Stream:     ic.Stream,
+		VirtType:   ic.VirtType,
+		Capability: ic.Capability,
+
+		ProductIdTemplate:  ic.productIdTemplate,
+		AllowUnknownArches: ic.allowUnknownArches,
+	}, nil
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler.
+func (ic *ImageConstraint) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var in imageConstraintYAML
+	if err := unmarshal(&in); err != nil {
+		return errors.Annotate(err, "cannot unmarshal image constraint")
+	}
+	ic.LookupParams = simplestreams.LookupParams{
+		CloudSpec: simplestreams.CloudSpec{
+			Region:   in.Region,
+			Endpoint: in.Endpoint,
+		},
+		Series: in.Series,
+		Arches: in.Arches,
+		Stream: in.Stream,
+	}
+	ic.VirtType = in.VirtType
+	ic.Capability = in.Capability
+	ic.productIdTemplate = ""
+	ic.allowUnknownArches = in.AllowUnknownArches
+	if in.ProductIdTemplate != "" {
+		return ic.SetProductIdTemplate(in.ProductIdTemplate)
+	}
+	return nil
+}
+
 const (
 	// Used to specify the released image metadata.
 	ReleasedStream = "released"
@@ -181,30 +295,134 @@ func idStream(stream string) string {
 	return idstream
 }
 
+// ImageContentId returns the id under which mirrors of
+// the images in the specified stream are published.
+func ImageContentId(stream string) string {
+	if stream == "" {
+		stream = ReleasedStream
+	}
+	return fmt.Sprintf("com.ubuntu.cloud:%s:images", stream)
+}
+
 // IndexIds generates a string array representing product ids formed similarly to an ISCSI qualified name (IQN).
 func (ic *ImageConstraint) IndexIds() []string {
 	// Image constraints do not filter on index ids.
 	return nil
 }
 
+const (
+	// DefaultProductIdTemplate is the template used to generate the
+	// product ids of Ubuntu cloud images.
+	DefaultProductIdTemplate = "com.ubuntu.cloud{stream}:server:{version}:{arch}"
+
+	streamPlaceholder  = "{stream}"
+	versionPlaceholder = "{version}"
+	archPlaceholder    = "{arch}"
+)
+
+// SetProductIdTemplate sets the template used to generate product ids,
+// allowing metadata published under a vendor's own namespace to be used.
+// The template must contain the placeholders {stream}, {version} and
+// {arch}. {stream} is replaced by "." followed by the stream name, or by
+// nothing for the released stream.
+func (ic *ImageConstraint) SetProductIdTemplate(template string) error {
+	if err := validateProductIdTemplate(template); err != nil {
+		return err
+	}
+	ic.productIdTemplate = template
+	return nil
+}
+
+// validateProductIdTemplate returns an error if the
+// product id template is missing any placeholder.
+func validateProductIdTemplate(template string) error {
+	for _, placeholder := range []string{streamPlaceholder, versionPlaceholder, archPlaceholder} {
+		if !strings.Contains(template, placeholder) {
+			return errors.NotValidf("product id template %q without %s", template, placeholder)
+		}
+	}
+	return nil
+}
+
+// formatProductId returns the id of the product holding images of the
+// specified stream, version and arch, generated from the template, or
+// from DefaultProductIdTemplate if the template is empty.
+func formatProductId(template, stream, version, arch string) string {
+	if template == "" {
+		template = DefaultProductIdTemplate
+	}
+	return strings.NewReplacer(
+		streamPlaceholder, idStream(stream),
+		versionPlaceholder, version,
+		archPlaceholder, arch,
+	).Replace(template)
+}
+
+// AllowUnknownArches permits the constraint to use arches not known
+// to Juju, as published by some non-Ubuntu vendors.
+func (ic *ImageConstraint) AllowUnknownArches() {
+	ic.allowUnknownArches = true
+}
+
+// knownArch reports whether images of the arch are published by Ubuntu.
+// As well as the arches Juju supports, this includes "arm", the name
+// used by older metadata.
+func knownArch(a string) bool {
+	return a == "arm" || arch.IsSupportedArch(a)
+}
+
+// ArchAliases maps the names some callers use for an arch to the name
+// under which images of that arch are published. Constraint arches are
+// resolved through it, so further aliases may be added as needed.
+var ArchAliases = map[string]string{
+	"x86": arch.I386,
+}
+
+// resolvedArches returns the constraint's arches with any aliases
+// resolved, omitting an arch which is already listed.
+func (ic *ImageConstraint) resolvedArches() []string {
+	arches := make([]string, 0, len(ic.Arches))
+	seen := make(map[string]bool)
+	for _, a := range ic.Arches {
+		if alias, ok := ArchAliases[a]; ok {
+			a = alias
+		}
+		if seen[a] {
+			continue
+		}
+		seen[a] = true
+		arches = append(arches, a)
+	}
+	return arches
+}
+
 // ProductIds generates a string array representing product ids formed similarly to an ISCSI qualified name (IQN).
 func (ic *ImageConstraint) ProductIds() ([]string, error) {
-	stream := idStream(ic.Stream)
-	nrArches := len(ic.Arches)
+	arches := ic.resolvedArches()
+	nrArches := len(arches)
 	nrSeries := len(ic.Series)
 	ids := make([]string, nrArches*nrSeries)
-	for i, arch := range ic.Arches {
+	for i, arch := range arches {
+		if !ic.allowUnknownArches && !knownArch(arch) {
+			return nil, errors.NewNotValid(nil, fmt.Sprintf("unknown architecture %q", arch))
+		}
 		for j, ser := range ic.Series {
-			version, err := series.SeriesVersion(ser)
+			version, err := seriesVersion(ser)
 			if err != nil {
 				return nil, err
 			}
-			ids[j*nrArches+i] = fmt.Sprintf("com.ubuntu.cloud%s:server:%s:%s", stream, version, arch)
+			ids[j*nrArches+i] = ic.productId(version, arch)
 		}
 	}
 	return ids, nil
 }
 
+// productId returns the id of the product holding images
+// of the specified version and arch in the constraint's stream.
+func (ic *ImageConstraint) productId(version, arch string) string {
+	return formatProductId(ic.productIdTemplate, ic.Stream, version, arch)
+}
+
 // ImageMetadata holds information about a particular cloud image.
 type ImageMetadata struct {
 	Id          string `json:"id"`
@@ -216,15 +434,217 @@ type ImageMetadata struct {
 	RegionName  string `json:"region,omitempty"`
 	Endpoint    string `json:"endpoint,omitempty"`
 	Stream      string `json:"-"`
+
+	// Label is the label the image is tagged with,
+	// eg "ubuntu-minimal", if any.
+	Label string `json:"label,omitempty"`
+
+	// SHA256 is the hex-encoded SHA256 checksum of the
+	// image artifact, if the metadata includes one.
+	SHA256 string `json:"sha256,omitempty"`
+
+	// Deprecated is true if the stream marks the
+	// image as retired in favour of a newer one.
+	Deprecated bool `json:"deprecated,omitempty"`
+
+	// SupersededBy is the id of the image replacing
+	// a deprecated image, if the stream records it.
+	SupersededBy string `json:"superseded_by,omitempty"`
+
+	// Kernel is the version of the kernel in the image,
+	// eg "4.4.0-21", if the stream records it.
+	Kernel string `json:"kernel,omitempty"`
+
+	// AgentVersion is the minimum Juju agent version the image
+	// supports, eg "2.1.0", if the stream records it.
+	AgentVersion string `json:"agent_version,omitempty"`
+
+	// Capabilities holds the instance type families or hardware
+	// capabilities the image is built for, eg "gpu", if the
+	// stream advertises any.
+	Capabilities []string `json:"capabilities,omitempty"`
+
+	// Signed records whether the image was found in signed
+	// metadata. It is set only by FetchWithOptions with
+	// IncludeUnsigned, and is otherwise always false.
+	Signed bool `json:"-"`
+
+	// Attrs holds any attributes of the image in the stream which
+	// have no corresponding field, keyed by attribute name, so that
+	// vendor-specific data is available to callers. It is nil if
+	// there are none.
+	Attrs map[string]interface{} `json:"-"`
 }
 
 func (im *ImageMetadata) String() string {
 	return fmt.Sprintf("%#v", im)
 }
 
-func (im *ImageMetadata) productId() string {
-	stream := idStream(im.Stream)
-	return fmt.Sprintf("com.ubuntu.cloud%s:server:%s:%s", stream, im.Version, im.Arch)
+// knownImageAttrs holds the names of the attributes
+// which correspond to fields of ImageMetadata.
+var knownImageAttrs = func() map[string]bool {
+	known := make(map[string]bool)
+	t := reflect.TypeOf(ImageMetadata{})
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			known[name] = true
+		}
+	}
+	return known
+}()
+
+// UnmarshalJSON implements json.Unmarshaler, recording any
+// unrecognised attributes in Attrs.
+func (im *ImageMetadata) UnmarshalJSON(data []byte) error {
+	// imageMetadata has the same fields, but
+	// does not implement json.Unmarshaler.
+	type imageMetadata ImageMetadata
+	if err := json.Unmarshal(data, (*imageMetadata)(im)); err != nil {
+		return err
+	}
+	var attrs map[string]interface{}
+	if err := json.Unmarshal(data, &attrs); err != nil {
+		return err
+	}
+	for name := range attrs {
+		if knownImageAttrs[name] {
+			delete(attrs, name)
+		}
+	}
+	im.Attrs = nil
+	if len(attrs) > 0 {
+		im.Attrs = attrs
+	}
+	return nil
+}
+
+// VerifyChecksum returns an error if the SHA256 checksum of the data
+// read from r does not match the checksum published for the image.
+// If no checksum was published, r is not read and nil is returned.
+func (im *ImageMetadata) VerifyChecksum(r io.Reader) error {
+	if im.SHA256 == "" {
+		return nil
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, r); err != nil {
+		return errors.Annotatef(err, "cannot read image %q", im.Id)
+	}
+	checksum := fmt.Sprintf("%x", hash.Sum(nil))
+	if checksum != im.SHA256 {
+		return errors.Errorf("image %q has SHA256 checksum %s, expected %s", im.Id, checksum, im.SHA256)
+	}
+	return nil
+}
+
+// productId returns the id of the product holding the image, generated
+// from the template, or from DefaultProductIdTemplate if it is empty.
+func (im *ImageMetadata) productId(template string) string {
+	return formatProductId(template, im.Stream, im.Version, im.Arch)
+}
+
+// FetchOptions holds optional parameters which alter the images
+// returned by FetchWithOptions.
+type FetchOptions struct {
+	// VerifiedIndexCache, if non-nil, is used to skip verifying the
+	// signature of a signed index which is unchanged since a previous
+	// fetch using the same cache.
+	VerifiedIndexCache *simplestreams.VerifiedIndexCache
+
+	// CloudSpecs, if non-empty, causes images to be returned for each
+	// of the specified region/endpoint pairs instead of the single
+	// cloud spec in the image constraint. Each image's endpoint is set
+	// to that of the cloud spec it was found for.
+	CloudSpecs []simplestreams.CloudSpec
+
+	// MaxBytes limits the size of each index and product file
+	// fetched. If zero, simplestreams.DefaultMaxMetadataBytes is used.
+	MaxBytes int64
+
+	// Label, if set, causes only images tagged with
+	// the specified label to be returned.
+	Label string
+
+	// IncludeDeprecated, if true, causes images the stream
+	// marks as deprecated to be returned. By default they
+	// are excluded, so that retired images are not used.
+	IncludeDeprecated bool
+
+	// EarlyStop, if positive, causes the search to stop as soon
+	// as that many images have been found, so that no further
+	// product data is fetched or parsed. If zero, all matching
+	// images are returned.
+	//
+	// Product versions are still searched newest first, and the
+	// cloud specs in CloudSpecs are searched in order, but the order
+	// in which the products within a catalog are searched is not
+	// defined. If more than EarlyStop images match, which of them
+	// are returned may therefore vary between calls.
+	EarlyStop int
+
+	// MinKernel, if set, causes only images whose kernel version
+	// is at least that specified, eg "4.4.0-21", to be returned.
+	// Images without a kernel version are excluded.
+	MinKernel string
+
+	// MinAgentVersion, if not zero, causes only images supporting
+	// an agent version of at least that specified to be returned.
+	// Images without a valid agent version are excluded.
+	MinAgentVersion version.Number
+
+	// IncludeUnsigned, if true, causes the images in both the signed
+	// and unsigned metadata of the first source holding either to be
+	// returned, with Signed set on those from the signed metadata,
+	// even if the source requires signed metadata. Signed metadata
+	// which cannot be verified is an error, rather than causing
+	// unsigned metadata to be used instead. It is intended for
+	// auditing which images are signed.
+	IncludeUnsigned bool
+
+	// IndexPaths, if non-empty, causes the images found using each
+	// of the specified indexes to be merged and returned, instead of
+	// those found using the default index. Each path excludes the
+	// signed or unsigned suffix, eg "streams/v1/index". An image
+	// found using more than one index is returned only once. This
+	// supports mirrors which publish each stream in its own index.
+	IndexPaths []string
+
+	// StreamFallback, if non-empty, holds the streams to try in turn,
+	// eg "released", if no images are found in the constraint's stream.
+	// The images returned are those of the first stream with any, and
+	// each has its Stream set to the stream it was found in.
+	StreamFallback []string
+
+	// Deadline, if not zero, limits the total time spent fetching
+	// from the sources, across every source, index, stream and
+	// cloud spec searched. No fetch is started after the deadline,
+	// and any fetch in progress at the deadline is abandoned; an
+	// error listing the fetches tried is then returned, whatever
+	// images were found.
+	Deadline time.Time
+
+	// Clock, if non-nil, is used to determine when Deadline has
+	// passed. If nil, the wall clock is used.
+	Clock clock.Clock
+
+	// MatchEndpoint, if true, causes only images whose endpoint is
+	// exactly that of the constraint's cloud spec to be returned,
+	// rather than any image in the cloud spec's region. It has no
+	// effect if the cloud spec has no endpoint. This distinguishes
+	// clouds with more than one endpoint in a region.
+	MatchEndpoint bool
+
+	// MaxProducts, if positive, limits the number of product files
+	// fetched from each source, across every index, stream and cloud
+	// spec searched. Once a source's limit is reached, no more of its
+	// products are searched, so the images returned may be incomplete;
+	// FetchWithWarnings reports when this happens. If zero, there is
+	// no limit.
+	MaxProducts int
+
+	// productLimit records the product files fetched
+	// from each source when MaxProducts is set.
+	productLimit *simplestreams.ProductLimit
 }
 
 // Fetch returns a list of images for the specified cloud matching the constraint.
@@ -234,27 +654,391 @@ func (im *ImageMetadata) productId() string {
 func Fetch(
 	sources []simplestreams.DataSource, cons *ImageConstraint,
 ) ([]*ImageMetadata, *simplestreams.ResolveInfo, error) {
+	return FetchWithOptions(sources, cons, FetchOptions{})
+}
 
+// FetchByProduct behaves like Fetch, but returns the images
+// keyed by the id of the product they were found in.
+func FetchByProduct(
+	sources []simplestreams.DataSource, cons *ImageConstraint,
+) (map[string][]*ImageMetadata, *simplestreams.ResolveInfo, error) {
+	metadata, resolveInfo, err := Fetch(sources, cons)
+	if err != nil {
+		return nil, resolveInfo, err
+	}
+	products := make(map[string][]*ImageMetadata)
+	for _, im := range metadata {
+		id := cons.productId(im.Version, im.Arch)
+		products[id] = append(products[id], im)
+	}
+	return products, resolveInfo, nil
+}
+
+// FetchRaw returns the unparsed contents of the image metadata index at
+// indexPath and of the image products files it references, keyed by path,
+// from the first of the sources holding the index. It is intended to help
+// diagnose problems with published metadata.
+func FetchRaw(sources []simplestreams.DataSource, indexPath string, requireSigned bool) (map[string][]byte, error) {
+	return simplestreams.FetchRaw(sources, indexPath, ImageIds, requireSigned)
+}
+
+// FetchHash returns the images matching the constraint found using the
+// index at indexPath in the first source holding it, along with a hash
+// of the images found. The index path excludes the signed or unsigned
+// suffix, eg "streams/v1/index". If requireSigned is true, only signed
+// metadata is used.
+//
+// The hash depends only on the set of images found, and not on the
+// order in which they appear in the streams, so that callers can tell
+// whether the images have changed between fetches by comparing hashes.
+func FetchHash(
+	sources []simplestreams.DataSource, indexPath string, cons *ImageConstraint, requireSigned bool,
+) (string, []*ImageMetadata, error) {
+	params := metadataParams(cons, FetchOptions{})
+	params.IndexPath = indexPath
+	params.RequireSigned = requireSigned
+	metadata, _, _, err := getMetadata(sources, params)
+	if err != nil {
+		return "", nil, err
+	}
+	Sort(metadata)
+	hash, err := hashImages(metadata)
+	if err != nil {
+		return "", nil, errors.Trace(err)
+	}
+	return hash, metadata, nil
+}
+
+// FetchProducts returns the images in exactly the specified products
+// found using the index at indexPath in the first source holding it,
+// rather than in products whose ids are constructed from series and
+// arches. The index path excludes the signed or unsigned suffix, eg
+// "streams/v1/index"; if empty, the default index is used. Only images
+// in the cloud spec's region are returned, unless it has no region. If
+// requireSigned is true, only signed metadata is used.
+func FetchProducts(
+	sources []simplestreams.DataSource, indexPath string, productIds []string,
+	cloudSpec simplestreams.CloudSpec, requireSigned bool,
+) ([]*ImageMetadata, *simplestreams.ResolveInfo, error) {
+	if len(productIds) == 0 {
+		return nil, nil, errors.New("no product ids specified")
+	}
+	cons := &productIdConstraint{
+		LookupParams: simplestreams.LookupParams{CloudSpec: cloudSpec},
+		productIds:   productIds,
+	}
 	params := simplestreams.GetMetadataParams{
 		StreamsVersion:   currentStreamsVersion,
 		LookupConstraint: cons,
 		ValueParams: simplestreams.ValueParams{
-			DataType:      ImageIds,
-			FilterFunc:    appendMatchingImages,
-			ValueTemplate: ImageMetadata{},
+			DataType:        ImageIds,
+			MirrorContentId: ImageContentId(""),
+			FilterFunc:      FetchOptions{}.appendWantedImages,
+			ValueTemplate:   ImageMetadata{},
 		},
+		IndexPath:     indexPath,
+		RequireSigned: requireSigned,
 	}
-	items, resolveInfo, err := simplestreams.GetMetadata(sources, params)
+	metadata, resolveInfo, _, err := getMetadata(sources, params)
 	if err != nil {
 		return nil, resolveInfo, err
 	}
-	metadata := make([]*ImageMetadata, len(items))
-	for i, md := range items {
-		metadata[i] = md.(*ImageMetadata)
+	Sort(metadata)
+	return metadata, resolveInfo, nil
+}
+
+// productIdConstraint is a lookup constraint for explicit product ids.
+type productIdConstraint struct {
+	simplestreams.LookupParams
+	productIds []string
+}
+
+// IndexIds is defined in simplestreams.LookupConstraint.
+func (pc *productIdConstraint) IndexIds() []string {
+	return nil
+}
+
+// ProductIds is defined in simplestreams.LookupConstraint.
+func (pc *productIdConstraint) ProductIds() ([]string, error) {
+	return pc.productIds, nil
+}
+
+// hashImages returns a hash of the images, which does
+// not depend on the order in which they are passed.
+func hashImages(metadata []*ImageMetadata) (string, error) {
+	records := make([]string, len(metadata))
+	for i, im := range metadata {
+		data, err := json.Marshal(im)
+		if err != nil {
+			return "", errors.Trace(err)
+		}
+		records[i] = string(data)
+	}
+	sort.Strings(records)
+	hash := sha256.New()
+	for _, record := range records {
+		fmt.Fprintln(hash, record)
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+// FetchRegions returns the endpoint of each region with images in the
+// image metadata index at indexPath, keyed by region name, regardless of
+// any image constraint. The regions are read from the first of the
+// sources holding the index.
+func FetchRegions(sources []simplestreams.DataSource, indexPath string, requireSigned bool) (map[string]string, error) {
+	return simplestreams.FetchRegions(sources, indexPath, ImageIds, ImageMetadata{}, requireSigned)
+}
+
+// FetchWithOptions behaves like Fetch, with the returned images
+// further refined according to the specified options.
+func FetchWithOptions(
+	sources []simplestreams.DataSource, cons *ImageConstraint, opts FetchOptions,
+) ([]*ImageMetadata, *simplestreams.ResolveInfo, error) {
+	metadata, resolveInfo, _, err := FetchWithWarnings(sources, cons, opts)
+	return metadata, resolveInfo, err
+}
+
+// FetchWithWarnings behaves like FetchWithOptions, additionally
+// returning a warning for each source whose products were not all
+// searched because the MaxProducts limit was reached.
+func FetchWithWarnings(
+	sources []simplestreams.DataSource, cons *ImageConstraint, opts FetchOptions,
+) ([]*ImageMetadata, *simplestreams.ResolveInfo, []string, error) {
+
+	if opts.MaxProducts > 0 {
+		opts.productLimit = simplestreams.NewProductLimit(opts.MaxProducts)
+	}
+	var deadline *fetchDeadline
+	if !opts.Deadline.IsZero() {
+		deadline = newFetchDeadline(opts.Deadline, opts.Clock)
+		sources = deadline.wrap(sources)
+	}
+	metadata, resolveInfo, err := fetchStream(sources, cons, opts)
+	for _, stream := range opts.StreamFallback {
+		if err != nil || len(metadata) > 0 {
+			break
+		}
+		streamCons := *cons
+		streamCons.Stream = stream
+		metadata, resolveInfo, err = fetchStream(sources, &streamCons, opts)
+	}
+	if deadline != nil {
+		// Fetches abandoned at the deadline appear to the search
+		// as missing data, so the deadline takes precedence over
+		// any other result.
+		if deadlineErr := deadline.err(); deadlineErr != nil {
+			return nil, resolveInfo, nil, deadlineErr
+		}
+	}
+	if err != nil {
+		return nil, resolveInfo, nil, err
 	}
 	// Sorting the metadata is not strictly necessary, but it ensures consistent ordering for
 	// all compilers, and it just makes it easier to look at the data.
 	Sort(metadata)
+	return metadata, resolveInfo, productLimitWarnings(opts), nil
+}
+
+// productLimitWarnings returns a warning for each source
+// whose product files were capped by opts.MaxProducts.
+func productLimitWarnings(opts FetchOptions) []string {
+	if opts.productLimit == nil {
+		return nil
+	}
+	var warnings []string
+	for _, source := range opts.productLimit.Capped() {
+		warnings = append(warnings, fmt.Sprintf(
+			"only %d product files were fetched from %q, so some images may be missing",
+			opts.MaxProducts, source,
+		))
+	}
+	return warnings
+}
+
+// fetchStream returns the images matching the constraint, unsorted.
+// If opts has a stream fallback, each image is tagged with the stream
+// of the constraint.
+func fetchStream(
+	sources []simplestreams.DataSource, cons *ImageConstraint, opts FetchOptions,
+) (metadata []*ImageMetadata, resolveInfo *simplestreams.ResolveInfo, err error) {
+	if len(opts.CloudSpecs) > 0 {
+		metadata, resolveInfo, err = fetchCloudSpecs(sources, cons, opts)
+	} else {
+		metadata, resolveInfo, _, err = fetchMetadata(sources, cons, opts)
+	}
+	if err != nil || len(opts.StreamFallback) == 0 {
+		return metadata, resolveInfo, err
+	}
+	stream := cons.Stream
+	if stream == "" {
+		stream = ReleasedStream
+	}
+	for _, im := range metadata {
+		im.Stream = stream
+	}
+	return metadata, resolveInfo, nil
+}
+
+// fetchCloudSpecs returns the images matching the constraint in each of
+// the cloud specs in opts. The resolve info returned is that of the
+// first cloud spec.
+func fetchCloudSpecs(
+	sources []simplestreams.DataSource, cons *ImageConstraint, opts FetchOptions,
+) ([]*ImageMetadata, *simplestreams.ResolveInfo, error) {
+	var (
+		result      []*ImageMetadata
+		resolveInfo *simplestreams.ResolveInfo
+	)
+	seen := make(map[imageKey]bool)
+	for _, spec := range opts.CloudSpecs {
+		specCons := *cons
+		specCons.CloudSpec = spec
+		metadata, info, _, err := fetchMetadata(sources, &specCons, opts)
+		if err != nil {
+			return nil, info, errors.Annotatef(err, "fetching images for region %q", spec.Region)
+		}
+		if resolveInfo == nil {
+			resolveInfo = info
+		}
+		for _, im := range metadata {
+			key := im.key()
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			im.Endpoint = spec.Endpoint
+			result = append(result, im)
+		}
+		if opts.EarlyStop > 0 && len(result) >= opts.EarlyStop {
+			return result[:opts.EarlyStop], resolveInfo, nil
+		}
+	}
+	return result, resolveInfo, nil
+}
+
+// fetchMetadata returns the images matching the constraint, unsorted,
+// along with the updated time of the index they were found from.
+func fetchMetadata(
+	sources []simplestreams.DataSource, cons *ImageConstraint, opts FetchOptions,
+) ([]*ImageMetadata, *simplestreams.ResolveInfo, time.Time, error) {
+	params := metadataParams(cons, opts)
+	if len(opts.IndexPaths) > 0 {
+		return fetchIndexPaths(sources, params, opts)
+	}
+	return fetchIndex(sources, params, opts)
+}
+
+// fetchIndex returns the images found using params,
+// unsorted, along with the updated time of the index.
+func fetchIndex(
+	sources []simplestreams.DataSource, params simplestreams.GetMetadataParams, opts FetchOptions,
+) ([]*ImageMetadata, *simplestreams.ResolveInfo, time.Time, error) {
+	if opts.IncludeUnsigned {
+		metadata, resolveInfo, err := getSignedAndUnsignedMetadata(sources, params)
+		return metadata, resolveInfo, time.Time{}, err
+	}
+	return getMetadata(sources, params)
+}
+
+// fetchIndexPaths returns the images found using each of the index
+// paths in opts, unsorted and without duplicates, along with the most
+// recent updated time of the indexes. The resolve info returned is
+// that of the first index path.
+func fetchIndexPaths(
+	sources []simplestreams.DataSource, params simplestreams.GetMetadataParams, opts FetchOptions,
+) ([]*ImageMetadata, *simplestreams.ResolveInfo, time.Time, error) {
+	var (
+		result       []*ImageMetadata
+		resolveInfo  *simplestreams.ResolveInfo
+		indexUpdated time.Time
+	)
+	type imageId struct {
+		id     string
+		region string
+	}
+	seen := make(map[imageId]bool)
+	for _, indexPath := range opts.IndexPaths {
+		params.IndexPath = indexPath
+		metadata, info, updated, err := fetchIndex(sources, params, opts)
+		if err != nil {
+			return nil, info, time.Time{}, errors.Annotatef(err, "fetching images using index %q", indexPath)
+		}
+		if resolveInfo == nil {
+			resolveInfo = info
+		}
+		if updated.After(indexUpdated) {
+			indexUpdated = updated
+		}
+		for _, im := range metadata {
+			id := imageId{im.Id, im.RegionName}
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			result = append(result, im)
+		}
+		if opts.EarlyStop > 0 && len(result) >= opts.EarlyStop {
+			return result[:opts.EarlyStop], resolveInfo, indexUpdated, nil
+		}
+	}
+	return result, resolveInfo, indexUpdated, nil
+}
+
+// metadataParams returns the parameters for
+// fetching the images matching the constraint.
+func metadataParams(cons *ImageConstraint, opts FetchOptions) simplestreams.GetMetadataParams {
+	return simplestreams.GetMetadataParams{
+		StreamsVersion:   currentStreamsVersion,
+		LookupConstraint: cons,
+		ValueParams: simplestreams.ValueParams{
+			DataType:        ImageIds,
+			MirrorContentId: ImageContentId(cons.Stream),
+			FilterFunc:      opts.appendWantedImages,
+			ValueTemplate:   ImageMetadata{},
+		},
+		VerifiedIndexCache: opts.VerifiedIndexCache,
+		MaxBytes:           opts.MaxBytes,
+		Limit:              opts.EarlyStop,
+		ProductLimit:       opts.productLimit,
+	}
+}
+
+// getMetadata returns the images found using params, unsorted,
+// along with the updated time of the index they were found from.
+func getMetadata(
+	sources []simplestreams.DataSource, params simplestreams.GetMetadataParams,
+) ([]*ImageMetadata, *simplestreams.ResolveInfo, time.Time, error) {
+	items, resolveInfo, indexUpdated, err := simplestreams.GetMetadataWithIndexTime(sources, params)
+	if err != nil {
+		return nil, resolveInfo, indexUpdated, err
+	}
+	metadata := make([]*ImageMetadata, len(items))
+	for i, md := range items {
+		metadata[i] = md.(*ImageMetadata)
+	}
+	return metadata, resolveInfo, indexUpdated, nil
+}
+
+// getSignedAndUnsignedMetadata returns the images found using params
+// in both the signed and unsigned metadata, unsorted, with Signed set
+// on those found in the signed metadata.
+func getSignedAndUnsignedMetadata(
+	sources []simplestreams.DataSource, params simplestreams.GetMetadataParams,
+) ([]*ImageMetadata, *simplestreams.ResolveInfo, error) {
+	signed, unsigned, resolveInfo, err := simplestreams.GetSignedAndUnsignedMetadata(sources, params)
+	if err != nil {
+		return nil, resolveInfo, err
+	}
+	metadata := make([]*ImageMetadata, 0, len(signed)+len(unsigned))
+	for _, md := range signed {
+		im := md.(*ImageMetadata)
+		im.Signed = true
+		metadata = append(metadata, im)
+	}
+	for _, md := range unsigned {
+		metadata = append(metadata, md.(*ImageMetadata))
+	}
 	return metadata, resolveInfo, nil
 }
 
@@ -276,6 +1060,91 @@ type imageKey struct {
 	version string
 	region  string
 	storage string
+	label   string
+}
+
+// key returns the key identifying the kind of image described by im.
+func (im *ImageMetadata) key() imageKey {
+	return imageKey{im.VirtType, im.Arch, im.Version, im.RegionName, im.Storage, im.Label}
+}
+
+// wants reports whether the options allow im to be returned.
+func (opts FetchOptions) wants(im *ImageMetadata) bool {
+	if opts.Label != "" && im.Label != opts.Label {
+		return false
+	}
+	if opts.MinKernel != "" && (im.Kernel == "" || compareKernelVersions(im.Kernel, opts.MinKernel) < 0) {
+		return false
+	}
+	if opts.MinAgentVersion != version.Zero {
+		agentVersion, err := version.Parse(im.AgentVersion)
+		if err != nil || agentVersion.Compare(opts.MinAgentVersion) < 0 {
+			return false
+		}
+	}
+	return opts.IncludeDeprecated || !im.Deprecated
+}
+
+// compareKernelVersions compares kernel versions such as "4.4.0-21"
+// by their numeric components in turn, returning -1, 0 or 1 as a is
+// less than, equal to or greater than b. Where one version has all the
+// components of the other, and more, it is the greater.
+func compareKernelVersions(a, b string) int {
+	aParts, bParts := kernelVersionParts(a), kernelVersionParts(b)
+	for i := 0; i < len(aParts) && i < len(bParts); i++ {
+		switch {
+		case aParts[i] < bParts[i]:
+			return -1
+		case aParts[i] > bParts[i]:
+			return 1
+		}
+	}
+	switch {
+	case len(aParts) < len(bParts):
+		return -1
+	case len(aParts) > len(bParts):
+		return 1
+	}
+	return 0
+}
+
+// kernelVersionParts returns the numeric components of
+// the kernel version, ignoring any other characters.
+func kernelVersionParts(v string) []int {
+	var parts []int
+	for _, field := range strings.FieldsFunc(v, func(r rune) bool { return r < '0' || r > '9' }) {
+		n, err := strconv.Atoi(field)
+		if err != nil {
+			// The field is too long to be a version.
+			continue
+		}
+		parts = append(parts, n)
+	}
+	return parts
+}
+
+// appendWantedImages behaves like appendMatchingImages, but ignores
+// any images the options do not want. Filtering as the images are
+// found, rather than afterwards, ensures EarlyStop counts only images
+// which will be returned.
+func (opts FetchOptions) appendWantedImages(source simplestreams.DataSource, matchingImages []interface{},
+	images map[string]interface{}, cons simplestreams.LookupConstraint) ([]interface{}, error) {
+
+	var endpoint string
+	if opts.MatchEndpoint && cons != nil {
+		endpoint = cons.Params().Endpoint
+	}
+	wanted := make(map[string]interface{}, len(images))
+	for id, val := range images {
+		im := val.(*ImageMetadata)
+		if endpoint != "" && im.Endpoint != endpoint {
+			continue
+		}
+		if opts.wants(im) {
+			wanted[id] = val
+		}
+	}
+	return appendMatchingImages(source, matchingImages, wanted, cons)
 }
 
 // appendMatchingImages updates matchingImages with image metadata records from images which belong to the
@@ -286,14 +1155,19 @@ func appendMatchingImages(source simplestreams.DataSource, matchingImages []inte
 	imagesMap := make(map[imageKey]*ImageMetadata, len(matchingImages))
 	for _, val := range matchingImages {
 		im := val.(*ImageMetadata)
-		imagesMap[imageKey{im.VirtType, im.Arch, im.Version, im.RegionName, im.Storage}] = im
+		imagesMap[im.key()] = im
 	}
 	for _, val := range images {
 		im := val.(*ImageMetadata)
 		if cons != nil && cons.Params().Region != "" && cons.Params().Region != im.RegionName {
 			continue
 		}
-		if _, ok := imagesMap[imageKey{im.VirtType, im.Arch, im.Version, im.RegionName, im.Storage}]; !ok {
+		if ic, ok := cons.(*ImageConstraint); ok {
+			if !ic.matchesVirtType(im.VirtType) || !ic.matchesCapabilities(im.Capabilities) {
+				continue
+			}
+		}
+		if _, ok := imagesMap[im.key()]; !ok {
 			matchingImages = append(matchingImages, im)
 		}
 	}
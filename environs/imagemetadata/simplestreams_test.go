@@ -11,10 +11,12 @@ import (
 	"strings"
 	stdtesting "testing"
 
+	"github.com/juju/errors"
 	jc "github.com/juju/testing/checkers"
 	"github.com/juju/utils"
 	"gopkg.in/amz.v3/aws"
 	gc "gopkg.in/check.v1"
+	"gopkg.in/yaml.v2"
 
 	"github.com/juju/juju/environs/imagemetadata"
 	"github.com/juju/juju/environs/simplestreams"
@@ -350,6 +352,146 @@ func (s *productSpecSuite) TestIdMultiArch(c *gc.C) {
 		"com.ubuntu.cloud.daily:server:12.04:i386"})
 }
 
+func (s *productSpecSuite) TestIdCustomTemplate(c *gc.C) {
+	imageConstraint := imagemetadata.NewImageConstraint(simplestreams.LookupParams{
+		Series: []string{"precise", "xenial"},
+		Arches: []string{"amd64"},
+		Stream: "daily",
+	})
+	err := imageConstraint.SetProductIdTemplate("com.example.images{stream}:{version}:{arch}")
+	c.Assert(err, jc.ErrorIsNil)
+	ids, err := imageConstraint.ProductIds()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(ids, gc.DeepEquals, []string{
+		"com.example.images.daily:12.04:amd64",
+		"com.example.images.daily:16.04:amd64"})
+
+	imageConstraint.Stream = "released"
+	ids, err = imageConstraint.ProductIds()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(ids, gc.DeepEquals, []string{
+		"com.example.images:12.04:amd64",
+		"com.example.images:16.04:amd64"})
+}
+
+func (s *productSpecSuite) TestIdUnknownArch(c *gc.C) {
+	imageConstraint := imagemetadata.NewImageConstraint(simplestreams.LookupParams{
+		Series: []string{"precise"},
+		Arches: []string{"amd64", "amdd64"},
+	})
+	_, err := imageConstraint.ProductIds()
+	c.Assert(err, gc.ErrorMatches, `unknown architecture "amdd64"`)
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+}
+
+func (s *productSpecSuite) TestIdKnownArches(c *gc.C) {
+	imageConstraint := imagemetadata.NewImageConstraint(simplestreams.LookupParams{
+		Series: []string{"precise"},
+		Arches: []string{"arm", "arm64", "ppc64el", "s390x"},
+	})
+	ids, err := imageConstraint.ProductIds()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(ids, gc.DeepEquals, []string{
+		"com.ubuntu.cloud:server:12.04:arm",
+		"com.ubuntu.cloud:server:12.04:arm64",
+		"com.ubuntu.cloud:server:12.04:ppc64el",
+		"com.ubuntu.cloud:server:12.04:s390x"})
+}
+
+func (s *productSpecSuite) TestIdAllowUnknownArches(c *gc.C) {
+	imageConstraint := imagemetadata.NewImageConstraint(simplestreams.LookupParams{
+		Series: []string{"precise"},
+		Arches: []string{"riscv64"},
+	})
+	imageConstraint.AllowUnknownArches()
+	ids, err := imageConstraint.ProductIds()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(ids, gc.DeepEquals, []string{"com.ubuntu.cloud:server:12.04:riscv64"})
+}
+
+func (s *productSpecSuite) TestIdArchAlias(c *gc.C) {
+	imageConstraint := imagemetadata.NewImageConstraint(simplestreams.LookupParams{
+		Series: []string{"precise"},
+		Arches: []string{"amd64", "x86"},
+	})
+	ids, err := imageConstraint.ProductIds()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(ids, gc.DeepEquals, []string{
+		"com.ubuntu.cloud:server:12.04:amd64",
+		"com.ubuntu.cloud:server:12.04:i386"})
+}
+
+func (s *productSpecSuite) TestIdArchAliasDuplicate(c *gc.C) {
+	imageConstraint := imagemetadata.NewImageConstraint(simplestreams.LookupParams{
+		Series: []string{"precise"},
+		Arches: []string{"i386", "x86"},
+	})
+	ids, err := imageConstraint.ProductIds()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(ids, gc.DeepEquals, []string{"com.ubuntu.cloud:server:12.04:i386"})
+}
+
+func (s *productSpecSuite) TestIdArchAliasExtended(c *gc.C) {
+	imagemetadata.ArchAliases["x86_64"] = "amd64"
+	defer delete(imagemetadata.ArchAliases, "x86_64")
+	imageConstraint := imagemetadata.NewImageConstraint(simplestreams.LookupParams{
+		Series: []string{"precise"},
+		Arches: []string{"x86_64"},
+	})
+	ids, err := imageConstraint.ProductIds()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(ids, gc.DeepEquals, []string{"com.ubuntu.cloud:server:12.04:amd64"})
+}
+
+func (s *productSpecSuite) TestSetProductIdTemplateInvalid(c *gc.C) {
+	imageConstraint := imagemetadata.NewImageConstraint(simplestreams.LookupParams{
+		Series: []string{"precise"},
+		Arches: []string{"amd64"},
+	})
+	for _, template := range []string{
+		"com.example.images:{version}:{arch}",
+		"com.example.images{stream}:{arch}",
+		"com.example.images{stream}:{version}",
+	} {
+		err := imageConstraint.SetProductIdTemplate(template)
+		c.Assert(err, jc.Satisfies, errors.IsNotValid)
+	}
+	ids, err := imageConstraint.ProductIds()
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(ids, gc.DeepEquals, []string{"com.ubuntu.cloud:server:12.04:amd64"})
+}
+
+func (s *productSpecSuite) TestYAMLRoundTrip(c *gc.C) {
+	imageConstraint := imagemetadata.NewImageConstraint(simplestreams.LookupParams{
+		CloudSpec: simplestreams.CloudSpec{"us-east-1", "https://ec2.us-east-1.amazonaws.com"},
+		Series:    []string{"precise", "xenial"},
+		Arches:    []string{"amd64", "arm64"},
+		Stream:    "daily",
+	})
+	imageConstraint.VirtType = "!pv"
+	imageConstraint.Capability = "gpu"
+	data, err := yaml.Marshal(imageConstraint)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(string(data), gc.Equals, `
+region: us-east-1
+endpoint: https://ec2.us-east-1.amazonaws.com
+series:
+- precise
+- xenial
+arches:
+- amd64
+- arm64
+stream: daily
+virt-type: '!pv'
+capability: gpu
+`[1:])
+
+	var read imagemetadata.ImageConstraint
+	err = yaml.Unmarshal(data, &read)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(&read, jc.DeepEquals, imageConstraint)
+}
+
 type signedSuite struct {
 	origKey string
 }
@@ -379,6 +521,14 @@ func (s *signedSuite) SetUpSuite(c *gc.C) {
 		r, sstesting.SignedMetadataPrivateKey, sstesting.PrivateKeyPassphrase)
 	c.Assert(err, jc.ErrorIsNil)
 	imageData["/signed/streams/v1/image_metadata.sjson"] = string(signedData)
+
+	// The mixed source holds both the signed and unsigned data.
+	for _, name := range []string{"index.json", "image_metadata.json"} {
+		imageData["/mixed/streams/v1/"+name] = imageData["/unsigned/streams/v1/"+name]
+	}
+	for _, name := range []string{"index.sjson", "image_metadata.sjson"} {
+		imageData["/mixed/streams/v1/"+name] = imageData["/signed/streams/v1/"+name]
+	}
 	sstesting.SetRoundTripperFiles(imageData, map[string]int{"test://unauth": http.StatusUnauthorized})
 	s.origKey = imagemetadata.SetSigningPublicKey(sstesting.SignedMetadataPublicKey)
 }
@@ -419,6 +569,71 @@ func (s *signedSuite) TestSignedImageMetadataInvalidSignature(c *gc.C) {
 	c.Assert(err, gc.ErrorMatches, "cannot read index data.*")
 }
 
+func (s *signedSuite) fetchIncludeUnsigned(c *gc.C, source simplestreams.DataSource) ([]*imagemetadata.ImageMetadata, *simplestreams.ResolveInfo, error) {
+	imageConstraint := imagemetadata.NewImageConstraint(simplestreams.LookupParams{
+		CloudSpec: simplestreams.CloudSpec{"us-east-1", "https://ec2.us-east-1.amazonaws.com"},
+		Series:    []string{"precise"},
+		Arches:    []string{"amd64"},
+	})
+	return imagemetadata.FetchWithOptions(
+		[]simplestreams.DataSource{source}, imageConstraint, imagemetadata.FetchOptions{IncludeUnsigned: true},
+	)
+}
+
+func (s *signedSuite) TestIncludeUnsignedMixed(c *gc.C) {
+	// The source requires signed data, but unsigned data is still reported.
+	source := simplestreams.NewURLSignedDataSource("test", "test://host/mixed", sstesting.SignedMetadataPublicKey, utils.VerifySSLHostnames, simplestreams.DEFAULT_CLOUD_DATA, true)
+	images, resolveInfo, err := s.fetchIncludeUnsigned(c, source)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(images, gc.HasLen, 2)
+	c.Check(images[0].Id, gc.Equals, "ami-123456")
+	c.Check(images[0].Signed, jc.IsTrue)
+	c.Check(images[1].Id, gc.Equals, "ami-26745463")
+	c.Check(images[1].Signed, jc.IsFalse)
+	c.Check(resolveInfo, gc.DeepEquals, &simplestreams.ResolveInfo{
+		Source:   "test",
+		Signed:   true,
+		IndexURL: "test://host/mixed/streams/v1/index.sjson",
+	})
+}
+
+func (s *signedSuite) TestIncludeUnsignedOnlySigned(c *gc.C) {
+	source := simplestreams.NewURLSignedDataSource("test", "test://host/signed", sstesting.SignedMetadataPublicKey, utils.VerifySSLHostnames, simplestreams.DEFAULT_CLOUD_DATA, true)
+	images, _, err := s.fetchIncludeUnsigned(c, source)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(images, gc.HasLen, 1)
+	c.Check(images[0].Id, gc.Equals, "ami-123456")
+	c.Check(images[0].Signed, jc.IsTrue)
+}
+
+func (s *signedSuite) TestIncludeUnsignedOnlyUnsigned(c *gc.C) {
+	source := simplestreams.NewURLDataSource("test", "test://host/unsigned", utils.VerifySSLHostnames, simplestreams.DEFAULT_CLOUD_DATA, true)
+	images, resolveInfo, err := s.fetchIncludeUnsigned(c, source)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(images, gc.HasLen, 1)
+	c.Check(images[0].Id, gc.Equals, "ami-26745463")
+	c.Check(images[0].Signed, jc.IsFalse)
+	c.Check(resolveInfo.Signed, jc.IsFalse)
+}
+
+func (s *signedSuite) TestIncludeUnsignedInvalidSignature(c *gc.C) {
+	// Without a key to verify the signed data, Fetch falls back to
+	// the unsigned data, but it is an error when including unsigned data.
+	source := simplestreams.NewURLDataSource("test", "test://host/mixed", utils.VerifySSLHostnames, simplestreams.DEFAULT_CLOUD_DATA, false)
+	imageConstraint := imagemetadata.NewImageConstraint(simplestreams.LookupParams{
+		CloudSpec: simplestreams.CloudSpec{"us-east-1", "https://ec2.us-east-1.amazonaws.com"},
+		Series:    []string{"precise"},
+		Arches:    []string{"amd64"},
+	})
+	images, _, err := imagemetadata.Fetch([]simplestreams.DataSource{source}, imageConstraint)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(images, gc.HasLen, 1)
+	c.Check(images[0].Id, gc.Equals, "ami-26745463")
+
+	_, _, err = s.fetchIncludeUnsigned(c, source)
+	c.Assert(err, gc.ErrorMatches, "cannot read index data.*")
+}
+
 var unsignedIndex = `
 {
  "index": {
@@ -0,0 +1,86 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package imagemetadata
+
+import (
+	"sort"
+
+	"github.com/juju/errors"
+
+	"github.com/juju/juju/environs/simplestreams"
+)
+
+// WeightedSource is a data source with an explicit priority, used by
+// FetchWeighted in place of the source's position in a list.
+type WeightedSource struct {
+	// Source is the data source to search.
+	Source simplestreams.DataSource
+
+	// Priority is the importance of the source; images from
+	// sources with a higher priority are preferred.
+	Priority int
+}
+
+// FetchWeighted returns the images matching the constraint found in
+// any of the sources, rather than only in the first source holding
+// metadata as Fetch does. Where more than one source has an image with
+// the same id and region, that from the source with the highest
+// priority is returned; sources of equal priority are preferred in the
+// order given. Sources without metadata are ignored, but if none has
+// any, the error from the preferred source is returned.
+//
+// The options are applied to the images found in each source. The
+// resolve info returned is that of the preferred source with metadata.
+func FetchWeighted(
+	sources []WeightedSource, cons *ImageConstraint, opts FetchOptions,
+) ([]*ImageMetadata, *simplestreams.ResolveInfo, error) {
+	ordered := append([]WeightedSource(nil), sources...)
+	sort.Stable(byPriority(ordered))
+
+	var (
+		result      []*ImageMetadata
+		resolveInfo *simplestreams.ResolveInfo
+		notFound    error
+	)
+	type imageId struct {
+		id     string
+		region string
+	}
+	seen := make(map[imageId]bool)
+	for _, source := range ordered {
+		metadata, info, err := FetchWithOptions([]simplestreams.DataSource{source.Source}, cons, opts)
+		if errors.IsNotFound(err) {
+			if notFound == nil {
+				notFound = err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, info, errors.Annotatef(err, "fetching images from %q", source.Source.Description())
+		}
+		if resolveInfo == nil {
+			resolveInfo = info
+		}
+		for _, im := range metadata {
+			id := imageId{im.Id, im.RegionName}
+			if seen[id] {
+				continue
+			}
+			seen[id] = true
+			result = append(result, im)
+		}
+	}
+	if resolveInfo == nil && notFound != nil {
+		return nil, nil, notFound
+	}
+	Sort(result)
+	return result, resolveInfo, nil
+}
+
+// byPriority orders sources by descending priority.
+type byPriority []WeightedSource
+
+func (b byPriority) Len() int           { return len(b) }
+func (b byPriority) Swap(i, j int)      { b[i], b[j] = b[j], b[i] }
+func (b byPriority) Less(i, j int) bool { return b[i].Priority > b[j].Priority }
@@ -71,6 +71,57 @@ type urlDataSource struct {
 	publicSigningKey     string
 	priority             int
 	requireSigned        bool
+	credentials          *Credentials
+	transport            http.RoundTripper
+}
+
+// Credentials authenticate the requests made by a URL data source,
+// using either HTTP basic authentication or a bearer token.
+type Credentials struct {
+	// Username and Password are used for basic authentication.
+	Username string
+	Password string
+
+	// BearerToken, if set, is sent in an Authorization
+	// header in place of a username and password.
+	BearerToken string
+}
+
+// Validate returns an error if the credentials are incomplete
+// or specify both basic authentication and a bearer token.
+func (c Credentials) Validate() error {
+	if c.BearerToken != "" {
+		if c.Username != "" || c.Password != "" {
+			return errors.NotValidf("credentials with both a bearer token and a username or password")
+		}
+		return nil
+	}
+	if c.Username == "" {
+		return errors.NotValidf("credentials without a username or bearer token")
+	}
+	return nil
+}
+
+// String implements fmt.Stringer, without revealing any secrets.
+func (c Credentials) String() string {
+	if c.BearerToken != "" {
+		return "bearer token"
+	}
+	return fmt.Sprintf("basic auth for %q", c.Username)
+}
+
+// GoString implements fmt.GoStringer, without revealing any secrets.
+func (c Credentials) GoString() string {
+	return c.String()
+}
+
+// apply authenticates the request with the credentials.
+func (c Credentials) apply(req *http.Request) {
+	if c.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.BearerToken)
+		return
+	}
+	req.SetBasicAuth(c.Username, c.Password)
 }
 
 // NewURLDataSource returns a new datasource reading from the specified baseURL.
@@ -96,6 +147,26 @@ func NewURLSignedDataSource(description, baseURL, publicKey string, hostnameVeri
 	}
 }
 
+// NewAuthenticatedURLDataSource returns a new datasource reading from the
+// specified baseURL, authenticating each request with the credentials.
+// Data sources for any mirrors found are not given the credentials.
+func NewAuthenticatedURLDataSource(
+	description, baseURL string, credentials Credentials,
+	hostnameVerification utils.SSLHostnameVerification, priority int, requireSigned bool,
+) (DataSource, error) {
+	if err := credentials.Validate(); err != nil {
+		return nil, errors.Trace(err)
+	}
+	return &urlDataSource{
+		description:          description,
+		baseURL:              baseURL,
+		hostnameVerification: hostnameVerification,
+		priority:             priority,
+		requireSigned:        requireSigned,
+		credentials:          &credentials,
+	}, nil
+}
+
 // Description is defined in simplestreams.DataSource.
 func (u *urlDataSource) Description() string {
 	return u.description
@@ -119,11 +190,18 @@ func urlJoin(baseURL, relpath string) string {
 // Fetch is defined in simplestreams.DataSource.
 func (h *urlDataSource) Fetch(path string) (io.ReadCloser, string, error) {
 	dataURL := urlJoin(h.baseURL, path)
-	client := utils.GetHTTPClient(h.hostnameVerification)
 	// dataURL can be http:// or file://
 	// MakeFileURL will only modify the URL if it's a file URL
 	dataURL = utils.MakeFileURL(dataURL)
-	resp, err := client.Get(dataURL)
+	req, err := http.NewRequest("GET", dataURL, nil)
+	if err != nil {
+		return nil, dataURL, errors.NotFoundf("invalid URL %q", dataURL)
+	}
+	if h.credentials != nil {
+		h.credentials.apply(req)
+	}
+	client := &http.Client{Transport: h.httpTransport(req.URL.Scheme)}
+	resp, err := client.Do(req)
 	if err != nil {
 		logger.Tracef("Got error requesting %q: %v", dataURL, err)
 		return nil, dataURL, errors.NotFoundf("invalid URL %q", dataURL)
@@ -134,7 +212,10 @@ func (h *urlDataSource) Fetch(path string) (io.ReadCloser, string, error) {
 		case http.StatusNotFound:
 			return nil, dataURL, errors.NotFoundf("cannot find URL %q", dataURL)
 		case http.StatusUnauthorized:
-			return nil, dataURL, errors.Unauthorizedf("unauthorised access to URL %q", dataURL)
+			if h.credentials == nil {
+				return nil, dataURL, errors.Unauthorizedf("unauthorised access to URL %q, credentials are required", dataURL)
+			}
+			return nil, dataURL, errors.Unauthorizedf("unauthorised access to URL %q, %v rejected", dataURL, h.credentials)
 		}
 		return nil, dataURL, fmt.Errorf("cannot access URL %q, %q", dataURL, resp.Status)
 	}
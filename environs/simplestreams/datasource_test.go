@@ -4,10 +4,16 @@
 package simplestreams_test
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"sync"
 
+	"github.com/juju/errors"
 	jc "github.com/juju/testing/checkers"
 	"github.com/juju/utils"
 	gc "gopkg.in/check.v1"
@@ -19,6 +25,8 @@ import (
 
 var _ = gc.Suite(&datasourceSuite{})
 var _ = gc.Suite(&datasourceHTTPSSuite{})
+var _ = gc.Suite(&datasourceAuthSuite{})
+var _ = gc.Suite(&datasourceTransportSuite{})
 
 type datasourceSuite struct {
 	testing.TestDataSuite
@@ -90,3 +98,198 @@ func (s *datasourceHTTPSSuite) TestNonVerifyingClientSucceeds(c *gc.C) {
 	c.Assert(err, jc.ErrorIsNil)
 	c.Check(string(byteContent), gc.Equals, "Greetings!\n")
 }
+
+type datasourceAuthSuite struct {
+	Server *httptest.Server
+}
+
+func (s *datasourceAuthSuite) SetUpTest(c *gc.C) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(resp http.ResponseWriter, req *http.Request) {
+		req.Body.Close()
+		user, password, ok := req.BasicAuth()
+		basicOK := ok && user == "user" && password == "secret"
+		bearerOK := req.Header.Get("Authorization") == "Bearer token"
+		if !basicOK && !bearerOK {
+			resp.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		resp.WriteHeader(http.StatusOK)
+		resp.Write([]byte("Greetings!\n"))
+	})
+	s.Server = httptest.NewServer(mux)
+}
+
+func (s *datasourceAuthSuite) TearDownTest(c *gc.C) {
+	if s.Server != nil {
+		s.Server.Close()
+		s.Server = nil
+	}
+}
+
+func (s *datasourceAuthSuite) assertFetch(c *gc.C, credentials simplestreams.Credentials) {
+	ds, err := simplestreams.NewAuthenticatedURLDataSource(
+		"test", s.Server.URL, credentials, utils.VerifySSLHostnames, simplestreams.DEFAULT_CLOUD_DATA, false)
+	c.Assert(err, jc.ErrorIsNil)
+	reader, _, err := ds.Fetch("bar")
+	c.Assert(err, jc.ErrorIsNil)
+	defer reader.Close()
+	byteContent, err := ioutil.ReadAll(reader)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(byteContent), gc.Equals, "Greetings!\n")
+}
+
+func (s *datasourceAuthSuite) TestFetchBasicAuth(c *gc.C) {
+	s.assertFetch(c, simplestreams.Credentials{Username: "user", Password: "secret"})
+}
+
+func (s *datasourceAuthSuite) TestFetchBearerToken(c *gc.C) {
+	s.assertFetch(c, simplestreams.Credentials{BearerToken: "token"})
+}
+
+func (s *datasourceAuthSuite) TestFetchWithoutCredentials(c *gc.C) {
+	ds := simplestreams.NewURLDataSource("test", s.Server.URL, utils.VerifySSLHostnames, simplestreams.DEFAULT_CLOUD_DATA, false)
+	_, _, err := ds.Fetch("bar")
+	c.Assert(err, jc.Satisfies, errors.IsUnauthorized)
+	c.Assert(err, gc.ErrorMatches, `unauthorised access to URL ".*/bar", credentials are required`)
+}
+
+func (s *datasourceAuthSuite) TestFetchWrongCredentials(c *gc.C) {
+	ds, err := simplestreams.NewAuthenticatedURLDataSource(
+		"test", s.Server.URL, simplestreams.Credentials{Username: "user", Password: "wrong"},
+		utils.VerifySSLHostnames, simplestreams.DEFAULT_CLOUD_DATA, false)
+	c.Assert(err, jc.ErrorIsNil)
+	_, _, err = ds.Fetch("bar")
+	c.Assert(err, jc.Satisfies, errors.IsUnauthorized)
+	c.Assert(err, gc.ErrorMatches, `unauthorised access to URL ".*/bar", basic auth for "user" rejected`)
+	c.Assert(err.Error(), gc.Not(jc.Contains), "wrong")
+}
+
+func (s *datasourceAuthSuite) TestFetchMetadataWithoutCredentials(c *gc.C) {
+	ds := simplestreams.NewURLDataSource("test", s.Server.URL, utils.VerifySSLHostnames, simplestreams.DEFAULT_CLOUD_DATA, false)
+	cons := imagemetadata.NewImageConstraint(simplestreams.LookupParams{
+		CloudSpec: simplestreams.CloudSpec{"us-east-1", "https://ec2.us-east-1.amazonaws.com"},
+		Series:    []string{"precise"},
+		Arches:    []string{"amd64"},
+	})
+	_, _, err := imagemetadata.Fetch([]simplestreams.DataSource{ds}, cons)
+	c.Assert(err, jc.Satisfies, errors.IsUnauthorized)
+	c.Assert(err, gc.ErrorMatches, `unauthorised access to URL ".*", credentials are required`)
+}
+
+func (s *datasourceAuthSuite) TestInvalidCredentials(c *gc.C) {
+	for _, credentials := range []simplestreams.Credentials{
+		{},
+		{Password: "secret"},
+		{Username: "user", BearerToken: "token"},
+	} {
+		_, err := simplestreams.NewAuthenticatedURLDataSource(
+			"test", s.Server.URL, credentials, utils.VerifySSLHostnames, simplestreams.DEFAULT_CLOUD_DATA, false)
+		c.Check(err, jc.Satisfies, errors.IsNotValid)
+	}
+}
+
+func (s *datasourceAuthSuite) TestCredentialsNotFormatted(c *gc.C) {
+	for _, credentials := range []simplestreams.Credentials{
+		{Username: "user", Password: "secret"},
+		{BearerToken: "secret"},
+	} {
+		formatted := fmt.Sprintf("%v %+v %#v", credentials, credentials, credentials)
+		c.Check(formatted, gc.Not(jc.Contains), "secret")
+	}
+}
+
+type datasourceTransportSuite struct {
+	Server *httptest.Server
+
+	mu             sync.Mutex
+	newConnections int
+}
+
+func (s *datasourceTransportSuite) SetUpTest(c *gc.C) {
+	s.newConnections = 0
+	s.Server = httptest.NewUnstartedServer(http.HandlerFunc(func(resp http.ResponseWriter, req *http.Request) {
+		req.Body.Close()
+		resp.Write([]byte("Greetings!\n"))
+	}))
+	s.Server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			s.mu.Lock()
+			s.newConnections++
+			s.mu.Unlock()
+		}
+	}
+	s.Server.Start()
+}
+
+func (s *datasourceTransportSuite) TearDownTest(c *gc.C) {
+	if s.Server != nil {
+		s.Server.Close()
+		s.Server = nil
+	}
+}
+
+func (s *datasourceTransportSuite) fetchAll(c *gc.C, ds simplestreams.DataSource, paths ...string) {
+	for _, path := range paths {
+		reader, _, err := ds.Fetch(path)
+		c.Assert(err, jc.ErrorIsNil)
+		byteContent, err := ioutil.ReadAll(reader)
+		reader.Close()
+		c.Assert(err, jc.ErrorIsNil)
+		c.Check(string(byteContent), gc.Equals, "Greetings!\n")
+	}
+}
+
+func (s *datasourceTransportSuite) connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.newConnections
+}
+
+func (s *datasourceTransportSuite) TestFetchReusesConnection(c *gc.C) {
+	ds := simplestreams.NewURLDataSource("test", s.Server.URL, utils.NoVerifySSLHostnames, simplestreams.DEFAULT_CLOUD_DATA, false)
+	err := simplestreams.SetHTTPTransport(ds, simplestreams.NewHTTPTransport(utils.NoVerifySSLHostnames))
+	c.Assert(err, jc.ErrorIsNil)
+	s.fetchAll(c, ds, "index.json", "foo.json", "bar.json")
+	c.Assert(s.connections(), gc.Equals, 1)
+}
+
+func (s *datasourceTransportSuite) TestSharedTransport(c *gc.C) {
+	transport := simplestreams.NewHTTPTransport(utils.VerifySSLHostnames)
+	for _, name := range []string{"first", "second"} {
+		ds := simplestreams.NewURLDataSource(name, s.Server.URL, utils.VerifySSLHostnames, simplestreams.DEFAULT_CLOUD_DATA, false)
+		err := simplestreams.SetHTTPTransport(ds, transport)
+		c.Assert(err, jc.ErrorIsNil)
+		s.fetchAll(c, ds, "index.json", "foo.json")
+	}
+	c.Assert(s.connections(), gc.Equals, 1)
+}
+
+func (s *datasourceTransportSuite) TestHTTPTransportUsesHTTP2(c *gc.C) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "Greetings!")
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	verified := simplestreams.NewHTTPTransport(utils.VerifySSLHostnames)
+	verified.TLSClientConfig = &tls.Config{RootCAs: roots}
+	for _, transport := range []*http.Transport{
+		simplestreams.NewHTTPTransport(utils.NoVerifySSLHostnames),
+		verified,
+	} {
+		resp, err := (&http.Client{Transport: transport}).Get(server.URL)
+		c.Assert(err, jc.ErrorIsNil)
+		resp.Body.Close()
+		c.Check(resp.ProtoMajor, gc.Equals, 2)
+	}
+}
+
+func (s *datasourceTransportSuite) TestSetHTTPTransportNotSupported(c *gc.C) {
+	ds := simplestreams.NewGitWorkTreeDataSource("git", c.MkDir(), "", simplestreams.CUSTOM_CLOUD_DATA, false)
+	err := simplestreams.SetHTTPTransport(ds, simplestreams.NewHTTPTransport(utils.VerifySSLHostnames))
+	c.Assert(err, jc.Satisfies, errors.IsNotSupported)
+}
@@ -3,6 +3,11 @@
 
 package simplestreams
 
+import (
+	"io"
+	"os"
+)
+
 func ExtractCatalogsForProducts(metadata CloudMetadata, productIds []string) []MetadataCatalog {
 	return metadata.extractCatalogsForProducts(productIds)
 }
@@ -24,3 +29,23 @@ func Filter(entries IndexMetadataSlice, match func(*IndexMetadata) bool) IndexMe
 }
 
 var FetchData = fetchData
+
+func FetchVerifiedData(source DataSource, path string, requireSigned bool, cache *VerifiedIndexCache) ([]byte, string, error) {
+	return fetchDataWithParams(source, path, requireSigned, fetchParams{verifiedCache: cache})
+}
+
+func SetVerifiedIndexCacheVerifier(cache *VerifiedIndexCache, verify func(io.Reader, string) ([]byte, error)) {
+	cache.verify = verify
+}
+
+var GitCloneTimeout = &gitCloneTimeout
+
+// ResetGitClones removes the Git repositories cloned by git data sources.
+func ResetGitClones() {
+	gitClones.mu.Lock()
+	defer gitClones.mu.Unlock()
+	for url, dir := range gitClones.dirs {
+		os.RemoveAll(dir)
+		delete(gitClones.dirs, url)
+	}
+}
@@ -0,0 +1,228 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package simplestreams
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+)
+
+// gitURLPrefix prefixes the URLs of Git repositories
+// holding simplestreams metadata.
+const gitURLPrefix = "git+"
+
+// gitCloneTimeout limits the time spent cloning a Git repository.
+var gitCloneTimeout = 5 * time.Minute
+
+// gitClones holds the directory into which each Git repository has
+// been cloned, keyed by Git URL, so that each is cloned at most once
+// per process. Clones are serialised by the lock for their URL, so
+// that a slow clone does not hold up clones of other repositories.
+var gitClones = struct {
+	mu    sync.Mutex
+	dirs  map[string]string
+	locks map[string]*sync.Mutex
+}{
+	dirs:  make(map[string]string),
+	locks: make(map[string]*sync.Mutex),
+}
+
+// A gitDataSource retrieves data from a clone of a Git repository,
+// or from an existing working tree. The data is only ever read.
+type gitDataSource struct {
+	description      string
+	gitURL           string
+	repoURL          string
+	ref              string
+	workTree         string
+	publicSigningKey string
+	priority         int
+	requireSigned    bool
+}
+
+// IsGitURL reports whether the URL identifies
+// a Git repository, eg "git+https://host/repo.git".
+func IsGitURL(url string) bool {
+	return strings.HasPrefix(url, gitURLPrefix)
+}
+
+// NewGitDataSource returns a new datasource reading from the Git
+// repository identified by gitURL, of the form
+// "git+<repository URL>#<ref>", eg "git+https://host/repo.git#stable",
+// where the ref is a branch or tag. If there is no ref, the
+// repository's default branch is used.
+//
+// The repository is shallow cloned at the ref when data is first
+// fetched, and the clone is shared with any other Git data source
+// for the same URL for the rest of the process.
+func NewGitDataSource(description, gitURL, publicKey string, priority int, requireSigned bool) (DataSource, error) {
+	if !IsGitURL(gitURL) {
+		return nil, errors.NotValidf("Git URL %q without %q prefix", gitURL, gitURLPrefix)
+	}
+	repoURL := strings.TrimPrefix(gitURL, gitURLPrefix)
+	var ref string
+	if i := strings.Index(repoURL, "#"); i >= 0 {
+		repoURL, ref = repoURL[:i], repoURL[i+1:]
+	}
+	if repoURL == "" {
+		return nil, errors.NotValidf("Git URL %q without repository", gitURL)
+	}
+	if strings.HasPrefix(ref, "-") {
+		return nil, errors.NotValidf("Git ref %q", ref)
+	}
+	return &gitDataSource{
+		description:      description,
+		gitURL:           gitURL,
+		repoURL:          repoURL,
+		ref:              ref,
+		publicSigningKey: publicKey,
+		priority:         priority,
+		requireSigned:    requireSigned,
+	}, nil
+}
+
+// NewGitWorkTreeDataSource returns a new datasource reading from an
+// existing Git working tree, such as a checkout of the metadata
+// repository, rather than cloning a repository.
+func NewGitWorkTreeDataSource(description, workTree, publicKey string, priority int, requireSigned bool) DataSource {
+	return &gitDataSource{
+		description:      description,
+		workTree:         workTree,
+		publicSigningKey: publicKey,
+		priority:         priority,
+		requireSigned:    requireSigned,
+	}
+}
+
+// Description is defined in simplestreams.DataSource.
+func (g *gitDataSource) Description() string {
+	return g.description
+}
+
+func (g *gitDataSource) GoString() string {
+	if g.workTree != "" {
+		return fmt.Sprintf("%v: gitDataSource(%q)", g.description, g.workTree)
+	}
+	return fmt.Sprintf("%v: gitDataSource(%q)", g.description, g.gitURL)
+}
+
+// Fetch is defined in simplestreams.DataSource.
+func (g *gitDataSource) Fetch(path string) (io.ReadCloser, string, error) {
+	dataURL, _ := g.URL(path)
+	dir := g.workTree
+	if dir == "" {
+		var err error
+		if dir, err = gitClone(g.gitURL, g.repoURL, g.ref); err != nil {
+			return nil, dataURL, errors.Annotatef(err, "cannot clone %q", g.gitURL)
+		}
+	}
+	// The path may not refer to files outside the tree.
+	relPath := filepath.Clean(filepath.FromSlash(path))
+	if filepath.IsAbs(relPath) || relPath == ".." || strings.HasPrefix(relPath, ".."+string(filepath.Separator)) {
+		return nil, dataURL, errors.NotFoundf("invalid path %q", path)
+	}
+	f, err := os.Open(filepath.Join(dir, relPath))
+	if os.IsNotExist(err) {
+		return nil, dataURL, errors.NotFoundf("cannot find URL %q", dataURL)
+	}
+	if err != nil {
+		return nil, dataURL, errors.Trace(err)
+	}
+	return f, dataURL, nil
+}
+
+// URL is defined in simplestreams.DataSource.
+func (g *gitDataSource) URL(path string) (string, error) {
+	if g.workTree != "" {
+		return filepath.Join(g.workTree, filepath.FromSlash(path)), nil
+	}
+	url := gitURLPrefix + urlJoin(g.repoURL, path)
+	if g.ref != "" {
+		url += "#" + g.ref
+	}
+	return url, nil
+}
+
+// PublicSigningKey is defined in simplestreams.DataSource.
+func (g *gitDataSource) PublicSigningKey() string {
+	return g.publicSigningKey
+}
+
+// SetAllowRetry is defined in simplestreams.DataSource.
+func (g *gitDataSource) SetAllowRetry(allow bool) {
+	// This is a NOOP for git datasources.
+}
+
+// Priority is defined in simplestreams.DataSource.
+func (g *gitDataSource) Priority() int {
+	return g.priority
+}
+
+// RequireSigned is defined in simplestreams.DataSource.
+func (g *gitDataSource) RequireSigned() bool {
+	return g.requireSigned
+}
+
+// gitClone returns the directory holding a shallow clone of the
+// repository at the ref, cloning it if it has not already been
+// cloned by this process. The clone is abandoned if it takes longer
+// than gitCloneTimeout. A failed clone is not remembered, so is tried
+// again by a later fetch.
+func gitClone(gitURL, repoURL, ref string) (string, error) {
+	gitClones.mu.Lock()
+	lock, ok := gitClones.locks[gitURL]
+	if !ok {
+		lock = new(sync.Mutex)
+		gitClones.locks[gitURL] = lock
+	}
+	gitClones.mu.Unlock()
+
+	lock.Lock()
+	defer lock.Unlock()
+	if dir, ok := cloneDir(gitURL); ok {
+		return dir, nil
+	}
+	dir, err := ioutil.TempDir("", "juju-simplestreams-git")
+	if err != nil {
+		return "", errors.Trace(err)
+	}
+	args := []string{"clone", "--quiet", "--depth", "1"}
+	if ref != "" {
+		args = append(args, "--branch", ref)
+	}
+	args = append(args, "--", repoURL, dir)
+	logger.Debugf("cloning simplestreams metadata from %q", gitURL)
+	ctx, cancel := context.WithTimeout(context.Background(), gitCloneTimeout)
+	defer cancel()
+	if out, err := exec.CommandContext(ctx, "git", args...).CombinedOutput(); err != nil {
+		os.RemoveAll(dir)
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", errors.Errorf("git clone timed out after %v", gitCloneTimeout)
+		}
+		return "", errors.Errorf("git clone failed: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	gitClones.mu.Lock()
+	gitClones.dirs[gitURL] = dir
+	gitClones.mu.Unlock()
+	return dir, nil
+}
+
+// cloneDir returns the directory holding the clone
+// of the repository at gitURL, if it has been cloned.
+func cloneDir(gitURL string) (string, bool) {
+	gitClones.mu.Lock()
+	defer gitClones.mu.Unlock()
+	dir, ok := gitClones.dirs[gitURL]
+	return dir, ok
+}
@@ -0,0 +1,142 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package simplestreams_test
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/juju/environs/simplestreams"
+)
+
+var _ = gc.Suite(&gitDataSourceSuite{})
+
+type gitDataSourceSuite struct {
+	workTree string
+	bareRepo string
+}
+
+const gitIndex = `{"format": "index:1.0"}`
+
+func (s *gitDataSourceSuite) SetUpTest(c *gc.C) {
+	if _, err := exec.LookPath("git"); err != nil {
+		c.Skip("git not installed")
+	}
+	dir := c.MkDir()
+	s.workTree = filepath.Join(dir, "work")
+	s.bareRepo = filepath.Join(dir, "metadata.git")
+	err := os.MkdirAll(filepath.Join(s.workTree, "streams", "v1"), 0755)
+	c.Assert(err, jc.ErrorIsNil)
+	err = ioutil.WriteFile(filepath.Join(s.workTree, "streams", "v1", "index.json"), []byte(gitIndex), 0644)
+	c.Assert(err, jc.ErrorIsNil)
+	s.git(c, s.workTree, "init", "--quiet")
+	s.git(c, s.workTree, "checkout", "--quiet", "-b", "release")
+	s.git(c, s.workTree, "add", ".")
+	s.git(c, s.workTree, "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "--quiet", "-m", "metadata")
+	s.git(c, dir, "clone", "--quiet", "--bare", s.workTree, s.bareRepo)
+}
+
+func (s *gitDataSourceSuite) TearDownTest(c *gc.C) {
+	simplestreams.ResetGitClones()
+}
+
+func (s *gitDataSourceSuite) git(c *gc.C, dir string, args ...string) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	c.Assert(err, jc.ErrorIsNil, gc.Commentf("git %v: %s", args, out))
+}
+
+func (s *gitDataSourceSuite) fetch(c *gc.C, ds simplestreams.DataSource, path string) string {
+	rc, _, err := ds.Fetch(path)
+	c.Assert(err, jc.ErrorIsNil)
+	defer rc.Close()
+	data, err := ioutil.ReadAll(rc)
+	c.Assert(err, jc.ErrorIsNil)
+	return string(data)
+}
+
+func (s *gitDataSourceSuite) TestFetch(c *gc.C) {
+	ds, err := simplestreams.NewGitDataSource("git", "git+file://"+s.bareRepo+"#release", "", simplestreams.CUSTOM_CLOUD_DATA, false)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(s.fetch(c, ds, "streams/v1/index.json"), gc.Equals, gitIndex)
+
+	url, err := ds.URL("streams/v1/index.json")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(url, gc.Equals, "git+file://"+s.bareRepo+"/streams/v1/index.json#release")
+}
+
+func (s *gitDataSourceSuite) TestFetchDefaultBranch(c *gc.C) {
+	ds, err := simplestreams.NewGitDataSource("git", "git+file://"+s.bareRepo, "", simplestreams.CUSTOM_CLOUD_DATA, false)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(s.fetch(c, ds, "streams/v1/index.json"), gc.Equals, gitIndex)
+}
+
+func (s *gitDataSourceSuite) TestFetchCachesClone(c *gc.C) {
+	gitURL := "git+file://" + s.bareRepo + "#release"
+	ds, err := simplestreams.NewGitDataSource("git", gitURL, "", simplestreams.CUSTOM_CLOUD_DATA, false)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(s.fetch(c, ds, "streams/v1/index.json"), gc.Equals, gitIndex)
+
+	// The repository is not cloned again, even by another data source.
+	err = os.RemoveAll(s.bareRepo)
+	c.Assert(err, jc.ErrorIsNil)
+	ds, err = simplestreams.NewGitDataSource("other", gitURL, "", simplestreams.CUSTOM_CLOUD_DATA, false)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(s.fetch(c, ds, "streams/v1/index.json"), gc.Equals, gitIndex)
+}
+
+func (s *gitDataSourceSuite) TestFetchNotFound(c *gc.C) {
+	ds, err := simplestreams.NewGitDataSource("git", "git+file://"+s.bareRepo+"#release", "", simplestreams.CUSTOM_CLOUD_DATA, false)
+	c.Assert(err, jc.ErrorIsNil)
+	_, _, err = ds.Fetch("streams/v1/missing.json")
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+	_, _, err = ds.Fetch("../metadata.git/HEAD")
+	c.Assert(err, jc.Satisfies, errors.IsNotFound)
+}
+
+func (s *gitDataSourceSuite) TestFetchCloneError(c *gc.C) {
+	ds, err := simplestreams.NewGitDataSource("git", "git+file://"+s.bareRepo+"#missing", "", simplestreams.CUSTOM_CLOUD_DATA, false)
+	c.Assert(err, jc.ErrorIsNil)
+	_, _, err = ds.Fetch("streams/v1/index.json")
+	c.Assert(err, gc.ErrorMatches, `cannot clone ".*#missing": git clone failed: .*`)
+}
+
+func (s *gitDataSourceSuite) TestFetchCloneTimeout(c *gc.C) {
+	restore := testing.PatchValue(simplestreams.GitCloneTimeout, time.Nanosecond)
+	defer restore()
+	ds, err := simplestreams.NewGitDataSource("git", "git+file://"+s.bareRepo+"#release", "", simplestreams.CUSTOM_CLOUD_DATA, false)
+	c.Assert(err, jc.ErrorIsNil)
+	_, _, err = ds.Fetch("streams/v1/index.json")
+	c.Assert(err, gc.ErrorMatches, `cannot clone ".*#release": git clone timed out after 1ns`)
+
+	// A timed out clone is tried again.
+	restore()
+	c.Assert(s.fetch(c, ds, "streams/v1/index.json"), gc.Equals, gitIndex)
+}
+
+func (s *gitDataSourceSuite) TestFetchWorkTree(c *gc.C) {
+	ds := simplestreams.NewGitWorkTreeDataSource("git", s.workTree, "", simplestreams.CUSTOM_CLOUD_DATA, false)
+	c.Assert(s.fetch(c, ds, "streams/v1/index.json"), gc.Equals, gitIndex)
+}
+
+func (s *gitDataSourceSuite) TestNewGitDataSourceInvalid(c *gc.C) {
+	_, err := simplestreams.NewGitDataSource("git", "https://example.com/metadata.git", "", simplestreams.CUSTOM_CLOUD_DATA, false)
+	c.Assert(err, gc.ErrorMatches, `Git URL "https://example.com/metadata.git" without "git\+" prefix not valid`)
+	c.Assert(err, jc.Satisfies, errors.IsNotValid)
+
+	_, err = simplestreams.NewGitDataSource("git", "git+#release", "", simplestreams.CUSTOM_CLOUD_DATA, false)
+	c.Assert(err, gc.ErrorMatches, `Git URL "git\+#release" without repository not valid`)
+
+	_, err = simplestreams.NewGitDataSource("git", "git+https://example.com/metadata.git#--upload-pack=x", "", simplestreams.CUSTOM_CLOUD_DATA, false)
+	c.Assert(err, gc.ErrorMatches, `Git ref "--upload-pack=x" not valid`)
+}
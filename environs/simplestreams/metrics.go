@@ -0,0 +1,72 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package simplestreams
+
+import (
+	"sync"
+)
+
+// MetricsSink receives counts of simplestreams metadata activity, so
+// that the health of the data sources can be monitored. An
+// *expvar.Map may be used as a MetricsSink.
+type MetricsSink interface {
+	// Add adds delta to the named counter.
+	Add(counter string, delta int64)
+}
+
+// The counters reported to the metrics sink.
+const (
+	// MetricFetches counts the metadata files fetched,
+	// or tried, from data sources.
+	MetricFetches = "fetches"
+
+	// MetricCacheHits counts the metadata found in a cache
+	// rather than being fetched or verified again.
+	MetricCacheHits = "cache-hits"
+
+	// MetricRetries counts the fetches retried by data sources.
+	MetricRetries = "retries"
+
+	// MetricBytesDownloaded counts the bytes of metadata fetched.
+	MetricBytesDownloaded = "bytes-downloaded"
+
+	// MetricParseErrors counts the metadata files which
+	// could not be parsed.
+	MetricParseErrors = "parse-errors"
+)
+
+// nopMetricsSink is a MetricsSink which discards the counts.
+type nopMetricsSink struct{}
+
+// Add is defined in MetricsSink.
+func (nopMetricsSink) Add(string, int64) {}
+
+var metrics = struct {
+	mu   sync.RWMutex
+	sink MetricsSink
+}{sink: nopMetricsSink{}}
+
+// SetMetricsSink sets the sink receiving the counts of metadata
+// activity in this process, returning the previous sink. By default,
+// and if sink is nil, the counts are discarded.
+func SetMetricsSink(sink MetricsSink) MetricsSink {
+	if sink == nil {
+		sink = nopMetricsSink{}
+	}
+	metrics.mu.Lock()
+	defer metrics.mu.Unlock()
+	previous := metrics.sink
+	metrics.sink = sink
+	return previous
+}
+
+// CountMetric adds delta to the named counter of the current metrics
+// sink. It allows data sources outside this package, and packages
+// caching metadata, to report their activity.
+func CountMetric(counter string, delta int64) {
+	metrics.mu.RLock()
+	sink := metrics.sink
+	metrics.mu.RUnlock()
+	sink.Add(counter, delta)
+}
@@ -0,0 +1,57 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package simplestreams
+
+import (
+	"sort"
+	"sync"
+)
+
+// ProductLimit limits the number of product files fetched from each
+// data source. It may be shared between searches, so as to limit the
+// total fetched from each source across all of them.
+type ProductLimit struct {
+	max int
+
+	mu      sync.Mutex
+	fetched map[string]int
+	capped  map[string]bool
+}
+
+// NewProductLimit returns a new ProductLimit allowing at most max
+// product files to be fetched from each data source. If max is not
+// positive, there is no limit.
+func NewProductLimit(max int) *ProductLimit {
+	return &ProductLimit{
+		max:     max,
+		fetched: make(map[string]int),
+		capped:  make(map[string]bool),
+	}
+}
+
+// take records a product file fetch from the described source,
+// returning false if the source's limit has already been reached.
+func (l *ProductLimit) take(source string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.max > 0 && l.fetched[source] >= l.max {
+		l.capped[source] = true
+		return false
+	}
+	l.fetched[source]++
+	return true
+}
+
+// Capped returns the sorted descriptions of the data sources
+// from which product files were not fetched because of the limit.
+func (l *ProductLimit) Capped() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var sources []string
+	for source := range l.capped {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	return sources
+}
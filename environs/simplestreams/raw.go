@@ -0,0 +1,142 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package simplestreams
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"github.com/juju/errors"
+)
+
+// FetchRaw returns the contents of the index at indexPath, and of each
+// products file of the specified data type referenced by it, exactly as
+// they were fetched, keyed by path. Sources are tried in turn, and the
+// files are fetched from the first source holding the index. Signed files
+// are verified if requireSigned is true, but are returned still signed.
+//
+// FetchRaw is intended for diagnosing problems with metadata, and does
+// not parse the products files.
+func FetchRaw(sources []DataSource, indexPath, dataType string, requireSigned bool) (map[string][]byte, error) {
+	for _, source := range sources {
+		raw, data, err := fetchRawData(source, indexPath, requireSigned)
+		if errors.IsNotFound(err) {
+			logger.Debugf("index %q not found in %s", indexPath, source.Description())
+			continue
+		}
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		var indices Indices
+		if err := json.Unmarshal(data, &indices); err != nil {
+			return nil, errors.Annotatef(err, "cannot unmarshal JSON index %q", indexPath)
+		}
+		files := map[string][]byte{indexPath: raw}
+		for _, metadata := range indices.Indexes {
+			if metadata.DataType != dataType {
+				continue
+			}
+			productsPath := metadata.ProductsFilePath
+			if _, ok := files[productsPath]; ok {
+				continue
+			}
+			raw, _, err := fetchRawData(source, productsPath, requireSigned)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			files[productsPath] = raw
+		}
+		return files, nil
+	}
+	return nil, errors.NotFoundf("index %q", indexPath)
+}
+
+// fetchRawData returns the data at path as fetched from source, along
+// with the data with any signature removed.
+func fetchRawData(source DataSource, path string, requireSigned bool) (raw, data []byte, err error) {
+	rc, dataURL, err := source.Fetch(path)
+	if err != nil {
+		return nil, nil, errors.NotFoundf("invalid URL %q", dataURL)
+	}
+	defer rc.Close()
+	raw, err = readLimited(rc, DefaultMaxMetadataBytes)
+	if err == nil && requireSigned {
+		data, err = DecodeCheckSignature(bytes.NewReader(raw), source.PublicSigningKey())
+	} else {
+		data = raw
+	}
+	if err != nil {
+		return nil, nil, errors.Annotatef(err, "cannot read data for source %q at URL %v", source.Description(), dataURL)
+	}
+	return raw, data, nil
+}
+
+// FetchRegions returns the endpoint of each region named in the index at
+// indexPath, or in the products files of the specified data type which it
+// references, keyed by region name. The products files are parsed using
+// valueTemplate as for ParseCloudMetadata. Sources are tried in turn, and
+// the regions are read from the first source holding the index.
+//
+// The endpoints listed in the index take precedence over those in the
+// products files. Where the products files alone give a region more than
+// one endpoint, which is returned is not defined.
+func FetchRegions(
+	sources []DataSource, indexPath, dataType string, valueTemplate interface{}, requireSigned bool,
+) (map[string]string, error) {
+	for _, source := range sources {
+		_, data, err := fetchRawData(source, indexPath, requireSigned)
+		if errors.IsNotFound(err) {
+			logger.Debugf("index %q not found in %s", indexPath, source.Description())
+			continue
+		}
+		if err != nil {
+			return nil, errors.Trace(err)
+		}
+		var indices Indices
+		if err := json.Unmarshal(data, &indices); err != nil {
+			return nil, errors.Annotatef(err, "cannot unmarshal JSON index %q", indexPath)
+		}
+		regions := make(map[string]string)
+		addRegion := func(region, endpoint string) {
+			if region != "" && regions[region] == "" {
+				regions[region] = endpoint
+			}
+		}
+		for _, metadata := range indices.Indexes {
+			if metadata.DataType != dataType {
+				continue
+			}
+			for _, cloud := range metadata.Clouds {
+				addRegion(cloud.Region, cloud.Endpoint)
+			}
+		}
+		parsed := make(map[string]bool)
+		for _, metadata := range indices.Indexes {
+			productsPath := metadata.ProductsFilePath
+			if metadata.DataType != dataType || parsed[productsPath] {
+				continue
+			}
+			parsed[productsPath] = true
+			_, data, err := fetchRawData(source, productsPath, requireSigned)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			cloudMetadata, err := ParseCloudMetadata(data, ProductFormat, productsPath, valueTemplate)
+			if err != nil {
+				return nil, errors.Trace(err)
+			}
+			// Parsing fills in the region and endpoint
+			// of each item from the levels above it.
+			for _, catalog := range cloudMetadata.Products {
+				for _, coll := range catalog.Items {
+					for _, item := range coll.Items {
+						addRegion(fieldByTag(item, "region"), fieldByTag(item, "endpoint"))
+					}
+				}
+			}
+		}
+		return regions, nil
+	}
+	return nil, errors.NotFoundf("index %q", indexPath)
+}
@@ -10,8 +10,10 @@
 package simplestreams
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path"
@@ -19,6 +21,7 @@ import (
 	"reflect"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/juju/errors"
 	"github.com/juju/loggo"
@@ -168,6 +171,10 @@ type IndexReference struct {
 	MirroredProductsPath string
 	Source               DataSource
 	valueParams          ValueParams
+	maxBytes             int64
+	limit                int
+	productLimit         *ProductLimit
+	sourceDescription    string
 }
 
 type IndexMetadata struct {
@@ -384,19 +391,82 @@ type GetMetadataParams struct {
 	StreamsVersion   string
 	LookupConstraint LookupConstraint
 	ValueParams      ValueParams
+
+	// VerifiedIndexCache, if non-nil, is used to avoid verifying
+	// the signature of a signed index which has not changed since
+	// it was last verified.
+	VerifiedIndexCache *VerifiedIndexCache
+
+	// MaxBytes limits the size of each index and product file
+	// fetched. If zero, DefaultMaxMetadataBytes is used.
+	MaxBytes int64
+
+	// Limit, if positive, causes the search for matching items to
+	// stop once that many have been found. Catalogs are searched
+	// newest version first, but the order in which products are
+	// searched is not defined, so which items are returned when
+	// there are more matches than the limit may vary.
+	Limit int
+
+	// IndexPath, if set, is the path of the index to use in each
+	// source, without the signed or unsigned suffix, eg
+	// "streams/v1/index". The legacy index path is not tried.
+	IndexPath string
+
+	// RequireSigned, if true, causes only signed metadata to be
+	// used, even from sources which allow unsigned metadata.
+	RequireSigned bool
+
+	// ProductLimit, if non-nil, limits the number of product files
+	// fetched from each source. Once a source's limit is reached,
+	// its metadata is treated as having no matching products.
+	ProductLimit *ProductLimit
+}
+
+// DefaultMaxMetadataBytes is the default limit on the size of
+// a simplestreams metadata file.
+const DefaultMaxMetadataBytes = 64 * 1024 * 1024
+
+// fetchParams holds optional parameters used when fetching data.
+type fetchParams struct {
+	// verifiedCache, if non-nil, is used to skip verifying
+	// unchanged signed data.
+	verifiedCache *VerifiedIndexCache
+
+	// maxBytes limits the size of the data fetched. If zero,
+	// DefaultMaxMetadataBytes is used.
+	maxBytes int64
+
+	// limit, if positive, is the number of matching items
+	// after which the search stops.
+	limit int
+
+	// productLimit, if non-nil, limits the number
+	// of product files fetched from each source.
+	productLimit *ProductLimit
 }
 
 // GetMetadata returns metadata records matching the specified constraint,looking in each source for signed metadata.
 // If onlySigned is false and no signed metadata is found in a source, the source is used to look for unsigned metadata.
 // Each source is tried in turn until at least one signed (or unsigned) match is found.
 func GetMetadata(sources []DataSource, params GetMetadataParams) (items []interface{}, resolveInfo *ResolveInfo, err error) {
+	items, resolveInfo, _, err = GetMetadataWithIndexTime(sources, params)
+	return items, resolveInfo, err
+}
+
+// GetMetadataWithIndexTime behaves like GetMetadata, additionally returning
+// the updated time recorded in the index the metadata was found from.
+// The time is zero if the index has no valid updated time.
+func GetMetadataWithIndexTime(sources []DataSource, params GetMetadataParams) (
+	items []interface{}, resolveInfo *ResolveInfo, indexUpdated time.Time, err error,
+) {
 	for _, source := range sources {
 		logger.Tracef("searching for signed metadata in datasource %q", source.Description())
-		items, resolveInfo, err = getMaybeSignedMetadata(source, params, true)
+		items, resolveInfo, indexUpdated, err = getMaybeSignedMetadata(source, params, true)
 		// If no items are found using signed metadata, check unsigned.
-		if err != nil && len(items) == 0 && !source.RequireSigned() {
+		if err != nil && len(items) == 0 && !source.RequireSigned() && !params.RequireSigned {
 			logger.Tracef("falling back to search for unsigned metadata in datasource %q", source.Description())
-			items, resolveInfo, err = getMaybeSignedMetadata(source, params, false)
+			items, resolveInfo, indexUpdated, err = getMaybeSignedMetadata(source, params, false)
 		}
 		if err == nil {
 			break
@@ -406,14 +476,64 @@ func GetMetadata(sources []DataSource, params GetMetadataParams) (items []interf
 		// no matching products is an internal error only
 		err = nil
 	}
-	return items, resolveInfo, err
+	return items, resolveInfo, indexUpdated, err
+}
+
+// GetSignedAndUnsignedMetadata returns the metadata records matching the
+// specified constraint in both the signed and the unsigned metadata of the
+// first source holding either, regardless of whether the source or params
+// require signed metadata. It is intended for reporting which metadata is
+// signed. Unlike GetMetadata, signed metadata which cannot be verified is
+// an error rather than a reason to fall back to unsigned metadata.
+// The resolve info returned is that of the signed metadata, if found.
+func GetSignedAndUnsignedMetadata(sources []DataSource, params GetMetadataParams) (
+	signed, unsigned []interface{}, resolveInfo *ResolveInfo, err error,
+) {
+	for _, source := range sources {
+		signedItems, signedInfo, foundSigned, err := getMetadataIfFound(source, params, true)
+		if err != nil {
+			return nil, nil, signedInfo, errors.Trace(err)
+		}
+		unsignedItems, unsignedInfo, foundUnsigned, err := getMetadataIfFound(source, params, false)
+		if err != nil {
+			return nil, nil, unsignedInfo, errors.Trace(err)
+		}
+		if foundSigned {
+			return signedItems, unsignedItems, signedInfo, nil
+		}
+		if foundUnsigned {
+			return nil, unsignedItems, unsignedInfo, nil
+		}
+	}
+	return nil, nil, nil, nil
+}
+
+// getMetadataIfFound behaves like getMaybeSignedMetadata, but also
+// returns whether the metadata exists in source. Missing metadata,
+// or metadata without matching products, is not an error.
+func getMetadataIfFound(source DataSource, params GetMetadataParams, signed bool) ([]interface{}, *ResolveInfo, bool, error) {
+	items, resolveInfo, _, err := getMaybeSignedMetadata(source, params, signed)
+	if _, ok := err.(*noMatchingProductsError); ok {
+		return nil, resolveInfo, true, nil
+	}
+	if errors.IsNotFound(err) || errors.IsUnauthorized(err) {
+		logger.Tracef("no metadata found at %q: %v", resolveInfo.IndexURL, err)
+		return nil, resolveInfo, false, nil
+	}
+	if err != nil {
+		return nil, resolveInfo, false, err
+	}
+	return items, resolveInfo, true, nil
 }
 
 // getMaybeSignedMetadata returns metadata records matching the specified constraint in params.
-func getMaybeSignedMetadata(source DataSource, params GetMetadataParams, signed bool) ([]interface{}, *ResolveInfo, error) {
+func getMaybeSignedMetadata(source DataSource, params GetMetadataParams, signed bool) ([]interface{}, *ResolveInfo, time.Time, error) {
 
 	makeIndexPath := func(basePath string) string {
-		pathNoSuffix := fmt.Sprintf(basePath, params.StreamsVersion)
+		pathNoSuffix := params.IndexPath
+		if pathNoSuffix == "" {
+			pathNoSuffix = fmt.Sprintf(basePath, params.StreamsVersion)
+		}
 		indexPath := pathNoSuffix + UnsignedSuffix
 		if signed {
 			indexPath = pathNoSuffix + SignedSuffix
@@ -429,18 +549,24 @@ func getMaybeSignedMetadata(source DataSource, params GetMetadataParams, signed
 	logger.Tracef("looking for data index using path %s", indexPath)
 	mirrorsPath := fmt.Sprintf(defaultMirrorsPath, params.StreamsVersion)
 	cons := params.LookupConstraint
+	fetch := fetchParams{
+		verifiedCache: params.VerifiedIndexCache,
+		maxBytes:      params.MaxBytes,
+		limit:         params.Limit,
+		productLimit:  params.ProductLimit,
+	}
 
 	indexRef, indexURL, err := fetchIndex(
-		source, indexPath, mirrorsPath, cons.Params().CloudSpec, signed, params.ValueParams,
+		source, indexPath, mirrorsPath, cons.Params().CloudSpec, signed, params.ValueParams, fetch,
 	)
 	logger.Tracef("looking for data index using URL %s", indexURL)
-	if errors.IsNotFound(err) || errors.IsUnauthorized(err) {
+	if params.IndexPath == "" && (errors.IsNotFound(err) || errors.IsUnauthorized(err)) {
 		legacyIndexPath := makeIndexPath(defaultLegacyIndexPath)
 		logger.Tracef("%s not accessed, actual error: %v", indexPath, err)
 		logger.Tracef("%s not accessed, trying legacy index path: %s", indexPath, legacyIndexPath)
 		indexPath = legacyIndexPath
 		indexRef, indexURL, err = fetchIndex(
-			source, indexPath, mirrorsPath, cons.Params().CloudSpec, signed, params.ValueParams,
+			source, indexPath, mirrorsPath, cons.Params().CloudSpec, signed, params.ValueParams, fetch,
 		)
 	}
 	resolveInfo.IndexURL = indexURL
@@ -448,14 +574,16 @@ func getMaybeSignedMetadata(source DataSource, params GetMetadataParams, signed
 		if errors.IsNotFound(err) || errors.IsUnauthorized(err) {
 			logger.Tracef("cannot load index %q: %v", indexURL, err)
 		}
-		return nil, resolveInfo, err
+		return nil, resolveInfo, time.Time{}, err
 	}
+	// A missing or unparseable updated time is treated as zero.
+	indexUpdated, _ := time.Parse(time.RFC1123Z, indexRef.Updated)
 	logger.Tracef("read metadata index at %q", indexURL)
 	items, err := indexRef.getLatestMetadataWithFormat(cons, ProductFormat, signed)
 	if err != nil {
 		if errors.IsNotFound(err) {
 			logger.Debugf("skipping index %q because of missing information: %v", indexURL, err)
-			return nil, resolveInfo, err
+			return nil, resolveInfo, indexUpdated, err
 		}
 		if _, ok := err.(*noMatchingProductsError); !ok {
 			logger.Debugf("%v", err)
@@ -464,20 +592,20 @@ func getMaybeSignedMetadata(source DataSource, params GetMetadataParams, signed
 	if indexRef.Source.Description() == "mirror" {
 		resolveInfo.MirrorURL = indexRef.Source.(*urlDataSource).baseURL
 	}
-	return items, resolveInfo, err
+	return items, resolveInfo, indexUpdated, err
 }
 
 // fetchIndex attempts to load the index file at indexPath in source.
 func fetchIndex(source DataSource, indexPath string, mirrorsPath string, cloudSpec CloudSpec,
-	signed bool, params ValueParams) (indexRef *IndexReference, indexURL string, _ error) {
+	signed bool, params ValueParams, fetch fetchParams) (indexRef *IndexReference, indexURL string, _ error) {
 	indexURL, err := source.URL(indexPath)
 	if err != nil {
 		// Some providers return an error if asked for the URL of a non-existent file.
 		// So the best we can do is use the relative path for the URL when logging messages.
 		indexURL = indexPath
 	}
-	indexRef, err = GetIndexWithFormat(
-		source, indexPath, IndexFormat, mirrorsPath, signed, cloudSpec, params,
+	indexRef, err = getIndexWithFormat(
+		source, indexPath, IndexFormat, mirrorsPath, signed, cloudSpec, params, fetch,
 	)
 	return indexRef, indexURL, err
 }
@@ -485,16 +613,34 @@ func fetchIndex(source DataSource, indexPath string, mirrorsPath string, cloudSp
 // fetchData gets all the data from the given source located at the specified path.
 // It returns the data found and the full URL used.
 func fetchData(source DataSource, path string, requireSigned bool) (data []byte, dataURL string, err error) {
+	return fetchDataWithParams(source, path, requireSigned, fetchParams{})
+}
+
+// fetchDataWithParams behaves like fetchData, limiting the size of the
+// data and using any verified data cache according to params.
+func fetchDataWithParams(source DataSource, path string, requireSigned bool, params fetchParams) (data []byte, dataURL string, err error) {
+	CountMetric(MetricFetches, 1)
 	rc, dataURL, err := source.Fetch(path)
 	if err != nil {
 		logger.Tracef("fetchData failed for %q: %v", dataURL, err)
+		if errors.IsUnauthorized(err) {
+			return nil, dataURL, err
+		}
 		return nil, dataURL, errors.NotFoundf("invalid URL %q", dataURL)
 	}
 	defer rc.Close()
-	if requireSigned {
-		data, err = DecodeCheckSignature(rc, source.PublicSigningKey())
-	} else {
-		data, err = ioutil.ReadAll(rc)
+	maxBytes := params.maxBytes
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxMetadataBytes
+	}
+	data, err = readLimited(rc, maxBytes)
+	CountMetric(MetricBytesDownloaded, int64(len(data)))
+	if err == nil && requireSigned {
+		if params.verifiedCache != nil {
+			data, err = params.verifiedCache.decode(source, dataURL, bytes.NewReader(data))
+		} else {
+			data, err = DecodeCheckSignature(bytes.NewReader(data), source.PublicSigningKey())
+		}
 	}
 	if err != nil {
 		return nil, dataURL, errors.Annotatef(err, "cannot read data for source %q at URL %v", source.Description(), dataURL)
@@ -502,12 +648,30 @@ func fetchData(source DataSource, path string, requireSigned bool) (data []byte,
 	return data, dataURL, nil
 }
 
+// readLimited reads all the data from r, returning an error
+// if there is more than maxBytes.
+func readLimited(r io.Reader, maxBytes int64) ([]byte, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(r, maxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > maxBytes {
+		return nil, errors.Errorf("metadata file exceeds limit of %d bytes", maxBytes)
+	}
+	return data, nil
+}
+
 // GetIndexWithFormat returns a simplestreams index of the specified format.
 // Exported for testing.
 func GetIndexWithFormat(source DataSource, indexPath, indexFormat, mirrorsPath string, requireSigned bool,
 	cloudSpec CloudSpec, params ValueParams) (*IndexReference, error) {
+	return getIndexWithFormat(source, indexPath, indexFormat, mirrorsPath, requireSigned, cloudSpec, params, fetchParams{})
+}
 
-	data, url, err := fetchData(source, indexPath, requireSigned)
+func getIndexWithFormat(source DataSource, indexPath, indexFormat, mirrorsPath string, requireSigned bool,
+	cloudSpec CloudSpec, params ValueParams, fetch fetchParams) (*IndexReference, error) {
+
+	data, url, err := fetchDataWithParams(source, indexPath, requireSigned, fetch)
 	if err != nil {
 		if errors.IsNotFound(err) || errors.IsUnauthorized(err) {
 			return nil, err
@@ -517,6 +681,7 @@ func GetIndexWithFormat(source DataSource, indexPath, indexFormat, mirrorsPath s
 	var indices Indices
 	err = json.Unmarshal(data, &indices)
 	if err != nil {
+		CountMetric(MetricParseErrors, 1)
 		logger.Errorf("bad JSON index data at URL %q: %v", url, string(data))
 		return nil, fmt.Errorf("cannot unmarshal JSON index metadata at URL %q: %v", url, err)
 	}
@@ -534,12 +699,19 @@ func GetIndexWithFormat(source DataSource, indexPath, indexFormat, mirrorsPath s
 		Source:      source,
 		Indices:     indices,
 		valueParams: params,
+		maxBytes:    fetch.maxBytes,
+		limit:       fetch.limit,
+
+		productLimit:      fetch.productLimit,
+		sourceDescription: source.Description(),
 	}
 
 	// Apply any mirror information to the source.
 	if params.MirrorContentId != "" {
-		mirrorInfo, err := getMirror(
-			source, mirrors, params.DataType, params.MirrorContentId, cloudSpec, requireSigned)
+		mirrorInfo, err := followMirrors(source, mirrors, mirrorsPath, cloudSpec, requireSigned, params)
+		if err == errMirrorRedirectLimit {
+			return nil, errors.Annotatef(err, "following mirrors of %q", params.MirrorContentId)
+		}
 		if err == nil {
 			logger.Debugf("using mirrored products path: %s", path.Join(mirrorInfo.MirrorURL, mirrorInfo.Path))
 			indexRef.Source = NewURLSignedDataSource("mirror", mirrorInfo.MirrorURL, source.PublicSigningKey(), utils.VerifySSLHostnames, source.Priority(), requireSigned)
@@ -570,11 +742,48 @@ func getMirrorRefs(source DataSource, baseMirrorsPath string, requireSigned bool
 	}
 	err = json.Unmarshal(data, &mirrors)
 	if err != nil {
+		CountMetric(MetricParseErrors, 1)
 		return mirrors, url, fmt.Errorf("cannot unmarshal JSON mirror metadata at URL %q: %v", url, err)
 	}
 	return mirrors, url, err
 }
 
+// maxMirrorRedirects is the maximum number of times a mirror may
+// redirect to a further mirror.
+const maxMirrorRedirects = 5
+
+var errMirrorRedirectLimit = errors.Errorf("mirror redirects exceed limit of %d", maxMirrorRedirects)
+
+// followMirrors returns the mirror info for the content and cloud
+// specified in params. If the mirror itself publishes mirrors of the
+// content, they are followed in turn, until a mirror refers to itself
+// or publishes no further mirror. errMirrorRedirectLimit is returned
+// if there are more than maxMirrorRedirects redirects.
+func followMirrors(source DataSource, mirrors MirrorRefs, mirrorsPath string, cloudSpec CloudSpec,
+	requireSigned bool, params ValueParams) (*MirrorInfo, error) {
+
+	mirrorInfo, err := getMirror(source, mirrors, params.DataType, params.MirrorContentId, cloudSpec, requireSigned)
+	if err != nil {
+		return nil, err
+	}
+	for redirects := 0; ; redirects++ {
+		mirrorSource := NewURLSignedDataSource("mirror", mirrorInfo.MirrorURL, source.PublicSigningKey(), utils.VerifySSLHostnames, source.Priority(), requireSigned)
+		mirrorRefs, _, err := getMirrorRefs(mirrorSource, mirrorsPath, requireSigned, params)
+		if err != nil {
+			return mirrorInfo, nil
+		}
+		next, err := getMirror(mirrorSource, mirrorRefs, params.DataType, params.MirrorContentId, cloudSpec, requireSigned)
+		if err != nil || (next.MirrorURL == mirrorInfo.MirrorURL && next.Path == mirrorInfo.Path) {
+			return mirrorInfo, nil
+		}
+		if redirects == maxMirrorRedirects {
+			return nil, errMirrorRedirectLimit
+		}
+		logger.Debugf("mirror %s redirects to %s", mirrorInfo.MirrorURL, next.MirrorURL)
+		mirrorInfo = next
+	}
+}
+
 // getMirror returns a mirror info struct matching the specified content and cloud.
 func getMirror(source DataSource, mirrors MirrorRefs, datatype, contentId string, cloudSpec CloudSpec,
 	requireSigned bool) (*MirrorInfo, error) {
@@ -723,6 +932,7 @@ func GetMirrorMetadataWithFormat(source DataSource, mirrorPath, format string,
 	var mirrors MirrorMetadata
 	err = json.Unmarshal(data, &mirrors)
 	if err != nil {
+		CountMetric(MetricParseErrors, 1)
 		return nil, fmt.Errorf("cannot unmarshal JSON mirror metadata at URL %q: %v", url, err)
 	}
 	if mirrors.Format != format {
@@ -952,7 +1162,12 @@ func (indexRef *IndexReference) GetCloudMetadataWithFormat(cons LookupConstraint
 		return nil, err
 	}
 	logger.Tracef("finding products at path %q", productFilesPath)
-	data, url, err := fetchData(indexRef.Source, productFilesPath, requireSigned)
+	if indexRef.productLimit != nil && !indexRef.productLimit.take(indexRef.sourceDescription) {
+		return nil, newNoMatchingProductsError(
+			"product file limit reached for source %q, not fetching %q", indexRef.sourceDescription, productFilesPath,
+		)
+	}
+	data, url, err := fetchDataWithParams(indexRef.Source, productFilesPath, requireSigned, fetchParams{maxBytes: indexRef.maxBytes})
 	if err != nil {
 		logger.Tracef("can't read product data: %v", err)
 		return nil, fmt.Errorf("cannot read product data, %v", err)
@@ -965,6 +1180,7 @@ func ParseCloudMetadata(data []byte, format, url string, valueTemplate interface
 	var metadata CloudMetadata
 	err := json.Unmarshal(data, &metadata)
 	if err != nil {
+		CountMetric(MetricParseErrors, 1)
 		return nil, fmt.Errorf("cannot unmarshal JSON metadata at URL %q: %v", url, err)
 	}
 	if metadata.Format != format {
@@ -974,6 +1190,7 @@ func ParseCloudMetadata(data []byte, format, url string, valueTemplate interface
 		err = metadata.construct(reflect.TypeOf(valueTemplate))
 	}
 	if err != nil {
+		CountMetric(MetricParseErrors, 1)
 		logger.Errorf("bad JSON product data at URL %q: %v", url, string(data))
 		return nil, fmt.Errorf("cannot unmarshal JSON metadata at URL %q: %v", url, err)
 	}
@@ -991,7 +1208,7 @@ func (indexRef *IndexReference) getLatestMetadataWithFormat(cons LookupConstrain
 		return nil, err
 	}
 	logger.Tracef("metadata: %v", metadata)
-	matches, err := GetLatestMetadata(metadata, cons, indexRef.Source, indexRef.valueParams.FilterFunc)
+	matches, err := getLatestMetadata(metadata, cons, indexRef.Source, indexRef.valueParams.FilterFunc, indexRef.limit)
 	if err != nil {
 		return nil, err
 	}
@@ -1003,6 +1220,15 @@ func (indexRef *IndexReference) getLatestMetadataWithFormat(cons LookupConstrain
 
 // GetLatestMetadata extracts and returns the metadata records matching the given criteria.
 func GetLatestMetadata(metadata *CloudMetadata, cons LookupConstraint, source DataSource, filterFunc AppendMatchingFunc) ([]interface{}, error) {
+	return getLatestMetadata(metadata, cons, source, filterFunc, 0)
+}
+
+// getLatestMetadata behaves like GetLatestMetadata, but if limit is
+// positive it stops searching once limit matching records have been
+// found, and returns no more than that many.
+func getLatestMetadata(
+	metadata *CloudMetadata, cons LookupConstraint, source DataSource, filterFunc AppendMatchingFunc, limit int,
+) ([]interface{}, error) {
 	prodIds, err := cons.ProductIds()
 	if err != nil {
 		return nil, err
@@ -1032,6 +1258,9 @@ func GetLatestMetadata(metadata *CloudMetadata, cons LookupConstraint, source Da
 			if err != nil {
 				return nil, errors.Trace(err)
 			}
+			if limit > 0 && len(matchingItems) >= limit {
+				return matchingItems[:limit], nil
+			}
 		}
 	}
 	return matchingItems, nil
@@ -0,0 +1,70 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package testing
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+
+	"github.com/juju/errors"
+)
+
+// MemoryDataSource is a simplestreams.DataSource serving metadata
+// held in memory, allowing fetch logic to be tested without a
+// server or round tripper.
+type MemoryDataSource struct {
+	// Files holds the content of each file, keyed
+	// by its path relative to the source.
+	Files map[string]string
+
+	description string
+}
+
+// NewMemoryDataSource returns a data source serving the specified
+// files, keyed by their path relative to the source.
+func NewMemoryDataSource(description string, files map[string]string) *MemoryDataSource {
+	return &MemoryDataSource{
+		Files:       files,
+		description: description,
+	}
+}
+
+// Description implements simplestreams.DataSource.
+func (s *MemoryDataSource) Description() string {
+	return s.description
+}
+
+// Fetch implements simplestreams.DataSource.
+func (s *MemoryDataSource) Fetch(path string) (io.ReadCloser, string, error) {
+	url, _ := s.URL(path)
+	content, ok := s.Files[path]
+	if !ok {
+		return nil, url, errors.NotFoundf("cannot find URL %q", url)
+	}
+	return ioutil.NopCloser(bytes.NewBufferString(content)), url, nil
+}
+
+// URL implements simplestreams.DataSource.
+func (s *MemoryDataSource) URL(path string) (string, error) {
+	return "memory://" + s.description + "/" + path, nil
+}
+
+// PublicSigningKey implements simplestreams.DataSource.
+func (s *MemoryDataSource) PublicSigningKey() string {
+	return ""
+}
+
+// SetAllowRetry implements simplestreams.DataSource.
+func (s *MemoryDataSource) SetAllowRetry(allow bool) {}
+
+// Priority implements simplestreams.DataSource.
+func (s *MemoryDataSource) Priority() int {
+	return 0
+}
+
+// RequireSigned implements simplestreams.DataSource.
+func (s *MemoryDataSource) RequireSigned() bool {
+	return false
+}
@@ -0,0 +1,90 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package simplestreams
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/juju/errors"
+	"github.com/juju/utils"
+)
+
+// NewHTTPTransport returns a new transport for fetching metadata from
+// URL data sources, which keeps connections alive so that they may be
+// reused by later fetches from the same host. It may be shared between
+// data sources with SetHTTPTransport.
+//
+// The transport uses HTTP/2 with servers supporting it.
+func NewHTTPTransport(hostnameVerification utils.SSLHostnameVerification) *http.Transport {
+	transport := &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   10,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+		// HTTP/2 is only attempted by default by transports
+		// without a custom dialer or TLS configuration.
+		ForceAttemptHTTP2: true,
+	}
+	if !hostnameVerification {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return transport
+}
+
+// sharedTransports holds the transports used by URL data sources
+// which have not been given one, so that all such data sources
+// reuse the same connections.
+var sharedTransports = struct {
+	mu         sync.Mutex
+	transports map[utils.SSLHostnameVerification]*http.Transport
+}{transports: make(map[utils.SSLHostnameVerification]*http.Transport)}
+
+// sharedTransport returns the transport shared by URL data sources
+// with the given hostname verification.
+func sharedTransport(hostnameVerification utils.SSLHostnameVerification) *http.Transport {
+	sharedTransports.mu.Lock()
+	defer sharedTransports.mu.Unlock()
+	transport, ok := sharedTransports.transports[hostnameVerification]
+	if !ok {
+		transport = NewHTTPTransport(hostnameVerification)
+		sharedTransports.transports[hostnameVerification] = transport
+	}
+	return transport
+}
+
+// SetHTTPTransport makes the URL data source use transport for its
+// fetches, in place of the transport shared by all URL data sources.
+// It returns a NotSupported error if source is not a URL data source.
+func SetHTTPTransport(source DataSource, transport http.RoundTripper) error {
+	h, ok := source.(*urlDataSource)
+	if !ok {
+		return errors.NotSupportedf("setting the HTTP transport of %q", source.Description())
+	}
+	h.transport = transport
+	return nil
+}
+
+// httpTransport returns the transport used by the data source
+// to fetch URLs with the given scheme.
+func (h *urlDataSource) httpTransport(scheme string) http.RoundTripper {
+	if scheme != "http" && scheme != "https" {
+		// Handlers for other schemes, such as file URLs,
+		// are registered with the default transport.
+		return http.DefaultTransport
+	}
+	if h.transport != nil {
+		return h.transport
+	}
+	return sharedTransport(h.hostnameVerification)
+}
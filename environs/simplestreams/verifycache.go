@@ -0,0 +1,71 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package simplestreams
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sync"
+)
+
+// VerifiedIndexCache records signed index data whose signature has
+// already been verified, so that fetching an unchanged index again
+// does not repeat the verification.
+//
+// Entries are keyed by data source and URL, and hold the entity tag
+// of the signed data that was verified. Data sources do not expose
+// HTTP headers, so the entity tag is a digest of the signed content;
+// any change to the content invalidates the entry.
+type VerifiedIndexCache struct {
+	mu      sync.Mutex
+	entries map[string]verifiedIndex
+	verify  func(r io.Reader, armoredPublicKey string) ([]byte, error)
+}
+
+type verifiedIndex struct {
+	etag string
+	data []byte
+}
+
+// NewVerifiedIndexCache returns a new, empty VerifiedIndexCache.
+func NewVerifiedIndexCache() *VerifiedIndexCache {
+	return &VerifiedIndexCache{
+		entries: make(map[string]verifiedIndex),
+		verify:  DecodeCheckSignature,
+	}
+}
+
+// decode returns the plain text of the signed data read from r, which
+// was fetched from the given URL in source. The signature is only
+// checked if the data differs from that last verified for the URL.
+func (c *VerifiedIndexCache) decode(source DataSource, url string, r io.Reader) ([]byte, error) {
+	signed, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	key := source.Description() + " " + url
+	etag := fmt.Sprintf("%x", sha256.Sum256(signed))
+
+	c.mu.Lock()
+	entry, ok := c.entries[key]
+	c.mu.Unlock()
+	if ok && entry.etag == etag {
+		CountMetric(MetricCacheHits, 1)
+		logger.Tracef("using previously verified index data at %q", url)
+		return entry.data, nil
+	}
+
+	data, err := c.verify(bytes.NewReader(signed), source.PublicSigningKey())
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err != nil {
+		delete(c.entries, key)
+		return nil, err
+	}
+	c.entries[key] = verifiedIndex{etag: etag, data: data}
+	return data, nil
+}
@@ -0,0 +1,74 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package simplestreams_test
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/juju/environs/simplestreams"
+	"github.com/juju/juju/environs/simplestreams/testing"
+)
+
+type verifiedIndexCacheSuite struct {
+	source     *testing.StubDataSource
+	readerData string
+	cache      *simplestreams.VerifiedIndexCache
+	verified   int
+}
+
+var _ = gc.Suite(&verifiedIndexCacheSuite{})
+
+func (s *verifiedIndexCacheSuite) SetUpTest(c *gc.C) {
+	s.readerData = signedData
+	s.verified = 0
+	s.source = testing.NewStubDataSource()
+	s.source.FetchFunc = func(path string) (io.ReadCloser, string, error) {
+		r := bytes.NewReader([]byte(s.readerData))
+		return ioutil.NopCloser(r), path, nil
+	}
+	s.source.PublicSigningKeyFunc = func() string {
+		return testSigningKey
+	}
+	s.cache = simplestreams.NewVerifiedIndexCache()
+	simplestreams.SetVerifiedIndexCacheVerifier(s.cache, func(r io.Reader, key string) ([]byte, error) {
+		s.verified++
+		return simplestreams.DecodeCheckSignature(r, key)
+	})
+}
+
+func (s *verifiedIndexCacheSuite) fetch(c *gc.C) []byte {
+	data, _, err := simplestreams.FetchVerifiedData(s.source, "streams/v1/index.sjson", true, s.cache)
+	c.Assert(err, jc.ErrorIsNil)
+	return data
+}
+
+func (s *verifiedIndexCacheSuite) TestUnchangedIndexNotReverified(c *gc.C) {
+	c.Assert(s.fetch(c), gc.DeepEquals, []byte(unsignedData[1:]))
+	c.Assert(s.fetch(c), gc.DeepEquals, []byte(unsignedData[1:]))
+	c.Assert(s.verified, gc.Equals, 1)
+}
+
+func (s *verifiedIndexCacheSuite) TestChangedIndexReverified(c *gc.C) {
+	s.fetch(c)
+	// The changed content no longer matches its signature, so
+	// verification must be attempted again and fail.
+	s.readerData = signPrefix + unsignedData + "line 3\n" + signSuffix
+	_, _, err := simplestreams.FetchVerifiedData(s.source, "streams/v1/index.sjson", true, s.cache)
+	c.Assert(err, gc.NotNil)
+	c.Assert(s.verified, gc.Equals, 2)
+}
+
+func (s *verifiedIndexCacheSuite) TestFailedVerificationNotCached(c *gc.C) {
+	s.readerData = unsignedData
+	for i := 0; i < 2; i++ {
+		_, _, err := simplestreams.FetchVerifiedData(s.source, "streams/v1/index.sjson", true, s.cache)
+		c.Assert(err, gc.ErrorMatches, ".*no PGP signature embedded in plain text data")
+	}
+	c.Assert(s.verified, gc.Equals, 2)
+}
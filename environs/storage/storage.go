@@ -42,13 +42,25 @@ func Get(stor StorageReader, name string) (io.ReadCloser, error) {
 //
 // TODO(katco): 2016-08-09: lp:1611427
 func GetWithRetry(stor StorageReader, name string, attempt utils.AttemptStrategy) (r io.ReadCloser, err error) {
+	r, _, err = getWithRetryCount(stor, name, attempt)
+	return r, err
+}
+
+// getWithRetryCount behaves like GetWithRetry,
+// additionally returning the number of retries.
+func getWithRetryCount(stor StorageReader, name string, attempt utils.AttemptStrategy) (r io.ReadCloser, retries int, err error) {
+	attempts := 0
 	for a := attempt.Start(); a.Next(); {
+		attempts++
 		r, err = stor.Get(name)
 		if err == nil || !stor.ShouldRetry(err) {
 			break
 		}
 	}
-	return r, err
+	if attempts > 1 {
+		retries = attempts - 1
+	}
+	return r, retries, err
 }
 
 // List lists the files matching prefix from stor using the stor's default consistency strategy.
@@ -125,7 +137,8 @@ func (s *storageSimpleStreamsDataSource) Fetch(path string) (io.ReadCloser, stri
 	if s.allowRetry {
 		attempt = s.storage.DefaultConsistencyStrategy()
 	}
-	rc, err := GetWithRetry(s.storage, relpath, attempt)
+	rc, retries, err := getWithRetryCount(s.storage, relpath, attempt)
+	simplestreams.CountMetric(simplestreams.MetricRetries, int64(retries))
 	if err != nil {
 		return nil, dataURL, err
 	}
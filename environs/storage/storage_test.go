@@ -8,8 +8,11 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"strings"
+	"sync"
 	stdtesting "testing"
 
+	"github.com/juju/errors"
 	jc "github.com/juju/testing/checkers"
 	"github.com/juju/utils"
 	gc "gopkg.in/check.v1"
@@ -108,6 +111,100 @@ func (s *datasourceSuite) TestURLWithBasePath(c *gc.C) {
 	c.Assert(url, gc.Equals, expectedURL)
 }
 
+// flakyStorage is a storage whose first get of each file fails
+// with an error which should be retried.
+type flakyStorage struct {
+	fakeStorage
+	files  map[string]string
+	failed map[string]bool
+}
+
+var errFlaky = errors.New("try again")
+
+func (s *flakyStorage) Get(name string) (io.ReadCloser, error) {
+	data, ok := s.files[name]
+	if !ok {
+		return nil, errors.NotFoundf("%q", name)
+	}
+	if !s.failed[name] {
+		s.failed[name] = true
+		return nil, errFlaky
+	}
+	return ioutil.NopCloser(strings.NewReader(data)), nil
+}
+
+func (s *flakyStorage) ShouldRetry(err error) bool {
+	return err == errFlaky
+}
+
+// recordingSink is a simplestreams.MetricsSink recording the counts.
+type recordingSink struct {
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+func (s *recordingSink) Add(counter string, delta int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts[counter] += delta
+}
+
+func (s *datasourceSuite) recordMetrics(c *gc.C) *recordingSink {
+	sink := &recordingSink{counts: make(map[string]int64)}
+	previous := simplestreams.SetMetricsSink(sink)
+	s.AddCleanup(func(*gc.C) { simplestreams.SetMetricsSink(previous) })
+	return sink
+}
+
+func (s *datasourceSuite) fetchIndex(c *gc.C, index string) error {
+	stor := &flakyStorage{
+		files:  map[string]string{"streams/v1/index.json": index},
+		failed: make(map[string]bool),
+	}
+	ds := storage.NewStorageSimpleStreamsDataSource("test datasource", stor, "", simplestreams.DEFAULT_CLOUD_DATA, false)
+	ds.SetAllowRetry(true)
+	_, err := simplestreams.GetIndexWithFormat(
+		ds, "streams/v1/index.json", simplestreams.IndexFormat, "streams/v1/mirrors", false,
+		simplestreams.CloudSpec{}, simplestreams.ValueParams{},
+	)
+	return err
+}
+
+func (s *datasourceSuite) TestFetchMetrics(c *gc.C) {
+	sink := s.recordMetrics(c)
+	index := `{"index": {}, "format": "index:1.0"}`
+	err := s.fetchIndex(c, index)
+	c.Assert(err, jc.ErrorIsNil)
+	// The index is fetched on the second attempt,
+	// and the mirrors are tried but not found.
+	c.Assert(sink.counts, jc.DeepEquals, map[string]int64{
+		simplestreams.MetricFetches:         2,
+		simplestreams.MetricRetries:         1,
+		simplestreams.MetricBytesDownloaded: int64(len(index)),
+	})
+}
+
+func (s *datasourceSuite) TestFetchMetricsParseError(c *gc.C) {
+	sink := s.recordMetrics(c)
+	err := s.fetchIndex(c, "{")
+	c.Assert(err, gc.ErrorMatches, "cannot unmarshal JSON index metadata .*")
+	c.Assert(sink.counts, jc.DeepEquals, map[string]int64{
+		simplestreams.MetricFetches:         1,
+		simplestreams.MetricRetries:         1,
+		simplestreams.MetricBytesDownloaded: 1,
+		simplestreams.MetricParseErrors:     1,
+	})
+}
+
+func (s *datasourceSuite) TestFetchMetricsDefaultSink(c *gc.C) {
+	// Counts are discarded once the sink is unset.
+	sink := s.recordMetrics(c)
+	simplestreams.SetMetricsSink(nil)
+	err := s.fetchIndex(c, `{"index": {}, "format": "index:1.0"}`)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(sink.counts, gc.HasLen, 0)
+}
+
 var _ = gc.Suite(&storageSuite{})
 
 type storageSuite struct{}
@@ -0,0 +1,52 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package jujuclient
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/juju/errors"
+	"gopkg.in/yaml.v2"
+
+	"github.com/juju/juju/juju/osenv"
+)
+
+// JujuSourceGroupsPath is the location where named groups of
+// offer sources (controllers) are expected to be found.
+func JujuSourceGroupsPath() string {
+	return osenv.JujuXDGDataHomePath("source-groups.yaml")
+}
+
+// ReadSourceGroupsFile loads all source groups defined in a given file.
+// If the file is not found, it is not an error.
+func ReadSourceGroupsFile(file string) (map[string][]string, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	groups, err := ParseSourceGroups(data)
+	if err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// ParseSourceGroups parses the given YAML bytes into a map of
+// group name to the controller names belonging to that group.
+func ParseSourceGroups(data []byte) (map[string][]string, error) {
+	var result sourceGroupsCollection
+	err := yaml.Unmarshal(data, &result)
+	if err != nil {
+		return nil, errors.Annotate(err, "cannot unmarshal source groups")
+	}
+	return result.SourceGroups, nil
+}
+
+type sourceGroupsCollection struct {
+	SourceGroups map[string][]string `yaml:"source-groups"`
+}
@@ -0,0 +1,53 @@
+// Copyright 2017 Canonical Ltd.
+// Licensed under the AGPLv3, see LICENCE file for details.
+
+package jujuclient_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/juju/jujuclient"
+	"github.com/juju/juju/testing"
+)
+
+type SourceGroupsFileSuite struct {
+	testing.FakeJujuXDGDataHomeSuite
+}
+
+var _ = gc.Suite(&SourceGroupsFileSuite{})
+
+const testSourceGroupsYAML = `
+source-groups:
+  prod:
+  - ctrl-east
+  - ctrl-west
+  staging:
+  - ctrl-staging
+`
+
+func (s *SourceGroupsFileSuite) TestReadNoFile(c *gc.C) {
+	groups, err := jujuclient.ReadSourceGroupsFile("nohere.yaml")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(groups, gc.IsNil)
+}
+
+func (s *SourceGroupsFileSuite) TestReadSourceGroupsFile(c *gc.C) {
+	path := filepath.Join(c.MkDir(), "source-groups.yaml")
+	err := ioutil.WriteFile(path, []byte(testSourceGroupsYAML), 0600)
+	c.Assert(err, jc.ErrorIsNil)
+	groups, err := jujuclient.ReadSourceGroupsFile(path)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(groups, jc.DeepEquals, map[string][]string{
+		"prod":    {"ctrl-east", "ctrl-west"},
+		"staging": {"ctrl-staging"},
+	})
+}
+
+func (s *SourceGroupsFileSuite) TestParseSourceGroupsInvalid(c *gc.C) {
+	_, err := jujuclient.ParseSourceGroups([]byte("source-groups: [}"))
+	c.Assert(err, gc.ErrorMatches, "cannot unmarshal source groups: .*")
+}
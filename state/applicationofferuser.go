@@ -5,9 +5,11 @@ package state
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/juju/errors"
 	"gopkg.in/juju/names.v2"
+	"gopkg.in/mgo.v2/bson"
 	"gopkg.in/mgo.v2/txn"
 
 	"github.com/juju/juju/permission"
@@ -26,6 +28,28 @@ func (st *State) GetOfferAccess(offer names.ApplicationOfferTag, user names.User
 	return perm.access(), nil
 }
 
+// GetOfferUsers gets the access permissions on an offer, keyed on user name.
+func (st *State) GetOfferUsers(offerName string) (map[string]permission.Access, error) {
+	offerUUID, err := applicationOfferUUID(st, offerName)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	permissions, closer := st.db().GetCollection(permissionsC)
+	defer closer()
+
+	var docs []permissionDoc
+	err = permissions.Find(bson.D{{"object-global-key", applicationOfferKey(offerUUID)}}).All(&docs)
+	if err != nil {
+		return nil, errors.Trace(err)
+	}
+	result := make(map[string]permission.Access)
+	for _, doc := range docs {
+		userName := strings.TrimPrefix(doc.SubjectGlobalKey, userGlobalKeyPrefix+"#")
+		result[userName] = stringToAccess(doc.Access)
+	}
+	return result, nil
+}
+
 // CreateOfferAccess creates a new access permission for a user on an offer.
 func (st *State) CreateOfferAccess(offer names.ApplicationOfferTag, user names.UserTag, access permission.Access) error {
 	if err := permission.ValidateOfferAccess(access); err != nil {
@@ -86,6 +86,17 @@ func (s *ApplicationOfferUserSuite) TestUpdateOfferAccess(c *gc.C) {
 	c.Assert(access, gc.Equals, permission.ReadAccess)
 }
 
+func (s *ApplicationOfferUserSuite) TestGetOfferUsers(c *gc.C) {
+	offerTag, _ := s.makeOffer(c, permission.ConsumeAccess)
+	users, err := s.State.GetOfferUsers(offerTag.Name)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Assert(users, jc.DeepEquals, map[string]permission.Access{
+		"test-admin":        permission.AdminAccess,
+		"everyone@external": permission.ReadAccess,
+		"validusername":     permission.ConsumeAccess,
+	})
+}
+
 func (s *ApplicationOfferUserSuite) TestCreateOfferAccessNoUserFails(c *gc.C) {
 	app := s.Factory.MakeApplication(c, nil)
 	offers := state.NewApplicationOffers(s.State)